@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"strconv"
+	"time"
 
 	"github.com/tanq16/expenseowl/internal/api"
 	"github.com/tanq16/expenseowl/internal/storage"
@@ -20,6 +23,10 @@ func runServer(port int) {
 	}
 	defer storage.Close()
 	handler := api.NewHandler(storage)
+	if retention := trashRetention(); retention > 0 {
+		go purgeExpiredTrash(storage, retention)
+	}
+	go materializeRecurring(storage)
 
 	// Version Handler
 	http.HandleFunc("/version", func(w http.ResponseWriter, r *http.Request) {
@@ -63,27 +70,88 @@ func runServer(port int) {
 	http.HandleFunc("/categories", handler.GetCategories)
 	http.HandleFunc("/categories/edit", handler.UpdateCategories)
 	http.HandleFunc("/categories/add", handler.AddCategory)
+	http.HandleFunc("/categories/update", handler.UpdateCategory)
+	http.HandleFunc("/categories/move", handler.MoveCategory)
+	http.HandleFunc("/categories/totals", handler.GetCategoryTotals)
 	http.HandleFunc("/categories/rename", handler.RenameCategory)
 	http.HandleFunc("/categories/delete", handler.DeleteCategory)
 	http.HandleFunc("/currency", handler.GetCurrency)
 	http.HandleFunc("/currency/edit", handler.UpdateCurrency)
+	http.HandleFunc("/currencies", handler.GetCurrencies)
+	http.HandleFunc("/currencies/edit", handler.UpdateCurrencies)
 	http.HandleFunc("/startdate", handler.GetStartDate)
 	http.HandleFunc("/startdate/edit", handler.UpdateStartDate)
-	// http.HandleFunc("/tags", handler.GetTags)
-	// http.HandleFunc("/tags/edit", handler.UpdateTags)
+	http.HandleFunc("/tags", handler.GetTags)
+	http.HandleFunc("/tags/add", handler.AddTag)
+	http.HandleFunc("/tags/rename", handler.RenameTag)
+	http.HandleFunc("/tags/merge", handler.MergeTags)
+	http.HandleFunc("/tags/delete", handler.DeleteTag)
 
 	// Expenses
 	http.HandleFunc("/expense", handler.AddExpense)                     // PUT for add
 	http.HandleFunc("/expenses", handler.GetExpenses)                   // GET all
 	http.HandleFunc("/expense/edit", handler.EditExpense)               // PUT for edit
 	http.HandleFunc("/expense/delete", handler.DeleteExpense)           // DELETE for single
-	http.HandleFunc("/expenses/delete", handler.DeleteMultipleExpenses) // DELETE for multiple
+	http.HandleFunc("/expenses/delete", handler.DeleteMultipleExpenses) // DELETE for multiple, moves to trash
+	http.HandleFunc("/expenses/trash", handler.GetTrash)                // GET trashed
+	http.HandleFunc("/expenses/restore", handler.RestoreExpenses)       // PUT {ids}
+	http.HandleFunc("/expenses/purge", handler.PurgeExpenses)           // DELETE {ids} or {all}
+	http.HandleFunc("/expense/history", handler.GetExpenseHistory)      // GET ?id=
+	http.HandleFunc("/expense/get", handler.GetExpense)                 // GET ?id=, with ETag
 
 	// Recurring Expenses
-	http.HandleFunc("/recurring-expense", handler.AddRecurringExpense)           // PUT for add
-	http.HandleFunc("/recurring-expenses", handler.GetRecurringExpenses)         // GET all
-	http.HandleFunc("/recurring-expense/edit", handler.UpdateRecurringExpense)   // PUT for edit
-	http.HandleFunc("/recurring-expense/delete", handler.DeleteRecurringExpense) // DELETE
+	http.HandleFunc("/recurring-expense", handler.AddRecurringExpense)                    // PUT for add
+	http.HandleFunc("/recurring-expenses", handler.GetRecurringExpenses)                  // GET all
+	http.HandleFunc("/recurring-expense/edit", handler.UpdateRecurringExpense)            // PUT for edit
+	http.HandleFunc("/recurring-expense/delete", handler.DeleteRecurringExpense)          // DELETE
+	http.HandleFunc("/recurring-expense/get", handler.GetRecurringExpense)                // GET ?id=, with ETag
+	http.HandleFunc("/recurring-expense/occurrence", handler.OverrideRecurringOccurrence) // PUT ?id=, skip or edit one occurrence
+	http.HandleFunc("/forecast", handler.GetForecast)                                     // GET ?from=&to=, with projected occurrences
+
+	// Exchange Rates and Summaries in the base currency
+	http.HandleFunc("/exchange-rates", handler.GetExchangeRates)              // GET all
+	http.HandleFunc("/exchange-rates/edit", handler.SaveExchangeRates)        // PUT [rates], upserts
+	http.HandleFunc("/exchange-rates/delete", handler.DeleteExchangeRate)     // DELETE {date, currency, quote}
+	http.HandleFunc("/exchange-rates/import", handler.ImportExchangeRatesCSV) // POST CSV file
+	http.HandleFunc("/summary", handler.GetSummary)                           // GET, same filters as /expenses
+	http.HandleFunc("/summary/monthly", handler.GetMonthlySummary)            // GET, same filters as /expenses
+
+	// Currency exchanges: legs left out of every summary
+	http.HandleFunc("/currency-exchanges", handler.GetCurrencyExchanges)         // GET all
+	http.HandleFunc("/currency-exchange", handler.AddCurrencyExchange)           // PUT for add
+	http.HandleFunc("/currency-exchange/delete", handler.DeleteCurrencyExchange) // DELETE ?id=, with both legs
+
+	// Accounts
+	http.HandleFunc("/accounts", handler.GetAccounts)                      // GET all, with balances
+	http.HandleFunc("/account", handler.AddAccount)                        // PUT for add
+	http.HandleFunc("/account/edit", handler.EditAccount)                  // PUT ?id=
+	http.HandleFunc("/account/delete", handler.DeleteAccount)              // DELETE ?id=, only when unused
+	http.HandleFunc("/account/ledger", handler.GetAccountLedger)           // GET ?id=, with running balance
+	http.HandleFunc("/account/statements", handler.GetAccountStatements)   // GET ?id=, credit cards only
+	http.HandleFunc("/account/statement/pay", handler.PayAccountStatement) // PUT ?id= {closing, fromAccountId}
+	http.HandleFunc("/cashflow", handler.GetCashflow)                      // GET, card purchases on their due date
+
+	// Installment purchases (cuotas) on credit cards
+	http.HandleFunc("/installments", handler.GetInstallmentPurchases)         // GET all, with pending installments
+	http.HandleFunc("/installment", handler.AddInstallmentPurchase)           // PUT for add, with its installments
+	http.HandleFunc("/installment/payoff", handler.PayOffInstallmentPurchase) // PUT ?id= {date}, charges what is left
+	http.HandleFunc("/installment/delete", handler.DeleteInstallmentPurchase) // DELETE ?id=, with its installments
+
+	// Inflation: monthly CPI series and reports in real terms
+	http.HandleFunc("/cpi", handler.GetCPIIndexes)          // GET all
+	http.HandleFunc("/cpi/edit", handler.SaveCPIIndexes)    // PUT [indexes], upserts
+	http.HandleFunc("/cpi/delete", handler.DeleteCPIIndex)  // DELETE {currency, month}
+	http.HandleFunc("/cpi/import", handler.ImportCPICSV)    // POST CSV file
+	http.HandleFunc("/reports/real", handler.GetRealReport) // GET ?reference=&period=, same filters as /expenses
+
+	// Holidays (feriados) that recurring rules move their occurrences off
+	http.HandleFunc("/holidays", handler.GetHolidays)              // GET all
+	http.HandleFunc("/holidays/edit", handler.SaveHolidays)        // PUT [holidays], upserts
+	http.HandleFunc("/holidays/delete", handler.DeleteHoliday)     // DELETE {date}
+	http.HandleFunc("/holidays/import", handler.ImportHolidaysCSV) // POST CSV file
+
+	// Audit
+	http.HandleFunc("/audit", handler.GetAuditLog) // GET ?entity=&id=&limit=&cursor=
 
 	// Import/Export
 	http.HandleFunc("/export/csv", handler.ExportCSV)
@@ -96,8 +164,103 @@ func runServer(port int) {
 	}
 }
 
+// trashRetention reads TRASH_RETENTION_DAYS (default 30); 0 keeps trashed
+// expenses until they are purged by hand
+func trashRetention() time.Duration {
+	days := 30
+	if env := os.Getenv("TRASH_RETENTION_DAYS"); env != "" {
+		parsed, err := strconv.Atoi(env)
+		if err != nil || parsed < 0 {
+			log.Fatalf("Invalid TRASH_RETENTION_DAYS: %q", env)
+		}
+		days = parsed
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// purgeExpiredTrash deletes expenses trashed longer than retention ago, at
+// startup and then once a day
+func purgeExpiredTrash(store storage.Storage, retention time.Duration) {
+	for {
+		if purged, err := store.PurgeTrash(time.Now().Add(-retention)); err != nil {
+			log.Printf("Failed to purge trash: %v", err)
+		} else if purged > 0 {
+			log.Printf("Purged %d expenses from the trash", purged)
+		}
+		time.Sleep(24 * time.Hour)
+	}
+}
+
+// materializeRecurring writes the occurrences of recurring rules as the
+// horizon rolls forward, at startup and then once a day
+func materializeRecurring(store storage.Storage) {
+	for {
+		if written, err := store.MaterializeRecurring(storage.RecurringHorizon(time.Now())); err != nil {
+			log.Printf("Failed to materialize recurring expenses: %v", err)
+		} else if written > 0 {
+			log.Printf("Materialized %d recurring expense instances", written)
+		}
+		time.Sleep(24 * time.Hour)
+	}
+}
+
+// runMigrate handles `expenseowl migrate up|down [steps]|status`; its error
+// comes back once the migrator is closed, so main exits after the Close
+func runMigrate(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: expenseowl migrate up|down [steps]|status")
+	}
+	migrator, err := storage.InitializeMigrator()
+	if err != nil {
+		return fmt.Errorf("failed to initialize storage: %v", err)
+	}
+	defer migrator.Close()
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up()
+		if err != nil {
+			return fmt.Errorf("migration failed: %v", err)
+		}
+		fmt.Printf("Applied %d migration(s)\n", len(applied))
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of steps: %s", args[1])
+			}
+		}
+		reverted, err := migrator.Down(steps)
+		if err != nil {
+			return fmt.Errorf("rollback failed: %v", err)
+		}
+		fmt.Printf("Rolled back %d migration(s)\n", len(reverted))
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			return fmt.Errorf("failed to read migration status: %v", err)
+		}
+		for _, st := range statuses {
+			state := "pending"
+			if st.Applied {
+				state = "applied " + st.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d  %-32s %s\n", st.Version, st.Name, state)
+		}
+	default:
+		return fmt.Errorf("unknown migrate command %q (use up, down or status)", args[0])
+	}
+	return nil
+}
+
 func main() {
 	port := flag.Int("port", 8080, "Port to serve from")
 	flag.Parse()
+	if flag.Arg(0) == "migrate" {
+		if err := runMigrate(flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 	runServer(*port)
 }
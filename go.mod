@@ -5,3 +5,5 @@ go 1.23.2
 require github.com/google/uuid v1.6.0
 
 require github.com/lib/pq v1.10.9
+
+require github.com/mattn/go-sqlite3 v1.14.22
@@ -0,0 +1,269 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+// ------------------------------------------------------------
+// Account Handlers
+// ------------------------------------------------------------
+
+// LedgerEntry is one movement of an account with the balance right after it
+type LedgerEntry struct {
+	storage.Expense
+	Balance storage.Money `json:"balance"`
+}
+
+type AccountLedgerResponse struct {
+	Account storage.AccountBalance `json:"account"`
+	Entries []LedgerEntry          `json:"entries"` // newest first
+}
+
+// GetAccounts lists the accounts with their current balances
+func (h *Handler) GetAccounts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	h.writeAccounts(w)
+}
+
+func (h *Handler) AddAccount(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	var account storage.Account
+	if err := json.NewDecoder(r.Body).Decode(&account); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	account.ID = ""
+	if !h.validateAccount(w, &account) {
+		return
+	}
+	if err := h.storage.AddAccount(account); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to save account"})
+		log.Printf("API ERROR: Failed to save account: %v\n", err)
+		return
+	}
+	h.writeAccounts(w)
+}
+
+// EditAccount replaces an account; expenses follow its new name and type
+func (h *Handler) EditAccount(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "ID parameter is required"})
+		return
+	}
+	var account storage.Account
+	if err := json.NewDecoder(r.Body).Decode(&account); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	current, err := h.storage.GetAccount(id)
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: "Account not found"})
+		return
+	}
+	account.ID = id
+	if !h.validateAccount(w, &account) {
+		return
+	}
+	if account.Currency != current.Currency {
+		used, ok := h.accountInUse(w, id)
+		if !ok {
+			return
+		}
+		if used {
+			writeJSON(w, http.StatusConflict, ErrorResponse{Error: "Account is in use; its currency cannot change"})
+			return
+		}
+	}
+	if err := h.storage.UpdateAccount(id, account); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to edit account"})
+		log.Printf("API ERROR: Failed to edit account: %v\n", err)
+		return
+	}
+	h.writeAccounts(w)
+}
+
+func (h *Handler) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "ID parameter is required"})
+		return
+	}
+	if _, err := h.storage.GetAccount(id); err != nil {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: "Account not found"})
+		return
+	}
+	used, ok := h.accountInUse(w, id)
+	if !ok {
+		return
+	}
+	if used {
+		writeJSON(w, http.StatusConflict, ErrorResponse{Error: "Account is in use; archive it instead"})
+		return
+	}
+	if err := h.storage.DeleteAccount(id); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete account"})
+		log.Printf("API ERROR: Failed to delete account: %v\n", err)
+		return
+	}
+	h.writeAccounts(w)
+}
+
+// GetAccountLedger lists the live expenses of an account, transfers on either
+// side included, with the running balance after each one
+func (h *Handler) GetAccountLedger(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "ID parameter is required"})
+		return
+	}
+	balances, err := h.storage.GetAccountBalances()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get accounts"})
+		log.Printf("API ERROR: Failed to get account balances: %v\n", err)
+		return
+	}
+	i := slices.IndexFunc(balances, func(b storage.AccountBalance) bool { return b.ID == id })
+	if i < 0 {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: "Account not found"})
+		return
+	}
+	expenses, err := h.storage.QueryExpenses(storage.ExpenseFilter{Account: id})
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve expenses"})
+		log.Printf("API ERROR: Failed to retrieve expenses of account %s: %v\n", id, err)
+		return
+	}
+	// expenses come newest first; the balance builds up from the oldest
+	entries := make([]LedgerEntry, len(expenses))
+	balance := balances[i].OpeningBalance
+	for j := len(expenses) - 1; j >= 0; j-- {
+		if balance, err = balance.Add(expenses[j].AccountAmount(id)); err != nil {
+			writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to compute balance"})
+			log.Printf("API ERROR: Failed to compute balance of account %s: %v\n", id, err)
+			return
+		}
+		entries[j] = LedgerEntry{Expense: expenses[j], Balance: balance}
+	}
+	writeJSON(w, http.StatusOK, AccountLedgerResponse{Account: balances[i], Entries: entries})
+}
+
+// validateAccount writes a 400 for an invalid account or one in a disabled
+// currency, and a 409 when its name is taken in the currency
+func (h *Handler) validateAccount(w http.ResponseWriter, account *storage.Account) bool {
+	if err := account.Validate(); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return false
+	}
+	if !h.requireEnabledCurrency(w, account.Currency) {
+		return false
+	}
+	accounts, err := h.storage.GetAccounts()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get accounts"})
+		log.Printf("API ERROR: Failed to get accounts: %v\n", err)
+		return false
+	}
+	if slices.ContainsFunc(accounts, func(a storage.Account) bool {
+		return a.ID != account.ID && a.Currency == account.Currency && strings.EqualFold(a.Name, account.Name)
+	}) {
+		writeJSON(w, http.StatusConflict, ErrorResponse{Error: fmt.Sprintf("Account '%s' already exists in %s", account.Name, account.Currency)})
+		return false
+	}
+	return true
+}
+
+// accountInUse reports whether any expense, trashed ones and transfers into
+// it included, or recurring rule is kept in the account; a failed lookup is
+// written as a 500
+func (h *Handler) accountInUse(w http.ResponseWriter, id string) (bool, bool) {
+	page, err := h.storage.QueryExpensesPage(storage.ExpenseFilter{Account: id}, nil, 1)
+	if err == nil && len(page.Expenses) > 0 {
+		return true, true
+	}
+	var trash []storage.TrashedExpense
+	if err == nil {
+		trash, err = h.storage.GetTrash()
+	}
+	var rules []storage.RecurringExpense
+	if err == nil {
+		rules, err = h.storage.GetRecurringExpenses()
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to check account usage"})
+		log.Printf("API ERROR: Failed to check usage of account %s: %v\n", id, err)
+		return false, false
+	}
+	if slices.ContainsFunc(rules, func(re storage.RecurringExpense) bool { return re.AccountID == id }) {
+		return true, true
+	}
+	return slices.ContainsFunc(trash, func(e storage.TrashedExpense) bool { return e.AccountID == id || e.ToAccountID == id }), true
+}
+
+// requireExpenseAccount writes a 400 unless the accounts of an expense exist,
+// hold its currency and are active; current is the stored expense, whose
+// accounts may stay even once archived
+func (h *Handler) requireExpenseAccount(w http.ResponseWriter, expense storage.Expense, current storage.Expense) bool {
+	if !h.requireAccount(w, expense, expense.AccountID, current.AccountID) {
+		return false
+	}
+	return expense.Type != storage.TransactionTypeTransfer || h.requireAccount(w, expense, expense.ToAccountID, current.ToAccountID)
+}
+
+func (h *Handler) requireAccount(w http.ResponseWriter, expense storage.Expense, id, current string) bool {
+	if id == "" {
+		return true
+	}
+	account, err := h.storage.GetAccount(id)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Account not found"})
+		return false
+	}
+	if account.Currency != expense.Currency {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("Account '%s' holds %s, not %s", account.Name, account.Currency, expense.Currency)})
+		return false
+	}
+	if account.Archived && account.ID != current {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("Account '%s' is archived", account.Name)})
+		return false
+	}
+	return true
+}
+
+func (h *Handler) writeAccounts(w http.ResponseWriter) {
+	balances, err := h.storage.GetAccountBalances()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get accounts"})
+		log.Printf("API ERROR: Failed to get account balances: %v\n", err)
+		return
+	}
+	if balances == nil {
+		balances = []storage.AccountBalance{}
+	}
+	writeJSON(w, http.StatusOK, balances)
+}
@@ -0,0 +1,187 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+func TestAccountHandlers(t *testing.T) {
+	h := newTestHandler(t)
+	date := time.Date(2024, 3, 5, 12, 0, 0, 0, time.UTC)
+
+	expectStatus(t, serve(t, h.AddAccount, http.MethodPut, "/account", storage.Account{Name: "Banco", Type: "savings", Currency: "ars"}), http.StatusBadRequest)
+	expectStatus(t, serve(t, h.AddAccount, http.MethodPut, "/account", storage.Account{Name: "Banco", Type: storage.AccountTypeBank, Currency: "clp"}), http.StatusBadRequest)
+	rec := serve(t, h.AddAccount, http.MethodPut, "/account", storage.Account{Name: "Banco", Type: storage.AccountTypeBank, Currency: "ars", OpeningBalance: money("1000")})
+	expectStatus(t, rec, http.StatusOK)
+	accounts := decodeBody[[]storage.AccountBalance](t, rec)
+	if len(accounts) != 1 || accounts[0].Balance.String() != "1000.00" {
+		t.Fatalf("unexpected accounts: %+v", accounts)
+	}
+	bank := accounts[0].Account
+	expectStatus(t, serve(t, h.AddAccount, http.MethodPut, "/account", storage.Account{Name: "BANCO", Type: storage.AccountTypeCash, Currency: "ars"}), http.StatusConflict)
+
+	expectStatus(t, serve(t, h.AddExpense, http.MethodPut, "/expense", storage.Expense{
+		Name: "Taxi", Category: "Travel", Amount: money("-5"), Currency: "usd", Date: date, AccountID: bank.ID,
+	}), http.StatusBadRequest)
+	expectStatus(t, serve(t, h.AddExpense, http.MethodPut, "/expense", storage.Expense{
+		Name: "Taxi", Category: "Travel", Amount: money("-5"), Currency: "ars", Date: date, AccountID: "missing",
+	}), http.StatusBadRequest)
+	for i, amount := range []string{"-100", "-50.50", "250"} {
+		expectStatus(t, serve(t, h.AddExpense, http.MethodPut, "/expense", storage.Expense{
+			Name: "Movement", Category: "Food", Amount: money(amount), Currency: "ars", Date: date.AddDate(0, 0, i), AccountID: bank.ID,
+		}), http.StatusOK)
+	}
+	// a legacy write creates the account its card stands for
+	expectStatus(t, serve(t, h.AddExpense, http.MethodPut, "/expense", storage.Expense{
+		Name: "Lunch", Category: "Food", Amount: money("-20"), Currency: "ars", Date: date, Source: "TARJETA", Card: "Visa",
+	}), http.StatusOK)
+
+	accounts = decodeBody[[]storage.AccountBalance](t, serve(t, h.GetAccounts, http.MethodGet, "/accounts", nil))
+	if len(accounts) != 2 || accounts[0].ID != bank.ID || accounts[0].Balance.String() != "1099.50" || accounts[1].Name != "Visa" || accounts[1].Balance.String() != "-20.00" {
+		t.Fatalf("unexpected balances: %+v", accounts)
+	}
+	if onCard := decodeBody[[]storage.Expense](t, serve(t, h.GetExpenses, http.MethodGet, "/expenses?account="+accounts[1].ID, nil)); len(onCard) != 1 || onCard[0].Name != "Lunch" {
+		t.Fatalf("unexpected expenses on the card: %+v", onCard)
+	}
+
+	expectStatus(t, serve(t, h.GetAccountLedger, http.MethodGet, "/account/ledger?id=missing", nil), http.StatusNotFound)
+	ledger := decodeBody[AccountLedgerResponse](t, serve(t, h.GetAccountLedger, http.MethodGet, "/account/ledger?id="+bank.ID, nil))
+	var running []string
+	for _, entry := range ledger.Entries {
+		running = append(running, entry.Balance.String())
+	}
+	if len(running) != 3 || running[0] != "1099.50" || running[1] != "849.50" || running[2] != "900.00" {
+		t.Fatalf("unexpected running balances: %v", running)
+	}
+
+	// the currency of an account in use stays, and it is archived rather than deleted
+	bank.Currency = "usd"
+	expectStatus(t, serve(t, h.EditAccount, http.MethodPut, "/account/edit?id="+bank.ID, bank), http.StatusConflict)
+	expectStatus(t, serve(t, h.DeleteAccount, http.MethodDelete, "/account/delete?id="+bank.ID, nil), http.StatusConflict)
+	bank.Currency, bank.Archived = "ars", true
+	expectStatus(t, serve(t, h.EditAccount, http.MethodPut, "/account/edit?id="+bank.ID, bank), http.StatusOK)
+	expectStatus(t, serve(t, h.AddExpense, http.MethodPut, "/expense", storage.Expense{
+		Name: "Bus", Category: "Travel", Amount: money("-1"), Currency: "ars", Date: date, AccountID: bank.ID,
+	}), http.StatusBadRequest)
+	expectStatus(t, serve(t, h.EditAccount, http.MethodPut, "/account/edit?id=missing", bank), http.StatusNotFound)
+
+	rec = serve(t, h.AddAccount, http.MethodPut, "/account", storage.Account{Name: "Billetera", Type: storage.AccountTypeCash, Currency: "usd"})
+	expectStatus(t, rec, http.StatusOK)
+	for _, a := range decodeBody[[]storage.AccountBalance](t, rec) {
+		if a.Name == "Billetera" {
+			expectStatus(t, serve(t, h.DeleteAccount, http.MethodDelete, "/account/delete?id="+a.ID, nil), http.StatusOK)
+		}
+	}
+	if accounts := decodeBody[[]storage.AccountBalance](t, serve(t, h.GetAccounts, http.MethodGet, "/accounts", nil)); len(accounts) != 2 {
+		t.Fatalf("expected the unused account gone, got %+v", accounts)
+	}
+}
+
+func TestTransferHandlers(t *testing.T) {
+	h := newTestHandler(t)
+	date := time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+	var ids []string
+	for _, a := range []storage.Account{
+		{Name: "Banco", Type: storage.AccountTypeBank, Currency: "ars", OpeningBalance: money("1000")},
+		{Name: "Efectivo", Type: storage.AccountTypeCash, Currency: "ars"},
+		{Name: "Dolares", Type: storage.AccountTypeCash, Currency: "usd"},
+	} {
+		rec := serve(t, h.AddAccount, http.MethodPut, "/account", a)
+		expectStatus(t, rec, http.StatusOK)
+		for _, b := range decodeBody[[]storage.AccountBalance](t, rec) {
+			if b.Name == a.Name {
+				ids = append(ids, b.ID)
+			}
+		}
+	}
+	bank, cash, dollars := ids[0], ids[1], ids[2]
+
+	transfer := storage.Expense{Name: "Retiro", Type: storage.TransactionTypeTransfer, Amount: money("200"), Currency: "ars", Date: date, AccountID: bank}
+	expectStatus(t, serve(t, h.AddExpense, http.MethodPut, "/expense", transfer), http.StatusBadRequest)
+	transfer.ToAccountID = dollars
+	expectStatus(t, serve(t, h.AddExpense, http.MethodPut, "/expense", transfer), http.StatusBadRequest)
+	expectStatus(t, serve(t, h.AddExpense, http.MethodPut, "/expense", storage.Expense{
+		Name: "Reintegro", Type: storage.TransactionTypeExpense, Category: "Food", Amount: money("10"), Currency: "ars", Date: date,
+	}), http.StatusBadRequest)
+	transfer.ToAccountID = cash
+	expectStatus(t, serve(t, h.AddExpense, http.MethodPut, "/expense", transfer), http.StatusOK)
+	expectStatus(t, serve(t, h.AddExpense, http.MethodPut, "/expense", storage.Expense{
+		Name: "Kiosco", Category: "Food", Amount: money("-30"), Currency: "ars", Date: date.AddDate(0, 0, 1), AccountID: cash,
+	}), http.StatusOK)
+
+	// moving money between accounts is neither spending nor income
+	summary := decodeBody[SummaryResponse](t, serve(t, h.GetSummary, http.MethodGet, "/summary", nil))
+	if len(summary.Unconverted) != 1 || summary.Unconverted[0].Amount.String() != "-30.00" || summary.Unconverted[0].Count != 1 {
+		t.Fatalf("expected the transfer left out of the summary, got %+v", summary)
+	}
+	transfers := decodeBody[[]storage.Expense](t, serve(t, h.GetExpenses, http.MethodGet, "/expenses?type=transfer", nil))
+	if len(transfers) != 1 || transfers[0].Amount.String() != "-200.00" || transfers[0].ToAccountID != cash {
+		t.Fatalf("unexpected transfers: %+v", transfers)
+	}
+	expectStatus(t, serve(t, h.GetExpenses, http.MethodGet, "/expenses?type=loan", nil), http.StatusBadRequest)
+
+	ledger := decodeBody[AccountLedgerResponse](t, serve(t, h.GetAccountLedger, http.MethodGet, "/account/ledger?id="+cash, nil))
+	if len(ledger.Entries) != 2 || ledger.Entries[0].Balance.String() != "170.00" || ledger.Entries[1].Balance.String() != "200.00" {
+		t.Fatalf("unexpected cash ledger: %+v", ledger)
+	}
+	expectStatus(t, serve(t, h.DeleteAccount, http.MethodDelete, "/account/delete?id="+cash, nil), http.StatusConflict)
+
+	// the export names the accounts, so a transfer survives the round trip
+	exported := serve(t, h.ExportCSV, http.MethodGet, "/export/csv", nil).Body.String()
+	fresh := newTestHandler(t)
+	for _, a := range []storage.Account{
+		{Name: "banco", Type: storage.AccountTypeBank, Currency: "ars"},
+		{Name: "Efectivo", Type: storage.AccountTypeCash, Currency: "ars"},
+	} {
+		expectStatus(t, serve(t, fresh.AddAccount, http.MethodPut, "/account", a), http.StatusOK)
+	}
+	result := decodeBody[map[string]any](t, serveCSV(t, fresh.ImportCSV, "/import/csv", exported))
+	if result["imported"].(float64) != 2 {
+		t.Fatalf("unexpected import result: %v", result)
+	}
+	imported := decodeBody[[]storage.Expense](t, serve(t, fresh.GetExpenses, http.MethodGet, "/expenses?type=transfer", nil))
+	if len(imported) != 1 || imported[0].AccountID == "" || imported[0].ToAccountID == "" || imported[0].Category != "" {
+		t.Fatalf("unexpected imported transfer: %+v", imported)
+	}
+}
+
+func TestRecurringAccountHandlers(t *testing.T) {
+	h := newTestHandler(t)
+	rec := serve(t, h.AddAccount, http.MethodPut, "/account", storage.Account{Name: "Visa", Type: storage.AccountTypeCreditCard, Currency: "usd"})
+	expectStatus(t, rec, http.StatusOK)
+	card := decodeBody[[]storage.AccountBalance](t, rec)[0].Account
+
+	rule := storage.RecurringExpense{Name: "Streaming", Category: "Entertainment", Amount: money("-10"), Currency: "ars",
+		StartDate: time.Now().AddDate(0, -1, 0), Interval: "monthly", Occurrences: 2, AccountID: card.ID}
+	expectStatus(t, serve(t, h.AddRecurringExpense, http.MethodPut, "/recurring-expense", rule), http.StatusBadRequest)
+	rule.AccountID = "missing"
+	expectStatus(t, serve(t, h.AddRecurringExpense, http.MethodPut, "/recurring-expense", rule), http.StatusBadRequest)
+	rule.Currency, rule.AccountID = "usd", card.ID
+	expectStatus(t, serve(t, h.AddRecurringExpense, http.MethodPut, "/recurring-expense", rule), http.StatusCreated)
+
+	// a card subscription lands on the card, not on cash
+	expenses := decodeBody[[]storage.Expense](t, serve(t, h.GetExpenses, http.MethodGet, "/expenses?account="+card.ID, nil))
+	if len(expenses) != 2 || expenses[0].Source != storage.SourceCreditCard || expenses[0].Card != "Visa" {
+		t.Fatalf("expected both instances on the card, got %+v", expenses)
+	}
+	expectStatus(t, serve(t, h.DeleteAccount, http.MethodDelete, "/account/delete?id="+card.ID, nil), http.StatusConflict)
+
+	// a rule keeps its archived account, but cannot move to another archived one
+	rules := decodeBody[[]storage.RecurringExpense](t, serve(t, h.GetRecurringExpenses, http.MethodGet, "/recurring-expenses", nil))
+	card.Archived = true
+	expectStatus(t, serve(t, h.EditAccount, http.MethodPut, "/account/edit?id="+card.ID, card), http.StatusOK)
+	rule = rules[0]
+	rule.Amount = money("-12")
+	expectStatus(t, serve(t, h.UpdateRecurringExpense, http.MethodPut, "/recurring-expense/edit?id="+rule.ID+"&updateAll=true", rule), http.StatusOK)
+	rec = serve(t, h.AddAccount, http.MethodPut, "/account", storage.Account{Name: "Master", Type: storage.AccountTypeCreditCard, Currency: "usd", Archived: true})
+	expectStatus(t, rec, http.StatusOK)
+	for _, a := range decodeBody[[]storage.AccountBalance](t, rec) {
+		if a.Name == "Master" {
+			rule.AccountID = a.ID
+		}
+	}
+	expectStatus(t, serve(t, h.UpdateRecurringExpense, http.MethodPut, "/recurring-expense/edit?id="+rule.ID+"&updateAll=true", rule), http.StatusBadRequest)
+}
@@ -0,0 +1,128 @@
+package api
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+// ------------------------------------------------------------
+// Audit Handlers
+// ------------------------------------------------------------
+
+// AuditPageResponse is the body of GET /audit; nextCursor is omitted on the last page
+type AuditPageResponse struct {
+	Entries    []storage.AuditEntry `json:"entries"`
+	NextCursor string               `json:"nextCursor,omitempty"`
+}
+
+var auditEntities = []string{storage.AuditExpense, storage.AuditRecurring, storage.AuditCategory, storage.AuditConfig, storage.AuditExchange, storage.AuditAccount, storage.AuditInstallment}
+
+// GetAuditLog serves the activity feed, newest first, optionally narrowed to
+// one entity kind and id
+func (h *Handler) GetAuditLog(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	query := r.URL.Query()
+	filter := storage.AuditFilter{Entity: query.Get("entity"), EntityID: query.Get("id"), Limit: defaultExpensePageSize}
+	if filter.Entity != "" && !slices.Contains(auditEntities, filter.Entity) {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("'entity' must be one of %v", auditEntities)})
+		return
+	}
+	if v := query.Get("limit"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 1 || parsed > maxExpensePageSize {
+			writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("'limit' must be between 1 and %d", maxExpensePageSize)})
+			return
+		}
+		filter.Limit = parsed
+	}
+	if v := query.Get("cursor"); v != "" {
+		parsed, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || parsed < 1 {
+			writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid cursor"})
+			return
+		}
+		filter.Before = parsed
+	}
+	// one extra entry tells whether another page follows
+	limit := filter.Limit
+	filter.Limit++
+	entries, err := h.storage.GetAuditLog(filter)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve audit log"})
+		log.Printf("API ERROR: Failed to retrieve audit log: %v\n", err)
+		return
+	}
+	response := AuditPageResponse{Entries: entries}
+	if len(entries) > limit {
+		response.Entries = entries[:limit]
+		response.NextCursor = strconv.FormatInt(entries[limit-1].ID, 10)
+	}
+	if response.Entries == nil {
+		response.Entries = []storage.AuditEntry{}
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// GetExpenseHistory returns every change to one expense, newest first, along
+// with the changes to the recurring rule that generated it; a purged expense
+// keeps its history
+func (h *Handler) GetExpenseHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "ID parameter is required"})
+		return
+	}
+	entries, err := h.storage.GetAuditLog(storage.AuditFilter{Entity: storage.AuditExpense, EntityID: id})
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve expense history"})
+		log.Printf("API ERROR: Failed to retrieve history of expense %s: %v\n", id, err)
+		return
+	}
+	expense, err := h.storage.GetExpense(id)
+	if err != nil && len(entries) == 0 {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: "Expense not found"})
+		return
+	}
+	// generated instances have no entries of their own until edited
+	recurringID := expense.RecurringID
+	for _, entry := range entries {
+		if recurringID != "" {
+			break
+		}
+		for _, data := range []json.RawMessage{entry.After, entry.Before} {
+			var snapshot storage.Expense
+			if data != nil && json.Unmarshal(data, &snapshot) == nil && snapshot.RecurringID != "" {
+				recurringID = snapshot.RecurringID
+				break
+			}
+		}
+	}
+	if recurringID != "" {
+		ruleEntries, err := h.storage.GetAuditLog(storage.AuditFilter{Entity: storage.AuditRecurring, EntityID: recurringID})
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve expense history"})
+			log.Printf("API ERROR: Failed to retrieve history of recurring expense %s: %v\n", recurringID, err)
+			return
+		}
+		entries = append(entries, ruleEntries...)
+		slices.SortFunc(entries, func(a, b storage.AuditEntry) int { return cmp.Compare(b.ID, a.ID) })
+	}
+	if entries == nil {
+		entries = []storage.AuditEntry{}
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
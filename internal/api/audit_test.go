@@ -0,0 +1,52 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+func TestAuditHandlers(t *testing.T) {
+	h := newTestHandler(t)
+	expectStatus(t, serve(t, h.AddExpense, http.MethodPut, "/expense", storage.Expense{Name: "Coffee", Category: "Food", Amount: money("-3"), Date: time.Now()}), http.StatusOK)
+	expense := decodeBody[[]storage.Expense](t, serve(t, h.GetExpenses, http.MethodGet, "/expenses", nil))[0]
+	expense.Amount = money("-4")
+	expectStatus(t, serve(t, h.EditExpense, http.MethodPut, "/expense/edit?id="+expense.ID, expense), http.StatusOK)
+	expectStatus(t, serve(t, h.DeleteExpense, http.MethodDelete, "/expense/delete?id="+expense.ID, nil), http.StatusOK)
+
+	history := decodeBody[[]storage.AuditEntry](t, serve(t, h.GetExpenseHistory, http.MethodGet, "/expense/history?id="+expense.ID, nil))
+	if len(history) != 3 || history[0].Action != storage.AuditDelete || history[2].Action != storage.AuditCreate {
+		t.Fatalf("unexpected expense history: %+v", history)
+	}
+	expectStatus(t, serve(t, h.GetExpenseHistory, http.MethodGet, "/expense/history?id=missing", nil), http.StatusNotFound)
+	expectStatus(t, serve(t, h.GetExpenseHistory, http.MethodGet, "/expense/history", nil), http.StatusBadRequest)
+
+	// generated instances share the history of their rule
+	rule := storage.RecurringExpense{Name: "Rent", Category: "Rent", Amount: money("-500"), StartDate: time.Now().AddDate(0, -1, 0), Interval: "monthly", Occurrences: 3}
+	expectStatus(t, serve(t, h.AddRecurringExpense, http.MethodPut, "/recurring-expense", rule), http.StatusCreated)
+	rule = decodeBody[[]storage.RecurringExpense](t, serve(t, h.GetRecurringExpenses, http.MethodGet, "/recurring-expenses", nil))[0]
+	page := decodeBody[ExpensePageResponse](t, serve(t, h.GetExpenses, http.MethodGet, "/expenses?recurring=true&limit=1", nil))
+	history = decodeBody[[]storage.AuditEntry](t, serve(t, h.GetExpenseHistory, http.MethodGet, "/expense/history?id="+page.Expenses[0].ID, nil))
+	if len(history) != 1 || history[0].Entity != storage.AuditRecurring || history[0].EntityID != rule.ID {
+		t.Fatalf("expected the rule creation in the instance history, got %+v", history)
+	}
+
+	expectStatus(t, serve(t, h.UpdateCurrency, http.MethodPut, "/currency/edit", `"eur"`), http.StatusOK)
+	feed := decodeBody[AuditPageResponse](t, serve(t, h.GetAuditLog, http.MethodGet, "/audit?limit=2", nil))
+	if len(feed.Entries) != 2 || feed.Entries[0].Entity != storage.AuditConfig || feed.NextCursor == "" {
+		t.Fatalf("unexpected first feed page: %+v", feed)
+	}
+	feed = decodeBody[AuditPageResponse](t, serve(t, h.GetAuditLog, http.MethodGet, "/audit?limit=3&cursor="+feed.NextCursor, nil))
+	if len(feed.Entries) != 3 || feed.Entries[0].Action != storage.AuditDelete || feed.Entries[2].Action != storage.AuditCreate || feed.NextCursor != "" {
+		t.Fatalf("unexpected last feed page: %+v", feed)
+	}
+	feed = decodeBody[AuditPageResponse](t, serve(t, h.GetAuditLog, http.MethodGet, "/audit?entity=recurring&id="+rule.ID, nil))
+	if len(feed.Entries) != 1 {
+		t.Fatalf("expected one entry for the rule, got %+v", feed.Entries)
+	}
+	expectStatus(t, serve(t, h.GetAuditLog, http.MethodGet, "/audit?entity=tag", nil), http.StatusBadRequest)
+	expectStatus(t, serve(t, h.GetAuditLog, http.MethodGet, "/audit?cursor=abc", nil), http.StatusBadRequest)
+	expectStatus(t, serve(t, h.GetAuditLog, http.MethodGet, "/audit?limit=0", nil), http.StatusBadRequest)
+}
@@ -0,0 +1,386 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+// ------------------------------------------------------------
+// Inflation (CPI) Handlers
+// ------------------------------------------------------------
+
+// defaultCPICurrency is the series used when a request names no currency
+const defaultCPICurrency = "ars"
+
+// RealAmounts pairs the sum of movements as spent with the same sum in the
+// prices of the reference month
+type RealAmounts struct {
+	Nominal storage.Money `json:"nominal"`
+	Real    storage.Money `json:"real"`
+	Count   int           `json:"count"`
+}
+
+type RealCategory struct {
+	Category string `json:"category"`
+	RealAmounts
+}
+
+type RealPeriod struct {
+	Period string `json:"period"` // 2006-01 or 2006
+	RealAmounts
+	Categories []RealCategory `json:"categories"`
+}
+
+// MonthSum totals the movements of a month left out of a real-terms report
+// because the month has no index
+type MonthSum struct {
+	Month  string        `json:"month"`
+	Amount storage.Money `json:"amount"`
+	Count  int           `json:"count"`
+}
+
+type RealReportResponse struct {
+	Currency  string `json:"currency"`
+	Reference string `json:"reference"` // month whose prices real amounts are in
+	Period    string `json:"period"`    // month or year
+	RealAmounts
+	Periods    []RealPeriod   `json:"periods"` // oldest first
+	Categories []RealCategory `json:"categories"`
+	Missing    []MonthSum     `json:"missing"`
+}
+
+type cpiIndexKey struct {
+	Currency string `json:"currency"`
+	Month    string `json:"month"` // 2006-01
+}
+
+func (a *RealAmounts) add(nominal, adjusted storage.Money) error {
+	var err error
+	if a.Nominal, err = a.Nominal.Add(nominal); err != nil {
+		return err
+	}
+	if a.Real, err = a.Real.Add(adjusted); err != nil {
+		return err
+	}
+	a.Count++
+	return nil
+}
+
+// in writes both sums with the decimals of currency, zeros included
+func (a RealAmounts) in(currency string) RealAmounts {
+	for _, total := range []*storage.Money{&a.Nominal, &a.Real} {
+		if scaled, err := total.In(currency); err == nil {
+			*total = scaled
+		}
+	}
+	return a
+}
+
+// parseMonth reads 2006-01 or any date accepted by parseDate
+func parseMonth(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if month, err := time.Parse("2006-01", s); err == nil {
+		return month, nil
+	}
+	date, err := parseDate(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unable to parse month: %s", s)
+	}
+	return storage.CPIMonth(date), nil
+}
+
+func (h *Handler) GetCPIIndexes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	h.writeCPIIndexes(w)
+}
+
+// SaveCPIIndexes upserts a list of indexes, replacing the value already
+// stored for a currency and month
+func (h *Handler) SaveCPIIndexes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	var indexes []storage.CPIIndex
+	if err := json.NewDecoder(r.Body).Decode(&indexes); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	for i := range indexes {
+		if indexes[i].Currency == "" {
+			indexes[i].Currency = defaultCPICurrency
+		}
+		if err := indexes[i].Validate(); err != nil {
+			writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+	}
+	if err := h.storage.SaveCPIIndexes(indexes); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to save cpi indexes"})
+		log.Printf("API ERROR: Failed to save cpi indexes: %v\n", err)
+		return
+	}
+	h.writeCPIIndexes(w)
+}
+
+func (h *Handler) DeleteCPIIndex(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	var payload cpiIndexKey
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	month, err := parseMonth(payload.Month)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if payload.Currency == "" {
+		payload.Currency = defaultCPICurrency
+	}
+	currency, err := storage.ValidateCurrencyCode(payload.Currency)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	indexes, err := h.storage.GetCPIIndexes()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get cpi indexes"})
+		log.Printf("API ERROR: Failed to get cpi indexes: %v\n", err)
+		return
+	}
+	if _, ok := storage.NewCPITable(indexes).Index(currency, month); !ok {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: "CPI index not found"})
+		return
+	}
+	if err := h.storage.DeleteCPIIndex(currency, month); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete cpi index"})
+		log.Printf("API ERROR: Failed to delete cpi index: %v\n", err)
+		return
+	}
+	h.writeCPIIndexes(w)
+}
+
+func (h *Handler) writeCPIIndexes(w http.ResponseWriter) {
+	indexes, err := h.storage.GetCPIIndexes()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get cpi indexes"})
+		log.Printf("API ERROR: Failed to get cpi indexes: %v\n", err)
+		return
+	}
+	if indexes == nil {
+		indexes = []storage.CPIIndex{}
+	}
+	writeJSON(w, http.StatusOK, indexes)
+}
+
+// ImportCPICSV reads a CSV with month and value columns, plus an optional
+// currency column (ars by default); invalid rows are skipped
+func (h *Handler) ImportCPICSV(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	if err := r.ParseMultipartForm(10 << 20); err != nil { // 10MB max file size
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Could not parse multipart form"})
+		return
+	}
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Error retrieving the file"})
+		return
+	}
+	defer file.Close()
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Failed to read CSV file"})
+		return
+	}
+	if len(records) < 2 {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "CSV file must have a header and at least one data row"})
+		return
+	}
+	colMap := make(map[string]int)
+	for i, col := range records[0] {
+		colMap[strings.ToLower(strings.TrimSpace(col))] = i
+	}
+	for _, col := range []string{"month", "value"} {
+		if _, ok := colMap[col]; !ok {
+			writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("Missing required column: %s", col)})
+			return
+		}
+	}
+	currencyIdx, currencyExists := colMap["currency"]
+
+	var indexes []storage.CPIIndex
+	skippedCount := 0
+	for i, record := range records[1:] {
+		if len(record) != len(records[0]) {
+			log.Printf("Warning: Skipping cpi row %d due to incorrect column count\n", i+2)
+			skippedCount++
+			continue
+		}
+		month, err := parseMonth(record[colMap["month"]])
+		if err != nil {
+			log.Printf("Warning: Skipping cpi row %d due to invalid month: %v\n", i+2, err)
+			skippedCount++
+			continue
+		}
+		value, err := storage.ParseMoney(record[colMap["value"]])
+		if err != nil {
+			log.Printf("Warning: Skipping cpi row %d due to invalid value: %v\n", i+2, err)
+			skippedCount++
+			continue
+		}
+		index := storage.CPIIndex{Currency: defaultCPICurrency, Month: month, Value: value}
+		if currencyExists && strings.TrimSpace(record[currencyIdx]) != "" {
+			index.Currency = record[currencyIdx]
+		}
+		if err := index.Validate(); err != nil {
+			log.Printf("Warning: Skipping cpi row %d due to validation error: %v\n", i+2, err)
+			skippedCount++
+			continue
+		}
+		indexes = append(indexes, index)
+	}
+	if err := h.storage.SaveCPIIndexes(indexes); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to save cpi indexes"})
+		log.Printf("API ERROR: Failed to save imported cpi indexes: %v\n", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"status":          "success",
+		"total_processed": len(records) - 1,
+		"imported":        len(indexes),
+		"skipped":         skippedCount,
+	})
+	log.Printf("HTTP: Imported %d cpi indexes from CSV file. Skipped %d records.", len(indexes), skippedCount)
+}
+
+// GetRealReport totals the filtered movements of one currency (the currency
+// filter, ars by default) as spent and in the prices of the reference month,
+// per period and per category. reference defaults to the latest indexed
+// month and period to month.
+func (h *Handler) GetRealReport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	query := r.URL.Query()
+	filter, err := parseExpenseFilter(query)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if filter.Currency == "" {
+		filter.Currency = defaultCPICurrency
+	}
+	if filter.Currency, err = storage.ValidateCurrencyCode(filter.Currency); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	periodFormat := map[string]string{"month": "2006-01", "year": "2006"}
+	period := query.Get("period")
+	if period == "" {
+		period = "month"
+	}
+	if _, ok := periodFormat[period]; !ok {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid 'period': must be month or year"})
+		return
+	}
+	indexes, err := h.storage.GetCPIIndexes()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get cpi indexes"})
+		log.Printf("API ERROR: Failed to get cpi indexes: %v\n", err)
+		return
+	}
+	table := storage.NewCPITable(indexes)
+	reference, ok := table.Latest(filter.Currency)
+	if v := query.Get("reference"); v != "" {
+		if reference, err = parseMonth(v); err != nil {
+			writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("invalid 'reference' month: %s", v)})
+			return
+		}
+		_, ok = table.Index(filter.Currency, reference)
+	}
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("No cpi index of %s for the reference month", filter.Currency)})
+		return
+	}
+
+	var totals RealAmounts
+	periods := map[string]RealAmounts{}
+	periodCategories := map[string]map[string]RealAmounts{}
+	categories := map[string]RealAmounts{}
+	missing := map[string]MonthSum{}
+	err = h.storage.StreamExpenses(spendingOnly(filter), func(e storage.Expense) error {
+		adjusted, ok := table.Adjust(e.Amount, e.Currency, e.Date, reference)
+		if !ok {
+			month := e.Date.UTC().Format("2006-01")
+			sum := missing[month]
+			total, err := sum.Amount.Add(e.Amount)
+			if err != nil {
+				return err
+			}
+			sum.Month, sum.Amount, sum.Count = month, total, sum.Count+1
+			missing[month] = sum
+			return nil
+		}
+		key := e.Date.UTC().Format(periodFormat[period])
+		if periodCategories[key] == nil {
+			periodCategories[key] = map[string]RealAmounts{}
+		}
+		inPeriod, inPeriodCategory, inCategory := periods[key], periodCategories[key][e.Category], categories[e.Category]
+		for _, amounts := range []*RealAmounts{&totals, &inPeriod, &inPeriodCategory, &inCategory} {
+			if err := amounts.add(e.Amount, adjusted); err != nil {
+				return err
+			}
+		}
+		periods[key], periodCategories[key][e.Category], categories[e.Category] = inPeriod, inPeriodCategory, inCategory
+		return nil
+	})
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to build real-terms report"})
+		log.Printf("API ERROR: Failed to build real-terms report: %v\n", err)
+		return
+	}
+	currency := filter.Currency
+	realCategories := func(sums map[string]RealAmounts) []RealCategory {
+		list := []RealCategory{}
+		for _, name := range slices.Sorted(maps.Keys(sums)) {
+			list = append(list, RealCategory{Category: name, RealAmounts: sums[name].in(currency)})
+		}
+		return list
+	}
+	response := RealReportResponse{
+		Currency:    currency,
+		Reference:   reference.Format("2006-01"),
+		Period:      period,
+		RealAmounts: totals.in(currency),
+		Periods:     []RealPeriod{},
+		Categories:  realCategories(categories),
+		Missing:     []MonthSum{},
+	}
+	for _, key := range slices.Sorted(maps.Keys(periods)) {
+		response.Periods = append(response.Periods, RealPeriod{Period: key, RealAmounts: periods[key].in(currency), Categories: realCategories(periodCategories[key])})
+	}
+	for _, month := range slices.Sorted(maps.Keys(missing)) {
+		response.Missing = append(response.Missing, missing[month])
+	}
+	writeJSON(w, http.StatusOK, response)
+}
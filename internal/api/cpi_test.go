@@ -0,0 +1,66 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+func TestRealReportHandlers(t *testing.T) {
+	h := newTestHandler(t)
+
+	expectStatus(t, serve(t, h.GetRealReport, http.MethodGet, "/reports/real", nil), http.StatusBadRequest)
+	expectStatus(t, serveCSV(t, h.ImportCPICSV, "/cpi/import", "date,value\n2024-01,100\n"), http.StatusBadRequest)
+	rec := serveCSV(t, h.ImportCPICSV, "/cpi/import", "Month,Value,Currency\n2024-01,100,\n2024-02-15,120,ARS\n2024-03,150,\nlast month,1,\n2024-03,1e3,\n2024-01,0,ars\n")
+	expectStatus(t, rec, http.StatusOK)
+	if result := decodeBody[map[string]any](t, rec); result["imported"] != float64(3) || result["skipped"] != float64(3) {
+		t.Fatalf("expected 3 imported and 3 skipped indexes, got %v", result)
+	}
+	rec = serve(t, h.SaveCPIIndexes, http.MethodPut, "/cpi/edit", `[{"currency":"usd","month":"2024-01-01T00:00:00Z","value":"308.417"}]`)
+	expectStatus(t, rec, http.StatusOK)
+	if indexes := decodeBody[[]storage.CPIIndex](t, rec); len(indexes) != 4 || indexes[1].Month.Month() != time.February {
+		t.Fatalf("unexpected indexes after saving: %+v", indexes)
+	}
+	expectStatus(t, serve(t, h.SaveCPIIndexes, http.MethodPut, "/cpi/edit", []storage.CPIIndex{{Month: time.Now(), Value: money("-1")}}), http.StatusBadRequest)
+	expectStatus(t, serve(t, h.DeleteCPIIndex, http.MethodDelete, "/cpi/delete", cpiIndexKey{Currency: "usd", Month: "2024-02"}), http.StatusNotFound)
+	expectStatus(t, serve(t, h.DeleteCPIIndex, http.MethodDelete, "/cpi/delete", cpiIndexKey{Currency: "usd", Month: "2024-01"}), http.StatusOK)
+
+	expectStatus(t, serve(t, h.UpdateCurrency, http.MethodPut, "/currency/edit", `"ars"`), http.StatusOK)
+	day := func(m time.Month) time.Time { return time.Date(2024, m, 10, 12, 0, 0, 0, time.UTC) }
+	expenses := []storage.Expense{
+		{Name: "Super", Category: "Groceries", Amount: money("-1000"), Date: day(time.January)},
+		{Name: "Super", Category: "Groceries", Amount: money("-1200"), Date: day(time.February)},
+		{Name: "Cine", Category: "Entertainment", Amount: money("-300"), Date: day(time.March)},
+		{Name: "Alquiler", Category: "Rent", Amount: money("-5000"), Date: day(time.April)},
+		{Name: "Lunch", Category: "Food", Amount: money("-20"), Currency: "usd", Date: day(time.January)},
+	}
+	for _, e := range expenses {
+		expectStatus(t, serve(t, h.AddExpense, http.MethodPut, "/expense", e), http.StatusOK)
+	}
+
+	report := decodeBody[RealReportResponse](t, serve(t, h.GetRealReport, http.MethodGet, "/reports/real", nil))
+	if report.Currency != "ars" || report.Reference != "2024-03" || report.Period != "month" ||
+		report.Nominal.String() != "-2500.00" || report.Real.String() != "-3300.00" || report.Count != 3 {
+		t.Fatalf("unexpected report totals: %+v", report)
+	}
+	if len(report.Periods) != 3 || report.Periods[0].Period != "2024-01" || report.Periods[0].Real.String() != "-1500.00" ||
+		report.Periods[1].Real.String() != "-1500.00" || report.Periods[1].Categories[0].Category != "Groceries" {
+		t.Fatalf("unexpected report periods: %+v", report.Periods)
+	}
+	if len(report.Categories) != 2 || report.Categories[1].Category != "Groceries" || report.Categories[1].Nominal.String() != "-2200.00" {
+		t.Fatalf("unexpected report categories: %+v", report.Categories)
+	}
+	if len(report.Missing) != 1 || report.Missing[0].Month != "2024-04" || report.Missing[0].Amount.String() != "-5000.00" {
+		t.Fatalf("expected april left out for lack of an index, got %+v", report.Missing)
+	}
+
+	report = decodeBody[RealReportResponse](t, serve(t, h.GetRealReport, http.MethodGet, "/reports/real?reference=2024-01&period=year&category=Groceries", nil))
+	if len(report.Periods) != 1 || report.Periods[0].Period != "2024" || report.Real.String() != "-2000.00" || report.Nominal.String() != "-2200.00" {
+		t.Fatalf("unexpected yearly report in january prices: %+v", report)
+	}
+	expectStatus(t, serve(t, h.GetRealReport, http.MethodGet, "/reports/real?reference=2024-04", nil), http.StatusBadRequest)
+	expectStatus(t, serve(t, h.GetRealReport, http.MethodGet, "/reports/real?period=week", nil), http.StatusBadRequest)
+	expectStatus(t, serve(t, h.GetRealReport, http.MethodGet, "/reports/real?currency=usd", nil), http.StatusBadRequest)
+}
@@ -0,0 +1,139 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+// ------------------------------------------------------------
+// Currency Catalog Handlers
+// ------------------------------------------------------------
+
+type CurrenciesResponse struct {
+	Enabled []string               `json:"enabled"` // in display order
+	Catalog []storage.CurrencyInfo `json:"catalog"`
+}
+
+func (h *Handler) GetCurrencies(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	h.writeCurrencies(w)
+}
+
+// UpdateCurrencies replaces the enabled currencies with the codes in the body
+func (h *Handler) UpdateCurrencies(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	var codes []string
+	if err := json.NewDecoder(r.Body).Decode(&codes); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	codes, err := storage.NormalizeCurrencyList(codes)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	base, err := h.storage.GetCurrency()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get currency"})
+		log.Printf("API ERROR: Failed to get currency: %v\n", err)
+		return
+	}
+	if !slices.Contains(codes, base) {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("Currency '%s' is the base currency and cannot be disabled", base)})
+		return
+	}
+	enabled, err := h.storage.GetEnabledCurrencies()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get currencies"})
+		log.Printf("API ERROR: Failed to get currencies: %v\n", err)
+		return
+	}
+	for _, code := range enabled {
+		if slices.Contains(codes, code) {
+			continue
+		}
+		inUse, err := h.currencyInUse(code)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to check currency usage"})
+			log.Printf("API ERROR: Failed to check currency usage: %v\n", err)
+			return
+		}
+		if inUse {
+			writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("Currency '%s' is still in use and cannot be disabled", code)})
+			return
+		}
+	}
+	if err := h.storage.UpdateEnabledCurrencies(codes); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to update currencies"})
+		log.Printf("API ERROR: Failed to update currencies: %v\n", err)
+		return
+	}
+	h.writeCurrencies(w)
+}
+
+func (h *Handler) writeCurrencies(w http.ResponseWriter) {
+	enabled, err := h.storage.GetEnabledCurrencies()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get currencies"})
+		log.Printf("API ERROR: Failed to get currencies: %v\n", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, CurrenciesResponse{Enabled: enabled, Catalog: storage.CurrencyCatalog()})
+}
+
+// requireEnabledCurrency writes a 400 response unless code is enabled
+func (h *Handler) requireEnabledCurrency(w http.ResponseWriter, code string) bool {
+	enabled, err := h.storage.GetEnabledCurrencies()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get currencies"})
+		log.Printf("API ERROR: Failed to get currencies: %v\n", err)
+		return false
+	}
+	if !slices.Contains(enabled, code) {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("Currency '%s' is not enabled", code)})
+		return false
+	}
+	return true
+}
+
+// currencyInUse reports whether any expense, trashed expense, recurring rule
+// or account is kept in code
+func (h *Handler) currencyInUse(code string) (bool, error) {
+	page, err := h.storage.QueryExpensesPage(storage.ExpenseFilter{Currency: code}, nil, 1)
+	if err != nil {
+		return false, err
+	}
+	if len(page.Expenses) > 0 {
+		return true, nil
+	}
+	trash, err := h.storage.GetTrash()
+	if err != nil {
+		return false, err
+	}
+	if slices.ContainsFunc(trash, func(e storage.TrashedExpense) bool { return e.Currency == code }) {
+		return true, nil
+	}
+	rules, err := h.storage.GetRecurringExpenses()
+	if err != nil {
+		return false, err
+	}
+	if slices.ContainsFunc(rules, func(re storage.RecurringExpense) bool { return re.Currency == code }) {
+		return true, nil
+	}
+	accounts, err := h.storage.GetAccounts()
+	if err != nil {
+		return false, err
+	}
+	return slices.ContainsFunc(accounts, func(a storage.Account) bool { return a.Currency == code }), nil
+}
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+func TestCurrencyHandlers(t *testing.T) {
+	h := newTestHandler(t)
+
+	currencies := decodeBody[CurrenciesResponse](t, serve(t, h.GetCurrencies, http.MethodGet, "/currencies", nil))
+	if !slices.Equal(currencies.Enabled, storage.DefaultCurrencies) || len(currencies.Catalog) < 100 {
+		t.Fatalf("unexpected currencies: %v with %d in the catalog", currencies.Enabled, len(currencies.Catalog))
+	}
+	expense := storage.Expense{Name: "Empanadas", Category: "Food", Amount: money("-4500"), Currency: "clp", Date: time.Now()}
+	expectStatus(t, serve(t, h.AddExpense, http.MethodPut, "/expense", expense), http.StatusBadRequest)
+	expectStatus(t, serve(t, h.UpdateCurrency, http.MethodPut, "/currency/edit", `"clp"`), http.StatusBadRequest)
+
+	expectStatus(t, serve(t, h.UpdateCurrencies, http.MethodPut, "/currencies/edit", []string{"usd", "xyz"}), http.StatusBadRequest)
+	expectStatus(t, serve(t, h.UpdateCurrencies, http.MethodPut, "/currencies/edit", []string{"ars", "clp"}), http.StatusBadRequest)
+	rec := serve(t, h.UpdateCurrencies, http.MethodPut, "/currencies/edit", []string{"usd", "ARS", "eur", "clp"})
+	expectStatus(t, rec, http.StatusOK)
+	if enabled := decodeBody[CurrenciesResponse](t, rec).Enabled; !slices.Equal(enabled, []string{"usd", "ars", "eur", "clp"}) {
+		t.Fatalf("unexpected enabled currencies: %v", enabled)
+	}
+	expectStatus(t, serve(t, h.AddExpense, http.MethodPut, "/expense", expense), http.StatusOK)
+	expense.Amount = money("-4500.50")
+	expectStatus(t, serve(t, h.AddExpense, http.MethodPut, "/expense", expense), http.StatusBadRequest)
+	rule := storage.RecurringExpense{Name: "Rent", Category: "Rent", Amount: money("-500"), Currency: "brl", StartDate: time.Now(), Interval: "monthly", Occurrences: 3}
+	expectStatus(t, serve(t, h.AddRecurringExpense, http.MethodPut, "/recurring-expense", rule), http.StatusBadRequest)
+
+	// clp is in use by the empanadas
+	expectStatus(t, serve(t, h.UpdateCurrencies, http.MethodPut, "/currencies/edit", []string{"usd", "ars", "eur"}), http.StatusBadRequest)
+	expectStatus(t, serve(t, h.UpdateCurrencies, http.MethodPut, "/currencies/edit", []string{"usd", "clp"}), http.StatusOK)
+
+	rec = serveCSV(t, h.ImportCSV, "/import/csv", "name,category,amount,date,currency\nBus,Travel,-800,2024-03-01,CLP\nTea,Food,-3,2024-03-01,eur\n")
+	expectStatus(t, rec, http.StatusOK)
+	if result := decodeBody[map[string]any](t, rec); result["imported"] != float64(1) || result["skipped"] != float64(1) {
+		t.Fatalf("expected the eur row skipped, got %v", result)
+	}
+}
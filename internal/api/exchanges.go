@@ -0,0 +1,127 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+// ------------------------------------------------------------
+// Currency Exchange Handlers
+// ------------------------------------------------------------
+
+// spendingOnly leaves transfers out of a filter, the legs of currency
+// exchanges included: moving money between accounts or currencies is neither
+// spending nor income
+func spendingOnly(filter storage.ExpenseFilter) storage.ExpenseFilter {
+	excluded := false
+	filter.Transfers = &excluded
+	return filter
+}
+
+func (h *Handler) GetCurrencyExchanges(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	h.writeCurrencyExchanges(w)
+}
+
+// AddCurrencyExchange records money moved from one currency to another along
+// with its two legs, and feeds the effective rate into the exchange rates
+func (h *Handler) AddCurrencyExchange(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	var exchange storage.CurrencyExchange
+	if err := json.NewDecoder(r.Body).Decode(&exchange); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	// the store assigns the ids of the exchange and its legs
+	exchange.ID, exchange.OutgoingID, exchange.IncomingID = "", "", ""
+	if err := exchange.Validate(); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if !h.requireEnabledCurrency(w, exchange.FromCurrency) || !h.requireEnabledCurrency(w, exchange.ToCurrency) {
+		return
+	}
+	if err := h.storage.AddCurrencyExchange(exchange); err != nil {
+		if writeInvalid(w, err) {
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to save currency exchange"})
+		log.Printf("API ERROR: Failed to save currency exchange: %v\n", err)
+		return
+	}
+	h.writeCurrencyExchanges(w)
+}
+
+// DeleteCurrencyExchange removes an exchange and both legs for good; the rate
+// it fed into the exchange rates stays
+func (h *Handler) DeleteCurrencyExchange(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "ID parameter is required"})
+		return
+	}
+	if _, err := h.storage.GetCurrencyExchange(id); err != nil {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: "Currency exchange not found"})
+		return
+	}
+	if err := h.storage.RemoveCurrencyExchange(id); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete currency exchange"})
+		log.Printf("API ERROR: Failed to delete currency exchange: %v\n", err)
+		return
+	}
+	h.writeCurrencyExchanges(w)
+}
+
+func (h *Handler) writeCurrencyExchanges(w http.ResponseWriter) {
+	exchanges, err := h.storage.GetCurrencyExchanges()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get currency exchanges"})
+		log.Printf("API ERROR: Failed to get currency exchanges: %v\n", err)
+		return
+	}
+	if exchanges == nil {
+		exchanges = []storage.CurrencyExchange{}
+	}
+	writeJSON(w, http.StatusOK, exchanges)
+}
+
+// rejectGeneratedExpenses writes a 400 when one of the expenses is a leg of a
+// currency exchange, an installment of a purchase or an occurrence of a
+// recurring rule; missing expenses are left to the caller
+func (h *Handler) rejectGeneratedExpenses(w http.ResponseWriter, ids ...string) bool {
+	for _, id := range ids {
+		expense, err := h.storage.GetExpense(id)
+		if err != nil {
+			continue
+		}
+		if expense.ExchangeID != "" {
+			writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Expense is part of a currency exchange; delete the exchange instead"})
+			return true
+		}
+		if expense.InstallmentID != "" {
+			writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Expense is an installment of a purchase; change the purchase instead"})
+			return true
+		}
+		if expense.RecurringID == "" {
+			continue
+		}
+		if _, err := h.storage.GetRecurringExpense(expense.RecurringID); err == nil {
+			writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Expense is an occurrence of a recurring expense; override the occurrence instead"})
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+func TestCurrencyExchangeHandlers(t *testing.T) {
+	h := newTestHandler(t)
+	date := time.Date(2024, 3, 5, 12, 0, 0, 0, time.UTC)
+
+	expectStatus(t, serve(t, h.AddCurrencyExchange, http.MethodPut, "/currency-exchange", storage.CurrencyExchange{
+		FromCurrency: "ars", FromAmount: money("100000"), ToCurrency: "ars", ToAmount: money("100"), Date: date,
+	}), http.StatusBadRequest)
+	expectStatus(t, serve(t, h.AddCurrencyExchange, http.MethodPut, "/currency-exchange", storage.CurrencyExchange{
+		FromCurrency: "ars", FromAmount: money("100000"), ToCurrency: "clp", ToAmount: money("100"), Date: date,
+	}), http.StatusBadRequest)
+	rec := serve(t, h.AddCurrencyExchange, http.MethodPut, "/currency-exchange", storage.CurrencyExchange{
+		Name: "Dolares", FromCurrency: "ars", FromAmount: money("100000"), ToCurrency: "usd", ToAmount: money("100"), Date: date,
+	})
+	expectStatus(t, rec, http.StatusOK)
+	exchanges := decodeBody[[]storage.CurrencyExchange](t, rec)
+	if len(exchanges) != 1 || exchanges[0].Rate.String() != "1000.000000" || exchanges[0].OutgoingID == "" {
+		t.Fatalf("unexpected exchanges: %+v", exchanges)
+	}
+	x := exchanges[0]
+
+	lunch := storage.Expense{Name: "Lunch", Category: "Food", Amount: money("-5000"), Currency: "ars", Date: date}
+	expectStatus(t, serve(t, h.AddExpense, http.MethodPut, "/expense", lunch), http.StatusOK)
+	salary := storage.Expense{Name: "Salary", Category: "Income", Amount: money("200"), Currency: "usd", Date: date}
+	expectStatus(t, serve(t, h.AddExpense, http.MethodPut, "/expense", salary), http.StatusOK)
+
+	// the legs are listed but stay out of every total; the effective rate converts the lunch
+	if legs := decodeBody[[]storage.Expense](t, serve(t, h.GetExpenses, http.MethodGet, "/expenses?exchange=true", nil)); len(legs) != 2 {
+		t.Fatalf("expected the two legs, got %+v", legs)
+	}
+	expectStatus(t, serve(t, h.GetExpenses, http.MethodGet, "/expenses?exchange=maybe", nil), http.StatusBadRequest)
+	summary := decodeBody[SummaryResponse](t, serve(t, h.GetSummary, http.MethodGet, "/summary", nil))
+	if summary.Income.String() != "200.00" || summary.Expenses.String() != "-5.00" || summary.Count != 2 || len(summary.Unconverted) != 0 {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+	totals := decodeBody[[]storage.CategorySum](t, serve(t, h.GetCategoryTotals, http.MethodGet, "/categories/totals", nil))
+	counted := 0
+	for _, total := range totals {
+		counted += total.Count
+	}
+	if counted != 2 {
+		t.Fatalf("expected only the lunch and the salary counted, got %+v", totals)
+	}
+	entries := decodeBody[AuditPageResponse](t, serve(t, h.GetAuditLog, http.MethodGet, "/audit?entity=exchange", nil)).Entries
+	if len(entries) != 1 || entries[0].EntityID != x.ID {
+		t.Fatalf("unexpected exchange audit: %+v", entries)
+	}
+
+	leg := storage.Expense{Name: "Dolares", Category: "Food", Amount: money("-100000"), Currency: "ars", Date: date}
+	expectStatus(t, serve(t, h.EditExpense, http.MethodPut, "/expense/edit?id="+x.OutgoingID, leg), http.StatusBadRequest)
+	expectStatus(t, serve(t, h.DeleteExpense, http.MethodDelete, "/expense/delete?id="+x.IncomingID, nil), http.StatusBadRequest)
+	expectStatus(t, serve(t, h.DeleteMultipleExpenses, http.MethodDelete, "/expenses/delete", map[string][]string{"ids": {x.OutgoingID}}), http.StatusBadRequest)
+
+	expectStatus(t, serve(t, h.DeleteCurrencyExchange, http.MethodDelete, "/currency-exchange/delete?id=missing", nil), http.StatusNotFound)
+	rec = serve(t, h.DeleteCurrencyExchange, http.MethodDelete, "/currency-exchange/delete?id="+x.ID, nil)
+	expectStatus(t, rec, http.StatusOK)
+	if exchanges := decodeBody[[]storage.CurrencyExchange](t, rec); len(exchanges) != 0 {
+		t.Fatalf("expected no exchanges left, got %+v", exchanges)
+	}
+	if expenses := decodeBody[[]storage.Expense](t, serve(t, h.GetExpenses, http.MethodGet, "/expenses", nil)); len(expenses) != 2 {
+		t.Fatalf("expected the legs gone, got %+v", expenses)
+	}
+	if rates := decodeBody[[]storage.ExchangeRate](t, serve(t, h.GetExchangeRates, http.MethodGet, "/exchange-rates", nil)); len(rates) != 1 {
+		t.Fatalf("expected the effective rate kept, got %+v", rates)
+	}
+}
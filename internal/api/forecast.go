@@ -0,0 +1,143 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+// ------------------------------------------------------------
+// Projected Recurring Occurrences and Forecast
+// ------------------------------------------------------------
+
+// ForecastResponse is what is expected to move in a range, per currency,
+// along with the occurrences of recurring rules not stored yet
+type ForecastResponse struct {
+	Currencies []CashflowTotals  `json:"currencies"` // by currency code
+	Projected  []storage.Expense `json:"projected"`  // oldest first
+}
+
+// projectedOccurrences are the occurrences of the recurring rules past their
+// stored horizon, dated up to filter.To and matching the filter, oldest first
+func (h *Handler) projectedOccurrences(filter storage.ExpenseFilter) ([]storage.Expense, error) {
+	rules, err := h.storage.GetRecurringExpenses()
+	if err != nil {
+		return nil, err
+	}
+	holidays, err := h.storage.GetHolidays()
+	if err != nil {
+		return nil, err
+	}
+	calendar := storage.NewHolidays(holidays)
+	projected := []storage.Expense{}
+	for _, re := range rules {
+		var after time.Time
+		if re.MaterializedThrough != nil {
+			after = *re.MaterializedThrough
+		}
+		for _, e := range re.Project(after, filter.To, calendar) {
+			e.Projected = true
+			if filter.Matches(e) {
+				projected = append(projected, e)
+			}
+		}
+	}
+	slices.SortStableFunc(projected, func(a, b storage.Expense) int { return a.Date.Compare(b.Date) })
+	return projected, nil
+}
+
+// getProjectedExpenses lists the stored expenses along with the projected
+// occurrences of recurring rules, newest first; indefinite rules need a to
+// and the listing is not paged
+func (h *Handler) getProjectedExpenses(w http.ResponseWriter, filter storage.ExpenseFilter, query url.Values) {
+	if filter.To.IsZero() {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "'to' is required with 'projected'"})
+		return
+	}
+	if query.Has("cursor") || query.Has("limit") || query.Has("stream") {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "'projected' cannot be paged or streamed"})
+		return
+	}
+	expenses, err := h.storage.QueryExpenses(filter)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve expenses"})
+		log.Printf("API ERROR: Failed to retrieve expenses: %v\n", err)
+		return
+	}
+	projected, err := h.projectedOccurrences(filter)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to project recurring expenses"})
+		log.Printf("API ERROR: Failed to project recurring expenses: %v\n", err)
+		return
+	}
+	slices.Reverse(projected)
+	expenses = append(projected, expenses...)
+	slices.SortStableFunc(expenses, func(a, b storage.Expense) int { return b.Date.Compare(a.Date) })
+	writeJSON(w, http.StatusOK, expenses)
+}
+
+// GetForecast totals per currency what is expected to move between from
+// (by default now) and to: the expenses stored in the range plus the
+// occurrences of recurring rules not stored yet. Transfers are left out; the
+// other filters apply as in /expenses.
+func (h *Handler) GetForecast(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	filter, err := parseExpenseFilter(r.URL.Query())
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if filter.To.IsZero() {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "'to' is required"})
+		return
+	}
+	if filter.From.IsZero() {
+		filter.From = time.Now()
+	}
+	if filter.To.Before(filter.From) {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("'to' must not be before %s", filter.From.Format(time.DateOnly))})
+		return
+	}
+	filter = spendingOnly(filter)
+	totals := map[string]SummaryTotals{}
+	count := func(e storage.Expense) error {
+		sum := totals[e.Currency]
+		if err := sum.add(e, e.Amount); err != nil {
+			return err
+		}
+		totals[e.Currency] = sum
+		return nil
+	}
+	if err := h.storage.StreamExpenses(filter, count); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to compute forecast"})
+		log.Printf("API ERROR: Failed to compute forecast: %v\n", err)
+		return
+	}
+	projected, err := h.projectedOccurrences(filter)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to project recurring expenses"})
+		log.Printf("API ERROR: Failed to project recurring expenses: %v\n", err)
+		return
+	}
+	for _, e := range projected {
+		if err := count(e); err != nil {
+			writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to compute forecast"})
+			log.Printf("API ERROR: Failed to compute forecast: %v\n", err)
+			return
+		}
+	}
+	response := ForecastResponse{Currencies: []CashflowTotals{}, Projected: projected}
+	for _, currency := range slices.Sorted(maps.Keys(totals)) {
+		response.Currencies = append(response.Currencies, CashflowTotals{Currency: currency, SummaryTotals: totals[currency].in(currency)})
+	}
+	writeJSON(w, http.StatusOK, response)
+}
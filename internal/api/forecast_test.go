@@ -0,0 +1,56 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+func TestProjectedRecurringExpenses(t *testing.T) {
+	h := newTestHandler(t)
+	start := time.Now().UTC().Add(time.Hour)
+	rule := storage.RecurringExpense{Name: "Gym", Category: "Healthcare", Amount: money("-30"), Currency: "usd", StartDate: start, Interval: "monthly"}
+	single := rule
+	single.Occurrences = 1
+	expectStatus(t, serve(t, h.AddRecurringExpense, http.MethodPut, "/recurring-expense", single), http.StatusBadRequest)
+	// without occurrences the rule recurs indefinitely, stored up to the horizon
+	expectStatus(t, serve(t, h.AddRecurringExpense, http.MethodPut, "/recurring-expense", rule), http.StatusCreated)
+	horizon := storage.RecurringHorizon(time.Now())
+	stored := decodeBody[[]storage.Expense](t, serve(t, h.GetExpenses, http.MethodGet, "/expenses?recurring=true", nil))
+	if len(stored) == 0 || len(stored) > 3 {
+		t.Fatalf("expected the occurrences up to the horizon stored, got %d", len(stored))
+	}
+	for _, e := range stored {
+		if e.Date.After(horizon) {
+			t.Fatalf("occurrence stored past the horizon: %+v", e)
+		}
+	}
+
+	to := horizon.AddDate(0, 6, 0).Format(time.DateOnly)
+	expectStatus(t, serve(t, h.GetExpenses, http.MethodGet, "/expenses?projected=true", nil), http.StatusBadRequest)
+	expectStatus(t, serve(t, h.GetExpenses, http.MethodGet, "/expenses?projected=true&limit=10&to="+to, nil), http.StatusBadRequest)
+	listed := decodeBody[[]storage.Expense](t, serve(t, h.GetExpenses, http.MethodGet, "/expenses?projected=true&to="+to, nil))
+	projected := 0
+	for i, e := range listed {
+		if i > 0 && e.Date.After(listed[i-1].Date) {
+			t.Fatalf("expected newest first, got %+v", listed)
+		}
+		if e.Projected {
+			projected++
+			if e.ID != "" || !e.Date.After(horizon) || e.Amount.String() != "-30.00" {
+				t.Fatalf("unexpected projected occurrence: %+v", e)
+			}
+		}
+	}
+	if projected < 5 || projected+len(stored) != len(listed) {
+		t.Fatalf("expected six months of projected occurrences, got %d of %d", projected, len(listed))
+	}
+
+	expectStatus(t, serve(t, h.GetForecast, http.MethodGet, "/forecast", nil), http.StatusBadRequest)
+	forecast := decodeBody[ForecastResponse](t, serve(t, h.GetForecast, http.MethodGet, "/forecast?to="+to, nil))
+	if len(forecast.Currencies) != 1 || forecast.Currencies[0].Count != len(listed) || len(forecast.Projected) != projected {
+		t.Fatalf("unexpected forecast: %+v", forecast)
+	}
+}
@@ -2,9 +2,12 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -39,6 +42,16 @@ func writeJSON(w http.ResponseWriter, status int, v any) {
 	}
 }
 
+// writeInvalid writes the 400 response when err is a storage validation failure
+func writeInvalid(w http.ResponseWriter, err error) bool {
+	var invalid *storage.ValidationError
+	if !errors.As(err, &invalid) {
+		return false
+	}
+	writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: invalid.Error()})
+	return true
+}
+
 // ------------------------------------------------------------
 // Config Handlers
 // ------------------------------------------------------------
@@ -62,12 +75,20 @@ func (h *Handler) GetCategories(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
 		return
 	}
+	// read first: a change landing in between makes the tag stale, never too new
+	version, err := h.storage.CategoriesVersion()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get categories"})
+		log.Printf("API ERROR: Failed to get categories version: %v\n", err)
+		return
+	}
 	categories, err := h.storage.GetCategories()
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get categories"})
 		log.Printf("API ERROR: Failed to get categories: %v\n", err)
 		return
 	}
+	w.Header().Set("ETag", formatETag(version))
 	writeJSON(w, http.StatusOK, categories)
 }
 
@@ -76,7 +97,7 @@ func (h *Handler) UpdateCategories(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
 		return
 	}
-	var categories []string
+	var categories []storage.Category
 	if err := json.NewDecoder(r.Body).Decode(&categories); err != nil {
 		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
 		return
@@ -88,27 +109,66 @@ func (h *Handler) UpdateCategories(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var sanitizedCategories []string
-	for _, category := range categories {
-		sanitized, err := storage.ValidateCategory(category)
-		if err != nil {
+	for i := range categories {
+		if err := categories[i].Validate(); err != nil {
 			log.Printf("API ERROR: Invalid category provided: %v\n", err)
-			writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("Invalid category '%s': %v", category, err)})
+			writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("Invalid category '%s': %v", categories[i].Name, err)})
+			return
+		}
+	}
+	if err := storage.ValidateCategoryTree(categories); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	base, ok := h.categoriesBase(w, r)
+	if !ok {
+		return
+	}
+	current, err := h.storage.GetCategories()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get categories"})
+		log.Printf("API ERROR: Failed to get categories: %v\n", err)
+		return
+	}
+	for _, category := range current {
+		if slices.ContainsFunc(categories, func(c storage.Category) bool { return c.Name == category.Name }) {
+			continue
+		}
+		inUse, err := h.categoryInUse(category.Name)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to check category usage"})
+			log.Printf("API ERROR: Failed to check category usage: %v\n", err)
+			return
+		}
+		if inUse {
+			writeJSON(w, http.StatusConflict, ErrorResponse{Error: fmt.Sprintf("Category '%s' is still in use; delete it with a reassignment instead", category.Name)})
 			return
 		}
-		sanitizedCategories = append(sanitizedCategories, sanitized)
 	}
 
-	if err := h.storage.UpdateCategories(sanitizedCategories); err != nil {
+	if err := h.storage.UpdateCategories(categories, base); err != nil {
+		if writeConflict(w, err) {
+			return
+		}
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to update categories"})
 		log.Printf("API ERROR: Failed to update categories: %v\n", err)
 		return
 	}
+	w.Header().Set("ETag", formatETag(base+1))
 	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
 }
 
+// categoryPayload identifies a category by name; the metadata fields are
+// read by the add and update handlers, parent by the add and move handlers
 type categoryPayload struct {
-	Name string `json:"name"`
+	Name     string `json:"name"`
+	Color    string `json:"color"`
+	Icon     string `json:"icon"`
+	Type     string `json:"type"`
+	Archived bool   `json:"archived"`
+	Parent   string `json:"parent"`
+	// ReassignTo receives the expenses and recurring rules of a deleted category
+	ReassignTo string `json:"reassignTo"`
 }
 
 type categoryRenamePayload struct {
@@ -116,15 +176,74 @@ type categoryRenamePayload struct {
 	To   string `json:"to"`
 }
 
-func findCategoryIndex(categories []string, name string) int {
+func findCategoryIndex(categories []storage.Category, name string) int {
 	for i, category := range categories {
-		if strings.EqualFold(category, name) {
+		if strings.EqualFold(category.Name, name) {
 			return i
 		}
 	}
 	return -1
 }
 
+// resolveCategory returns the stored spelling of a category name, writing a
+// 400 response when the category does not exist
+func (h *Handler) resolveCategory(w http.ResponseWriter, name string) (string, bool) {
+	categories, err := h.storage.GetCategories()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get categories"})
+		log.Printf("API ERROR: Failed to get categories: %v\n", err)
+		return "", false
+	}
+	index := findCategoryIndex(categories, name)
+	if index == -1 {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("Unknown category '%s'", name)})
+		return "", false
+	}
+	return categories[index].Name, true
+}
+
+// categoryInUse reports whether any expense, trashed expense, recurring rule
+// or installment purchase is filed under name
+func (h *Handler) categoryInUse(name string) (bool, error) {
+	page, err := h.storage.QueryExpensesPage(storage.ExpenseFilter{Categories: []string{name}}, nil, 1)
+	if err != nil {
+		return false, err
+	}
+	if len(page.Expenses) > 0 {
+		return true, nil
+	}
+	trash, err := h.storage.GetTrash()
+	if err != nil {
+		return false, err
+	}
+	if slices.ContainsFunc(trash, func(e storage.TrashedExpense) bool { return e.Category == name }) {
+		return true, nil
+	}
+	rules, err := h.storage.GetRecurringExpenses()
+	if err != nil {
+		return false, err
+	}
+	if slices.ContainsFunc(rules, func(re storage.RecurringExpense) bool { return re.Category == name }) {
+		return true, nil
+	}
+	purchases, err := h.storage.GetInstallmentPurchases()
+	if err != nil {
+		return false, err
+	}
+	return slices.ContainsFunc(purchases, func(p storage.InstallmentPurchase) bool { return p.Category == name }), nil
+}
+
+// hasOtherActiveCategory reports whether a category other than the one at
+// skip is still offered in the pickers
+func hasOtherActiveCategory(categories []storage.Category, skip int) bool {
+	for i, category := range categories {
+		if i != skip && !category.Archived {
+			return true
+		}
+	}
+	return false
+}
+
 func (h *Handler) AddCategory(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
@@ -140,6 +259,25 @@ func (h *Handler) AddCategory(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 		return
 	}
+	// metadata left out of the payload comes from the matching default category
+	category := storage.NewCategory(name)
+	if payload.Color != "" {
+		category.Color = payload.Color
+	}
+	if payload.Icon != "" {
+		category.Icon = payload.Icon
+	}
+	if payload.Type != "" {
+		category.Type = payload.Type
+	}
+	if err := category.Validate(); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	base, ok := h.categoriesBase(w, r)
+	if !ok {
+		return
+	}
 	categories, err := h.storage.GetCategories()
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get categories"})
@@ -150,15 +288,83 @@ func (h *Handler) AddCategory(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusConflict, ErrorResponse{Error: "Category already exists"})
 		return
 	}
-	updated := append(categories, name)
-	if err := h.storage.UpdateCategories(updated); err != nil {
+	if payload.Parent != "" {
+		parent := findCategoryIndex(categories, payload.Parent)
+		if parent == -1 {
+			writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Parent category not found"})
+			return
+		}
+		category.Parent = categories[parent].Name
+	}
+	updated := append(categories, category)
+	if err := h.storage.UpdateCategories(updated, base); err != nil {
+		if writeConflict(w, err) {
+			return
+		}
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to update categories"})
 		log.Printf("API ERROR: Failed to update categories: %v\n", err)
 		return
 	}
+	w.Header().Set("ETag", formatETag(base+1))
 	writeJSON(w, http.StatusOK, updated)
 }
 
+// UpdateCategory replaces the color, icon, type and archived flag of a category
+func (h *Handler) UpdateCategory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	var payload categoryPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	category := storage.Category{
+		Name:     payload.Name,
+		Color:    payload.Color,
+		Icon:     payload.Icon,
+		Type:     payload.Type,
+		Archived: payload.Archived,
+	}
+	if err := category.Validate(); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	base, ok := h.categoriesBase(w, r)
+	if !ok {
+		return
+	}
+	categories, err := h.storage.GetCategories()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get categories"})
+		log.Printf("API ERROR: Failed to get categories: %v\n", err)
+		return
+	}
+	index := findCategoryIndex(categories, category.Name)
+	if index == -1 {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: "Category not found"})
+		return
+	}
+	if category.Archived && !hasOtherActiveCategory(categories, index) {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "At least one active category is required"})
+		return
+	}
+	category.Name = categories[index].Name
+	category.Parent = categories[index].Parent
+	categories[index] = category
+	if err := h.storage.UpdateCategories(categories, base); err != nil {
+		if writeConflict(w, err) {
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to update categories"})
+		log.Printf("API ERROR: Failed to update categories: %v\n", err)
+		return
+	}
+	w.Header().Set("ETag", formatETag(base+1))
+	writeJSON(w, http.StatusOK, categories)
+}
+
 func (h *Handler) RenameCategory(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPut {
 		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
@@ -179,6 +385,10 @@ func (h *Handler) RenameCategory(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 		return
 	}
+	base, ok := h.categoriesBase(w, r)
+	if !ok {
+		return
+	}
 	categories, err := h.storage.GetCategories()
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get categories"})
@@ -191,21 +401,43 @@ func (h *Handler) RenameCategory(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	for i, category := range categories {
-		if i != index && strings.EqualFold(category, to) {
+		if i != index && strings.EqualFold(category.Name, to) {
 			writeJSON(w, http.StatusConflict, ErrorResponse{Error: "Category already exists"})
 			return
 		}
 	}
-	if strings.EqualFold(categories[index], to) {
+	if categories[index].Name == to {
+		w.Header().Set("ETag", formatETag(base))
 		writeJSON(w, http.StatusOK, categories)
 		return
 	}
-	categories[index] = to
-	if err := h.storage.UpdateCategories(categories); err != nil {
-		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to update categories"})
-		log.Printf("API ERROR: Failed to update categories: %v\n", err)
+	// expenses and recurring rules follow the new name in the same transaction
+	if err := h.storage.RenameCategory(categories[index].Name, to, base); err != nil {
+		if writeConflict(w, err) {
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to rename category"})
+		log.Printf("API ERROR: Failed to rename category: %v\n", err)
+		return
+	}
+	h.writeCategories(w)
+}
+
+// writeCategories responds with the stored category list and its version
+func (h *Handler) writeCategories(w http.ResponseWriter) {
+	version, err := h.storage.CategoriesVersion()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get categories"})
+		log.Printf("API ERROR: Failed to get categories version: %v\n", err)
 		return
 	}
+	categories, err := h.storage.GetCategories()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get categories"})
+		log.Printf("API ERROR: Failed to get categories: %v\n", err)
+		return
+	}
+	w.Header().Set("ETag", formatETag(version))
 	writeJSON(w, http.StatusOK, categories)
 }
 
@@ -224,6 +456,10 @@ func (h *Handler) DeleteCategory(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 		return
 	}
+	base, ok := h.categoriesBase(w, r)
+	if !ok {
+		return
+	}
 	categories, err := h.storage.GetCategories()
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get categories"})
@@ -235,17 +471,136 @@ func (h *Handler) DeleteCategory(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: "Category not found"})
 		return
 	}
-	if len(categories) <= 1 {
-		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "At least one category is required"})
+	if !hasOtherActiveCategory(categories, index) {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "At least one active category is required"})
+		return
+	}
+	name = categories[index].Name
+	reassignTo := ""
+	if payload.ReassignTo != "" {
+		target := findCategoryIndex(categories, payload.ReassignTo)
+		if target == -1 {
+			writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Reassignment category not found"})
+			return
+		}
+		if target == index {
+			writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Cannot reassign a category to itself"})
+			return
+		}
+		reassignTo = categories[target].Name
+	} else {
+		inUse, err := h.categoryInUse(name)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to check category usage"})
+			log.Printf("API ERROR: Failed to check category usage: %v\n", err)
+			return
+		}
+		if inUse {
+			writeJSON(w, http.StatusConflict, ErrorResponse{Error: "Category is in use; choose a category to reassign its expenses to"})
+			return
+		}
+	}
+	// expenses and rules move to reassignTo, subcategories to the deleted category's parent
+	if err := h.storage.DeleteCategory(name, reassignTo, base); err != nil {
+		if writeConflict(w, err) {
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete category"})
+		log.Printf("API ERROR: Failed to delete category: %v\n", err)
+		return
+	}
+	h.writeCategories(w)
+}
+
+// MoveCategory nests a category under parent, or moves it to the top level
+// when parent is empty; its subcategories move along with it
+func (h *Handler) MoveCategory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	var payload categoryPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	name, err := storage.ValidateCategory(payload.Name)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	base, ok := h.categoriesBase(w, r)
+	if !ok {
+		return
+	}
+	categories, err := h.storage.GetCategories()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get categories"})
+		log.Printf("API ERROR: Failed to get categories: %v\n", err)
 		return
 	}
-	updated := append(categories[:index], categories[index+1:]...)
-	if err := h.storage.UpdateCategories(updated); err != nil {
+	index := findCategoryIndex(categories, name)
+	if index == -1 {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: "Category not found"})
+		return
+	}
+	parent := ""
+	if payload.Parent != "" {
+		parentIndex := findCategoryIndex(categories, payload.Parent)
+		if parentIndex == -1 {
+			writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Parent category not found"})
+			return
+		}
+		parent = categories[parentIndex].Name
+	}
+	categories[index].Parent = parent
+	if err := storage.ValidateCategoryTree(categories); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "A category cannot be moved under itself or its subcategories"})
+		return
+	}
+	if err := h.storage.UpdateCategories(categories, base); err != nil {
+		if writeConflict(w, err) {
+			return
+		}
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to update categories"})
 		log.Printf("API ERROR: Failed to update categories: %v\n", err)
 		return
 	}
-	writeJSON(w, http.StatusOK, updated)
+	w.Header().Set("ETag", formatETag(base+1))
+	writeJSON(w, http.StatusOK, categories)
+}
+
+// GetCategoryTotals sums the expenses matching the /expenses filters per
+// category and currency, rolling subcategory sums up into their parents
+func (h *Handler) GetCategoryTotals(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	filter, err := parseExpenseFilter(r.URL.Query())
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	categories, err := h.storage.GetCategories()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get categories"})
+		log.Printf("API ERROR: Failed to get categories: %v\n", err)
+		return
+	}
+	sums, err := h.storage.SumExpensesByCategory(spendingOnly(filter))
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to compute category totals"})
+		log.Printf("API ERROR: Failed to compute category totals: %v\n", err)
+		return
+	}
+	totals, err := storage.RollUpCategoryTotals(categories, sums)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to compute category totals"})
+		log.Printf("API ERROR: Failed to compute category totals: %v\n", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, totals)
 }
 
 func (h *Handler) GetCurrency(w http.ResponseWriter, r *http.Request) {
@@ -272,6 +627,9 @@ func (h *Handler) UpdateCurrency(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
 		return
 	}
+	if !h.requireEnabledCurrency(w, currency) {
+		return
+	}
 	if err := h.storage.UpdateCurrency(currency); err != nil {
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		log.Printf("API ERROR: Failed to update currency: %v\n", err)
@@ -326,19 +684,37 @@ func (h *Handler) AddExpense(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
 		return
 	}
-	if err := expense.Validate(); err != nil {
-		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
-		return
-	}
+	// the currency comes first: it decides how many decimals the amount may have
 	if expense.Currency == "" {
 		if cfgCur, err := h.storage.GetCurrency(); err == nil {
 			expense.Currency = cfgCur
 		}
 	}
+	if err := expense.Validate(); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
 	if expense.Date.IsZero() {
 		expense.Date = time.Now()
 	}
+	// transfers have no category
+	if expense.Type != storage.TransactionTypeTransfer {
+		category, ok := h.resolveCategory(w, expense.Category)
+		if !ok {
+			return
+		}
+		expense.Category = category
+	}
+	if expense.Currency != "" && !h.requireEnabledCurrency(w, expense.Currency) {
+		return
+	}
+	if !h.requireExpenseAccount(w, expense, storage.Expense{}) {
+		return
+	}
 	if err := h.storage.AddExpense(expense); err != nil {
+		if writeInvalid(w, err) {
+			return
+		}
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to save expense"})
 		log.Printf("API ERROR: Failed to save expense: %v\n", err)
 		return
@@ -351,7 +727,25 @@ func (h *Handler) GetExpenses(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
 		return
 	}
-	expenses, err := h.storage.GetAllExpenses()
+	filter, err := parseExpenseFilter(r.URL.Query())
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	query := r.URL.Query()
+	if projected, _ := strconv.ParseBool(query.Get("projected")); projected {
+		h.getProjectedExpenses(w, filter, query)
+		return
+	}
+	if stream, _ := strconv.ParseBool(query.Get("stream")); stream {
+		h.streamExpenses(w, filter)
+		return
+	}
+	if query.Has("cursor") || query.Has("limit") {
+		h.getExpensePage(w, filter, query)
+		return
+	}
+	expenses, err := h.storage.QueryExpenses(filter)
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve expenses"})
 		log.Printf("API ERROR: Failed to retrieve expenses: %v\n", err)
@@ -360,6 +754,157 @@ func (h *Handler) GetExpenses(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, expenses)
 }
 
+const (
+	defaultExpensePageSize = 100
+	maxExpensePageSize     = 1000
+)
+
+// ExpensePageResponse is the body of a paginated GET /expenses; nextCursor
+// is omitted on the last page
+type ExpensePageResponse struct {
+	Expenses   []storage.Expense `json:"expenses"`
+	NextCursor string            `json:"nextCursor,omitempty"`
+}
+
+func (h *Handler) getExpensePage(w http.ResponseWriter, filter storage.ExpenseFilter, query url.Values) {
+	limit := defaultExpensePageSize
+	if v := query.Get("limit"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 1 || parsed > maxExpensePageSize {
+			writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("'limit' must be between 1 and %d", maxExpensePageSize)})
+			return
+		}
+		limit = parsed
+	}
+	var after *storage.ExpenseCursor
+	if v := query.Get("cursor"); v != "" {
+		cursor, err := storage.ParseExpenseCursor(v)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		after = &cursor
+	}
+	page, err := h.storage.QueryExpensesPage(filter, after, limit)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve expenses"})
+		log.Printf("API ERROR: Failed to retrieve expenses: %v\n", err)
+		return
+	}
+	response := ExpensePageResponse{Expenses: page.Expenses}
+	if response.Expenses == nil {
+		response.Expenses = []storage.Expense{}
+	}
+	if page.Next != nil {
+		response.NextCursor = page.Next.String()
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// streamExpenses writes one JSON expense per line (NDJSON) as rows are read.
+// Once the first row is out the status is committed, so a failure midway
+// only ends the stream early.
+func (h *Handler) streamExpenses(w http.ResponseWriter, filter storage.ExpenseFilter) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	flusher, _ := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+	written := 0
+	err := h.storage.StreamExpenses(filter, func(e storage.Expense) error {
+		if err := encoder.Encode(e); err != nil {
+			return err
+		}
+		if written++; flusher != nil && written%defaultExpensePageSize == 0 {
+			flusher.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		if written == 0 {
+			writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve expenses"})
+		}
+		log.Printf("API ERROR: Failed to stream expenses: %v\n", err)
+	}
+}
+
+// parseExpenseFilter reads the GET /expenses filter parameters:
+// from, to, category (repeatable), tag (repeatable), source, card, currency,
+// minAmount, maxAmount, recurring and name
+func parseExpenseFilter(q url.Values) (storage.ExpenseFilter, error) {
+	var filter storage.ExpenseFilter
+	var err error
+	if v := q.Get("from"); v != "" {
+		if filter.From, err = parseDate(v); err != nil {
+			return filter, fmt.Errorf("invalid 'from' date: %s", v)
+		}
+	}
+	if v := q.Get("to"); v != "" {
+		if filter.To, err = parseDate(v); err != nil {
+			return filter, fmt.Errorf("invalid 'to' date: %s", v)
+		}
+		// a bare day is inclusive of the whole day
+		if len(v) <= len("2006-01-02") {
+			filter.To = filter.To.Add(24*time.Hour - time.Nanosecond)
+		}
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && filter.To.Before(filter.From) {
+		return filter, fmt.Errorf("'to' must not be before 'from'")
+	}
+	for _, category := range q["category"] {
+		if category = strings.TrimSpace(category); category != "" {
+			filter.Categories = append(filter.Categories, category)
+		}
+	}
+	for _, tag := range q["tag"] {
+		if tag = storage.SanitizeString(tag); tag != "" {
+			filter.Tags = append(filter.Tags, tag)
+		}
+	}
+	filter.Source = strings.TrimSpace(q.Get("source"))
+	filter.Card = strings.TrimSpace(q.Get("card"))
+	filter.Account = strings.TrimSpace(q.Get("account"))
+	filter.Currency = strings.ToLower(strings.TrimSpace(q.Get("currency")))
+	filter.Name = strings.TrimSpace(q.Get("name"))
+	for key, target := range map[string]**storage.Money{"minAmount": &filter.MinAmount, "maxAmount": &filter.MaxAmount} {
+		if v := q.Get(key); v != "" {
+			amount, err := storage.ParseMoney(v)
+			if err != nil {
+				return filter, fmt.Errorf("invalid '%s': %s", key, v)
+			}
+			*target = &amount
+		}
+	}
+	if v := q.Get("recurring"); v != "" {
+		recurring, err := strconv.ParseBool(v)
+		if err != nil {
+			return filter, fmt.Errorf("invalid 'recurring': %s", v)
+		}
+		filter.Recurring = &recurring
+	}
+	filter.Installment = strings.TrimSpace(q.Get("installment"))
+	if v := q.Get("exchange"); v != "" {
+		exchange, err := strconv.ParseBool(v)
+		if err != nil {
+			return filter, fmt.Errorf("invalid 'exchange': %s", v)
+		}
+		filter.Exchanges = &exchange
+	}
+	for _, kind := range q["type"] {
+		kind = strings.ToLower(strings.TrimSpace(kind))
+		if !slices.Contains([]string{storage.TransactionTypeExpense, storage.TransactionTypeIncome, storage.TransactionTypeTransfer}, kind) {
+			return filter, fmt.Errorf("invalid 'type': %s", kind)
+		}
+		filter.Types = append(filter.Types, kind)
+	}
+	if v := q.Get("transfer"); v != "" {
+		transfer, err := strconv.ParseBool(v)
+		if err != nil {
+			return filter, fmt.Errorf("invalid 'transfer': %s", v)
+		}
+		filter.Transfers = &transfer
+	}
+	return filter, nil
+}
+
 func (h *Handler) EditExpense(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPut {
 		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
@@ -375,21 +920,49 @@ func (h *Handler) EditExpense(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
 		return
 	}
+	// the currency comes first: it decides how many decimals the amount may have
+	if expense.Currency == "" {
+		if cfgCur, err := h.storage.GetCurrency(); err == nil {
+			expense.Currency = cfgCur
+		}
+	}
 	if err := expense.Validate(); err != nil {
 		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 		return
 	}
-	if expense.Currency == "" {
-		if cfgCur, err := h.storage.GetCurrency(); err == nil {
-			expense.Currency = cfgCur
+	// transfers have no category
+	if expense.Type != storage.TransactionTypeTransfer {
+		category, ok := h.resolveCategory(w, expense.Category)
+		if !ok {
+			return
 		}
+		expense.Category = category
+	}
+	if expense.Currency != "" && !h.requireEnabledCurrency(w, expense.Currency) {
+		return
+	}
+	if h.rejectGeneratedExpenses(w, id) {
+		return
+	}
+	if current, err := h.storage.GetExpense(id); err == nil && !h.requireExpenseAccount(w, expense, current) {
+		return
+	}
+	// If-Match wins over the version in the body; neither leaves the edit unchecked
+	if version, err := ifMatch(r); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	} else if version != 0 {
+		expense.Version = version
 	}
 	if err := h.storage.UpdateExpense(id, expense); err != nil {
+		if writeConflict(w, err) || writeInvalid(w, err) {
+			return
+		}
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to edit expense"})
 		log.Printf("API ERROR: Failed to edit expense: %v\n", err)
 		return
 	}
-	writeJSON(w, http.StatusOK, expense)
+	h.writeExpense(w, id)
 }
 
 func (h *Handler) DeleteExpense(w http.ResponseWriter, r *http.Request) {
@@ -402,7 +975,18 @@ func (h *Handler) DeleteExpense(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "ID parameter is required"})
 		return
 	}
-	if err := h.storage.RemoveExpense(id); err != nil {
+	if h.rejectGeneratedExpenses(w, id) {
+		return
+	}
+	version, err := ifMatch(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err := h.storage.RemoveExpense(id, version); err != nil {
+		if writeConflict(w, err) {
+			return
+		}
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete expense"})
 		log.Printf("API ERROR: Failed to delete expense: %v\n", err)
 		return
@@ -422,6 +1006,9 @@ func (h *Handler) DeleteMultipleExpenses(w http.ResponseWriter, r *http.Request)
 		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
 		return
 	}
+	if h.rejectGeneratedExpenses(w, payload.IDs...) {
+		return
+	}
 	if err := h.storage.RemoveMultipleExpenses(payload.IDs); err != nil {
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete multiple expenses"})
 		log.Printf("API ERROR: Failed to delete multiple expenses: %v\n", err)
@@ -444,11 +1031,30 @@ func (h *Handler) AddRecurringExpense(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
 		return
 	}
+	if re.Currency == "" {
+		if cfgCur, err := h.storage.GetCurrency(); err == nil {
+			re.Currency = cfgCur
+		}
+	}
 	if err := re.Validate(); err != nil {
 		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 		return
 	}
+	category, ok := h.resolveCategory(w, re.Category)
+	if !ok {
+		return
+	}
+	re.Category = category
+	if re.Currency != "" && !h.requireEnabledCurrency(w, re.Currency) {
+		return
+	}
+	if !h.requireAccount(w, storage.Expense{Currency: re.Currency}, re.AccountID, "") {
+		return
+	}
 	if err := h.storage.AddRecurringExpense(re); err != nil {
+		if writeInvalid(w, err) {
+			return
+		}
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to add recurring expense"})
 		log.Printf("API ERROR: Failed to add recurring expense: %v\n", err)
 		return
@@ -487,16 +1093,93 @@ func (h *Handler) UpdateRecurringExpense(w http.ResponseWriter, r *http.Request)
 		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
 		return
 	}
+	if re.Currency == "" {
+		if cfgCur, err := h.storage.GetCurrency(); err == nil {
+			re.Currency = cfgCur
+		}
+	}
 	if err := re.Validate(); err != nil {
 		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 		return
 	}
+	category, ok := h.resolveCategory(w, re.Category)
+	if !ok {
+		return
+	}
+	re.Category = category
+	if re.Currency != "" && !h.requireEnabledCurrency(w, re.Currency) {
+		return
+	}
+	if current, err := h.storage.GetRecurringExpense(id); err == nil && !h.requireAccount(w, storage.Expense{Currency: re.Currency}, re.AccountID, current.AccountID) {
+		return
+	}
+	if version, err := ifMatch(r); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	} else if version != 0 {
+		re.Version = version
+	}
 	if err := h.storage.UpdateRecurringExpense(id, re, updateAll); err != nil {
+		if writeConflict(w, err) || writeInvalid(w, err) {
+			return
+		}
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to update recurring expense"})
 		log.Printf("API ERROR: Failed to update recurring expense: %v\n", err)
 		return
 	}
-	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+	h.writeRecurringVersion(w, id)
+}
+
+// OverrideRecurringOccurrence skips or edits one occurrence of a rule; an
+// override without edits restores the occurrence
+func (h *Handler) OverrideRecurringOccurrence(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "ID parameter is required"})
+		return
+	}
+	var override storage.RecurringOverride
+	if err := json.NewDecoder(r.Body).Decode(&override); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	if err := override.Validate(); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	re, err := h.storage.GetRecurringExpense(id)
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: "Recurring expense not found"})
+		return
+	}
+	version, err := ifMatch(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	holidays, err := h.storage.GetHolidays()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get holidays"})
+		log.Printf("API ERROR: Failed to get holidays: %v\n", err)
+		return
+	}
+	if !re.Schedules(override.Occurrence, storage.NewHolidays(holidays)) {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "The recurring expense has no occurrence on that date"})
+		return
+	}
+	if err := h.storage.OverrideRecurringOccurrence(id, override, version); err != nil {
+		if writeConflict(w, err) || writeInvalid(w, err) {
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to override occurrence"})
+		log.Printf("API ERROR: Failed to override occurrence of recurring expense %s: %v\n", id, err)
+		return
+	}
+	h.writeRecurringVersion(w, id)
 }
 
 func (h *Handler) DeleteRecurringExpense(w http.ResponseWriter, r *http.Request) {
@@ -511,7 +1194,15 @@ func (h *Handler) DeleteRecurringExpense(w http.ResponseWriter, r *http.Request)
 	}
 	removeAll, _ := strconv.ParseBool(r.URL.Query().Get("removeAll"))
 
-	if err := h.storage.RemoveRecurringExpense(id, removeAll); err != nil {
+	version, err := ifMatch(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err := h.storage.RemoveRecurringExpense(id, removeAll, version); err != nil {
+		if writeConflict(w, err) {
+			return
+		}
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete recurring expense"})
 		log.Printf("API ERROR: Failed to delete recurring expense: %v\n", err)
 		return
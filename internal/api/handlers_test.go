@@ -0,0 +1,531 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+func newTestHandler(t *testing.T) *Handler {
+	t.Helper()
+	return NewHandler(storage.NewMemoryStore())
+}
+
+func money(s string) storage.Money { return storage.MustParseMoney(s) }
+
+// serve runs a handler func against an in-memory request and returns the recorder
+func serve(t *testing.T, fn http.HandlerFunc, method, target string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	var reader *bytes.Reader
+	switch b := body.(type) {
+	case nil:
+		reader = bytes.NewReader(nil)
+	case string:
+		reader = bytes.NewReader([]byte(b))
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			t.Fatalf("marshal request body: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req := httptest.NewRequest(method, target, reader)
+	rec := httptest.NewRecorder()
+	fn(rec, req)
+	return rec
+}
+
+func decodeBody[T any](t *testing.T, rec *httptest.ResponseRecorder) T {
+	t.Helper()
+	var v T
+	if err := json.NewDecoder(rec.Body).Decode(&v); err != nil {
+		t.Fatalf("decode response body %q: %v", rec.Body.String(), err)
+	}
+	return v
+}
+
+func expectStatus(t *testing.T, rec *httptest.ResponseRecorder, want int) {
+	t.Helper()
+	if rec.Code != want {
+		t.Fatalf("expected status %d, got %d: %s", want, rec.Code, rec.Body.String())
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	h := newTestHandler(t)
+	cases := []struct {
+		name   string
+		fn     http.HandlerFunc
+		method string
+	}{
+		{"GetConfig", h.GetConfig, http.MethodPost},
+		{"GetExpenses", h.GetExpenses, http.MethodPost},
+		{"AddExpense", h.AddExpense, http.MethodGet},
+		{"EditExpense", h.EditExpense, http.MethodPost},
+		{"DeleteExpense", h.DeleteExpense, http.MethodGet},
+		{"AddCategory", h.AddCategory, http.MethodGet},
+		{"UpdateCurrency", h.UpdateCurrency, http.MethodGet},
+		{"AddRecurringExpense", h.AddRecurringExpense, http.MethodPost},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			expectStatus(t, serve(t, c.fn, c.method, "/", nil), http.StatusMethodNotAllowed)
+		})
+	}
+}
+
+func TestExpenseHandlers(t *testing.T) {
+	h := newTestHandler(t)
+
+	expectStatus(t, serve(t, h.AddExpense, http.MethodPut, "/expense", "{not json"), http.StatusBadRequest)
+	expectStatus(t, serve(t, h.AddExpense, http.MethodPut, "/expense", storage.Expense{Name: "No amount", Category: "Food", Date: time.Now()}), http.StatusBadRequest)
+
+	rec := serve(t, h.AddExpense, http.MethodPut, "/expense", storage.Expense{
+		Name:     "Coffee",
+		Category: "Food",
+		Amount:   money("-3.5"),
+		Date:     time.Now(),
+		Tags:     []string{" morning "},
+	})
+	expectStatus(t, rec, http.StatusOK)
+	added := decodeBody[storage.Expense](t, rec)
+	if added.Currency != "usd" {
+		t.Fatalf("expected default currency usd, got %q", added.Currency)
+	}
+
+	rec = serve(t, h.GetExpenses, http.MethodGet, "/expenses", nil)
+	expectStatus(t, rec, http.StatusOK)
+	expenses := decodeBody[[]storage.Expense](t, rec)
+	if len(expenses) != 1 || expenses[0].Name != "Coffee" || !slices.Equal(expenses[0].Tags, []string{"morning"}) {
+		t.Fatalf("unexpected expenses: %+v", expenses)
+	}
+	id := expenses[0].ID
+
+	expectStatus(t, serve(t, h.EditExpense, http.MethodPut, "/expense/edit", expenses[0]), http.StatusBadRequest)
+	edited := expenses[0]
+	edited.Amount = money("-4")
+	expectStatus(t, serve(t, h.EditExpense, http.MethodPut, "/expense/edit?id="+id, edited), http.StatusOK)
+	expectStatus(t, serve(t, h.EditExpense, http.MethodPut, "/expense/edit?id=missing", edited), http.StatusInternalServerError)
+
+	rec = serve(t, h.GetExpenses, http.MethodGet, "/expenses", nil)
+	if expenses = decodeBody[[]storage.Expense](t, rec); !expenses[0].Amount.Equal(money("-4")) {
+		t.Fatalf("edit not applied: %+v", expenses[0])
+	}
+
+	expectStatus(t, serve(t, h.DeleteExpense, http.MethodDelete, "/expense/delete", nil), http.StatusBadRequest)
+	expectStatus(t, serve(t, h.DeleteExpense, http.MethodDelete, "/expense/delete?id="+id, nil), http.StatusOK)
+	expectStatus(t, serve(t, h.DeleteExpense, http.MethodDelete, "/expense/delete?id="+id, nil), http.StatusInternalServerError)
+}
+
+// categoryDroppingStore deletes the category of an expense right before the
+// write, as a concurrent request could between the handler checks and the store
+type categoryDroppingStore struct {
+	storage.Storage
+}
+
+func (s categoryDroppingStore) AddExpense(expense storage.Expense) error {
+	if err := s.DeleteCategory(expense.Category, "", 0); err != nil {
+		return err
+	}
+	return s.Storage.AddExpense(expense)
+}
+
+func TestStorageValidationErrors(t *testing.T) {
+	h := NewHandler(categoryDroppingStore{storage.NewMemoryStore()})
+	expectStatus(t, serve(t, h.AddCategory, http.MethodPost, "/categories/add", map[string]string{"name": "Pets"}), http.StatusOK)
+	rec := serve(t, h.AddExpense, http.MethodPut, "/expense", storage.Expense{Name: "Food", Category: "Pets", Amount: money("-3"), Date: time.Now()})
+	expectStatus(t, rec, http.StatusBadRequest)
+	if body := decodeBody[ErrorResponse](t, rec); body.Error != "category Pets not found" {
+		t.Fatalf("expected the storage error in the response, got %q", body.Error)
+	}
+
+	// the handler leaves the accounts of an exchange to the store
+	exchange := storage.CurrencyExchange{FromCurrency: "ars", FromAmount: money("1000"), ToCurrency: "usd", ToAmount: money("1"), Date: time.Now(), FromAccountID: "missing"}
+	expectStatus(t, serve(t, h.AddCurrencyExchange, http.MethodPut, "/currency-exchange", exchange), http.StatusBadRequest)
+}
+
+func TestExactAmounts(t *testing.T) {
+	h := newTestHandler(t)
+	body := `{"name": "Car", "category": "Travel", "amount": "-123456789.99", "currency": "ars", "date": "2024-05-01T00:00:00Z"}`
+	rec := serve(t, h.AddExpense, http.MethodPut, "/expense", body)
+	expectStatus(t, rec, http.StatusOK)
+	if !strings.Contains(rec.Body.String(), `"amount":-123456789.99,`) {
+		t.Fatalf("expected the amount echoed exactly, got %s", rec.Body.String())
+	}
+	for _, amount := range []string{"-1.005", "1e3", `"ten"`} {
+		body := `{"name": "Bad", "category": "Food", "amount": ` + amount + `, "currency": "usd", "date": "2024-05-01T00:00:00Z"}`
+		expectStatus(t, serve(t, h.AddExpense, http.MethodPut, "/expense", body), http.StatusBadRequest)
+	}
+	expenses := decodeBody[[]storage.Expense](t, serve(t, h.GetExpenses, http.MethodGet, "/expenses?maxAmount=-123456789.99", nil))
+	if len(expenses) != 1 || expenses[0].Amount != storage.NewMoney(-12345678999, 2) {
+		t.Fatalf("expected the car at its exact bound, got %+v", expenses)
+	}
+	if expenses = decodeBody[[]storage.Expense](t, serve(t, h.GetExpenses, http.MethodGet, "/expenses?maxAmount=-123456790", nil)); len(expenses) != 0 {
+		t.Fatalf("expected nothing below the bound, got %+v", expenses)
+	}
+}
+
+func TestGetExpensesFilters(t *testing.T) {
+	h := newTestHandler(t)
+	day := time.Date(2024, 3, 15, 10, 0, 0, 0, time.UTC)
+	for _, e := range []storage.Expense{
+		{Name: "Groceries", Category: "Food", Amount: money("-30"), Date: day, Tags: []string{"home"}},
+		{Name: "Taxi", Category: "Travel", Amount: money("-12"), Currency: "ars", Date: day.AddDate(0, 0, 1)},
+		{Name: "Salary", Category: "Income", Amount: money("1000"), Date: day.AddDate(0, 1, 0)},
+	} {
+		expectStatus(t, serve(t, h.AddExpense, http.MethodPut, "/expense", e), http.StatusOK)
+	}
+
+	cases := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"Salary", "Taxi", "Groceries"}},
+		{"?from=2024-03-01&to=2024-03-15", []string{"Groceries"}},
+		{"?from=2024-03-16", []string{"Salary", "Taxi"}},
+		{"?category=Food&category=Travel", []string{"Taxi", "Groceries"}},
+		{"?tag=+home+", []string{"Groceries"}},
+		{"?currency=ARS", []string{"Taxi"}},
+		{"?minAmount=-20&maxAmount=0", []string{"Taxi"}},
+		{"?name=sal", []string{"Salary"}},
+		{"?recurring=true", nil},
+	}
+	for _, c := range cases {
+		t.Run(c.query, func(t *testing.T) {
+			rec := serve(t, h.GetExpenses, http.MethodGet, "/expenses"+c.query, nil)
+			expectStatus(t, rec, http.StatusOK)
+			var names []string
+			for _, e := range decodeBody[[]storage.Expense](t, rec) {
+				names = append(names, e.Name)
+			}
+			if !slices.Equal(names, c.want) {
+				t.Fatalf("got %v, want %v", names, c.want)
+			}
+		})
+	}
+
+	for _, query := range []string{"?from=yesterday", "?from=2024-03-10&to=2024-03-01", "?minAmount=ten", "?recurring=maybe"} {
+		expectStatus(t, serve(t, h.GetExpenses, http.MethodGet, "/expenses"+query, nil), http.StatusBadRequest)
+	}
+}
+
+func TestGetExpensesPaginationAndStreaming(t *testing.T) {
+	h := newTestHandler(t)
+	day := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	for i := range 5 {
+		e := storage.Expense{Name: fmt.Sprintf("Item %d", i), Category: "Food", Amount: money("-1"), Date: day.AddDate(0, 0, i)}
+		expectStatus(t, serve(t, h.AddExpense, http.MethodPut, "/expense", e), http.StatusOK)
+	}
+
+	var names []string
+	target := "/expenses?limit=2"
+	for pages := 1; ; pages++ {
+		rec := serve(t, h.GetExpenses, http.MethodGet, target, nil)
+		expectStatus(t, rec, http.StatusOK)
+		page := decodeBody[ExpensePageResponse](t, rec)
+		for _, e := range page.Expenses {
+			names = append(names, e.Name)
+		}
+		if page.NextCursor == "" {
+			if pages != 3 {
+				t.Fatalf("expected 3 pages, got %d", pages)
+			}
+			break
+		}
+		target = "/expenses?limit=2&cursor=" + url.QueryEscape(page.NextCursor)
+	}
+	want := []string{"Item 4", "Item 3", "Item 2", "Item 1", "Item 0"}
+	if !slices.Equal(names, want) {
+		t.Fatalf("got %v, want %v", names, want)
+	}
+
+	// filters apply to pages too, and an empty page is still an array
+	rec := serve(t, h.GetExpenses, http.MethodGet, "/expenses?limit=10&category=Travel", nil)
+	if body := strings.TrimSpace(rec.Body.String()); body != `{"expenses":[]}` {
+		t.Fatalf("unexpected empty page %s", body)
+	}
+
+	rec = serve(t, h.GetExpenses, http.MethodGet, "/expenses?stream=true&from=2024-03-03", nil)
+	expectStatus(t, rec, http.StatusOK)
+	if ct := rec.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+	lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 streamed lines, got %d: %s", len(lines), rec.Body.String())
+	}
+	var first storage.Expense
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil || first.Name != "Item 4" {
+		t.Fatalf("unexpected first streamed line %q: %v", lines[0], err)
+	}
+
+	for _, query := range []string{"?limit=0", "?limit=5000", "?limit=abc", "?cursor=not-a-cursor"} {
+		expectStatus(t, serve(t, h.GetExpenses, http.MethodGet, "/expenses"+query, nil), http.StatusBadRequest)
+	}
+}
+
+func TestDeleteMultipleExpenses(t *testing.T) {
+	h := newTestHandler(t)
+	for _, name := range []string{"One", "Two", "Three"} {
+		expectStatus(t, serve(t, h.AddExpense, http.MethodPut, "/expense", storage.Expense{Name: name, Category: "Food", Amount: money("-1"), Date: time.Now()}), http.StatusOK)
+	}
+	expenses := decodeBody[[]storage.Expense](t, serve(t, h.GetExpenses, http.MethodGet, "/expenses", nil))
+	payload := map[string][]string{"ids": {expenses[0].ID, expenses[1].ID}}
+	expectStatus(t, serve(t, h.DeleteMultipleExpenses, http.MethodDelete, "/expenses/delete", payload), http.StatusOK)
+	expenses = decodeBody[[]storage.Expense](t, serve(t, h.GetExpenses, http.MethodGet, "/expenses", nil))
+	if len(expenses) != 1 {
+		t.Fatalf("expected 1 expense left, got %d", len(expenses))
+	}
+}
+
+func TestCategoryHandlers(t *testing.T) {
+	h := newTestHandler(t)
+
+	rec := serve(t, h.AddCategory, http.MethodPost, "/categories/add", map[string]string{"name": "Pets", "color": "#AABBCC", "icon": "paw"})
+	expectStatus(t, rec, http.StatusOK)
+	want := storage.Category{Name: "Pets", Color: "#aabbcc", Icon: "paw", Type: storage.CategoryTypeExpense}
+	if categories := decodeBody[[]storage.Category](t, rec); categories[len(categories)-1] != want {
+		t.Fatalf("expected %+v appended, got %v", want, categories)
+	}
+	expectStatus(t, serve(t, h.AddCategory, http.MethodPost, "/categories/add", map[string]string{"name": "pets"}), http.StatusConflict)
+	expectStatus(t, serve(t, h.AddCategory, http.MethodPost, "/categories/add", map[string]string{"name": "@@"}), http.StatusBadRequest)
+	expectStatus(t, serve(t, h.AddCategory, http.MethodPost, "/categories/add", map[string]string{"name": "Fish", "color": "red"}), http.StatusBadRequest)
+	expectStatus(t, serve(t, h.AddCategory, http.MethodPost, "/categories/add", map[string]string{"name": "Fish", "type": "gift"}), http.StatusBadRequest)
+
+	expectStatus(t, serve(t, h.UpdateCategory, http.MethodPut, "/categories/update", map[string]any{"name": "Nope"}), http.StatusNotFound)
+	rec = serve(t, h.UpdateCategory, http.MethodPut, "/categories/update", map[string]any{"name": "pets", "type": "both", "archived": true})
+	expectStatus(t, rec, http.StatusOK)
+	want = storage.Category{Name: "Pets", Type: storage.CategoryTypeBoth, Archived: true}
+	if categories := decodeBody[[]storage.Category](t, rec); !slices.Contains(categories, want) {
+		t.Fatalf("expected %+v after update, got %v", want, categories)
+	}
+
+	expectStatus(t, serve(t, h.RenameCategory, http.MethodPut, "/categories/rename", map[string]string{"from": "Pets", "to": "Food"}), http.StatusConflict)
+	expectStatus(t, serve(t, h.RenameCategory, http.MethodPut, "/categories/rename", map[string]string{"from": "Nope", "to": "Other"}), http.StatusNotFound)
+	rec = serve(t, h.RenameCategory, http.MethodPut, "/categories/rename", map[string]string{"from": "Pets", "to": "Animals"})
+	expectStatus(t, rec, http.StatusOK)
+	want.Name = "Animals"
+	if categories := decodeBody[[]storage.Category](t, rec); !slices.Contains(categories, want) {
+		t.Fatalf("rename did not keep the metadata: %v", categories)
+	}
+	// a case-only rename is still a rename
+	rec = serve(t, h.RenameCategory, http.MethodPut, "/categories/rename", map[string]string{"from": "animals", "to": "ANIMALS"})
+	expectStatus(t, rec, http.StatusOK)
+	want.Name = "ANIMALS"
+	if categories := decodeBody[[]storage.Category](t, rec); !slices.Contains(categories, want) || findCategoryIndex(categories, "Animals") != slices.Index(categories, want) {
+		t.Fatalf("expected the category renamed to ANIMALS, got %v", categories)
+	}
+
+	expectStatus(t, serve(t, h.DeleteCategory, http.MethodDelete, "/categories/delete", map[string]string{"name": "Nope"}), http.StatusNotFound)
+	rec = serve(t, h.DeleteCategory, http.MethodDelete, "/categories/delete", map[string]string{"name": "ANIMALS"})
+	expectStatus(t, rec, http.StatusOK)
+	if categories := decodeBody[[]storage.Category](t, rec); findCategoryIndex(categories, "ANIMALS") != -1 {
+		t.Fatalf("delete not applied: %v", categories)
+	}
+
+	// bare names are still accepted when replacing the whole list
+	expectStatus(t, serve(t, h.UpdateCategories, http.MethodPut, "/categories/edit", []string{}), http.StatusBadRequest)
+	expectStatus(t, serve(t, h.UpdateCategories, http.MethodPut, "/categories/edit", []any{"B", map[string]any{"name": "A", "type": "income"}}), http.StatusOK)
+	rec = serve(t, h.GetCategories, http.MethodGet, "/categories", nil)
+	wantList := []storage.Category{{Name: "B", Type: storage.CategoryTypeExpense}, {Name: "A", Type: storage.CategoryTypeIncome}}
+	if categories := decodeBody[[]storage.Category](t, rec); !slices.Equal(categories, wantList) {
+		t.Fatalf("unexpected categories: %v", categories)
+	}
+	expectStatus(t, serve(t, h.UpdateCategory, http.MethodPut, "/categories/update", map[string]any{"name": "A", "archived": true}), http.StatusOK)
+	expectStatus(t, serve(t, h.UpdateCategory, http.MethodPut, "/categories/update", map[string]any{"name": "B", "archived": true}), http.StatusBadRequest)
+	expectStatus(t, serve(t, h.DeleteCategory, http.MethodDelete, "/categories/delete", map[string]string{"name": "B"}), http.StatusBadRequest)
+	expectStatus(t, serve(t, h.DeleteCategory, http.MethodDelete, "/categories/delete", map[string]string{"name": "A"}), http.StatusOK)
+}
+
+func TestCategoryTreeHandlers(t *testing.T) {
+	h := newTestHandler(t)
+
+	expectStatus(t, serve(t, h.AddCategory, http.MethodPost, "/categories/add", map[string]string{"name": "Sushi", "parent": "Nope"}), http.StatusBadRequest)
+	expectStatus(t, serve(t, h.AddCategory, http.MethodPost, "/categories/add", map[string]string{"name": "Restaurants", "parent": "food"}), http.StatusOK)
+	expectStatus(t, serve(t, h.AddCategory, http.MethodPost, "/categories/add", map[string]string{"name": "Sushi", "parent": "Restaurants"}), http.StatusOK)
+	expectStatus(t, serve(t, h.AddCategory, http.MethodPost, "/categories/add", map[string]string{"name": "Delivery"}), http.StatusOK)
+
+	expectStatus(t, serve(t, h.MoveCategory, http.MethodPut, "/categories/move", map[string]string{"name": "Food", "parent": "Sushi"}), http.StatusBadRequest)
+	expectStatus(t, serve(t, h.MoveCategory, http.MethodPut, "/categories/move", map[string]string{"name": "Nope", "parent": "Food"}), http.StatusNotFound)
+	rec := serve(t, h.MoveCategory, http.MethodPut, "/categories/move", map[string]string{"name": "Delivery", "parent": "Food"})
+	expectStatus(t, rec, http.StatusOK)
+	categories := decodeBody[[]storage.Category](t, rec)
+	if i := findCategoryIndex(categories, "Delivery"); i == -1 || categories[i].Parent != "Food" {
+		t.Fatalf("move not applied: %+v", categories)
+	}
+
+	day := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	for _, e := range []storage.Expense{
+		{Name: "Market", Category: "Food", Amount: money("-10"), Date: day},
+		{Name: "Nigiri", Category: "Sushi", Amount: money("-30"), Date: day},
+		{Name: "Pizza", Category: "Delivery", Amount: money("-12"), Date: day},
+		{Name: "Old pizza", Category: "Delivery", Amount: money("-99"), Date: day.AddDate(-1, 0, 0)},
+	} {
+		expectStatus(t, serve(t, h.AddExpense, http.MethodPut, "/expense", e), http.StatusOK)
+	}
+	rec = serve(t, h.GetCategoryTotals, http.MethodGet, "/categories/totals?from=2024-06-01", nil)
+	expectStatus(t, rec, http.StatusOK)
+	totals := map[string]storage.CategoryTotal{}
+	for _, total := range decodeBody[[]storage.CategoryTotal](t, rec) {
+		totals[total.Category] = total
+	}
+	if food := totals["Food"]; !food.Total["usd"].Equal(money("-52")) || !food.Own["usd"].Equal(money("-10")) || food.TotalCount != 3 {
+		t.Fatalf("unexpected Food totals: %+v", food)
+	}
+	if restaurants := totals["Restaurants"]; !restaurants.Total["usd"].Equal(money("-30")) || restaurants.Parent != "Food" {
+		t.Fatalf("unexpected Restaurants totals: %+v", restaurants)
+	}
+	expectStatus(t, serve(t, h.GetCategoryTotals, http.MethodGet, "/categories/totals?from=bad", nil), http.StatusBadRequest)
+
+	// renaming a parent keeps its children; deleting it lifts them one level
+	expectStatus(t, serve(t, h.RenameCategory, http.MethodPut, "/categories/rename", map[string]string{"from": "Restaurants", "to": "Eating out"}), http.StatusOK)
+	rec = serve(t, h.DeleteCategory, http.MethodDelete, "/categories/delete", map[string]string{"name": "Eating out"})
+	expectStatus(t, rec, http.StatusOK)
+	categories = decodeBody[[]storage.Category](t, rec)
+	if i := findCategoryIndex(categories, "Sushi"); i == -1 || categories[i].Parent != "Food" {
+		t.Fatalf("expected Sushi under Food after deleting its parent: %+v", categories)
+	}
+
+	cycle := []map[string]string{{"name": "A", "parent": "B"}, {"name": "B", "parent": "A"}}
+	expectStatus(t, serve(t, h.UpdateCategories, http.MethodPut, "/categories/edit", cycle), http.StatusBadRequest)
+}
+
+func TestCategoryCascadeHandlers(t *testing.T) {
+	h := newTestHandler(t)
+	day := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	expectStatus(t, serve(t, h.AddExpense, http.MethodPut, "/expense", storage.Expense{Name: "Mate", Category: "Yerba", Amount: money("-5"), Date: day}), http.StatusBadRequest)
+	rec := serve(t, h.AddExpense, http.MethodPut, "/expense", storage.Expense{Name: "Market", Category: "food", Amount: money("-10"), Date: day})
+	expectStatus(t, rec, http.StatusOK)
+	if expense := decodeBody[storage.Expense](t, rec); expense.Category != "Food" {
+		t.Fatalf("expected the stored spelling of the category, got %q", expense.Category)
+	}
+	rule := storage.RecurringExpense{Name: "Box", Category: "Food", Amount: money("-20"), Currency: "usd", StartDate: day, Interval: "monthly", Occurrences: 2}
+	expectStatus(t, serve(t, h.AddRecurringExpense, http.MethodPut, "/recurring-expense", storage.RecurringExpense{Name: "Box", Category: "Yerba", Amount: money("-20"), Currency: "usd",
+		StartDate: day, Interval: "monthly", Occurrences: 2}), http.StatusBadRequest)
+	expectStatus(t, serve(t, h.AddRecurringExpense, http.MethodPut, "/recurring-expense", rule), http.StatusCreated)
+
+	// a rename reaches every expense and rule
+	expectStatus(t, serve(t, h.RenameCategory, http.MethodPut, "/categories/rename", map[string]string{"from": "Food", "to": "Comida"}), http.StatusOK)
+	expenses, _ := h.storage.GetAllExpenses()
+	for _, e := range expenses {
+		if e.Category != "Comida" {
+			t.Fatalf("expense %s kept category %q after rename", e.Name, e.Category)
+		}
+	}
+	rules, _ := h.storage.GetRecurringExpenses()
+	if len(rules) != 1 || rules[0].Category != "Comida" {
+		t.Fatalf("rule not renamed: %+v", rules)
+	}
+
+	// categories in use cannot be dropped without a target
+	expectStatus(t, serve(t, h.DeleteCategory, http.MethodDelete, "/categories/delete", map[string]string{"name": "Comida"}), http.StatusConflict)
+	expectStatus(t, serve(t, h.DeleteCategory, http.MethodDelete, "/categories/delete", map[string]string{"name": "Comida", "reassignTo": "Nope"}), http.StatusBadRequest)
+	expectStatus(t, serve(t, h.DeleteCategory, http.MethodDelete, "/categories/delete", map[string]string{"name": "Comida", "reassignTo": "comida"}), http.StatusBadRequest)
+	expectStatus(t, serve(t, h.UpdateCategories, http.MethodPut, "/categories/edit", []string{"Groceries", "Travel"}), http.StatusConflict)
+	rec = serve(t, h.DeleteCategory, http.MethodDelete, "/categories/delete", map[string]string{"name": "Comida", "reassignTo": "groceries"})
+	expectStatus(t, rec, http.StatusOK)
+	if categories := decodeBody[[]storage.Category](t, rec); findCategoryIndex(categories, "Comida") != -1 {
+		t.Fatalf("category not deleted: %+v", categories)
+	}
+	expenses, _ = h.storage.GetAllExpenses()
+	for _, e := range expenses {
+		if e.Category != "Groceries" {
+			t.Fatalf("expense %s not reassigned: %q", e.Name, e.Category)
+		}
+	}
+	expectStatus(t, serve(t, h.UpdateCategories, http.MethodPut, "/categories/edit", []string{"Groceries", "Travel"}), http.StatusOK)
+}
+
+func TestConfigHandlers(t *testing.T) {
+	h := newTestHandler(t)
+
+	expectStatus(t, serve(t, h.UpdateCurrency, http.MethodPut, "/currency/edit", `"xyz"`), http.StatusBadRequest)
+	expectStatus(t, serve(t, h.UpdateCurrency, http.MethodPut, "/currency/edit", `"ars"`), http.StatusOK)
+	if currency := decodeBody[string](t, serve(t, h.GetCurrency, http.MethodGet, "/currency", nil)); currency != "ars" {
+		t.Fatalf("expected ars, got %s", currency)
+	}
+
+	expectStatus(t, serve(t, h.UpdateStartDate, http.MethodPut, "/startdate/edit", `40`), http.StatusInternalServerError)
+	expectStatus(t, serve(t, h.UpdateStartDate, http.MethodPut, "/startdate/edit", `10`), http.StatusOK)
+	if startDate := decodeBody[int](t, serve(t, h.GetStartDate, http.MethodGet, "/startdate", nil)); startDate != 10 {
+		t.Fatalf("expected 10, got %d", startDate)
+	}
+
+	config := decodeBody[storage.Config](t, serve(t, h.GetConfig, http.MethodGet, "/config", nil))
+	if config.Currency != "ars" || config.StartDate != 10 || len(config.Categories) == 0 {
+		t.Fatalf("unexpected config: %+v", config)
+	}
+}
+
+func TestRecurringExpenseHandlers(t *testing.T) {
+	h := newTestHandler(t)
+	rule := storage.RecurringExpense{
+		Name:        "Gym",
+		Amount:      money("-30"),
+		Category:    "Healthcare",
+		StartDate:   time.Now().AddDate(0, -1, 0),
+		Interval:    "monthly",
+		Occurrences: 3,
+	}
+	invalid := rule
+	invalid.Interval = "hourly"
+	expectStatus(t, serve(t, h.AddRecurringExpense, http.MethodPut, "/recurring-expense", invalid), http.StatusBadRequest)
+	expectStatus(t, serve(t, h.AddRecurringExpense, http.MethodPut, "/recurring-expense", rule), http.StatusCreated)
+
+	rules := decodeBody[[]storage.RecurringExpense](t, serve(t, h.GetRecurringExpenses, http.MethodGet, "/recurring-expenses", nil))
+	if len(rules) != 1 {
+		t.Fatalf("expected 1 rule, got %d", len(rules))
+	}
+	expenses := decodeBody[[]storage.Expense](t, serve(t, h.GetExpenses, http.MethodGet, "/expenses", nil))
+	if len(expenses) != 3 {
+		t.Fatalf("expected 3 generated expenses, got %d", len(expenses))
+	}
+
+	rule.Amount = money("-35")
+	expectStatus(t, serve(t, h.UpdateRecurringExpense, http.MethodPut, "/recurring-expense/edit?updateAll=true", rule), http.StatusBadRequest)
+	expectStatus(t, serve(t, h.UpdateRecurringExpense, http.MethodPut, "/recurring-expense/edit?id="+rules[0].ID+"&updateAll=true", rule), http.StatusOK)
+	expenses = decodeBody[[]storage.Expense](t, serve(t, h.GetExpenses, http.MethodGet, "/expenses", nil))
+	for _, e := range expenses {
+		if !e.Amount.Equal(money("-35")) {
+			t.Fatalf("expected updated amount on every instance, got %v", e.Amount)
+		}
+	}
+
+	// skipping an occurrence drops its expense, and an empty override brings it back
+	occurrence := *expenses[0].Occurrence
+	target := "/recurring-expense/occurrence?id=" + rules[0].ID
+	expectStatus(t, serve(t, h.OverrideRecurringOccurrence, http.MethodPut, "/recurring-expense/occurrence?id=missing", storage.RecurringOverride{Occurrence: occurrence, Skip: true}), http.StatusNotFound)
+	expectStatus(t, serve(t, h.OverrideRecurringOccurrence, http.MethodPut, target, storage.RecurringOverride{Occurrence: occurrence.Add(time.Hour), Skip: true}), http.StatusBadRequest)
+	expectStatus(t, serve(t, h.OverrideRecurringOccurrence, http.MethodPut, target, storage.RecurringOverride{Occurrence: occurrence, Skip: true}), http.StatusOK)
+	if expenses = decodeBody[[]storage.Expense](t, serve(t, h.GetExpenses, http.MethodGet, "/expenses", nil)); len(expenses) != 2 {
+		t.Fatalf("expected the skipped occurrence gone, got %d expenses", len(expenses))
+	}
+	amount := money("-40")
+	expectStatus(t, serve(t, h.OverrideRecurringOccurrence, http.MethodPut, target, storage.RecurringOverride{Occurrence: occurrence, Amount: &amount}), http.StatusOK)
+	expenses = decodeBody[[]storage.Expense](t, serve(t, h.GetExpenses, http.MethodGet, "/expenses", nil))
+	if len(expenses) != 3 || !expenses[0].Amount.Equal(amount) || !expenses[1].Amount.Equal(money("-35")) {
+		t.Fatalf("expected only the overridden occurrence at -40, got %+v", expenses)
+	}
+	// the occurrences themselves only change through overrides
+	direct := expenses[1]
+	direct.Name = "Changed"
+	expectStatus(t, serve(t, h.EditExpense, http.MethodPut, "/expense/edit?id="+direct.ID, direct), http.StatusBadRequest)
+	expectStatus(t, serve(t, h.DeleteExpense, http.MethodDelete, "/expense/delete?id="+direct.ID, nil), http.StatusBadRequest)
+
+	expectStatus(t, serve(t, h.DeleteRecurringExpense, http.MethodDelete, "/recurring-expense/delete?id="+rules[0].ID+"&removeAll=true", nil), http.StatusOK)
+	expenses = decodeBody[[]storage.Expense](t, serve(t, h.GetExpenses, http.MethodGet, "/expenses", nil))
+	if len(expenses) != 0 {
+		t.Fatalf("expected removeAll to delete instances, %d left", len(expenses))
+	}
+	expectStatus(t, serve(t, h.DeleteRecurringExpense, http.MethodDelete, "/recurring-expense/delete?id="+rules[0].ID, nil), http.StatusInternalServerError)
+}
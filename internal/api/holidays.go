@@ -0,0 +1,202 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+// ------------------------------------------------------------
+// Holiday Handlers
+// ------------------------------------------------------------
+
+// holidayColumns maps the headers of a holiday CSV, the spanish ones of the
+// published lists of feriados included, to date and name
+var holidayColumns = map[string]string{
+	"date":   "date",
+	"fecha":  "date",
+	"name":   "name",
+	"nombre": "name",
+	"motivo": "name",
+}
+
+type holidayKey struct {
+	Date string `json:"date"` // 2006-01-02
+}
+
+// parseHolidayDate reads any date accepted by parseDate or a day first
+// 02/01/2006 one
+func parseHolidayDate(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if date, err := parseDate(s); err == nil {
+		return date, nil
+	}
+	date, err := time.Parse("2/1/2006", s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unable to parse date: %s", s)
+	}
+	return date, nil
+}
+
+func (h *Handler) GetHolidays(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	h.writeHolidays(w)
+}
+
+// SaveHolidays upserts a list of holidays, replacing the name already stored
+// for a date
+func (h *Handler) SaveHolidays(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	var holidays []storage.Holiday
+	if err := json.NewDecoder(r.Body).Decode(&holidays); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	for i := range holidays {
+		if err := holidays[i].Validate(); err != nil {
+			writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+	}
+	if err := h.storage.SaveHolidays(holidays); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to save holidays"})
+		log.Printf("API ERROR: Failed to save holidays: %v\n", err)
+		return
+	}
+	h.writeHolidays(w)
+}
+
+func (h *Handler) DeleteHoliday(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	var payload holidayKey
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	date, err := parseHolidayDate(payload.Date)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	holidays, err := h.storage.GetHolidays()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get holidays"})
+		log.Printf("API ERROR: Failed to get holidays: %v\n", err)
+		return
+	}
+	if _, ok := storage.NewHolidays(holidays).Name(date); !ok {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: "Holiday not found"})
+		return
+	}
+	if err := h.storage.DeleteHoliday(date); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete holiday"})
+		log.Printf("API ERROR: Failed to delete holiday: %v\n", err)
+		return
+	}
+	h.writeHolidays(w)
+}
+
+func (h *Handler) writeHolidays(w http.ResponseWriter) {
+	holidays, err := h.storage.GetHolidays()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get holidays"})
+		log.Printf("API ERROR: Failed to get holidays: %v\n", err)
+		return
+	}
+	if holidays == nil {
+		holidays = []storage.Holiday{}
+	}
+	writeJSON(w, http.StatusOK, holidays)
+}
+
+// ImportHolidaysCSV reads a CSV with a date column and an optional name one,
+// under their english or spanish headers; invalid rows are skipped
+func (h *Handler) ImportHolidaysCSV(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	if err := r.ParseMultipartForm(10 << 20); err != nil { // 10MB max file size
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Could not parse multipart form"})
+		return
+	}
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Error retrieving the file"})
+		return
+	}
+	defer file.Close()
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Failed to read CSV file"})
+		return
+	}
+	if len(records) < 2 {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "CSV file must have a header and at least one data row"})
+		return
+	}
+	colMap := make(map[string]int)
+	for i, col := range records[0] {
+		if name, ok := holidayColumns[strings.ToLower(strings.TrimSpace(col))]; ok {
+			colMap[name] = i
+		}
+	}
+	if _, ok := colMap["date"]; !ok {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Missing required column: date"})
+		return
+	}
+	nameIdx, nameExists := colMap["name"]
+
+	var holidays []storage.Holiday
+	skippedCount := 0
+	for i, record := range records[1:] {
+		if len(record) != len(records[0]) {
+			log.Printf("Warning: Skipping holiday row %d due to incorrect column count\n", i+2)
+			skippedCount++
+			continue
+		}
+		date, err := parseHolidayDate(record[colMap["date"]])
+		if err != nil {
+			log.Printf("Warning: Skipping holiday row %d due to invalid date: %v\n", i+2, err)
+			skippedCount++
+			continue
+		}
+		holiday := storage.Holiday{Date: date}
+		if nameExists {
+			holiday.Name = record[nameIdx]
+		}
+		if err := holiday.Validate(); err != nil {
+			log.Printf("Warning: Skipping holiday row %d due to validation error: %v\n", i+2, err)
+			skippedCount++
+			continue
+		}
+		holidays = append(holidays, holiday)
+	}
+	if err := h.storage.SaveHolidays(holidays); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to save holidays"})
+		log.Printf("API ERROR: Failed to save imported holidays: %v\n", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"status":          "success",
+		"total_processed": len(records) - 1,
+		"imported":        len(holidays),
+		"skipped":         skippedCount,
+	})
+	log.Printf("HTTP: Imported %d holidays from CSV file. Skipped %d records.", len(holidays), skippedCount)
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+func TestHolidayHandlers(t *testing.T) {
+	h := newTestHandler(t)
+
+	expectStatus(t, serveCSV(t, h.ImportHolidaysCSV, "/holidays/import", "name\nCarnaval\n"), http.StatusBadRequest)
+	rec := serveCSV(t, h.ImportHolidaysCSV, "/holidays/import", "Fecha,Motivo\n03/03/2025,Carnaval\n2025-03-04,Carnaval\n31/02/2025,Nada\nmañana,Nada\n")
+	expectStatus(t, rec, http.StatusOK)
+	if result := decodeBody[map[string]any](t, rec); result["imported"] != float64(2) || result["skipped"] != float64(2) {
+		t.Fatalf("expected 2 imported and 2 skipped holidays, got %v", result)
+	}
+	rec = serve(t, h.SaveHolidays, http.MethodPut, "/holidays/edit", `[{"date":"2025-04-02T00:00:00Z","name":"Malvinas"}]`)
+	expectStatus(t, rec, http.StatusOK)
+	if holidays := decodeBody[[]storage.Holiday](t, rec); len(holidays) != 3 || holidays[0].Name != "Carnaval" || holidays[2].Name != "Malvinas" {
+		t.Fatalf("unexpected holidays after saving: %+v", holidays)
+	}
+	expectStatus(t, serve(t, h.SaveHolidays, http.MethodPut, "/holidays/edit", []storage.Holiday{{Name: "Sin fecha"}}), http.StatusBadRequest)
+	expectStatus(t, serve(t, h.DeleteHoliday, http.MethodDelete, "/holidays/delete", holidayKey{Date: "2025-05-01"}), http.StatusNotFound)
+	expectStatus(t, serve(t, h.DeleteHoliday, http.MethodDelete, "/holidays/delete", holidayKey{Date: "2025-04-02"}), http.StatusOK)
+
+	// the first business day of march 2025 is past the carnival holidays
+	rule := storage.RecurringExpense{Name: "Expensas", Category: "Rent", Amount: money("-50000"), Currency: "ars",
+		StartDate: time.Date(2025, time.March, 1, 0, 0, 0, 0, time.UTC), BusinessDay: storage.BusinessDayFollowing,
+		RRule: "FREQ=MONTHLY;BYDAY=MO,TU,WE,TH,FR;BYSETPOS=1;COUNT=2"}
+	bad := rule
+	bad.RRule = "FREQ=MONTHLY;BYHOUR=9"
+	expectStatus(t, serve(t, h.AddRecurringExpense, http.MethodPut, "/recurring-expense", bad), http.StatusBadRequest)
+	rec = serve(t, h.AddRecurringExpense, http.MethodPut, "/recurring-expense", rule)
+	expectStatus(t, rec, http.StatusCreated)
+	if added := decodeBody[storage.RecurringExpense](t, rec); added.Interval != "monthly" || added.Occurrences != 2 {
+		t.Fatalf("expected the rrule to fill interval and occurrences, got %+v", added)
+	}
+	var dates []string
+	for _, e := range decodeBody[[]storage.Expense](t, serve(t, h.GetExpenses, http.MethodGet, "/expenses?recurring=true", nil)) {
+		dates = append(dates, e.Date.Format(time.DateOnly))
+	}
+	if want := []string{"2025-04-01", "2025-03-05"}; !slices.Equal(dates, want) {
+		t.Fatalf("expected instances on %v, got %v", want, dates)
+	}
+}
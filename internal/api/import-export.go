@@ -6,7 +6,6 @@ import (
 	"log"
 	"net/http"
 	"slices"
-	"strconv"
 	"strings"
 	"time"
 
@@ -25,13 +24,24 @@ func (h *Handler) ExportCSV(w http.ResponseWriter, r *http.Request) {
 		log.Printf("API ERROR: Failed to retrieve expenses for CSV export: %v\n", err)
 		return
 	}
+	accounts, err := h.storage.GetAccounts()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get accounts"})
+		log.Printf("API ERROR: Failed to get accounts for CSV export: %v\n", err)
+		return
+	}
+	accountNames := map[string]string{}
+	for _, a := range accounts {
+		accountNames[a.ID] = a.Name
+	}
 	w.Header().Set("Content-Type", "text/csv")
 	w.Header().Set("Content-Disposition", "attachment; filename=expenses.csv")
 	writer := csv.NewWriter(w)
 	defer writer.Flush()
 
 	// Write header
-	headers := []string{"ID", "Name", "Category", "Amount", "Date", "Tags"}
+	// the currency tells how many decimals the amount has; accounts go by name
+	headers := []string{"ID", "Name", "Category", "Amount", "Date", "Tags", "Currency", "Type", "Account", "To Account"}
 	if err := writer.Write(headers); err != nil {
 		log.Printf("API ERROR: Failed to write CSV header: %v\n", err)
 		return
@@ -43,10 +53,13 @@ func (h *Handler) ExportCSV(w http.ResponseWriter, r *http.Request) {
 			expense.ID,
 			expense.Name,
 			expense.Category,
-			// expense.Currency,
-			strconv.FormatFloat(expense.Amount, 'f', 2, 64),
+			expense.Amount.String(),
 			expense.Date.Format(time.RFC3339),
 			strings.Join(expense.Tags, ","),
+			expense.Currency,
+			expense.Type,
+			accountNames[expense.AccountID],
+			accountNames[expense.ToAccountID],
 		}
 		if err := writer.Write(record); err != nil {
 			log.Printf("API ERROR: Failed to write CSV record for expense ID %s: %v\n", expense.ID, err)
@@ -100,17 +113,15 @@ func (h *Handler) ImportCSV(w http.ResponseWriter, r *http.Request) {
 	idIdx, idExists := colMap["id"]
 	tagsIdx, tagsExists := colMap["tags"]
 	currencyIdx, currencyExists := colMap["currency"]
+	typeIdx, typeExists := colMap["type"]
+	accountIdx, accountExists := colMap["account"]
+	toAccountIdx, toAccountExists := colMap["to account"]
 
-	currentCategories, err := h.storage.GetCategories()
+	categories, err := h.newImportCategories()
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Could not retrieve current categories"})
 		return
 	}
-	categorySet := make(map[string]bool)
-	for _, cat := range currentCategories {
-		categorySet[strings.ToLower(cat)] = true
-	}
-	var newCategories []string
 	var importedCount, skippedCount int
 	// TODO: might be worth setting default currency when we have currency updation behavior
 	currencyVal, err := h.storage.GetCurrency()
@@ -119,6 +130,18 @@ func (h *Handler) ImportCSV(w http.ResponseWriter, r *http.Request) {
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Could not retrieve currency"})
 		return
 	}
+	enabledCurrencies, err := h.storage.GetEnabledCurrencies()
+	if err != nil {
+		log.Printf("Error: Could not retrieve enabled currencies, shutting down import: %v\n", err)
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Could not retrieve currencies"})
+		return
+	}
+	accounts, err := h.storage.GetAccounts()
+	if err != nil {
+		log.Printf("Error: Could not retrieve accounts, shutting down import: %v\n", err)
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Could not retrieve accounts"})
+		return
+	}
 
 	for i, record := range records[1:] {
 		if len(record) != len(header) {
@@ -140,16 +163,16 @@ func (h *Handler) ImportCSV(w http.ResponseWriter, r *http.Request) {
 		// Check for currency field, if provided - default is retrieved
 		localCurrency := currencyVal
 		if currencyExists {
-			currency := record[currencyIdx]
-			if !slices.Contains(storage.SupportedCurrencies, currency) {
-				log.Printf("Warning: Skipping row %d due to invalid currency: %s\n", i+2, currency)
+			currency := strings.ToLower(strings.TrimSpace(record[currencyIdx]))
+			if !slices.Contains(enabledCurrencies, currency) {
+				log.Printf("Warning: Skipping row %d due to invalid or disabled currency: %s\n", i+2, currency)
 				skippedCount++
 				continue
 			}
-			localCurrency = strings.TrimSpace(currency)
+			localCurrency = currency
 		}
 
-		amount, err := strconv.ParseFloat(record[colMap["amount"]], 64)
+		amount, err := storage.ParseMoney(record[colMap["amount"]])
 		if err != nil {
 			log.Printf("Warning: Skipping row %d due to invalid amount: %s\n", i+2, record[colMap["amount"]])
 			skippedCount++
@@ -162,10 +185,6 @@ func (h *Handler) ImportCSV(w http.ResponseWriter, r *http.Request) {
 			continue
 		}
 		category := strings.TrimSpace(record[colMap["category"]])
-		if _, ok := categorySet[strings.ToLower(category)]; !ok {
-			newCategories = append(newCategories, category)
-			categorySet[strings.ToLower(category)] = true // Add to set to handle duplicates in the same file
-		}
 		var tags []string
 		if tagsExists {
 			tagsStr := record[tagsIdx]
@@ -185,11 +204,38 @@ func (h *Handler) ImportCSV(w http.ResponseWriter, r *http.Request) {
 			Date:     date,
 			Tags:     tags,
 		}
+		if typeExists {
+			expense.Type = record[typeIdx]
+		}
+		// accounts are matched by name in the currency of the row
+		if accountExists {
+			if expense.AccountID, err = importAccount(accounts, record[accountIdx], localCurrency); err != nil {
+				log.Printf("Warning: Skipping row %d: %v\n", i+2, err)
+				skippedCount++
+				continue
+			}
+		}
+		if toAccountExists {
+			if expense.ToAccountID, err = importAccount(accounts, record[toAccountIdx], localCurrency); err != nil {
+				log.Printf("Warning: Skipping row %d: %v\n", i+2, err)
+				skippedCount++
+				continue
+			}
+		}
 		if err := expense.Validate(); err != nil {
 			log.Printf("Warning: Skipping row %d due to validation error: %v\n", i+2, err)
 			skippedCount++
 			continue
 		}
+		if expense.Type != storage.TransactionTypeTransfer {
+			resolved, err := categories.resolve(expense.Category)
+			if err != nil {
+				log.Printf("Error: Could not add category from row %d: %v\n", i+2, err)
+				skippedCount++
+				continue
+			}
+			expense.Category = resolved.Name
+		}
 		if err := h.storage.AddExpense(expense); err != nil {
 			log.Printf("Error: Could not add expense from row %d: %v\n", i+2, err)
 			skippedCount++
@@ -199,17 +245,12 @@ func (h *Handler) ImportCSV(w http.ResponseWriter, r *http.Request) {
 		time.Sleep(10 * time.Millisecond) // Throttle to reduce storage overhead
 	}
 
-	if len(newCategories) > 0 {
-		if err := h.storage.UpdateCategories(append(currentCategories, newCategories...)); err != nil {
-			log.Printf("Warning: Failed to add new categories to config: %v\n", err)
-		}
-	}
 	writeJSON(w, http.StatusOK, map[string]any{
 		"status":          "success",
 		"total_processed": len(records) - 1,
 		"imported":        importedCount,
 		"skipped":         skippedCount,
-		"new_categories":  newCategories,
+		"new_categories":  categories.added,
 	})
 	log.Printf("HTTP: Imported %d expenses from CSV file. Skipped %d records.", importedCount, skippedCount)
 }
@@ -255,16 +296,11 @@ func (h *Handler) ImportOldCSV(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	currentCategories, err := h.storage.GetCategories()
+	categories, err := h.newImportCategories()
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Could not retrieve current categories"})
 		return
 	}
-	categorySet := make(map[string]bool)
-	for _, cat := range currentCategories {
-		categorySet[strings.ToLower(cat)] = true
-	}
-	var newCategories []string
 	var importedCount, skippedCount int
 
 	for i, record := range records[1:] {
@@ -273,7 +309,7 @@ func (h *Handler) ImportOldCSV(w http.ResponseWriter, r *http.Request) {
 			skippedCount++
 			continue
 		}
-		amount, err := strconv.ParseFloat(record[colMap["amount"]], 64)
+		amount, err := storage.ParseMoney(record[colMap["amount"]])
 		if err != nil {
 			log.Printf("Warning: Skipping row %d due to invalid amount: %s\n", i+2, record[colMap["amount"]])
 			skippedCount++
@@ -285,21 +321,10 @@ func (h *Handler) ImportOldCSV(w http.ResponseWriter, r *http.Request) {
 			skippedCount++
 			continue
 		}
-		category := strings.TrimSpace(record[colMap["category"]])
-		if _, ok := categorySet[strings.ToLower(category)]; !ok {
-			newCategories = append(newCategories, category)
-			categorySet[strings.ToLower(category)] = true // Add to set to handle duplicates in the same file
-		}
-
-		// switches sign for new expenseowl
-		amountUpdated := amount
-		if category != "Income" {
-			amountUpdated = amount * -1
-		}
 		expense := storage.Expense{
 			Name:     strings.TrimSpace(record[colMap["name"]]),
-			Category: category,
-			Amount:   amountUpdated,
+			Category: strings.TrimSpace(record[colMap["category"]]),
+			Amount:   amount,
 			Date:     date,
 		}
 		if err := expense.Validate(); err != nil {
@@ -307,6 +332,18 @@ func (h *Handler) ImportOldCSV(w http.ResponseWriter, r *http.Request) {
 			skippedCount++
 			continue
 		}
+		category, err := categories.resolve(expense.Category)
+		if err != nil {
+			log.Printf("Error: Could not add category from row %d: %v\n", i+2, err)
+			skippedCount++
+			continue
+		}
+		expense.Category = category.Name
+		// old versions stored every amount as positive; only income categories keep the sign
+		if category.Type != storage.CategoryTypeIncome {
+			expense.Amount = expense.Amount.Neg()
+			expense.Type = storage.TransactionTypeExpense
+		}
 		if err := h.storage.AddExpense(expense); err != nil {
 			log.Printf("Error: Could not add expense from row %d: %v\n", i+2, err)
 			skippedCount++
@@ -316,21 +353,65 @@ func (h *Handler) ImportOldCSV(w http.ResponseWriter, r *http.Request) {
 		time.Sleep(10 * time.Millisecond)
 	}
 
-	if len(newCategories) > 0 {
-		if err := h.storage.UpdateCategories(append(currentCategories, newCategories...)); err != nil {
-			log.Printf("Warning: Failed to add new categories to config: %v\n", err)
-		}
-	}
 	writeJSON(w, http.StatusOK, map[string]any{
 		"status":          "success",
 		"total_processed": len(records) - 1,
 		"imported":        importedCount,
 		"skipped":         skippedCount,
-		"new_categories":  newCategories,
+		"new_categories":  categories.added,
 	})
 	log.Printf("HTTP: Imported %d expenses from CSV file. Skipped %d records.", importedCount, skippedCount)
 }
 
+// importCategories resolves the category names of an import against the
+// stored list; expenses can only reference stored categories, so missing
+// ones are added before the first expense that uses them
+type importCategories struct {
+	storage storage.Storage
+	list    []storage.Category
+	added   []string
+}
+
+func (h *Handler) newImportCategories() (*importCategories, error) {
+	list, err := h.storage.GetCategories()
+	if err != nil {
+		return nil, err
+	}
+	return &importCategories{storage: h.storage, list: list}, nil
+}
+
+// resolve returns the stored category matching name case-insensitively,
+// creating it with the default metadata when missing
+func (c *importCategories) resolve(name string) (storage.Category, error) {
+	for _, cat := range c.list {
+		if strings.EqualFold(cat.Name, name) {
+			return cat, nil
+		}
+	}
+	category := storage.NewCategory(name)
+	if err := c.storage.UpdateCategories(append(slices.Clone(c.list), category), 0); err != nil {
+		return storage.Category{}, err
+	}
+	c.list = append(c.list, category)
+	c.added = append(c.added, name)
+	return category, nil
+}
+
+// importAccount returns the id of the account named like name in the
+// currency, ignoring case; an empty name leaves the expense without account
+func importAccount(accounts []storage.Account, name, currency string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", nil
+	}
+	for _, a := range accounts {
+		if a.Currency == currency && strings.EqualFold(a.Name, name) {
+			return a.ID, nil
+		}
+	}
+	return "", fmt.Errorf("unknown account '%s' in %s", name, currency)
+}
+
 func parseDate(dateStr string) (time.Time, error) {
 	dateFormats := []string{
 		time.RFC3339,
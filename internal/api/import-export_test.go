@@ -0,0 +1,116 @@
+package api
+
+import (
+	"bytes"
+	"encoding/csv"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+// serveCSV posts a CSV file as the "file" field of a multipart form
+func serveCSV(t *testing.T, fn http.HandlerFunc, target, content string) *httptest.ResponseRecorder {
+	t.Helper()
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	part, err := mw.CreateFormFile("file", "expenses.csv")
+	if err != nil {
+		t.Fatalf("create form file: %v", err)
+	}
+	part.Write([]byte(content))
+	mw.Close()
+	req := httptest.NewRequest(http.MethodPost, target, &buf)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	rec := httptest.NewRecorder()
+	fn(rec, req)
+	return rec
+}
+
+func TestImportCSV(t *testing.T) {
+	h := newTestHandler(t)
+
+	expectStatus(t, serveCSV(t, h.ImportCSV, "/import/csv", "name,amount,date\nx,1,2024-01-01\n"), http.StatusBadRequest)
+
+	content := strings.Join([]string{
+		"Name,Category,Amount,Date,Tags,Currency",
+		"Salary,Income,1000,2024-01-01,\"work,monthly\",usd",
+		"Mate,Yerba,-5.5,2024-01-02,,ars",
+		"Bad amount,Food,abc,2024-01-03,,usd",
+		"Bad currency,Food,-1,2024-01-03,,xyz",
+		"Bad date,Food,-1,someday,,usd",
+	}, "\n")
+	rec := serveCSV(t, h.ImportCSV, "/import/csv", content)
+	expectStatus(t, rec, http.StatusOK)
+	result := decodeBody[map[string]any](t, rec)
+	if result["imported"].(float64) != 2 || result["skipped"].(float64) != 3 {
+		t.Fatalf("unexpected import result: %v", result)
+	}
+
+	categories := decodeBody[[]storage.Category](t, serve(t, h.GetCategories, http.MethodGet, "/categories", nil))
+	if !slices.Contains(categories, storage.Category{Name: "Yerba", Type: storage.CategoryTypeExpense}) {
+		t.Fatalf("expected new category Yerba to be added, got %v", categories)
+	}
+	expenses := decodeBody[[]storage.Expense](t, serve(t, h.GetExpenses, http.MethodGet, "/expenses", nil))
+	if len(expenses) != 2 {
+		t.Fatalf("expected 2 imported expenses, got %d", len(expenses))
+	}
+	if expenses[0].Currency != "ars" || !slices.Equal(expenses[1].Tags, []string{"work", "monthly"}) {
+		t.Fatalf("unexpected imported expenses: %+v", expenses)
+	}
+
+	// re-importing with the same IDs must skip existing rows
+	exported := serve(t, h.ExportCSV, http.MethodGet, "/export/csv", nil)
+	rec = serveCSV(t, h.ImportCSV, "/import/csv", exported.Body.String())
+	result = decodeBody[map[string]any](t, rec)
+	if result["imported"].(float64) != 0 || result["skipped"].(float64) != 2 {
+		t.Fatalf("expected existing IDs to be skipped, got %v", result)
+	}
+}
+
+func TestImportOldCSV(t *testing.T) {
+	h := newTestHandler(t)
+	// the sign follows the category type, not the category name
+	expectStatus(t, serve(t, h.AddCategory, http.MethodPost, "/categories/add", map[string]string{"name": "Bonus", "type": "income"}), http.StatusOK)
+	content := "name,category,amount,date\nPaycheck,Income,500,2024-02-01\nBread,Groceries,3,2024-02-02\nGift,Bonus,50,2024-02-03\n"
+	expectStatus(t, serveCSV(t, h.ImportOldCSV, "/import/csvold", content), http.StatusOK)
+
+	expenses := decodeBody[[]storage.Expense](t, serve(t, h.GetExpenses, http.MethodGet, "/expenses", nil))
+	amounts := map[string]string{}
+	for _, e := range expenses {
+		amounts[e.Name] = e.Amount.String()
+	}
+	if amounts["Paycheck"] != "500.00" || amounts["Bread"] != "-3.00" || amounts["Gift"] != "50.00" {
+		t.Fatalf("expected old import to flip non-income signs, got %v", amounts)
+	}
+}
+
+func TestExportCSV(t *testing.T) {
+	h := newTestHandler(t)
+	date := time.Date(2024, 3, 4, 5, 6, 7, 0, time.UTC)
+	expectStatus(t, serve(t, h.AddExpense, http.MethodPut, "/expense", storage.Expense{
+		Name: "Book", Category: "Shopping", Amount: money("-12.3"), Date: date, Tags: []string{"a", "b"},
+	}), http.StatusOK)
+
+	rec := serve(t, h.ExportCSV, http.MethodGet, "/export/csv", nil)
+	expectStatus(t, rec, http.StatusOK)
+	if ct := rec.Header().Get("Content-Type"); ct != "text/csv" {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+	records, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("parse exported csv: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected header and one row, got %d rows", len(records))
+	}
+	row := records[1]
+	if row[1] != "Book" || row[2] != "Shopping" || row[3] != "-12.30" || row[4] != date.Format(time.RFC3339) || row[5] != "a,b" || row[6] != "usd" || row[7] != "expense" {
+		t.Fatalf("unexpected exported row: %v", row)
+	}
+}
@@ -0,0 +1,210 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+// ------------------------------------------------------------
+// Installment Purchase Handlers
+// ------------------------------------------------------------
+
+// InstallmentStatus is a purchase along with how far its installments went
+type InstallmentStatus struct {
+	storage.InstallmentPurchase
+	Charged   int               `json:"charged"`   // installments dated up to now, a payoff charge included
+	Pending   int               `json:"pending"`   // installments still to come
+	Remaining storage.Money     `json:"remaining"` // left to be charged, positive
+	Schedule  []storage.Expense `json:"schedule"`  // the expenses of the purchase, oldest first
+}
+
+// InstallmentPayoff charges the installments left of a purchase at once
+type InstallmentPayoff struct {
+	Date time.Time `json:"date"` // defaults to now
+}
+
+func (h *Handler) GetInstallmentPurchases(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	h.writeInstallmentPurchases(w)
+}
+
+// AddInstallmentPurchase records a purchase on a credit card along with one
+// expense per installment
+func (h *Handler) AddInstallmentPurchase(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	var purchase storage.InstallmentPurchase
+	if err := json.NewDecoder(r.Body).Decode(&purchase); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	// the store assigns the id and settles the currency against the card
+	purchase.ID, purchase.Currency, purchase.PaidOffAt = "", "", nil
+	if err := purchase.Validate(); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	card, err := h.storage.GetAccount(purchase.AccountID)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Account not found"})
+		return
+	}
+	// scheduling a copy catches a card that is not one or a first
+	// installment before the purchase
+	preview := purchase
+	if _, err := preview.Schedule(card); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if !h.requireEnabledCurrency(w, card.Currency) {
+		return
+	}
+	var ok bool
+	if purchase.Category, ok = h.resolveCategory(w, purchase.Category); !ok {
+		return
+	}
+	if err := h.storage.AddInstallmentPurchase(purchase); err != nil {
+		if writeInvalid(w, err) {
+			return
+		}
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to save installment purchase"})
+		log.Printf("API ERROR: Failed to save installment purchase: %v\n", err)
+		return
+	}
+	h.writeInstallmentPurchases(w)
+}
+
+// PayOffInstallmentPurchase replaces the installments after the payoff date
+// with a single expense on that date
+func (h *Handler) PayOffInstallmentPurchase(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	var payoff InstallmentPayoff
+	if err := json.NewDecoder(r.Body).Decode(&payoff); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	if payoff.Date.IsZero() {
+		payoff.Date = time.Now().UTC()
+	}
+	status, ok := h.installmentStatus(w, r.URL.Query().Get("id"), payoff.Date)
+	if !ok {
+		return
+	}
+	if status.PaidOffAt != nil {
+		writeJSON(w, http.StatusConflict, ErrorResponse{Error: "Installment purchase is already paid off"})
+		return
+	}
+	if status.Pending == 0 {
+		writeJSON(w, http.StatusConflict, ErrorResponse{Error: "No installments left after the payoff date"})
+		return
+	}
+	if err := h.storage.PayOffInstallmentPurchase(status.ID, payoff.Date); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to pay off installment purchase"})
+		log.Printf("API ERROR: Failed to pay off installment purchase %s: %v\n", status.ID, err)
+		return
+	}
+	h.writeInstallmentPurchases(w)
+}
+
+// DeleteInstallmentPurchase removes a purchase and all its installments for good
+func (h *Handler) DeleteInstallmentPurchase(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "ID parameter is required"})
+		return
+	}
+	if _, err := h.storage.GetInstallmentPurchase(id); err != nil {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: "Installment purchase not found"})
+		return
+	}
+	if err := h.storage.RemoveInstallmentPurchase(id); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete installment purchase"})
+		log.Printf("API ERROR: Failed to delete installment purchase: %v\n", err)
+		return
+	}
+	h.writeInstallmentPurchases(w)
+}
+
+// installmentStatus loads a purchase and counts its installments up to now;
+// it writes a 404 for a missing purchase
+func (h *Handler) installmentStatus(w http.ResponseWriter, id string, now time.Time) (InstallmentStatus, bool) {
+	if id == "" {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "ID parameter is required"})
+		return InstallmentStatus{}, false
+	}
+	purchase, err := h.storage.GetInstallmentPurchase(id)
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: "Installment purchase not found"})
+		return InstallmentStatus{}, false
+	}
+	status, err := h.statusOf(purchase, now)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve installments"})
+		log.Printf("API ERROR: Failed to retrieve installments of purchase %s: %v\n", id, err)
+		return InstallmentStatus{}, false
+	}
+	return status, true
+}
+
+func (h *Handler) statusOf(purchase storage.InstallmentPurchase, now time.Time) (InstallmentStatus, error) {
+	expenses, err := h.storage.QueryExpenses(storage.ExpenseFilter{Installment: purchase.ID})
+	if err != nil {
+		return InstallmentStatus{}, err
+	}
+	status := InstallmentStatus{
+		InstallmentPurchase: purchase,
+		Remaining:           storage.Money{Scale: storage.CurrencyDecimals(purchase.Currency)},
+		Schedule:            make([]storage.Expense, 0, len(expenses)),
+	}
+	// expenses come newest first
+	for i := len(expenses) - 1; i >= 0; i-- {
+		e := expenses[i]
+		status.Schedule = append(status.Schedule, e)
+		if e.Date.After(now) {
+			status.Pending++
+			if status.Remaining, err = status.Remaining.Add(e.Amount.Neg()); err != nil {
+				return InstallmentStatus{}, err
+			}
+		} else {
+			status.Charged++
+		}
+	}
+	return status, nil
+}
+
+func (h *Handler) writeInstallmentPurchases(w http.ResponseWriter) {
+	purchases, err := h.storage.GetInstallmentPurchases()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get installment purchases"})
+		log.Printf("API ERROR: Failed to get installment purchases: %v\n", err)
+		return
+	}
+	now := time.Now()
+	statuses := make([]InstallmentStatus, 0, len(purchases))
+	for _, purchase := range purchases {
+		status, err := h.statusOf(purchase, now)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve installments"})
+			log.Printf("API ERROR: Failed to retrieve installments of purchase %s: %v\n", purchase.ID, err)
+			return
+		}
+		statuses = append(statuses, status)
+	}
+	writeJSON(w, http.StatusOK, statuses)
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+func TestInstallmentHandlers(t *testing.T) {
+	h := newTestHandler(t)
+	var visa, bank storage.Account
+	for _, a := range []storage.Account{
+		{Name: "Visa", Type: storage.AccountTypeCreditCard, Currency: "ars"},
+		{Name: "Banco", Type: storage.AccountTypeBank, Currency: "ars"},
+	} {
+		rec := serve(t, h.AddAccount, http.MethodPut, "/account", a)
+		expectStatus(t, rec, http.StatusOK)
+		for _, b := range decodeBody[[]storage.AccountBalance](t, rec) {
+			switch b.Name {
+			case "Visa":
+				visa = b.Account
+			case "Banco":
+				bank = b.Account
+			}
+		}
+	}
+
+	// without a cycle the installments fall on the day of the purchase, so
+	// one bought twenty days ago has its first one charged
+	purchase := storage.InstallmentPurchase{
+		Name:         "Heladera",
+		Category:     "shopping",
+		AccountID:    visa.ID,
+		Total:        money("1000"),
+		Interest:     money("200"),
+		Installments: 3,
+		Date:         time.Now().UTC().AddDate(0, 0, -20),
+	}
+	bad := purchase
+	bad.AccountID = bank.ID
+	expectStatus(t, serve(t, h.AddInstallmentPurchase, http.MethodPut, "/installment", bad), http.StatusBadRequest)
+	bad = purchase
+	bad.Category = "Unknown"
+	expectStatus(t, serve(t, h.AddInstallmentPurchase, http.MethodPut, "/installment", bad), http.StatusBadRequest)
+	bad = purchase
+	bad.FirstMonth = purchase.Date.AddDate(0, -2, 0)
+	expectStatus(t, serve(t, h.AddInstallmentPurchase, http.MethodPut, "/installment", bad), http.StatusBadRequest)
+
+	rec := serve(t, h.AddInstallmentPurchase, http.MethodPut, "/installment", purchase)
+	expectStatus(t, rec, http.StatusOK)
+	statuses := decodeBody[[]InstallmentStatus](t, rec)
+	if len(statuses) != 1 {
+		t.Fatalf("expected one purchase, got %+v", statuses)
+	}
+	status := statuses[0]
+	if status.Category != "Shopping" || status.Currency != "ars" || len(status.Schedule) != 3 {
+		t.Fatalf("unexpected purchase: %+v", status)
+	}
+	if status.Charged != 1 || status.Pending != 2 || status.Remaining.String() != "800.00" {
+		t.Fatalf("expected two installments of 400 pending, got %+v", status)
+	}
+
+	// installments only change through the purchase
+	installment := status.Schedule[0]
+	installment.Name = "Edited"
+	expectStatus(t, serve(t, h.EditExpense, http.MethodPut, "/expense/edit?id="+installment.ID, installment), http.StatusBadRequest)
+	expectStatus(t, serve(t, h.DeleteExpense, http.MethodDelete, "/expense/delete?id="+installment.ID, nil), http.StatusBadRequest)
+	filtered := decodeBody[[]storage.Expense](t, serve(t, h.GetExpenses, http.MethodGet, "/expenses?installment="+status.ID, nil))
+	if len(filtered) != 3 {
+		t.Fatalf("expected the installments filtered, got %+v", filtered)
+	}
+
+	expectStatus(t, serve(t, h.PayOffInstallmentPurchase, http.MethodPut, "/installment/payoff?id=missing", InstallmentPayoff{}), http.StatusNotFound)
+	rec = serve(t, h.PayOffInstallmentPurchase, http.MethodPut, "/installment/payoff?id="+status.ID, InstallmentPayoff{})
+	expectStatus(t, rec, http.StatusOK)
+	status = decodeBody[[]InstallmentStatus](t, rec)[0]
+	if status.PaidOffAt == nil || status.Pending != 0 || status.Charged != 2 || !status.Remaining.IsZero() {
+		t.Fatalf("expected the purchase paid off, got %+v", status)
+	}
+	if payoff := status.Schedule[1]; payoff.Amount.String() != "-800.00" {
+		t.Fatalf("expected the installments left charged at once, got %+v", payoff)
+	}
+	expectStatus(t, serve(t, h.PayOffInstallmentPurchase, http.MethodPut, "/installment/payoff?id="+status.ID, InstallmentPayoff{}), http.StatusConflict)
+
+	expectStatus(t, serve(t, h.DeleteInstallmentPurchase, http.MethodDelete, "/installment/delete?id=missing", nil), http.StatusNotFound)
+	rec = serve(t, h.DeleteInstallmentPurchase, http.MethodDelete, "/installment/delete?id="+status.ID, nil)
+	expectStatus(t, rec, http.StatusOK)
+	if left := decodeBody[[]InstallmentStatus](t, rec); len(left) != 0 {
+		t.Fatalf("expected no purchases, got %+v", left)
+	}
+	if left := decodeBody[[]storage.Expense](t, serve(t, h.GetExpenses, http.MethodGet, "/expenses?installment="+status.ID, nil)); len(left) != 0 {
+		t.Fatalf("expected the installments gone, got %+v", left)
+	}
+}
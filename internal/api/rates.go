@@ -0,0 +1,363 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+// ------------------------------------------------------------
+// Exchange Rate Handlers
+// ------------------------------------------------------------
+
+// SummaryTotals splits converted movements by type; Expenses is negative
+type SummaryTotals struct {
+	Income   storage.Money `json:"income"`
+	Expenses storage.Money `json:"expenses"`
+	Balance  storage.Money `json:"balance"`
+	Count    int           `json:"count"`
+}
+
+type CategorySummary struct {
+	Category string        `json:"category"`
+	Amount   storage.Money `json:"amount"`
+	Count    int           `json:"count"`
+}
+
+type MonthSummary struct {
+	Month string `json:"month"` // 2006-01
+	SummaryTotals
+}
+
+// CurrencySum totals the movements of one currency left out of a summary
+// because no rate to the base currency was in effect on their date
+type CurrencySum struct {
+	Currency string        `json:"currency"`
+	Amount   storage.Money `json:"amount"`
+	Count    int           `json:"count"`
+}
+
+type SummaryResponse struct {
+	Currency string `json:"currency"` // base currency every amount is converted to
+	SummaryTotals
+	Categories  []CategorySummary `json:"categories"`
+	Unconverted []CurrencySum     `json:"unconverted"`
+}
+
+type MonthlySummaryResponse struct {
+	Currency    string         `json:"currency"`
+	Months      []MonthSummary `json:"months"` // oldest first
+	Unconverted []CurrencySum  `json:"unconverted"`
+}
+
+type exchangeRateKey struct {
+	Date     string `json:"date"`
+	Currency string `json:"currency"`
+	Quote    string `json:"quote"`
+}
+
+// in writes every total with the decimals of currency, zeros included;
+// converted amounts already have them, so nothing is rounded
+func (t SummaryTotals) in(currency string) SummaryTotals {
+	for _, total := range []*storage.Money{&t.Income, &t.Expenses, &t.Balance} {
+		if scaled, err := total.In(currency); err == nil {
+			*total = scaled
+		}
+	}
+	return t
+}
+
+// add counts a converted amount as income or expense by the type of its expense
+func (t *SummaryTotals) add(e storage.Expense, amount storage.Money) error {
+	side := &t.Expenses
+	if e.Type == storage.TransactionTypeIncome {
+		side = &t.Income
+	}
+	var err error
+	if *side, err = side.Add(amount); err != nil {
+		return err
+	}
+	if t.Balance, err = t.Balance.Add(amount); err != nil {
+		return err
+	}
+	t.Count++
+	return nil
+}
+
+func (h *Handler) GetExchangeRates(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	h.writeExchangeRates(w)
+}
+
+// SaveExchangeRates upserts a list of rates, replacing the rate of a pair
+// already stored for the same day
+func (h *Handler) SaveExchangeRates(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	var rates []storage.ExchangeRate
+	if err := json.NewDecoder(r.Body).Decode(&rates); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	for i := range rates {
+		if err := rates[i].Validate(); err != nil {
+			writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+	}
+	if err := h.storage.SaveExchangeRates(rates); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to save exchange rates"})
+		log.Printf("API ERROR: Failed to save exchange rates: %v\n", err)
+		return
+	}
+	h.writeExchangeRates(w)
+}
+
+func (h *Handler) DeleteExchangeRate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	var payload exchangeRateKey
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	date, err := parseDate(payload.Date)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	rate := storage.ExchangeRate{Date: date, Currency: payload.Currency, Quote: payload.Quote, Rate: storage.NewMoney(1, 0)}
+	if err := rate.Validate(); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	rates, err := h.storage.GetExchangeRates()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get exchange rates"})
+		log.Printf("API ERROR: Failed to get exchange rates: %v\n", err)
+		return
+	}
+	if !slices.ContainsFunc(rates, func(stored storage.ExchangeRate) bool {
+		return stored.Currency == rate.Currency && stored.Quote == rate.Quote && stored.Date.Equal(rate.Date)
+	}) {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: "Exchange rate not found"})
+		return
+	}
+	if err := h.storage.DeleteExchangeRate(rate.Date, rate.Currency, rate.Quote); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete exchange rate"})
+		log.Printf("API ERROR: Failed to delete exchange rate: %v\n", err)
+		return
+	}
+	h.writeExchangeRates(w)
+}
+
+func (h *Handler) writeExchangeRates(w http.ResponseWriter) {
+	rates, err := h.storage.GetExchangeRates()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get exchange rates"})
+		log.Printf("API ERROR: Failed to get exchange rates: %v\n", err)
+		return
+	}
+	if rates == nil {
+		rates = []storage.ExchangeRate{}
+	}
+	writeJSON(w, http.StatusOK, rates)
+}
+
+// ImportExchangeRatesCSV reads a CSV with date, currency, quote and rate
+// columns; invalid rows are skipped like in the expense import
+func (h *Handler) ImportExchangeRatesCSV(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	if err := r.ParseMultipartForm(10 << 20); err != nil { // 10MB max file size
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Could not parse multipart form"})
+		return
+	}
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Error retrieving the file"})
+		return
+	}
+	defer file.Close()
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Failed to read CSV file"})
+		return
+	}
+	if len(records) < 2 {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "CSV file must have a header and at least one data row"})
+		return
+	}
+	colMap := make(map[string]int)
+	for i, col := range records[0] {
+		colMap[strings.ToLower(strings.TrimSpace(col))] = i
+	}
+	for _, col := range []string{"date", "currency", "quote", "rate"} {
+		if _, ok := colMap[col]; !ok {
+			writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("Missing required column: %s", col)})
+			return
+		}
+	}
+
+	var rates []storage.ExchangeRate
+	skippedCount := 0
+	for i, record := range records[1:] {
+		if len(record) != len(records[0]) {
+			log.Printf("Warning: Skipping rate row %d due to incorrect column count\n", i+2)
+			skippedCount++
+			continue
+		}
+		date, err := parseDate(strings.TrimSpace(record[colMap["date"]]))
+		if err != nil {
+			log.Printf("Warning: Skipping rate row %d due to invalid date: %v\n", i+2, err)
+			skippedCount++
+			continue
+		}
+		value, err := storage.ParseMoney(record[colMap["rate"]])
+		if err != nil {
+			log.Printf("Warning: Skipping rate row %d due to invalid rate: %v\n", i+2, err)
+			skippedCount++
+			continue
+		}
+		rate := storage.ExchangeRate{Date: date, Currency: record[colMap["currency"]], Quote: record[colMap["quote"]], Rate: value}
+		if err := rate.Validate(); err != nil {
+			log.Printf("Warning: Skipping rate row %d due to validation error: %v\n", i+2, err)
+			skippedCount++
+			continue
+		}
+		rates = append(rates, rate)
+	}
+	if err := h.storage.SaveExchangeRates(rates); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to save exchange rates"})
+		log.Printf("API ERROR: Failed to save imported exchange rates: %v\n", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"status":          "success",
+		"total_processed": len(records) - 1,
+		"imported":        len(rates),
+		"skipped":         skippedCount,
+	})
+	log.Printf("HTTP: Imported %d exchange rates from CSV file. Skipped %d records.", len(rates), skippedCount)
+}
+
+// summarize streams the filtered expenses to fn converted to the base
+// currency with the rate in effect on each date; movements without a rate
+// are totalled apart per currency and currency exchanges are left out. It
+// writes the error response itself.
+func (h *Handler) summarize(w http.ResponseWriter, r *http.Request, fn func(e storage.Expense, amount storage.Money) error) (string, []CurrencySum, bool) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return "", nil, false
+	}
+	filter, err := parseExpenseFilter(r.URL.Query())
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return "", nil, false
+	}
+	base, err := h.storage.GetCurrency()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get currency"})
+		log.Printf("API ERROR: Failed to get currency: %v\n", err)
+		return "", nil, false
+	}
+	rates, err := h.storage.GetExchangeRates()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get exchange rates"})
+		log.Printf("API ERROR: Failed to get exchange rates: %v\n", err)
+		return "", nil, false
+	}
+	table := storage.NewRateTable(rates)
+	unconverted := map[string]CurrencySum{}
+	err = h.storage.StreamExpenses(spendingOnly(filter), func(e storage.Expense) error {
+		amount, ok := table.Convert(e, base)
+		if !ok {
+			sum := unconverted[e.Currency]
+			total, err := sum.Amount.Add(e.Amount)
+			if err != nil {
+				return err
+			}
+			sum.Currency, sum.Amount, sum.Count = e.Currency, total, sum.Count+1
+			unconverted[e.Currency] = sum
+			return nil
+		}
+		return fn(e, amount)
+	})
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to summarize expenses"})
+		log.Printf("API ERROR: Failed to summarize expenses: %v\n", err)
+		return "", nil, false
+	}
+	sums := []CurrencySum{}
+	for _, currency := range slices.Sorted(maps.Keys(unconverted)) {
+		sums = append(sums, unconverted[currency])
+	}
+	return base, sums, true
+}
+
+// GetSummary converts the filtered movements to the base currency and
+// totals them overall and per category
+func (h *Handler) GetSummary(w http.ResponseWriter, r *http.Request) {
+	var totals SummaryTotals
+	categories := map[string]CategorySummary{}
+	base, unconverted, ok := h.summarize(w, r, func(e storage.Expense, amount storage.Money) error {
+		if err := totals.add(e, amount); err != nil {
+			return err
+		}
+		sum := categories[e.Category]
+		total, err := sum.Amount.Add(amount)
+		if err != nil {
+			return err
+		}
+		sum.Category, sum.Amount, sum.Count = e.Category, total, sum.Count+1
+		categories[e.Category] = sum
+		return nil
+	})
+	if !ok {
+		return
+	}
+	response := SummaryResponse{Currency: base, SummaryTotals: totals.in(base), Categories: []CategorySummary{}, Unconverted: unconverted}
+	for _, name := range slices.Sorted(maps.Keys(categories)) {
+		response.Categories = append(response.Categories, categories[name])
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// GetMonthlySummary converts the filtered movements to the base currency and
+// totals them per calendar month
+func (h *Handler) GetMonthlySummary(w http.ResponseWriter, r *http.Request) {
+	months := map[string]SummaryTotals{}
+	base, unconverted, ok := h.summarize(w, r, func(e storage.Expense, amount storage.Money) error {
+		month := e.Date.UTC().Format("2006-01")
+		totals := months[month]
+		if err := totals.add(e, amount); err != nil {
+			return err
+		}
+		months[month] = totals
+		return nil
+	})
+	if !ok {
+		return
+	}
+	response := MonthlySummaryResponse{Currency: base, Months: []MonthSummary{}, Unconverted: unconverted}
+	for _, month := range slices.Sorted(maps.Keys(months)) {
+		response.Months = append(response.Months, MonthSummary{Month: month, SummaryTotals: months[month].in(base)})
+	}
+	writeJSON(w, http.StatusOK, response)
+}
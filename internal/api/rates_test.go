@@ -0,0 +1,76 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+func TestExchangeRateHandlers(t *testing.T) {
+	h := newTestHandler(t)
+
+	expectStatus(t, serveCSV(t, h.ImportExchangeRatesCSV, "/exchange-rates/import", "date,currency,rate\n2024-03-01,usd,900\n"), http.StatusBadRequest)
+	rec := serveCSV(t, h.ImportExchangeRatesCSV, "/exchange-rates/import",
+		"Date,Currency,Quote,Rate\n2024-03-01,usd,ars,900\n2024-03-02,usd,usd,1\nyesterday,usd,ars,1\n2024-03-03,eur,ars,1e3\n")
+	expectStatus(t, rec, http.StatusOK)
+	if result := decodeBody[map[string]any](t, rec); result["imported"] != float64(1) || result["skipped"] != float64(3) {
+		t.Fatalf("expected 1 imported and 3 skipped rates, got %v", result)
+	}
+	expectStatus(t, serve(t, h.SaveExchangeRates, http.MethodPut, "/exchange-rates/edit", []storage.ExchangeRate{{Date: time.Now(), Currency: "usd", Quote: "ars", Rate: money("-1")}}), http.StatusBadRequest)
+	rec = serve(t, h.SaveExchangeRates, http.MethodPut, "/exchange-rates/edit", `[{"date":"2024-04-01T00:00:00Z","currency":"usd","quote":"ars","rate":"1000.125"}]`)
+	expectStatus(t, rec, http.StatusOK)
+	rates := decodeBody[[]storage.ExchangeRate](t, rec)
+	if len(rates) != 2 || rates[1].Rate.String() != "1000.125" {
+		t.Fatalf("unexpected rates after saving: %+v", rates)
+	}
+	expectStatus(t, serve(t, h.DeleteExchangeRate, http.MethodDelete, "/exchange-rates/delete", exchangeRateKey{Date: "2024-04-02", Currency: "usd", Quote: "ars"}), http.StatusNotFound)
+	expectStatus(t, serve(t, h.DeleteExchangeRate, http.MethodDelete, "/exchange-rates/delete", exchangeRateKey{Date: "2024-04-01", Currency: "usd", Quote: "ars"}), http.StatusOK)
+	if rates := decodeBody[[]storage.ExchangeRate](t, serve(t, h.GetExchangeRates, http.MethodGet, "/exchange-rates", nil)); len(rates) != 1 {
+		t.Fatalf("expected one rate left, got %+v", rates)
+	}
+
+	// the base currency is usd; ars converts through the imported rate
+	march := time.Date(2024, 3, 5, 12, 0, 0, 0, time.UTC)
+	expenses := []storage.Expense{
+		{Name: "Taxi", Category: "Travel", Amount: money("-90000"), Currency: "ars", Date: march},
+		{Name: "Lunch", Category: "Food", Amount: money("-20"), Currency: "usd", Date: march},
+		{Name: "Museum", Category: "Entertainment", Amount: money("-10"), Currency: "eur", Date: march},
+		{Name: "Train", Category: "Travel", Amount: money("-10"), Currency: "eur", Date: march, Rate: ptr(money("1.1"))},
+		{Name: "Salary", Category: "Income", Amount: money("500"), Currency: "usd", Date: march.AddDate(0, 1, 0)},
+	}
+	for _, e := range expenses {
+		expectStatus(t, serve(t, h.AddExpense, http.MethodPut, "/expense", e), http.StatusOK)
+	}
+	summary := decodeBody[SummaryResponse](t, serve(t, h.GetSummary, http.MethodGet, "/summary", nil))
+	if summary.Currency != "usd" || summary.Income.String() != "500.00" || summary.Expenses.String() != "-131.00" ||
+		summary.Balance.String() != "369.00" || summary.Count != 4 {
+		t.Fatalf("unexpected summary totals: %+v", summary)
+	}
+	wantCategories := []CategorySummary{
+		{Category: "Food", Amount: money("-20.00"), Count: 1},
+		{Category: "Income", Amount: money("500.00"), Count: 1},
+		{Category: "Travel", Amount: money("-111.00"), Count: 2},
+	}
+	if !slices.Equal(summary.Categories, wantCategories) {
+		t.Fatalf("categories: got %+v, want %+v", summary.Categories, wantCategories)
+	}
+	if len(summary.Unconverted) != 1 || summary.Unconverted[0].Currency != "eur" || summary.Unconverted[0].Amount.String() != "-10.00" {
+		t.Fatalf("expected the eur museum ticket unconverted, got %+v", summary.Unconverted)
+	}
+	summary = decodeBody[SummaryResponse](t, serve(t, h.GetSummary, http.MethodGet, "/summary?from=2024-04-01", nil))
+	if summary.Count != 1 || summary.Expenses.String() != "0.00" || len(summary.Unconverted) != 0 {
+		t.Fatalf("expected only the salary from april on, got %+v", summary)
+	}
+	expectStatus(t, serve(t, h.GetSummary, http.MethodGet, "/summary?from=abc", nil), http.StatusBadRequest)
+
+	monthly := decodeBody[MonthlySummaryResponse](t, serve(t, h.GetMonthlySummary, http.MethodGet, "/summary/monthly", nil))
+	if len(monthly.Months) != 2 || monthly.Months[0].Month != "2024-03" || monthly.Months[0].Balance.String() != "-131.00" ||
+		monthly.Months[0].Income.String() != "0.00" || monthly.Months[1].Month != "2024-04" || monthly.Months[1].Income.String() != "500.00" {
+		t.Fatalf("unexpected monthly summary: %+v", monthly)
+	}
+}
+
+func ptr[T any](v T) *T { return &v }
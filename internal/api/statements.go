@@ -0,0 +1,235 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+// ------------------------------------------------------------
+// Credit Card Statements and Cashflow
+// ------------------------------------------------------------
+
+// StatementPayment pays a statement of a credit card with a transfer from
+// another account of the same currency
+type StatementPayment struct {
+	Closing       string         `json:"closing"` // 2006-01-02, closing day of the statement
+	FromAccountID string         `json:"fromAccountId"`
+	Amount        *storage.Money `json:"amount,omitempty"` // defaults to what is left to pay
+	Date          time.Time      `json:"date"`             // defaults to now, or the due date outside the payment window
+	Name          string         `json:"name"`
+}
+
+// CashflowTotals is the money in and out of one currency, unconverted
+type CashflowTotals struct {
+	Currency string `json:"currency"`
+	SummaryTotals
+}
+
+type CashflowResponse struct {
+	Currencies []CashflowTotals `json:"currencies"` // by currency code
+}
+
+// GetAccountStatements lists the statements of a credit card, newest first
+func (h *Handler) GetAccountStatements(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	if _, statements, ok := h.cardStatements(w, r.URL.Query().Get("id")); ok {
+		writeJSON(w, http.StatusOK, statements)
+	}
+}
+
+// PayAccountStatement records the payment of a statement as a transfer into
+// the card dated after its closing, and lists the statements again
+func (h *Handler) PayAccountStatement(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	var payment StatementPayment
+	if err := json.NewDecoder(r.Body).Decode(&payment); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	id := r.URL.Query().Get("id")
+	card, statements, ok := h.cardStatements(w, id)
+	if !ok {
+		return
+	}
+	closing, err := time.Parse("2006-01-02", payment.Closing)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Closing must be a date like 2006-01-02"})
+		return
+	}
+	i := slices.IndexFunc(statements, func(s storage.CardStatement) bool { return s.Closing.Equal(closing) })
+	if i < 0 {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: "Statement not found"})
+		return
+	}
+	statement := statements[i]
+
+	// a payment counts for the last statement closed before it, so it has to
+	// land after this closing and up to the next one
+	next, _ := card.StatementDates(statement.Closing.AddDate(0, 0, 1))
+	inWindow := func(date time.Time) bool {
+		closing, _ := card.StatementDates(date)
+		return closing.Equal(next)
+	}
+	if payment.Date.IsZero() {
+		payment.Date = time.Now()
+		if !inWindow(payment.Date) {
+			payment.Date = statement.Due.Add(12 * time.Hour)
+		}
+	} else if !inWindow(payment.Date) {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("Payment date must fall after %s and up to %s", statement.Closing.Format("2006-01-02"), next.Format("2006-01-02"))})
+		return
+	}
+	var amount storage.Money
+	if payment.Amount != nil {
+		if payment.Amount.Sign() <= 0 {
+			writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Payment amount must be positive"})
+			return
+		}
+		amount = *payment.Amount
+	} else {
+		amount, err = statement.Total.Add(statement.Paid.Neg())
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to compute the statement balance"})
+			log.Printf("API ERROR: Failed to compute the balance of statement %s: %v\n", statement.Closing.Format("2006-01-02"), err)
+			return
+		}
+		if amount.Sign() <= 0 {
+			writeJSON(w, http.StatusConflict, ErrorResponse{Error: "Statement is already paid"})
+			return
+		}
+	}
+	if payment.Name == "" {
+		payment.Name = fmt.Sprintf("Pago %s %s", card.Name, statement.Closing.Format("2006-01-02"))
+	}
+	expense := storage.Expense{
+		Name:        payment.Name,
+		Type:        storage.TransactionTypeTransfer,
+		Amount:      amount,
+		Currency:    card.Currency,
+		Date:        payment.Date,
+		AccountID:   payment.FromAccountID,
+		ToAccountID: card.ID,
+	}
+	if err := expense.Validate(); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if !h.requireExpenseAccount(w, expense, storage.Expense{}) {
+		return
+	}
+	if err := h.storage.AddExpense(expense); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to save payment"})
+		log.Printf("API ERROR: Failed to save payment of account %s: %v\n", id, err)
+		return
+	}
+	if _, statements, ok := h.cardStatements(w, id); ok {
+		writeJSON(w, http.StatusOK, statements)
+	}
+}
+
+// cardStatements loads a credit card and its statements; it writes a 404 for
+// a missing account and a 400 for one without a statement cycle
+func (h *Handler) cardStatements(w http.ResponseWriter, id string) (storage.Account, []storage.CardStatement, bool) {
+	if id == "" {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "ID parameter is required"})
+		return storage.Account{}, nil, false
+	}
+	card, err := h.storage.GetAccount(id)
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: "Account not found"})
+		return storage.Account{}, nil, false
+	}
+	if !card.HasCycle() {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Account is not a credit card with closing and due days"})
+		return storage.Account{}, nil, false
+	}
+	expenses, err := h.storage.QueryExpenses(storage.ExpenseFilter{Account: id})
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to retrieve expenses"})
+		log.Printf("API ERROR: Failed to retrieve expenses of account %s: %v\n", id, err)
+		return storage.Account{}, nil, false
+	}
+	statements, err := storage.CardStatements(card, expenses)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to build statements"})
+		log.Printf("API ERROR: Failed to build statements of account %s: %v\n", id, err)
+		return storage.Account{}, nil, false
+	}
+	return card, statements, true
+}
+
+// GetCashflow totals the money in and out per currency by the day it moves:
+// purchases on a credit card with a statement cycle count on the due date of
+// their statement, everything else on its own date. Transfers, card payments
+// included, are left out. From and to bound that day; the other filters
+// apply as in /expenses.
+func (h *Handler) GetCashflow(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	filter, err := parseExpenseFilter(r.URL.Query())
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	accounts, err := h.storage.GetAccounts()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get accounts"})
+		log.Printf("API ERROR: Failed to get accounts: %v\n", err)
+		return
+	}
+	cards := map[string]storage.Account{}
+	for _, a := range accounts {
+		if a.HasCycle() {
+			cards[a.ID] = a
+		}
+	}
+	// a statement is due within two months of its purchases, so older ones
+	// can still move money on or after from
+	from, to := filter.From, filter.To
+	if !from.IsZero() {
+		filter.From = from.AddDate(0, -2, 0)
+	}
+	totals := map[string]SummaryTotals{}
+	err = h.storage.StreamExpenses(spendingOnly(filter), func(e storage.Expense) error {
+		date := e.Date
+		if card, ok := cards[e.AccountID]; ok {
+			// midday, so the due day stays the same in any time zone
+			_, due := card.StatementDates(e.Date)
+			date = due.Add(12 * time.Hour)
+		}
+		if (!from.IsZero() && date.Before(from)) || (!to.IsZero() && date.After(to)) {
+			return nil
+		}
+		sum := totals[e.Currency]
+		if err := sum.add(e, e.Amount); err != nil {
+			return err
+		}
+		totals[e.Currency] = sum
+		return nil
+	})
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to compute cashflow"})
+		log.Printf("API ERROR: Failed to compute cashflow: %v\n", err)
+		return
+	}
+	response := CashflowResponse{Currencies: []CashflowTotals{}}
+	for _, currency := range slices.Sorted(maps.Keys(totals)) {
+		response.Currencies = append(response.Currencies, CashflowTotals{Currency: currency, SummaryTotals: totals[currency].in(currency)})
+	}
+	writeJSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+func TestStatementHandlers(t *testing.T) {
+	h := newTestHandler(t)
+	addAccount := func(a storage.Account) storage.Account {
+		t.Helper()
+		rec := serve(t, h.AddAccount, http.MethodPut, "/account", a)
+		expectStatus(t, rec, http.StatusOK)
+		for _, b := range decodeBody[[]storage.AccountBalance](t, rec) {
+			if b.Name == a.Name {
+				return b.Account
+			}
+		}
+		t.Fatalf("account %s not listed", a.Name)
+		return storage.Account{}
+	}
+	expectStatus(t, serve(t, h.AddAccount, http.MethodPut, "/account", storage.Account{Name: "Master", Type: storage.AccountTypeCreditCard, Currency: "ars", ClosingDay: 40, DueDay: 5}), http.StatusBadRequest)
+	bank := addAccount(storage.Account{Name: "Banco", Type: storage.AccountTypeBank, Currency: "ars", OpeningBalance: money("1000")})
+	visa := addAccount(storage.Account{Name: "Visa", Type: storage.AccountTypeCreditCard, Currency: "ars", ClosingDay: 25, DueDay: 5})
+	if visa.ClosingDay != 25 || visa.DueDay != 5 {
+		t.Fatalf("expected the card cycle kept, got %+v", visa)
+	}
+
+	for _, e := range []storage.Expense{
+		{Name: "Groceries", Category: "Food", Amount: money("-100"), Currency: "ars", Date: time.Date(2024, 1, 20, 12, 0, 0, 0, time.UTC), AccountID: visa.ID},
+		{Name: "Dinner", Category: "Food", Amount: money("-40"), Currency: "ars", Date: time.Date(2024, 1, 26, 12, 0, 0, 0, time.UTC), AccountID: visa.ID},
+		{Name: "Salary", Category: "Income", Amount: money("500"), Currency: "ars", Date: time.Date(2024, 2, 1, 12, 0, 0, 0, time.UTC), AccountID: bank.ID},
+		{Name: "Rent", Category: "Food", Amount: money("-200"), Currency: "ars", Date: time.Date(2024, 2, 2, 12, 0, 0, 0, time.UTC), AccountID: bank.ID},
+	} {
+		expectStatus(t, serve(t, h.AddExpense, http.MethodPut, "/expense", e), http.StatusOK)
+	}
+
+	expectStatus(t, serve(t, h.GetAccountStatements, http.MethodGet, "/account/statements?id=missing", nil), http.StatusNotFound)
+	expectStatus(t, serve(t, h.GetAccountStatements, http.MethodGet, "/account/statements?id="+bank.ID, nil), http.StatusBadRequest)
+	statements := decodeBody[[]storage.CardStatement](t, serve(t, h.GetAccountStatements, http.MethodGet, "/account/statements?id="+visa.ID, nil))
+	if len(statements) != 2 {
+		t.Fatalf("expected two statements, got %+v", statements)
+	}
+	january := statements[1]
+	if january.Closing.Format("2006-01-02") != "2024-01-25" || january.Due.Format("2006-01-02") != "2024-02-05" || january.Total.String() != "100.00" || len(january.Purchases) != 1 {
+		t.Fatalf("unexpected january statement: %+v", january)
+	}
+
+	pay := func(p StatementPayment) *storage.CardStatement {
+		t.Helper()
+		rec := serve(t, h.PayAccountStatement, http.MethodPut, "/account/statement/pay?id="+visa.ID, p)
+		expectStatus(t, rec, http.StatusOK)
+		statements := decodeBody[[]storage.CardStatement](t, rec)
+		return &statements[len(statements)-1]
+	}
+	paidOn := time.Date(2024, 2, 4, 12, 0, 0, 0, time.UTC)
+	expectStatus(t, serve(t, h.PayAccountStatement, http.MethodPut, "/account/statement/pay?id="+visa.ID, StatementPayment{Closing: "2023-12-25", FromAccountID: bank.ID, Date: paidOn}), http.StatusNotFound)
+	// a payment dated before the closing would count for the previous statement
+	expectStatus(t, serve(t, h.PayAccountStatement, http.MethodPut, "/account/statement/pay?id="+visa.ID, StatementPayment{Closing: "2024-01-25", FromAccountID: bank.ID, Date: january.Closing}), http.StatusBadRequest)
+	expectStatus(t, serve(t, h.PayAccountStatement, http.MethodPut, "/account/statement/pay?id="+visa.ID, StatementPayment{Closing: "2024-01-25", FromAccountID: visa.ID, Date: paidOn}), http.StatusBadRequest)
+	half := money("30")
+	if paid := pay(StatementPayment{Closing: "2024-01-25", FromAccountID: bank.ID, Amount: &half, Date: paidOn}); paid.Paid.String() != "30.00" {
+		t.Fatalf("expected a partial payment, got %+v", paid)
+	}
+	// without an amount, what is left gets paid
+	if paid := pay(StatementPayment{Closing: "2024-01-25", FromAccountID: bank.ID, Date: paidOn}); paid.Paid.String() != "100.00" {
+		t.Fatalf("expected the statement paid, got %+v", paid)
+	}
+	expectStatus(t, serve(t, h.PayAccountStatement, http.MethodPut, "/account/statement/pay?id="+visa.ID, StatementPayment{Closing: "2024-01-25", FromAccountID: bank.ID, Date: paidOn}), http.StatusConflict)
+	accounts := decodeBody[[]storage.AccountBalance](t, serve(t, h.GetAccounts, http.MethodGet, "/accounts", nil))
+	for _, a := range accounts {
+		if (a.ID == bank.ID && a.Balance.String() != "1200.00") || (a.ID == visa.ID && a.Balance.String() != "-40.00") {
+			t.Fatalf("unexpected balances after the payment: %+v", accounts)
+		}
+	}
+
+	// january card purchases move money in february, when they are due; the
+	// payments themselves are transfers and stay out
+	cashflow := func(from, to string) SummaryTotals {
+		t.Helper()
+		response := decodeBody[CashflowResponse](t, serve(t, h.GetCashflow, http.MethodGet, "/cashflow?from="+from+"&to="+to, nil))
+		if len(response.Currencies) == 0 {
+			return SummaryTotals{}
+		}
+		if len(response.Currencies) != 1 || response.Currencies[0].Currency != "ars" {
+			t.Fatalf("unexpected cashflow: %+v", response)
+		}
+		return response.Currencies[0].SummaryTotals
+	}
+	if january := cashflow("2024-01-01", "2024-01-31"); january.Count != 0 {
+		t.Fatalf("expected no cash out in january, got %+v", january)
+	}
+	february := cashflow("2024-02-01", "2024-02-29")
+	if february.Income.String() != "500.00" || february.Expenses.String() != "-300.00" || february.Count != 3 {
+		t.Fatalf("unexpected february cashflow: %+v", february)
+	}
+	if march := cashflow("2024-03-01", "2024-03-31"); march.Expenses.String() != "-40.00" || march.Count != 1 {
+		t.Fatalf("unexpected march cashflow: %+v", march)
+	}
+}
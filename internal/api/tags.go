@@ -0,0 +1,223 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+// ------------------------------------------------------------
+// Tag Handlers
+// ------------------------------------------------------------
+
+type tagPayload struct {
+	Name string `json:"name"`
+}
+
+type tagRenamePayload struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type tagMergePayload struct {
+	Sources []string `json:"sources"`
+	Target  string   `json:"target"`
+}
+
+func validateTag(name string) (string, error) {
+	sanitized := storage.SanitizeString(name)
+	if sanitized == "" {
+		return "", fmt.Errorf("tag name cannot be empty or contain only invalid characters")
+	}
+	return sanitized, nil
+}
+
+func tagExists(tags []storage.Tag, name string) bool {
+	return slices.ContainsFunc(tags, func(tag storage.Tag) bool { return tag.Name == name })
+}
+
+// writeTags answers a tag change with the updated catalog
+func (h *Handler) writeTags(w http.ResponseWriter) {
+	tags, err := h.storage.GetTags()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get tags"})
+		log.Printf("API ERROR: Failed to get tags: %v\n", err)
+		return
+	}
+	if tags == nil {
+		tags = []storage.Tag{}
+	}
+	writeJSON(w, http.StatusOK, tags)
+}
+
+func (h *Handler) GetTags(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	h.writeTags(w)
+}
+
+func (h *Handler) AddTag(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	var payload tagPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	name, err := validateTag(payload.Name)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	tags, err := h.storage.GetTags()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get tags"})
+		log.Printf("API ERROR: Failed to get tags: %v\n", err)
+		return
+	}
+	if tagExists(tags, name) {
+		writeJSON(w, http.StatusConflict, ErrorResponse{Error: "Tag already exists"})
+		return
+	}
+	if err := h.storage.AddTag(name); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to add tag"})
+		log.Printf("API ERROR: Failed to add tag: %v\n", err)
+		return
+	}
+	h.writeTags(w)
+}
+
+func (h *Handler) RenameTag(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	var payload tagRenamePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	from, err := validateTag(payload.From)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid current tag"})
+		return
+	}
+	to, err := validateTag(payload.To)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	tags, err := h.storage.GetTags()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get tags"})
+		log.Printf("API ERROR: Failed to get tags: %v\n", err)
+		return
+	}
+	if !tagExists(tags, from) {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: "Tag not found"})
+		return
+	}
+	if from == to {
+		h.writeTags(w)
+		return
+	}
+	if tagExists(tags, to) {
+		writeJSON(w, http.StatusConflict, ErrorResponse{Error: "Tag already exists, merge the tags instead"})
+		return
+	}
+	if err := h.storage.RenameTag(from, to); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to rename tag"})
+		log.Printf("API ERROR: Failed to rename tag: %v\n", err)
+		return
+	}
+	h.writeTags(w)
+}
+
+func (h *Handler) MergeTags(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	var payload tagMergePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	target, err := validateTag(payload.Target)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if len(payload.Sources) == 0 {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "At least one source tag is required"})
+		return
+	}
+	tags, err := h.storage.GetTags()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get tags"})
+		log.Printf("API ERROR: Failed to get tags: %v\n", err)
+		return
+	}
+	var sources []string
+	for _, source := range payload.Sources {
+		name, err := validateTag(source)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		if !tagExists(tags, name) {
+			writeJSON(w, http.StatusNotFound, ErrorResponse{Error: fmt.Sprintf("Tag not found: %s", name)})
+			return
+		}
+		if name != target && !slices.Contains(sources, name) {
+			sources = append(sources, name)
+		}
+	}
+	if err := h.storage.MergeTags(sources, target); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to merge tags"})
+		log.Printf("API ERROR: Failed to merge tags: %v\n", err)
+		return
+	}
+	h.writeTags(w)
+}
+
+func (h *Handler) DeleteTag(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	var payload tagPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+	name, err := validateTag(payload.Name)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	tags, err := h.storage.GetTags()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get tags"})
+		log.Printf("API ERROR: Failed to get tags: %v\n", err)
+		return
+	}
+	if !tagExists(tags, name) {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: "Tag not found"})
+		return
+	}
+	if err := h.storage.DeleteTag(name); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to delete tag"})
+		log.Printf("API ERROR: Failed to delete tag: %v\n", err)
+		return
+	}
+	h.writeTags(w)
+}
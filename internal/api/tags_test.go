@@ -0,0 +1,52 @@
+package api
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+func TestTagHandlers(t *testing.T) {
+	h := newTestHandler(t)
+	for _, tags := range [][]string{{"cafe", "work"}, {"coffee"}} {
+		e := storage.Expense{Name: "Tagged", Category: "Food", Amount: money("-1"), Date: time.Now(), Tags: tags}
+		expectStatus(t, serve(t, h.AddExpense, http.MethodPut, "/expense", e), http.StatusOK)
+	}
+
+	rec := serve(t, h.GetTags, http.MethodGet, "/tags", nil)
+	expectStatus(t, rec, http.StatusOK)
+	tags := decodeBody[[]storage.Tag](t, rec)
+	want := []storage.Tag{{Name: "cafe", Count: 1}, {Name: "coffee", Count: 1}, {Name: "work", Count: 1}}
+	if !slices.Equal(tags, want) {
+		t.Fatalf("got %+v, want %+v", tags, want)
+	}
+
+	expectStatus(t, serve(t, h.AddTag, http.MethodPost, "/tags/add", tagPayload{Name: "  "}), http.StatusBadRequest)
+	expectStatus(t, serve(t, h.AddTag, http.MethodPost, "/tags/add", tagPayload{Name: "cafe"}), http.StatusConflict)
+	expectStatus(t, serve(t, h.AddTag, http.MethodPost, "/tags/add", tagPayload{Name: "travel"}), http.StatusOK)
+
+	expectStatus(t, serve(t, h.RenameTag, http.MethodPut, "/tags/rename", tagRenamePayload{From: "missing", To: "x"}), http.StatusNotFound)
+	expectStatus(t, serve(t, h.RenameTag, http.MethodPut, "/tags/rename", tagRenamePayload{From: "cafe", To: "coffee"}), http.StatusConflict)
+	expectStatus(t, serve(t, h.RenameTag, http.MethodPut, "/tags/rename", tagRenamePayload{From: "work", To: "office"}), http.StatusOK)
+
+	expectStatus(t, serve(t, h.MergeTags, http.MethodPut, "/tags/merge", tagMergePayload{Target: "drinks"}), http.StatusBadRequest)
+	expectStatus(t, serve(t, h.MergeTags, http.MethodPut, "/tags/merge", tagMergePayload{Sources: []string{"missing"}, Target: "drinks"}), http.StatusNotFound)
+	rec = serve(t, h.MergeTags, http.MethodPut, "/tags/merge", tagMergePayload{Sources: []string{"cafe", "coffee"}, Target: "drinks"})
+	expectStatus(t, rec, http.StatusOK)
+	tags = decodeBody[[]storage.Tag](t, rec)
+	want = []storage.Tag{{Name: "drinks", Count: 2}, {Name: "office", Count: 1}, {Name: "travel"}}
+	if !slices.Equal(tags, want) {
+		t.Fatalf("after merge got %+v, want %+v", tags, want)
+	}
+
+	expectStatus(t, serve(t, h.DeleteTag, http.MethodDelete, "/tags/delete", tagPayload{Name: "missing"}), http.StatusNotFound)
+	expectStatus(t, serve(t, h.DeleteTag, http.MethodDelete, "/tags/delete", tagPayload{Name: "office"}), http.StatusOK)
+	for _, e := range decodeBody[[]storage.Expense](t, serve(t, h.GetExpenses, http.MethodGet, "/expenses", nil)) {
+		if !slices.Equal(e.Tags, []string{"drinks"}) {
+			t.Fatalf("tag changes did not cascade to expense: %v", e.Tags)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+// ------------------------------------------------------------
+// Trash Handlers
+// ------------------------------------------------------------
+
+type trashPayload struct {
+	IDs []string `json:"ids"`
+	All bool     `json:"all"` // purge only: empty the whole trash
+}
+
+// writeTrash answers a trash change with the remaining trashed expenses
+func (h *Handler) writeTrash(w http.ResponseWriter) {
+	trash, err := h.storage.GetTrash()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get trash"})
+		log.Printf("API ERROR: Failed to get trash: %v\n", err)
+		return
+	}
+	if trash == nil {
+		trash = []storage.TrashedExpense{}
+	}
+	writeJSON(w, http.StatusOK, trash)
+}
+
+// decodeTrashIDs reads the payload and checks that every id is in the trash,
+// writing the error response when it is not
+func (h *Handler) decodeTrashIDs(w http.ResponseWriter, r *http.Request) (trashPayload, bool) {
+	var payload trashPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return payload, false
+	}
+	if payload.All {
+		return payload, true
+	}
+	if len(payload.IDs) == 0 {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "At least one ID is required"})
+		return payload, false
+	}
+	trash, err := h.storage.GetTrash()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get trash"})
+		log.Printf("API ERROR: Failed to get trash: %v\n", err)
+		return payload, false
+	}
+	for _, id := range payload.IDs {
+		if !slices.ContainsFunc(trash, func(e storage.TrashedExpense) bool { return e.ID == id }) {
+			writeJSON(w, http.StatusNotFound, ErrorResponse{Error: "Expense not found in trash: " + id})
+			return payload, false
+		}
+	}
+	return payload, true
+}
+
+func (h *Handler) GetTrash(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	h.writeTrash(w)
+}
+
+func (h *Handler) RestoreExpenses(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	payload, ok := h.decodeTrashIDs(w, r)
+	if !ok {
+		return
+	}
+	if payload.All {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "Restore needs the IDs of the expenses"})
+		return
+	}
+	if err := h.storage.RestoreExpenses(payload.IDs); err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to restore expenses"})
+		log.Printf("API ERROR: Failed to restore expenses: %v\n", err)
+		return
+	}
+	h.writeTrash(w)
+}
+
+// PurgeExpenses deletes trashed expenses for good, either the given ids or
+// the whole trash with {"all": true}
+func (h *Handler) PurgeExpenses(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	payload, ok := h.decodeTrashIDs(w, r)
+	if !ok {
+		return
+	}
+	var err error
+	if payload.All {
+		_, err = h.storage.PurgeTrash(time.Now())
+	} else {
+		err = h.storage.PurgeExpenses(payload.IDs)
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to purge expenses"})
+		log.Printf("API ERROR: Failed to purge expenses: %v\n", err)
+		return
+	}
+	h.writeTrash(w)
+}
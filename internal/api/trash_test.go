@@ -0,0 +1,52 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+func TestTrashHandlers(t *testing.T) {
+	h := newTestHandler(t)
+	for _, name := range []string{"One", "Two", "Three"} {
+		expectStatus(t, serve(t, h.AddExpense, http.MethodPut, "/expense", storage.Expense{Name: name, Category: "Food", Amount: money("-1"), Date: time.Now()}), http.StatusOK)
+	}
+	expenses := decodeBody[[]storage.Expense](t, serve(t, h.GetExpenses, http.MethodGet, "/expenses", nil))
+	ids := []string{expenses[0].ID, expenses[1].ID}
+	expectStatus(t, serve(t, h.DeleteMultipleExpenses, http.MethodDelete, "/expenses/delete", map[string][]string{"ids": ids}), http.StatusOK)
+	expectStatus(t, serve(t, h.DeleteExpense, http.MethodDelete, "/expense/delete?id="+expenses[2].ID, nil), http.StatusOK)
+
+	trash := decodeBody[[]storage.TrashedExpense](t, serve(t, h.GetTrash, http.MethodGet, "/expenses/trash", nil))
+	if len(trash) != 3 || trash[0].DeletedAt.IsZero() {
+		t.Fatalf("expected 3 trashed expenses, got %+v", trash)
+	}
+
+	expectStatus(t, serve(t, h.RestoreExpenses, http.MethodPut, "/expenses/restore", map[string][]string{"ids": {}}), http.StatusBadRequest)
+	expectStatus(t, serve(t, h.RestoreExpenses, http.MethodPut, "/expenses/restore", map[string][]string{"ids": {ids[0], "missing"}}), http.StatusNotFound)
+	expectStatus(t, serve(t, h.RestoreExpenses, http.MethodPut, "/expenses/restore", map[string]bool{"all": true}), http.StatusBadRequest)
+	rec := serve(t, h.RestoreExpenses, http.MethodPut, "/expenses/restore", map[string][]string{"ids": {ids[0]}})
+	expectStatus(t, rec, http.StatusOK)
+	if trash = decodeBody[[]storage.TrashedExpense](t, rec); len(trash) != 2 {
+		t.Fatalf("expected 2 trashed expenses after restore, got %d", len(trash))
+	}
+	if expenses = decodeBody[[]storage.Expense](t, serve(t, h.GetExpenses, http.MethodGet, "/expenses", nil)); len(expenses) != 1 || expenses[0].ID != ids[0] {
+		t.Fatalf("expected the restored expense back, got %+v", expenses)
+	}
+
+	// a trashed expense still holds its category
+	expectStatus(t, serve(t, h.DeleteCategory, http.MethodDelete, "/categories/delete", map[string]string{"name": "Food"}), http.StatusConflict)
+
+	expectStatus(t, serve(t, h.PurgeExpenses, http.MethodDelete, "/expenses/purge", map[string][]string{"ids": {ids[0]}}), http.StatusNotFound)
+	rec = serve(t, h.PurgeExpenses, http.MethodDelete, "/expenses/purge", map[string][]string{"ids": {ids[1]}})
+	expectStatus(t, rec, http.StatusOK)
+	if trash = decodeBody[[]storage.TrashedExpense](t, rec); len(trash) != 1 {
+		t.Fatalf("expected 1 trashed expense after purge, got %d", len(trash))
+	}
+	rec = serve(t, h.PurgeExpenses, http.MethodDelete, "/expenses/purge", map[string]bool{"all": true})
+	expectStatus(t, rec, http.StatusOK)
+	if trash = decodeBody[[]storage.TrashedExpense](t, rec); len(trash) != 0 {
+		t.Fatalf("expected an empty trash, got %+v", trash)
+	}
+}
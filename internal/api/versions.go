@@ -0,0 +1,144 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+// ------------------------------------------------------------
+// Version Handlers
+// ------------------------------------------------------------
+
+func formatETag(version int64) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// ifMatch reads the version a write is based on: 0 without an If-Match header
+// or with "*", which leaves the write unchecked
+func ifMatch(r *http.Request) (int64, error) {
+	value := strings.TrimSpace(r.Header.Get("If-Match"))
+	if value == "" || value == "*" {
+		return 0, nil
+	}
+	value = strings.Trim(strings.TrimPrefix(value, "W/"), `"`)
+	version, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || version < 1 {
+		return 0, fmt.Errorf("invalid If-Match header")
+	}
+	return version, nil
+}
+
+// writePreconditionFailed answers a write based on a stale version, with the
+// current version as ETag so the client knows what to re-read
+func writePreconditionFailed(w http.ResponseWriter, current int64) {
+	w.Header().Set("ETag", formatETag(current))
+	writeJSON(w, http.StatusPreconditionFailed, ErrorResponse{Error: "Modified by another request; reload and try again"})
+}
+
+// writeConflict writes the 412 response when err is a storage conflict
+func writeConflict(w http.ResponseWriter, err error) bool {
+	var conflict *storage.ConflictError
+	if !errors.As(err, &conflict) {
+		return false
+	}
+	writePreconditionFailed(w, conflict.Current)
+	return true
+}
+
+// checkIfMatch compares the If-Match header with the current version, writing
+// the error response when it does not match
+func checkIfMatch(w http.ResponseWriter, r *http.Request, current int64) bool {
+	expected, err := ifMatch(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return false
+	}
+	if expected != 0 && expected != current {
+		writePreconditionFailed(w, current)
+		return false
+	}
+	return true
+}
+
+// categoriesBase returns the version a category write is checked against:
+// the list version read before the handler reads the list itself, so its
+// read-modify-write fails rather than overwrite a concurrent change
+func (h *Handler) categoriesBase(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	version, err := h.storage.CategoriesVersion()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get categories"})
+		log.Printf("API ERROR: Failed to get categories version: %v\n", err)
+		return 0, false
+	}
+	return version, checkIfMatch(w, r, version)
+}
+
+// GetExpense returns one expense with its version as ETag
+func (h *Handler) GetExpense(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "ID parameter is required"})
+		return
+	}
+	expense, err := h.storage.GetExpense(id)
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: "Expense not found"})
+		return
+	}
+	w.Header().Set("ETag", formatETag(expense.Version))
+	writeJSON(w, http.StatusOK, expense)
+}
+
+// GetRecurringExpense returns one recurring rule with its version as ETag
+func (h *Handler) GetRecurringExpense(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "Method not allowed"})
+		return
+	}
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "ID parameter is required"})
+		return
+	}
+	re, err := h.storage.GetRecurringExpense(id)
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, ErrorResponse{Error: "Recurring expense not found"})
+		return
+	}
+	w.Header().Set("ETag", formatETag(re.Version))
+	writeJSON(w, http.StatusOK, re)
+}
+
+// writeExpense answers an edit with the stored expense and its new version
+func (h *Handler) writeExpense(w http.ResponseWriter, id string) {
+	expense, err := h.storage.GetExpense(id)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get expense"})
+		log.Printf("API ERROR: Failed to get expense %s: %v\n", id, err)
+		return
+	}
+	w.Header().Set("ETag", formatETag(expense.Version))
+	writeJSON(w, http.StatusOK, expense)
+}
+
+// writeRecurringVersion answers an edit of a rule with its new version as ETag
+func (h *Handler) writeRecurringVersion(w http.ResponseWriter, id string) {
+	re, err := h.storage.GetRecurringExpense(id)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, ErrorResponse{Error: "Failed to get recurring expense"})
+		log.Printf("API ERROR: Failed to get recurring expense %s: %v\n", id, err)
+		return
+	}
+	w.Header().Set("ETag", formatETag(re.Version))
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/tanq16/expenseowl/internal/storage"
+)
+
+// serveIfMatch is serve with an If-Match header
+func serveIfMatch(t *testing.T, fn http.HandlerFunc, method, target, etag string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("marshal request body: %v", err)
+	}
+	req := httptest.NewRequest(method, target, bytes.NewReader(data))
+	req.Header.Set("If-Match", etag)
+	rec := httptest.NewRecorder()
+	fn(rec, req)
+	return rec
+}
+
+func TestVersionHandlers(t *testing.T) {
+	h := newTestHandler(t)
+	expectStatus(t, serve(t, h.AddExpense, http.MethodPut, "/expense", storage.Expense{Name: "Coffee", Category: "Food", Amount: money("-3"), Date: time.Now()}), http.StatusOK)
+	id := decodeBody[[]storage.Expense](t, serve(t, h.GetExpenses, http.MethodGet, "/expenses", nil))[0].ID
+
+	rec := serve(t, h.GetExpense, http.MethodGet, "/expense/get?id="+id, nil)
+	expectStatus(t, rec, http.StatusOK)
+	etag := rec.Header().Get("ETag")
+	if etag != `"1"` {
+		t.Fatalf("expected ETag \"1\", got %q", etag)
+	}
+	expense := decodeBody[storage.Expense](t, rec)
+	expense.Amount = money("-4")
+	rec = serveIfMatch(t, h.EditExpense, http.MethodPut, "/expense/edit?id="+id, etag, expense)
+	expectStatus(t, rec, http.StatusOK)
+	if got := rec.Header().Get("ETag"); got != `"2"` || decodeBody[storage.Expense](t, rec).Version != 2 {
+		t.Fatalf("expected version 2 after the edit, got ETag %q", got)
+	}
+	// the stale tag is refused and the response names the current version
+	rec = serveIfMatch(t, h.EditExpense, http.MethodPut, "/expense/edit?id="+id, etag, expense)
+	expectStatus(t, rec, http.StatusPreconditionFailed)
+	if got := rec.Header().Get("ETag"); got != `"2"` {
+		t.Fatalf("expected the current ETag on 412, got %q", got)
+	}
+	// so is the stale version in the body when no header is sent
+	expectStatus(t, serve(t, h.EditExpense, http.MethodPut, "/expense/edit?id="+id, expense), http.StatusPreconditionFailed)
+	expectStatus(t, serveIfMatch(t, h.EditExpense, http.MethodPut, "/expense/edit?id="+id, "abc", expense), http.StatusBadRequest)
+	expectStatus(t, serveIfMatch(t, h.DeleteExpense, http.MethodDelete, "/expense/delete?id="+id, etag, nil), http.StatusPreconditionFailed)
+	expectStatus(t, serveIfMatch(t, h.DeleteExpense, http.MethodDelete, "/expense/delete?id="+id, `W/"2"`, nil), http.StatusOK)
+	expectStatus(t, serve(t, h.GetExpense, http.MethodGet, "/expense/get?id="+id, nil), http.StatusNotFound)
+
+	rule := storage.RecurringExpense{Name: "Rent", Category: "Rent", Amount: money("-500"), StartDate: time.Now(), Interval: "monthly", Occurrences: 2}
+	expectStatus(t, serve(t, h.AddRecurringExpense, http.MethodPut, "/recurring-expense", rule), http.StatusCreated)
+	rule = decodeBody[[]storage.RecurringExpense](t, serve(t, h.GetRecurringExpenses, http.MethodGet, "/recurring-expenses", nil))[0]
+	rec = serveIfMatch(t, h.UpdateRecurringExpense, http.MethodPut, "/recurring-expense/edit?id="+rule.ID, `"1"`, rule)
+	expectStatus(t, rec, http.StatusOK)
+	if got := rec.Header().Get("ETag"); got != `"2"` {
+		t.Fatalf("expected rule ETag \"2\", got %q", got)
+	}
+	expectStatus(t, serveIfMatch(t, h.UpdateRecurringExpense, http.MethodPut, "/recurring-expense/edit?id="+rule.ID, `"1"`, rule), http.StatusPreconditionFailed)
+	rec = serve(t, h.GetRecurringExpense, http.MethodGet, "/recurring-expense/get?id="+rule.ID, nil)
+	if got := rec.Header().Get("ETag"); got != `"2"` {
+		t.Fatalf("expected rule ETag \"2\" on read, got %q", got)
+	}
+	skip := storage.RecurringOverride{Occurrence: rule.StartDate, Skip: true}
+	expectStatus(t, serveIfMatch(t, h.OverrideRecurringOccurrence, http.MethodPut, "/recurring-expense/occurrence?id="+rule.ID, `"1"`, skip), http.StatusPreconditionFailed)
+	expectStatus(t, serveIfMatch(t, h.OverrideRecurringOccurrence, http.MethodPut, "/recurring-expense/occurrence?id="+rule.ID, `"2"`, skip), http.StatusOK)
+	rec = serveIfMatch(t, h.DeleteRecurringExpense, http.MethodDelete, "/recurring-expense/delete?id="+rule.ID, `"2"`, nil)
+	expectStatus(t, rec, http.StatusPreconditionFailed)
+	if got := rec.Header().Get("ETag"); got != `"3"` {
+		t.Fatalf("expected the current rule ETag on 412, got %q", got)
+	}
+	expectStatus(t, serveIfMatch(t, h.DeleteRecurringExpense, http.MethodDelete, "/recurring-expense/delete?id="+rule.ID, `"3"`, nil), http.StatusOK)
+
+	// category writes share the version of the list
+	rec = serve(t, h.GetCategories, http.MethodGet, "/categories", nil)
+	etag = rec.Header().Get("ETag")
+	rec = serveIfMatch(t, h.AddCategory, http.MethodPost, "/categories/add", etag, categoryPayload{Name: "Books"})
+	expectStatus(t, rec, http.StatusOK)
+	next := rec.Header().Get("ETag")
+	if next == etag || next == "" {
+		t.Fatalf("expected a new ETag after adding a category, got %q", next)
+	}
+	expectStatus(t, serveIfMatch(t, h.RenameCategory, http.MethodPut, "/categories/rename", etag, categoryRenamePayload{From: "Books", To: "Reading"}), http.StatusPreconditionFailed)
+	rec = serveIfMatch(t, h.RenameCategory, http.MethodPut, "/categories/rename", next, categoryRenamePayload{From: "Books", To: "Reading"})
+	expectStatus(t, rec, http.StatusOK)
+	expectStatus(t, serveIfMatch(t, h.DeleteCategory, http.MethodDelete, "/categories/delete", next, categoryPayload{Name: "Reading"}), http.StatusPreconditionFailed)
+	expectStatus(t, serveIfMatch(t, h.DeleteCategory, http.MethodDelete, "/categories/delete", rec.Header().Get("ETag"), categoryPayload{Name: "Reading"}), http.StatusOK)
+	// without If-Match writes stay unconditional
+	expectStatus(t, serve(t, h.AddCategory, http.MethodPost, "/categories/add", categoryPayload{Name: "Books"}), http.StatusOK)
+}
@@ -0,0 +1,468 @@
+package storage
+
+import (
+	"cmp"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+const (
+	AccountTypeBank       = "bank"
+	AccountTypeCash       = "cash"
+	AccountTypeCreditCard = "credit_card"
+)
+
+// legacy values of Expense.Source, now derived from the account
+const (
+	SourceBank       = "CA"
+	SourceCash       = "EFECTIVO"
+	SourceCreditCard = "TARJETA"
+)
+
+// Account is where the money of an expense comes from or goes to: a bank
+// account, a cash wallet or a credit card, in a single currency
+type Account struct {
+	ID             string `json:"id"`
+	Name           string `json:"name"` // unique per currency, ignoring case
+	Type           string `json:"type"` // bank, cash or credit_card
+	Currency       string `json:"currency"`
+	OpeningBalance Money  `json:"openingBalance"`       // in the minor units of Currency once stored
+	Archived       bool   `json:"archived"`             // hidden from pickers, kept on existing expenses
+	ClosingDay     int    `json:"closingDay,omitempty"` // credit cards: day of the month the statement closes
+	DueDay         int    `json:"dueDay,omitempty"`     // credit cards: day of the month the statement is due
+}
+
+// AccountBalance is an account with the opening balance plus its live expenses
+type AccountBalance struct {
+	Account
+	Balance Money `json:"balance"`
+	Count   int   `json:"count"` // live expenses of the account
+}
+
+// Validate sanitizes the name, lowercases the type and currency and brings
+// the opening balance to the minor units of the currency
+func (a *Account) Validate() error {
+	a.Name = SanitizeString(a.Name)
+	if a.Name == "" {
+		return fmt.Errorf("account 'name' cannot be empty")
+	}
+	a.Type = strings.ToLower(strings.TrimSpace(a.Type))
+	if !slices.Contains([]string{AccountTypeBank, AccountTypeCash, AccountTypeCreditCard}, a.Type) {
+		return fmt.Errorf("invalid account type: '%s'. Must be one of 'bank', 'cash' or 'credit_card'", a.Type)
+	}
+	currency, err := ValidateCurrencyCode(a.Currency)
+	if err != nil {
+		return err
+	}
+	a.Currency = currency
+	if a.OpeningBalance, err = a.OpeningBalance.In(currency); err != nil {
+		return err
+	}
+	if a.Type != AccountTypeCreditCard {
+		a.ClosingDay, a.DueDay = 0, 0
+		return nil
+	}
+	if a.ClosingDay < 0 || a.ClosingDay > 31 || a.DueDay < 0 || a.DueDay > 31 {
+		return fmt.Errorf("account 'closingDay' and 'dueDay' must be between 1 and 31")
+	}
+	if (a.ClosingDay == 0) != (a.DueDay == 0) {
+		return fmt.Errorf("account 'closingDay' and 'dueDay' go together")
+	}
+	return nil
+}
+
+// legacyFields are the Source and Card an expense of the account carries,
+// kept for clients that still read them
+func (a Account) legacyFields() (source, card string) {
+	switch a.Type {
+	case AccountTypeCash:
+		return SourceCash, ""
+	case AccountTypeCreditCard:
+		return SourceCreditCard, a.Name
+	}
+	return SourceBank, ""
+}
+
+// legacyAccount maps the free-text Source and Card of an expense to the
+// account they stand for; false when the expense names no account
+func legacyAccount(source, card, currency string) (Account, bool) {
+	source = strings.ToUpper(SanitizeString(source))
+	card = SanitizeString(card)
+	switch {
+	case source == SourceCreditCard || (source == "" && card != ""):
+		if card == "" {
+			card = "Tarjeta"
+		}
+		return Account{Name: card, Type: AccountTypeCreditCard, Currency: currency}, true
+	case source == SourceCash:
+		return Account{Name: "Efectivo", Type: AccountTypeCash, Currency: currency}, true
+	case source == SourceBank:
+		return Account{Name: "Caja de ahorro", Type: AccountTypeBank, Currency: currency}, true
+	case source != "":
+		return Account{Name: SanitizeString(source), Type: AccountTypeBank, Currency: currency}, true
+	}
+	return Account{}, false
+}
+
+// findAccount returns the account named like name in the currency, ignoring case
+func findAccount(accounts []Account, name, currency string) (Account, bool) {
+	i := slices.IndexFunc(accounts, func(a Account) bool {
+		return a.Currency == currency && strings.EqualFold(a.Name, name)
+	})
+	if i < 0 {
+		return Account{}, false
+	}
+	return accounts[i], true
+}
+
+// requireUniqueAccount refuses a name already taken in the currency by another account
+func requireUniqueAccount(accounts []Account, a Account) error {
+	if other, ok := findAccount(accounts, a.Name, a.Currency); ok && other.ID != a.ID {
+		return fmt.Errorf("account %s already exists in %s", other.Name, a.Currency)
+	}
+	return nil
+}
+
+// attachAccount checks the account of an expense and derives its legacy
+// fields; current is the account the expense had before the change, which
+// may stay even once archived
+func attachAccount(e *Expense, a Account, current string) error {
+	if a.Currency != e.Currency {
+		return invalid(fmt.Errorf("account %s holds %s, not %s", a.Name, a.Currency, e.Currency))
+	}
+	if a.Archived && a.ID != current {
+		return invalid(fmt.Errorf("account %s is archived", a.Name))
+	}
+	e.AccountID = a.ID
+	e.Source, e.Card = a.legacyFields()
+	return nil
+}
+
+func compareAccounts(a, b Account) int {
+	if a.Archived != b.Archived {
+		if a.Archived {
+			return 1
+		}
+		return -1
+	}
+	return cmp.Or(strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name)), strings.Compare(a.Currency, b.Currency), strings.Compare(a.ID, b.ID))
+}
+
+const accountColumns = "id, name, type, currency, opening_balance, archived, closing_day, due_day"
+
+func scanAccount(scanner interface{ Scan(...any) error }) (Account, error) {
+	var a Account
+	if err := scanner.Scan(&a.ID, &a.Name, &a.Type, &a.Currency, &a.OpeningBalance.Units, &a.Archived, &a.ClosingDay, &a.DueDay); err != nil {
+		return Account{}, err
+	}
+	a.OpeningBalance.Scale = CurrencyDecimals(a.Currency)
+	return a, nil
+}
+
+// listAccounts returns the active accounts by name, then the archived ones
+func (d sqlDialect) listAccounts(q interface {
+	Query(string, ...any) (*sql.Rows, error)
+}) ([]Account, error) {
+	rows, err := q.Query(`SELECT ` + accountColumns + ` FROM accounts`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query accounts: %v", err)
+	}
+	defer rows.Close()
+	var accounts []Account
+	for rows.Next() {
+		a, err := scanAccount(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan account: %v", err)
+		}
+		accounts = append(accounts, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	slices.SortFunc(accounts, compareAccounts)
+	return accounts, nil
+}
+
+func (d sqlDialect) getAccount(q interface {
+	QueryRow(string, ...any) *sql.Row
+}, id string) (Account, error) {
+	query := fmt.Sprintf(`SELECT %s FROM accounts WHERE id = %s`, accountColumns, d.placeholder(1))
+	a, err := scanAccount(q.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return Account{}, fmt.Errorf("account with ID %s not found", id)
+	} else if err != nil {
+		return Account{}, fmt.Errorf("failed to get account: %v", err)
+	}
+	return a, nil
+}
+
+// requireAccount is getAccount for the account a write points to; a missing
+// one is invalid input
+func (d sqlDialect) requireAccount(tx *sql.Tx, id string) (Account, error) {
+	query := fmt.Sprintf(`SELECT %s FROM accounts WHERE id = %s`, accountColumns, d.placeholder(1))
+	a, err := scanAccount(tx.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return Account{}, invalid(fmt.Errorf("account with ID %s not found", id))
+	} else if err != nil {
+		return Account{}, fmt.Errorf("failed to get account: %v", err)
+	}
+	return a, nil
+}
+
+func (d sqlDialect) insertAccount(tx *sql.Tx, a Account) error {
+	insert := fmt.Sprintf(`INSERT INTO accounts (%s) VALUES (%s, %s, %s, %s, %s, %s, %s, %s)`, accountColumns,
+		d.placeholder(1), d.placeholder(2), d.placeholder(3), d.placeholder(4), d.placeholder(5), d.placeholder(6), d.placeholder(7), d.placeholder(8))
+	if _, err := tx.Exec(insert, a.ID, a.Name, a.Type, a.Currency, a.OpeningBalance.Units, a.Archived, a.ClosingDay, a.DueDay); err != nil {
+		return fmt.Errorf("failed to save account: %v", err)
+	}
+	return nil
+}
+
+// accountUsage counts the expenses of an account, trashed ones, transfers
+// into it and recurring rules included
+func (d sqlDialect) accountUsage(tx *sql.Tx, id string) (int, error) {
+	var count int
+	query := fmt.Sprintf(`SELECT (SELECT COUNT(1) FROM expenses WHERE account_id = %s OR to_account_id = %s)
+		+ (SELECT COUNT(1) FROM recurring_expenses WHERE account_id = %s)`, d.placeholder(1), d.placeholder(2), d.placeholder(3))
+	err := tx.QueryRow(query, id, id, id).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count expenses of account %s: %v", id, err)
+	}
+	return count, nil
+}
+
+func (d sqlDialect) addAccount(db *sql.DB, a Account) error {
+	if err := a.Validate(); err != nil {
+		return err
+	}
+	if a.ID == "" {
+		a.ID = uuid.New().String()
+	}
+	return withTx(db, func(tx *sql.Tx) error {
+		if err := d.requireCurrency(tx, a.Currency); err != nil {
+			return err
+		}
+		accounts, err := d.listAccounts(tx)
+		if err != nil {
+			return err
+		}
+		if err := requireUniqueAccount(accounts, a); err != nil {
+			return err
+		}
+		if err := d.insertAccount(tx, a); err != nil {
+			return err
+		}
+		return d.recordAudit(tx, auditChange{entity: AuditAccount, id: a.ID, action: AuditCreate, after: a})
+	})
+}
+
+// updateAccount replaces an account and refreshes the legacy fields of its
+// expenses and recurring rules; the currency only changes while the account is unused
+func (d sqlDialect) updateAccount(db *sql.DB, id string, a Account) error {
+	if err := a.Validate(); err != nil {
+		return err
+	}
+	a.ID = id
+	return withTx(db, func(tx *sql.Tx) error {
+		before, err := d.getAccount(tx, id)
+		if err != nil {
+			return err
+		}
+		if a.Currency != before.Currency {
+			used, err := d.accountUsage(tx, id)
+			if err != nil {
+				return err
+			}
+			if used > 0 {
+				return fmt.Errorf("account %s is used by %d expenses; its currency cannot change", before.Name, used)
+			}
+			if err := d.requireCurrency(tx, a.Currency); err != nil {
+				return err
+			}
+		}
+		accounts, err := d.listAccounts(tx)
+		if err != nil {
+			return err
+		}
+		if err := requireUniqueAccount(accounts, a); err != nil {
+			return err
+		}
+		update := fmt.Sprintf(`UPDATE accounts SET name = %s, type = %s, currency = %s, opening_balance = %s, archived = %s, closing_day = %s, due_day = %s WHERE id = %s`,
+			d.placeholder(1), d.placeholder(2), d.placeholder(3), d.placeholder(4), d.placeholder(5), d.placeholder(6), d.placeholder(7), d.placeholder(8))
+		if _, err := tx.Exec(update, a.Name, a.Type, a.Currency, a.OpeningBalance.Units, a.Archived, a.ClosingDay, a.DueDay, id); err != nil {
+			return fmt.Errorf("failed to update account: %v", err)
+		}
+		source, card := a.legacyFields()
+		for _, table := range []string{"expenses", "recurring_expenses"} {
+			cascade := fmt.Sprintf(`UPDATE %s SET source = %s, card = %s, version = version + 1
+				WHERE account_id = %s AND (COALESCE(source, '') <> %s OR COALESCE(card, '') <> %s)`,
+				table, d.placeholder(1), d.placeholder(2), d.placeholder(3), d.placeholder(4), d.placeholder(5))
+			if _, err := tx.Exec(cascade, source, card, id, source, card); err != nil {
+				return fmt.Errorf("failed to update %s of account: %v", strings.ReplaceAll(table, "_", " "), err)
+			}
+		}
+		return d.recordAudit(tx, auditChange{entity: AuditAccount, id: id, action: AuditUpdate, before: before, after: a})
+	})
+}
+
+// deleteAccount refuses an account still referenced by an expense
+func (d sqlDialect) deleteAccount(db *sql.DB, id string) error {
+	return withTx(db, func(tx *sql.Tx) error {
+		before, err := d.getAccount(tx, id)
+		if err != nil {
+			return err
+		}
+		used, err := d.accountUsage(tx, id)
+		if err != nil {
+			return err
+		}
+		if used > 0 {
+			return fmt.Errorf("account %s is used by %d expenses; archive it instead", before.Name, used)
+		}
+		if _, err := tx.Exec(fmt.Sprintf(`DELETE FROM accounts WHERE id = %s`, d.placeholder(1)), id); err != nil {
+			return fmt.Errorf("failed to delete account: %v", err)
+		}
+		return d.recordAudit(tx, auditChange{entity: AuditAccount, id: id, action: AuditDelete, before: before})
+	})
+}
+
+// accountBalances adds the live expenses of every account to its opening
+// balance; transfers also count, with the opposite sign, on their destination
+func (d sqlDialect) accountBalances(db *sql.DB) ([]AccountBalance, error) {
+	accounts, err := d.listAccounts(db)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(`SELECT account_id, SUM(amount), COUNT(1) FROM expenses
+		WHERE deleted_at IS NULL AND account_id IS NOT NULL GROUP BY account_id
+		UNION ALL
+		SELECT to_account_id, -SUM(amount), COUNT(1) FROM expenses
+		WHERE deleted_at IS NULL AND COALESCE(to_account_id, '') <> '' GROUP BY to_account_id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sum expenses by account: %v", err)
+	}
+	defer rows.Close()
+	type total struct {
+		units int64
+		count int
+	}
+	totals := map[string]total{}
+	for rows.Next() {
+		var id string
+		var t total
+		if err := rows.Scan(&id, &t.units, &t.count); err != nil {
+			return nil, fmt.Errorf("failed to scan account sum: %v", err)
+		}
+		sum := totals[id]
+		totals[id] = total{units: sum.units + t.units, count: sum.count + t.count}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	var balances []AccountBalance
+	for _, a := range accounts {
+		t := totals[a.ID]
+		balance := a.OpeningBalance
+		balance.Units += t.units
+		balances = append(balances, AccountBalance{Account: a, Balance: balance, Count: t.count})
+	}
+	return balances, nil
+}
+
+// resolveAccount points an expense at its account before it is written.
+// Without an AccountID the legacy Source and Card pick the account, which
+// is created when missing; current is the stored expense, zero on insert.
+func (d sqlDialect) resolveAccount(tx *sql.Tx, e *Expense, current Expense) error {
+	if e.Type == TransactionTypeTransfer {
+		to, err := d.requireAccount(tx, e.ToAccountID)
+		if err != nil {
+			return err
+		}
+		if err := attachDestination(e, to, current.ToAccountID); err != nil {
+			return err
+		}
+	}
+	if e.AccountID == "" {
+		legacy, ok := legacyAccount(e.Source, e.Card, e.Currency)
+		if !ok {
+			e.Source, e.Card = "", ""
+			return nil
+		}
+		accounts, err := d.listAccounts(tx)
+		if err != nil {
+			return err
+		}
+		a, found := findAccount(accounts, legacy.Name, legacy.Currency)
+		if !found {
+			a = legacy
+			a.ID = uuid.New().String()
+			a.OpeningBalance = Money{Scale: CurrencyDecimals(a.Currency)}
+			if err := d.insertAccount(tx, a); err != nil {
+				return err
+			}
+			if err := d.recordAudit(tx, auditChange{entity: AuditAccount, id: a.ID, action: AuditCreate, detail: "created from expense source", after: a}); err != nil {
+				return err
+			}
+		}
+		return attachAccount(e, a, current.AccountID)
+	}
+	a, err := d.requireAccount(tx, e.AccountID)
+	if err != nil {
+		return err
+	}
+	return attachAccount(e, a, current.AccountID)
+}
+
+// mapLegacyAccounts turns the distinct source and card values of the stored
+// expenses, trashed ones included, into accounts and links the expenses
+func mapLegacyAccounts(tx *sql.Tx, d sqlDialect) error {
+	rows, err := tx.Query(`SELECT DISTINCT COALESCE(source, ''), COALESCE(card, ''), currency FROM expenses ORDER BY 1, 2, 3`)
+	if err != nil {
+		return err
+	}
+	type legacyValue struct{ source, card, currency string }
+	var values []legacyValue
+	for rows.Next() {
+		var v legacyValue
+		if err := rows.Scan(&v.source, &v.card, &v.currency); err != nil {
+			rows.Close()
+			return err
+		}
+		values = append(values, v)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	var accounts []Account
+	// the columns of accounts as this migration created them
+	insert := fmt.Sprintf(`INSERT INTO accounts (id, name, type, currency, opening_balance, archived) VALUES (%s, %s, %s, %s, 0, %s)`,
+		d.placeholder(1), d.placeholder(2), d.placeholder(3), d.placeholder(4), d.placeholder(5))
+	link := fmt.Sprintf(`UPDATE expenses SET account_id = %s, source = %s, card = %s
+		WHERE COALESCE(source, '') = %s AND COALESCE(card, '') = %s AND currency = %s`,
+		d.placeholder(1), d.placeholder(2), d.placeholder(3), d.placeholder(4), d.placeholder(5), d.placeholder(6))
+	for _, v := range values {
+		legacy, ok := legacyAccount(v.source, v.card, v.currency)
+		if !ok {
+			continue
+		}
+		a, found := findAccount(accounts, legacy.Name, legacy.Currency)
+		if !found {
+			a = legacy
+			a.ID = uuid.New().String()
+			if _, err := tx.Exec(insert, a.ID, a.Name, a.Type, a.Currency, false); err != nil {
+				return err
+			}
+			accounts = append(accounts, a)
+		}
+		source, card := a.legacyFields()
+		if _, err := tx.Exec(link, a.ID, source, card, v.source, v.card, v.currency); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,265 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// AuditEntry records one change to an expense, a recurring rule, the
+// categories, the config or a currency exchange, with JSON snapshots of the record around it
+type AuditEntry struct {
+	ID       int64           `json:"id"`
+	At       time.Time       `json:"at"`
+	Entity   string          `json:"entity"`
+	EntityID string          `json:"entityId"` // expense or rule id, category name; empty for list-wide changes
+	Action   string          `json:"action"`
+	Detail   string          `json:"detail,omitempty"`
+	Before   json.RawMessage `json:"before"` // null on create
+	After    json.RawMessage `json:"after"`  // null on delete
+}
+
+// audited entities
+const (
+	AuditExpense     = "expense"
+	AuditRecurring   = "recurring"
+	AuditCategory    = "category"
+	AuditConfig      = "config"
+	AuditExchange    = "exchange"
+	AuditAccount     = "account"
+	AuditInstallment = "installment"
+)
+
+// audited actions; deleting an expense moves it to the trash, purge removes it for good
+const (
+	AuditCreate  = "create"
+	AuditUpdate  = "update"
+	AuditRename  = "rename"
+	AuditDelete  = "delete"
+	AuditRestore = "restore"
+	AuditPurge   = "purge"
+)
+
+// AuditFilter narrows the activity feed; zero-valued fields do not filter
+type AuditFilter struct {
+	Entity   string
+	EntityID string
+	Before   int64 // only entries older than this id, for paging
+	Limit    int   // 0 returns every match
+}
+
+func (f AuditFilter) Matches(e AuditEntry) bool {
+	if f.Entity != "" && e.Entity != f.Entity {
+		return false
+	}
+	if f.EntityID != "" && e.EntityID != f.EntityID {
+		return false
+	}
+	return f.Before == 0 || e.ID < f.Before
+}
+
+// configSnapshot is the audited part of the config; categories and rules
+// have entries of their own
+type configSnapshot struct {
+	Currency  string `json:"currency"`
+	StartDate int    `json:"startDate"`
+}
+
+// auditChange is an entry before it is numbered and stamped
+type auditChange struct {
+	entity, id, action, detail string
+	before, after              any // nil records a null snapshot
+}
+
+func snapshot(v any) (json.RawMessage, error) {
+	if v == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to snapshot %T: %v", v, err)
+	}
+	return data, nil
+}
+
+func (c auditChange) entry(at time.Time) (AuditEntry, error) {
+	before, err := snapshot(c.before)
+	if err != nil {
+		return AuditEntry{}, err
+	}
+	after, err := snapshot(c.after)
+	if err != nil {
+		return AuditEntry{}, err
+	}
+	return AuditEntry{At: at, Entity: c.entity, EntityID: c.id, Action: c.action, Detail: c.detail, Before: before, After: after}, nil
+}
+
+// nullableJSON stores a missing snapshot as NULL rather than the text "null"
+func nullableJSON(data json.RawMessage) any {
+	if data == nil {
+		return nil
+	}
+	return string(data)
+}
+
+// recordAudit appends entries inside the transaction of the change they describe
+func (d sqlDialect) recordAudit(tx *sql.Tx, changes ...auditChange) error {
+	insert := fmt.Sprintf(`INSERT INTO audit_log (at, entity, entity_id, action, detail, before_data, after_data) VALUES (%s, %s, %s, %s, %s, %s, %s)`,
+		d.placeholder(1), d.placeholder(2), d.placeholder(3), d.placeholder(4), d.placeholder(5), d.placeholder(6), d.placeholder(7))
+	at := time.Now().UTC()
+	for _, change := range changes {
+		entry, err := change.entry(at)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(insert, entry.At, entry.Entity, entry.EntityID, entry.Action, entry.Detail,
+			nullableJSON(entry.Before), nullableJSON(entry.After)); err != nil {
+			return fmt.Errorf("failed to record %s %s: %v", entry.Entity, entry.Action, err)
+		}
+	}
+	return nil
+}
+
+// queryAudit lists the matching entries newest first
+func (d sqlDialect) queryAudit(db *sql.DB, f AuditFilter) ([]AuditEntry, error) {
+	var conds []string
+	var args []any
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, d.placeholder(len(args))))
+	}
+	if f.Entity != "" {
+		add("entity = %s", f.Entity)
+	}
+	if f.EntityID != "" {
+		add("entity_id = %s", f.EntityID)
+	}
+	if f.Before > 0 {
+		add("id < %s", f.Before)
+	}
+	query := `SELECT id, at, entity, entity_id, action, detail, before_data, after_data FROM audit_log`
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	query += " ORDER BY id DESC"
+	if f.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", f.Limit)
+	}
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit log: %v", err)
+	}
+	defer rows.Close()
+	var entries []AuditEntry
+	for rows.Next() {
+		var entry AuditEntry
+		var before, after sql.NullString
+		if err := rows.Scan(&entry.ID, &entry.At, &entry.Entity, &entry.EntityID, &entry.Action, &entry.Detail, &before, &after); err != nil {
+			return nil, fmt.Errorf("failed to scan audit entry: %v", err)
+		}
+		if before.Valid {
+			entry.Before = json.RawMessage(before.String)
+		}
+		if after.Valid {
+			entry.After = json.RawMessage(after.String)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// loadExpense reads an expense inside a transaction, trashed or not
+func (d sqlDialect) loadExpense(tx *sql.Tx, id string) (Expense, error) {
+	query := fmt.Sprintf(`SELECT %s FROM expenses WHERE id = %s`, d.expenseColumns(), d.placeholder(1))
+	return scanExpense(tx.QueryRow(query, id))
+}
+
+// loadExpenses reads the listed expenses that exist, in the order of ids
+func (d sqlDialect) loadExpenses(tx *sql.Tx, ids []string) ([]Expense, error) {
+	var expenses []Expense
+	for _, id := range ids {
+		expense, err := d.loadExpense(tx, id)
+		if err == sql.ErrNoRows {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read expense %s: %v", id, err)
+		}
+		expenses = append(expenses, expense)
+	}
+	return expenses, nil
+}
+
+// loadRecurring reads a recurring rule inside a transaction
+func (d sqlDialect) loadRecurring(tx *sql.Tx, id string) (RecurringExpense, error) {
+	query := fmt.Sprintf(`SELECT %s FROM recurring_expenses WHERE id = %s`, d.recurringColumns(), d.placeholder(1))
+	return scanRecurringExpense(tx.QueryRow(query, id))
+}
+
+// loadCategory reads one category inside a transaction
+func (d sqlDialect) loadCategory(tx *sql.Tx, name string) (Category, error) {
+	categories, err := d.listCategories(tx)
+	if err != nil {
+		return Category{}, err
+	}
+	for _, category := range categories {
+		if category.Name == name {
+			return category, nil
+		}
+	}
+	return Category{}, fmt.Errorf("category %s not found", name)
+}
+
+// recordOwnerChanges completes the update entries a cascade started with the
+// owners as the cascade left them and records them
+func (d sqlDialect) recordOwnerChanges(tx *sql.Tx, changes []auditChange) error {
+	for i, change := range changes {
+		after, err := d.loadOwner(tx, change.entity, change.id)
+		if err != nil {
+			return err
+		}
+		changes[i].after = after
+	}
+	return d.recordAudit(tx, changes...)
+}
+
+// loadOwner reads the expense, rule or purchase a cascade of a tag or a
+// category reaches
+func (d sqlDialect) loadOwner(tx *sql.Tx, entity, id string) (any, error) {
+	switch entity {
+	case AuditRecurring:
+		re, err := d.loadRecurring(tx, id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read recurring expense %s: %v", id, err)
+		}
+		return re, nil
+	case AuditInstallment:
+		return d.getInstallment(tx, id)
+	}
+	e, err := d.loadExpense(tx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read expense %s: %v", id, err)
+	}
+	return e, nil
+}
+
+// updateConfig applies updater to the stored config and records the change
+func (d sqlDialect) updateConfig(db *sql.DB, updater func(c *configSnapshot)) (configSnapshot, error) {
+	var after configSnapshot
+	err := withTx(db, func(tx *sql.Tx) error {
+		var before configSnapshot
+		err := tx.QueryRow(`SELECT currency, start_date FROM config WHERE id = 'default'`).Scan(&before.Currency, &before.StartDate)
+		if err != nil {
+			return fmt.Errorf("failed to get config from db: %v", err)
+		}
+		after = before
+		updater(&after)
+		update := fmt.Sprintf(`UPDATE config SET currency = %s, start_date = %s WHERE id = 'default'`, d.placeholder(1), d.placeholder(2))
+		if _, err := tx.Exec(update, after.Currency, after.StartDate); err != nil {
+			return fmt.Errorf("failed to save config: %v", err)
+		}
+		return d.recordAudit(tx, auditChange{entity: AuditConfig, action: AuditUpdate, before: before, after: after})
+	})
+	return after, err
+}
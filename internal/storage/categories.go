@@ -0,0 +1,557 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+const (
+	CategoryTypeExpense = "expense"
+	CategoryTypeIncome  = "income"
+	CategoryTypeBoth    = "both"
+)
+
+// Category is an entry of the ordered category list
+type Category struct {
+	Name     string `json:"name"`
+	Color    string `json:"color"`    // #rrggbb; empty lets the UI pick one
+	Icon     string `json:"icon"`     // Font Awesome icon name, e.g. "utensils"
+	Type     string `json:"type"`     // expense, income or both
+	Archived bool   `json:"archived"` // hidden from pickers, kept on existing expenses
+	Parent   string `json:"parent"`   // name of the parent category, empty at the top level
+}
+
+var (
+	reCategoryColor = regexp.MustCompile(`^#[0-9a-f]{6}$`)
+	reCategoryIcon  = regexp.MustCompile(`^[a-z0-9-]*$`)
+)
+
+// UnmarshalJSON also accepts a bare name, the format used before categories
+// carried metadata
+func (c *Category) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*c = Category{Name: name}
+		return nil
+	}
+	type plain Category
+	return json.Unmarshal(data, (*plain)(c))
+}
+
+// Validate sanitizes the name and normalizes the metadata; the type defaults to expense
+func (c *Category) Validate() error {
+	name, err := ValidateCategory(c.Name)
+	if err != nil {
+		return err
+	}
+	c.Name = name
+	c.Color = strings.ToLower(strings.TrimSpace(c.Color))
+	if c.Color != "" && !reCategoryColor.MatchString(c.Color) {
+		return fmt.Errorf("invalid color: '%s'. Must be a hex color like #ff6b6b", c.Color)
+	}
+	c.Icon = strings.ToLower(strings.TrimSpace(c.Icon))
+	if !reCategoryIcon.MatchString(c.Icon) {
+		return fmt.Errorf("invalid icon: '%s'. Must contain only letters, digits and dashes", c.Icon)
+	}
+	c.Type = strings.ToLower(strings.TrimSpace(c.Type))
+	switch c.Type {
+	case "":
+		c.Type = CategoryTypeExpense
+	case CategoryTypeExpense, CategoryTypeIncome, CategoryTypeBoth:
+	default:
+		return fmt.Errorf("invalid category type: '%s'. Must be one of 'expense', 'income' or 'both'", c.Type)
+	}
+	return nil
+}
+
+// NewCategory returns the default metadata for a category name: the one of
+// the matching default category, or a plain expense category
+func NewCategory(name string) Category {
+	for _, category := range defaultCategories {
+		if strings.EqualFold(category.Name, name) {
+			category.Name = name
+			return category
+		}
+	}
+	return Category{Name: name, Type: CategoryTypeExpense}
+}
+
+func categoryNames(categories []Category) []string {
+	names := make([]string, len(categories))
+	for i, category := range categories {
+		names[i] = category.Name
+	}
+	return names
+}
+
+// normalizeCategoryList checks a list about to be stored and returns a copy
+// where a missing type reads as expense
+func normalizeCategoryList(categories []Category) ([]Category, error) {
+	if len(categories) == 0 {
+		return nil, fmt.Errorf("categories cannot be empty")
+	}
+	normalized := slices.Clone(categories)
+	for i, cat := range normalized {
+		if strings.TrimSpace(cat.Name) == "" {
+			return nil, fmt.Errorf("category names cannot be empty")
+		}
+		if cat.Type == "" {
+			normalized[i].Type = CategoryTypeExpense
+		}
+	}
+	if err := ValidateCategoryTree(normalized); err != nil {
+		return nil, err
+	}
+	return normalized, nil
+}
+
+// ValidateCategoryTree checks that every parent is a category of the list and
+// that no category ends up nested under itself
+func ValidateCategoryTree(categories []Category) error {
+	parents := make(map[string]string, len(categories))
+	for _, cat := range categories {
+		parents[cat.Name] = cat.Parent
+	}
+	for _, cat := range categories {
+		if cat.Parent == "" {
+			continue
+		}
+		if _, ok := parents[cat.Parent]; !ok {
+			return fmt.Errorf("parent category %s of %s not found", cat.Parent, cat.Name)
+		}
+		seen := map[string]bool{cat.Name: true}
+		for parent := cat.Parent; parent != ""; parent = parents[parent] {
+			if seen[parent] {
+				return fmt.Errorf("category %s cannot be nested under itself", cat.Name)
+			}
+			seen[parent] = true
+		}
+	}
+	return nil
+}
+
+// CategoryAncestors returns the chain of parents of name, nearest first
+func CategoryAncestors(categories []Category, name string) []string {
+	parents := make(map[string]string, len(categories))
+	for _, cat := range categories {
+		parents[cat.Name] = cat.Parent
+	}
+	var ancestors []string
+	// bounded by the list size in case the tree was never validated
+	for parent := parents[name]; parent != "" && len(ancestors) < len(categories); parent = parents[parent] {
+		ancestors = append(ancestors, parent)
+	}
+	return ancestors
+}
+
+// CategorySum aggregates the expenses of one category in one currency
+type CategorySum struct {
+	Category string `json:"category"`
+	Currency string `json:"currency"`
+	Amount   Money  `json:"amount"`
+	Count    int    `json:"count"`
+}
+
+// CategoryTotal is a category with its own sums and the sums rolled up from
+// every subcategory below it, both keyed by currency
+type CategoryTotal struct {
+	Category   string           `json:"category"`
+	Parent     string           `json:"parent"`
+	Own        map[string]Money `json:"own"`
+	Total      map[string]Money `json:"total"`
+	Count      int              `json:"count"`
+	TotalCount int              `json:"totalCount"`
+}
+
+// RollUpCategoryTotals adds each sum to its category and to all of its
+// ancestors. Categories keep the list order; expenses filed under a name
+// missing from the list are reported as extra top-level entries.
+func RollUpCategoryTotals(categories []Category, sums []CategorySum) ([]CategoryTotal, error) {
+	var totals []CategoryTotal
+	index := map[string]int{}
+	entry := func(name, parent string) *CategoryTotal {
+		if i, ok := index[name]; ok {
+			return &totals[i]
+		}
+		index[name] = len(totals)
+		totals = append(totals, CategoryTotal{Category: name, Parent: parent, Own: map[string]Money{}, Total: map[string]Money{}})
+		return &totals[len(totals)-1]
+	}
+	for _, cat := range categories {
+		entry(cat.Name, cat.Parent)
+	}
+	var err error
+	for _, sum := range sums {
+		own := entry(sum.Category, "")
+		if own.Own[sum.Currency], err = own.Own[sum.Currency].Add(sum.Amount); err != nil {
+			return nil, err
+		}
+		own.Count += sum.Count
+		for _, name := range append([]string{sum.Category}, CategoryAncestors(categories, sum.Category)...) {
+			total := entry(name, "")
+			if total.Total[sum.Currency], err = total.Total[sum.Currency].Add(sum.Amount); err != nil {
+				return nil, err
+			}
+			total.TotalCount += sum.Count
+		}
+	}
+	return totals, nil
+}
+
+// listCategories reads the categories table in display order
+func (d sqlDialect) listCategories(q interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}) ([]Category, error) {
+	rows, err := q.Query(`
+		SELECT c.name, c.color, c.icon, c.type, c.archived, COALESCE(p.name, '')
+		FROM categories c LEFT JOIN categories p ON p.id = c.parent_id
+		ORDER BY c.position ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query categories: %v", err)
+	}
+	defer rows.Close()
+	var categories []Category
+	for rows.Next() {
+		var category Category
+		if err := rows.Scan(&category.Name, &category.Color, &category.Icon, &category.Type, &category.Archived, &category.Parent); err != nil {
+			return nil, fmt.Errorf("failed to scan category: %v", err)
+		}
+		categories = append(categories, category)
+	}
+	return categories, rows.Err()
+}
+
+// getCategories returns the stored categories, seeding the defaults into an empty table
+func (d sqlDialect) getCategories(db *sql.DB) ([]Category, error) {
+	categories, err := d.listCategories(db)
+	if err != nil {
+		return nil, err
+	}
+	if len(categories) == 0 {
+		categories = slices.Clone(defaultCategories)
+		err := withTx(db, func(tx *sql.Tx) error {
+			return d.writeCategories(tx, categories)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to seed categories: %v", err)
+		}
+	}
+	return categories, nil
+}
+
+// saveCategories replaces the category list: entries are upserted in order
+// and categories missing from the list are deleted
+func (d sqlDialect) saveCategories(db *sql.DB, categories []Category, version int64) error {
+	categories, err := normalizeCategoryList(categories)
+	if err != nil {
+		return err
+	}
+	return withTx(db, func(tx *sql.Tx) error {
+		if _, err := d.bumpVersion(tx, categoriesVersion, version); err != nil {
+			return err
+		}
+		before, err := d.listCategories(tx)
+		if err != nil {
+			return err
+		}
+		if err := d.writeCategories(tx, categories); err != nil {
+			return err
+		}
+		return d.recordAudit(tx, auditChange{entity: AuditCategory, action: AuditUpdate, before: before, after: categories})
+	})
+}
+
+// writeCategories stores a normalized category list
+func (d sqlDialect) writeCategories(tx *sql.Tx, categories []Category) error {
+	upsert := fmt.Sprintf(`INSERT INTO categories (name, position, color, icon, type, archived) VALUES (%s, %s, %s, %s, %s, %s)
+		ON CONFLICT (name) DO UPDATE SET position = EXCLUDED.position, color = EXCLUDED.color,
+			icon = EXCLUDED.icon, type = EXCLUDED.type, archived = EXCLUDED.archived`,
+		d.placeholder(1), d.placeholder(2), d.placeholder(3), d.placeholder(4), d.placeholder(5), d.placeholder(6))
+	for i, category := range categories {
+		if _, err := tx.Exec(upsert, category.Name, i+1, category.Color, category.Icon, category.Type, category.Archived); err != nil {
+			return fmt.Errorf("failed to save category %s: %v", category.Name, err)
+		}
+	}
+	placeholders := make([]string, len(categories))
+	args := make([]any, len(categories))
+	for i, category := range categories {
+		placeholders[i] = d.placeholder(i + 1)
+		args[i] = category.Name
+	}
+	inUse := fmt.Sprintf(`SELECT name FROM categories WHERE name NOT IN (%s) AND (
+		EXISTS (SELECT 1 FROM expenses e WHERE e.category = categories.name) OR
+		EXISTS (SELECT 1 FROM recurring_expenses r WHERE r.category = categories.name) OR
+		EXISTS (SELECT 1 FROM installment_purchases p WHERE p.category = categories.name))`, strings.Join(placeholders, ", "))
+	var used string
+	err := tx.QueryRow(inUse, args...).Scan(&used)
+	if err == nil {
+		return fmt.Errorf("category %s is still in use and cannot be removed from the list", used)
+	} else if err != sql.ErrNoRows {
+		return fmt.Errorf("failed to check removed categories: %v", err)
+	}
+	deleteQuery := fmt.Sprintf(`DELETE FROM categories WHERE name NOT IN (%s)`, strings.Join(placeholders, ", "))
+	if _, err := tx.Exec(deleteQuery, args...); err != nil {
+		return fmt.Errorf("failed to delete removed categories: %v", err)
+	}
+	// parents are linked by id once every row of the list exists
+	link := fmt.Sprintf(`UPDATE categories SET parent_id = (SELECT p.id FROM categories p WHERE p.name = %s) WHERE name = %s`,
+		d.placeholder(1), d.placeholder(2))
+	for _, category := range categories {
+		var parent any
+		if category.Parent != "" {
+			parent = category.Parent
+		}
+		if _, err := tx.Exec(link, parent, category.Name); err != nil {
+			return fmt.Errorf("failed to set parent of category %s: %v", category.Name, err)
+		}
+	}
+	return nil
+}
+
+// requireCategory fails unless name is a stored category; expense and rule
+// writes call it inside their transaction
+func (d sqlDialect) requireCategory(tx *sql.Tx, name string) error {
+	var exists int
+	err := tx.QueryRow(fmt.Sprintf(`SELECT COUNT(1) FROM categories WHERE name = %s`, d.placeholder(1)), name).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to check category %s: %v", name, err)
+	}
+	if exists == 0 {
+		return invalid(fmt.Errorf("category %s not found", name))
+	}
+	return nil
+}
+
+// requireExpenseCategory is requireCategory for an expense; transfers have none
+func (d sqlDialect) requireExpenseCategory(tx *sql.Tx, e Expense) error {
+	if e.Type == TransactionTypeTransfer {
+		return nil
+	}
+	return d.requireCategory(tx, e.Category)
+}
+
+// categoryOwners are the tables filed under a category, with the audit
+// entity of their rows; purchases carry no version
+var categoryOwners = []struct {
+	table, entity string
+	versioned     bool
+}{
+	{"expenses", AuditExpense, true},
+	{"recurring_expenses", AuditRecurring, true},
+	{"installment_purchases", AuditInstallment, false},
+}
+
+// reassignCategory points every expense, recurring rule and installment
+// purchase filed under from to to, recording an update of each with detail
+func (d sqlDialect) reassignCategory(tx *sql.Tx, from, to, detail string) error {
+	if from == to {
+		return nil
+	}
+	var changes []auditChange
+	for _, owner := range categoryOwners {
+		rows, err := tx.Query(fmt.Sprintf(`SELECT id FROM %s WHERE category = %s ORDER BY id`, owner.table, d.placeholder(1)), from)
+		if err != nil {
+			return fmt.Errorf("failed to list %s of category %s: %v", strings.ReplaceAll(owner.table, "_", " "), from, err)
+		}
+		var ids []string
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		for _, id := range ids {
+			before, err := d.loadOwner(tx, owner.entity, id)
+			if err != nil {
+				return err
+			}
+			changes = append(changes, auditChange{entity: owner.entity, id: id, action: AuditUpdate, detail: detail, before: before})
+		}
+		update := fmt.Sprintf(`UPDATE %s SET category = %s WHERE category = %s`, owner.table, d.placeholder(1), d.placeholder(2))
+		if owner.versioned {
+			update = fmt.Sprintf(`UPDATE %s SET category = %s, version = version + 1 WHERE category = %s`, owner.table, d.placeholder(1), d.placeholder(2))
+		}
+		if _, err := tx.Exec(update, to, from); err != nil {
+			return fmt.Errorf("failed to move %s of category %s: %v", strings.ReplaceAll(owner.table, "_", " "), from, err)
+		}
+	}
+	return d.recordOwnerChanges(tx, changes)
+}
+
+// renameCategory renames in place, keeping the position and the parent links,
+// and moves every expense and recurring rule along in the same transaction
+func (d sqlDialect) renameCategory(db *sql.DB, from, to string, version int64) error {
+	return withTx(db, func(tx *sql.Tx) error {
+		if _, err := d.bumpVersion(tx, categoriesVersion, version); err != nil {
+			return err
+		}
+		var exists int
+		err := tx.QueryRow(fmt.Sprintf(`SELECT COUNT(1) FROM categories WHERE name = %s`, d.placeholder(1)), to).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("failed to check category %s: %v", to, err)
+		}
+		if exists > 0 && from != to {
+			return fmt.Errorf("category %s already exists", to)
+		}
+		before, err := d.loadCategory(tx, from)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(fmt.Sprintf(`UPDATE categories SET name = %s WHERE name = %s`, d.placeholder(1), d.placeholder(2)), to, from); err != nil {
+			return fmt.Errorf("failed to rename category: %v", err)
+		}
+		if err := d.reassignCategory(tx, from, to, fmt.Sprintf("category %s renamed to %s", from, to)); err != nil {
+			return err
+		}
+		after := before
+		after.Name = to
+		return d.recordAudit(tx, auditChange{entity: AuditCategory, id: to, action: AuditRename, before: before, after: after})
+	})
+}
+
+// deleteCategory removes a category, moving its expenses, rules and purchases to
+// reassignTo and its subcategories up to its own parent. Without reassignTo
+// a category still in use is refused.
+func (d sqlDialect) deleteCategory(db *sql.DB, name, reassignTo string, version int64) error {
+	return withTx(db, func(tx *sql.Tx) error {
+		if _, err := d.bumpVersion(tx, categoriesVersion, version); err != nil {
+			return err
+		}
+		before, err := d.loadCategory(tx, name)
+		if err != nil {
+			return err
+		}
+		var id int64
+		var parentID sql.NullInt64
+		err = tx.QueryRow(fmt.Sprintf(`SELECT id, parent_id FROM categories WHERE name = %s`, d.placeholder(1)), name).Scan(&id, &parentID)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("category %s not found", name)
+		} else if err != nil {
+			return fmt.Errorf("failed to resolve category %s: %v", name, err)
+		}
+		if reassignTo == "" {
+			var used int
+			usage := fmt.Sprintf(`SELECT (SELECT COUNT(1) FROM expenses WHERE category = %s) + (SELECT COUNT(1) FROM recurring_expenses WHERE category = %s)
+				+ (SELECT COUNT(1) FROM installment_purchases WHERE category = %s)`,
+				d.placeholder(1), d.placeholder(2), d.placeholder(3))
+			if err := tx.QueryRow(usage, name, name, name).Scan(&used); err != nil {
+				return fmt.Errorf("failed to check usage of category %s: %v", name, err)
+			}
+			if used > 0 {
+				return fmt.Errorf("category %s is used by %d expenses, recurring rules and installment purchases", name, used)
+			}
+		} else {
+			if reassignTo == name {
+				return fmt.Errorf("category %s cannot be reassigned to itself", name)
+			}
+			if err := d.requireCategory(tx, reassignTo); err != nil {
+				return err
+			}
+			if err := d.reassignCategory(tx, name, reassignTo, fmt.Sprintf("category %s deleted, reassigned to %s", name, reassignTo)); err != nil {
+				return err
+			}
+		}
+		lift := fmt.Sprintf(`UPDATE categories SET parent_id = %s WHERE parent_id = %s`, d.placeholder(1), d.placeholder(2))
+		if _, err := tx.Exec(lift, parentID, id); err != nil {
+			return fmt.Errorf("failed to move subcategories of %s: %v", name, err)
+		}
+		if _, err := tx.Exec(fmt.Sprintf(`DELETE FROM categories WHERE id = %s`, d.placeholder(1)), id); err != nil {
+			return fmt.Errorf("failed to delete category: %v", err)
+		}
+		var remaining int
+		if err := tx.QueryRow(`SELECT COUNT(1) FROM categories`).Scan(&remaining); err != nil {
+			return fmt.Errorf("failed to count categories: %v", err)
+		}
+		if remaining == 0 {
+			return fmt.Errorf("categories cannot be empty")
+		}
+		change := auditChange{entity: AuditCategory, id: name, action: AuditDelete, before: before}
+		if reassignTo != "" {
+			change.detail = "reassigned to " + reassignTo
+		}
+		return d.recordAudit(tx, change)
+	})
+}
+
+// sumExpensesByCategory totals the filtered expenses per category and currency
+func (d sqlDialect) sumExpensesByCategory(db *sql.DB, f ExpenseFilter) ([]CategorySum, error) {
+	where, args := d.expenseWhere(f, nil)
+	rows, err := db.Query(`SELECT category, currency, SUM(amount), COUNT(1) FROM expenses`+where+
+		` GROUP BY category, currency ORDER BY category, currency`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sum expenses: %v", err)
+	}
+	defer rows.Close()
+	var sums []CategorySum
+	for rows.Next() {
+		var sum CategorySum
+		if err := rows.Scan(&sum.Category, &sum.Currency, &sum.Amount.Units, &sum.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan category sum: %v", err)
+		}
+		sum.Amount.Scale = CurrencyDecimals(sum.Currency)
+		sums = append(sums, sum)
+	}
+	return sums, rows.Err()
+}
+
+// decorateDefaultCategories fills the metadata of stored categories named
+// like a default one, leaving categories the user already styled alone
+func decorateDefaultCategories(tx *sql.Tx, d sqlDialect) error {
+	update := fmt.Sprintf(`UPDATE categories SET color = %s, icon = %s, type = %s WHERE name = %s AND color = ''`,
+		d.placeholder(1), d.placeholder(2), d.placeholder(3), d.placeholder(4))
+	for _, category := range defaultCategories {
+		if _, err := tx.Exec(update, category.Color, category.Icon, category.Type, category.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// registerUsedCategories adds every category referenced by an expense or a
+// recurring rule but missing from the table, after the existing ones
+func registerUsedCategories(tx *sql.Tx, d sqlDialect) error {
+	rows, err := tx.Query(`
+		SELECT category FROM expenses WHERE category NOT IN (SELECT name FROM categories)
+		UNION
+		SELECT category FROM recurring_expenses WHERE category NOT IN (SELECT name FROM categories)
+		ORDER BY 1`)
+	if err != nil {
+		return err
+	}
+	var missing []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		missing = append(missing, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	var last int
+	if err := tx.QueryRow(`SELECT COALESCE(MAX(position), 0) FROM categories`).Scan(&last); err != nil {
+		return err
+	}
+	insert := fmt.Sprintf(`INSERT INTO categories (name, position, color, icon, type) VALUES (%s, %s, %s, %s, %s)`,
+		d.placeholder(1), d.placeholder(2), d.placeholder(3), d.placeholder(4), d.placeholder(5))
+	for i, name := range missing {
+		category := NewCategory(name)
+		if _, err := tx.Exec(insert, category.Name, last+i+1, category.Color, category.Icon, category.Type); err != nil {
+			return err
+		}
+	}
+	return nil
+}
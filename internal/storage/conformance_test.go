@@ -0,0 +1,2580 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// runConformanceSuite exercises the behaviour every Storage backend must share.
+// Subtests only rely on records they create themselves so the suite can also
+// run against a shared postgres database. reopen closes a store and opens the
+// same data again, as a restart would.
+func runConformanceSuite(t *testing.T, newStore func(t *testing.T) Storage, reopen func(t *testing.T, store Storage) Storage) {
+	t.Run("ExpenseCRUD", func(t *testing.T) { testExpenseCRUD(t, newStore(t)) })
+	t.Run("MultipleExpenses", func(t *testing.T) { testMultipleExpenses(t, newStore(t)) })
+	t.Run("Trash", func(t *testing.T) { testTrash(t, newStore(t)) })
+	t.Run("QueryExpenses", func(t *testing.T) { testQueryExpenses(t, newStore(t)) })
+	t.Run("PaginationAndStreaming", func(t *testing.T) { testPaginationAndStreaming(t, newStore(t)) })
+	t.Run("RecurringUpdateAll", func(t *testing.T) { testRecurringUpdateAll(t, newStore(t)) })
+	t.Run("RecurringUpdateFuture", func(t *testing.T) { testRecurringUpdateFuture(t, newStore(t)) })
+	t.Run("RecurringRemove", func(t *testing.T) { testRecurringRemove(t, newStore(t)) })
+	t.Run("RecurringMaterialization", func(t *testing.T) { testRecurringMaterialization(t, newStore(t)) })
+	t.Run("RecurrenceRules", func(t *testing.T) { testRecurrenceRules(t, newStore(t)) })
+	t.Run("RecurringOverrides", func(t *testing.T) { testRecurringOverrides(t, newStore(t)) })
+	t.Run("RecurringAccounts", func(t *testing.T) { testRecurringAccounts(t, newStore(t)) })
+	t.Run("Tags", func(t *testing.T) { testTags(t, newStore(t)) })
+	t.Run("CategoryOrdering", func(t *testing.T) { testCategoryOrdering(t, newStore(t)) })
+	t.Run("CategoryTree", func(t *testing.T) { testCategoryTree(t, newStore(t)) })
+	t.Run("CurrencyAndStartDate", func(t *testing.T) { testCurrencyAndStartDate(t, newStore(t)) })
+	t.Run("BaseCurrencyAfterReopen", func(t *testing.T) { testBaseCurrencyAfterReopen(t, newStore(t), reopen) })
+	t.Run("AuditLog", func(t *testing.T) { testAuditLog(t, newStore(t)) })
+	t.Run("Versions", func(t *testing.T) { testVersions(t, newStore(t)) })
+	t.Run("ValidationErrors", func(t *testing.T) { testValidationErrors(t, newStore(t)) })
+	t.Run("ExactAmounts", func(t *testing.T) { testExactAmounts(t, newStore(t)) })
+	t.Run("ExchangeRates", func(t *testing.T) { testExchangeRates(t, newStore(t)) })
+	t.Run("EnabledCurrencies", func(t *testing.T) { testEnabledCurrencies(t, newStore(t)) })
+	t.Run("CPIIndexes", func(t *testing.T) { testCPIIndexes(t, newStore(t)) })
+	t.Run("CurrencyExchanges", func(t *testing.T) { testCurrencyExchanges(t, newStore(t)) })
+	t.Run("ExchangeAccounts", func(t *testing.T) { testExchangeAccounts(t, newStore(t)) })
+	t.Run("Accounts", func(t *testing.T) { testAccounts(t, newStore(t)) })
+	t.Run("TransactionTypes", func(t *testing.T) { testTransactionTypes(t, newStore(t)) })
+	t.Run("CardStatements", func(t *testing.T) { testCardStatements(t, newStore(t)) })
+	t.Run("InstallmentPurchases", func(t *testing.T) { testInstallmentPurchases(t, newStore(t)) })
+}
+
+func TestMemoryStoreConformance(t *testing.T) {
+	runConformanceSuite(t, func(t *testing.T) Storage {
+		return NewMemoryStore()
+	}, func(t *testing.T, store Storage) Storage {
+		return store // nothing outlives the process
+	})
+}
+
+func TestSQLiteStoreConformance(t *testing.T) {
+	dirs := map[Storage]string{}
+	open := func(t *testing.T, dir string) Storage {
+		store, err := InitializeSQLiteStore(SystemConfig{StorageURL: dir, StorageType: BackendTypeSQLite})
+		if err != nil {
+			t.Fatalf("failed to init sqlite store: %v", err)
+		}
+		t.Cleanup(func() { _ = store.Close() })
+		dirs[store] = dir
+		return store
+	}
+	runConformanceSuite(t, func(t *testing.T) Storage {
+		return open(t, t.TempDir())
+	}, func(t *testing.T, store Storage) Storage {
+		_ = store.Close()
+		return open(t, dirs[store])
+	})
+}
+
+func TestPostgresStoreConformance(t *testing.T) {
+	baseConfig := postgresTestConfig(t)
+	open := func(t *testing.T) Storage {
+		store, err := InitializePostgresStore(baseConfig)
+		if err != nil {
+			t.Fatalf("failed to init postgres store: %v", err)
+		}
+		t.Cleanup(func() { _ = store.Close() })
+		return store
+	}
+	runConformanceSuite(t, open, func(t *testing.T, store Storage) Storage {
+		_ = store.Close()
+		return open(t)
+	})
+}
+
+// expensesForRule returns the stored instances of a recurring rule
+func expensesForRule(t *testing.T, store Storage, recurringID string) []Expense {
+	t.Helper()
+	all, err := store.GetAllExpenses()
+	if err != nil {
+		t.Fatalf("get all expenses: %v", err)
+	}
+	var instances []Expense
+	for _, e := range all {
+		if e.RecurringID == recurringID {
+			instances = append(instances, e)
+		}
+	}
+	return instances
+}
+
+func money(s string) Money { return MustParseMoney(s) }
+
+// newTestRule starts two months ago so that three instances are in the past and one in the future
+func newTestRule() RecurringExpense {
+	return RecurringExpense{
+		ID:          uuid.New().String(),
+		Name:        "Conformance Rent",
+		Amount:      money("-1000"),
+		Currency:    "usd",
+		Category:    "Rent",
+		StartDate:   time.Now().Add(-time.Hour).AddDate(0, -2, 0),
+		Interval:    "monthly",
+		Occurrences: 4,
+		Tags:        []string{"home"},
+	}
+}
+
+func testExpenseCRUD(t *testing.T, store Storage) {
+	expense := Expense{
+		ID:       uuid.New().String(),
+		Name:     "Conformance Lunch",
+		Category: "Food",
+		Amount:   money("-12.5"),
+		Currency: "usd",
+		Date:     time.Now().Add(-time.Hour).Truncate(time.Second),
+		Tags:     []string{"work", "lunch"},
+		Source:   "TARJETA",
+		Card:     "Visa",
+	}
+	if err := store.AddExpense(expense); err != nil {
+		t.Fatalf("add expense: %v", err)
+	}
+	t.Cleanup(func() { _ = store.RemoveExpense(expense.ID, 0) })
+
+	got, err := store.GetExpense(expense.ID)
+	if err != nil {
+		t.Fatalf("get expense: %v", err)
+	}
+	if got.Name != expense.Name || got.Category != expense.Category || !got.Amount.Equal(expense.Amount) ||
+		got.Currency != expense.Currency || got.Source != expense.Source || got.Card != expense.Card {
+		t.Fatalf("stored expense mismatch: got %+v, want %+v", got, expense)
+	}
+	if !got.Date.Equal(expense.Date) {
+		t.Fatalf("stored date mismatch: got %v, want %v", got.Date, expense.Date)
+	}
+	if !slices.Equal(got.Tags, expense.Tags) {
+		t.Fatalf("stored tags mismatch: got %v, want %v", got.Tags, expense.Tags)
+	}
+
+	got.Amount = money("-20")
+	got.Name = "Conformance Dinner"
+	if err := store.UpdateExpense(expense.ID, got); err != nil {
+		t.Fatalf("update expense: %v", err)
+	}
+	updated, err := store.GetExpense(expense.ID)
+	if err != nil {
+		t.Fatalf("get updated expense: %v", err)
+	}
+	if !updated.Amount.Equal(money("-20")) || updated.Name != "Conformance Dinner" {
+		t.Fatalf("update not applied: %+v", updated)
+	}
+	if err := store.UpdateExpense(uuid.New().String(), got); err == nil {
+		t.Fatalf("expected error updating a missing expense")
+	}
+
+	if err := store.RemoveExpense(expense.ID, 0); err != nil {
+		t.Fatalf("remove expense: %v", err)
+	}
+	if _, err := store.GetExpense(expense.ID); err == nil {
+		t.Fatalf("expected error getting a removed expense")
+	}
+	if err := store.RemoveExpense(expense.ID, 0); err == nil {
+		t.Fatalf("expected error removing a missing expense")
+	}
+}
+
+func testMultipleExpenses(t *testing.T, store Storage) {
+	base := time.Now().Add(-24 * time.Hour).Truncate(time.Second)
+	var ids []string
+	var expenses []Expense
+	for i := range 3 {
+		e := Expense{
+			ID:       uuid.New().String(),
+			Name:     "Conformance Bulk",
+			Category: "Shopping",
+			Amount:   NewMoney(int64(-(i + 1)), 0),
+			Currency: "eur",
+			Date:     base.Add(time.Duration(i) * time.Minute),
+		}
+		ids = append(ids, e.ID)
+		expenses = append(expenses, e)
+	}
+	if err := store.AddMultipleExpenses(expenses); err != nil {
+		t.Fatalf("add multiple expenses: %v", err)
+	}
+	t.Cleanup(func() { _ = store.RemoveMultipleExpenses(ids) })
+
+	all, err := store.GetAllExpenses()
+	if err != nil {
+		t.Fatalf("get all expenses: %v", err)
+	}
+	var order []string
+	for i, e := range all {
+		if i > 0 && e.Date.After(all[i-1].Date) {
+			t.Fatalf("expenses not ordered by date desc at index %d", i)
+		}
+		if slices.Contains(ids, e.ID) {
+			order = append(order, e.ID)
+		}
+	}
+	if !slices.Equal(order, []string{ids[2], ids[1], ids[0]}) {
+		t.Fatalf("unexpected order of bulk expenses: %v", order)
+	}
+
+	if err := store.RemoveMultipleExpenses(ids[:2]); err != nil {
+		t.Fatalf("remove multiple expenses: %v", err)
+	}
+	for _, id := range ids[:2] {
+		if _, err := store.GetExpense(id); err == nil {
+			t.Fatalf("expected expense %s to be removed", id)
+		}
+	}
+	if _, err := store.GetExpense(ids[2]); err != nil {
+		t.Fatalf("expected expense %s to survive: %v", ids[2], err)
+	}
+	if err := store.RemoveMultipleExpenses(nil); err != nil {
+		t.Fatalf("removing no expenses should be a no-op: %v", err)
+	}
+
+	// a bad expense in the middle of a batch leaves nothing of it behind
+	token := uuid.New().String()[:8]
+	batch := []Expense{
+		{ID: uuid.New().String(), Name: "Batch", Category: "Shopping", Amount: money("-1"), Currency: "eur", Date: base, Card: "Batch " + token, Tags: []string{"batch-" + token}},
+		{ID: uuid.New().String(), Name: "Batch", Category: "Missing " + token, Amount: money("-2"), Currency: "eur", Date: base},
+		{ID: uuid.New().String(), Name: "Batch", Category: "Shopping", Amount: money("-3"), Currency: "eur", Date: base},
+	}
+	if err := store.AddMultipleExpenses(batch); err == nil {
+		t.Fatalf("expected the batch with an unknown category refused")
+	}
+	for _, e := range batch {
+		if _, err := store.GetExpense(e.ID); err == nil {
+			t.Fatalf("expected expense %s of the failed batch not stored", e.ID)
+		}
+	}
+	if tags, err := store.GetTags(); err != nil || slices.ContainsFunc(tags, func(tg Tag) bool { return tg.Name == "batch-"+token }) {
+		t.Fatalf("expected the tags of the failed batch not registered, got %+v (%v)", tags, err)
+	}
+	if accounts, err := store.GetAccounts(); err != nil || slices.ContainsFunc(accounts, func(a Account) bool { return a.Name == "Batch "+token }) {
+		t.Fatalf("expected no card created by the failed batch, got %+v (%v)", accounts, err)
+	}
+}
+
+func testTrash(t *testing.T, store Storage) {
+	token := uuid.New().String()
+	day := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	var ids []string
+	for i := range 3 {
+		e := Expense{ID: uuid.New().String(), Name: token, Category: "Food", Amount: NewMoney(int64(-(i + 1)), 0), Currency: "usd", Date: day,
+			Tags: []string{"trash-" + token}}
+		if err := store.AddExpense(e); err != nil {
+			t.Fatalf("add expense: %v", err)
+		}
+		ids = append(ids, e.ID)
+	}
+	t.Cleanup(func() {
+		_ = store.RemoveMultipleExpenses(ids)
+		_, _ = store.PurgeTrash(time.Now().Add(time.Hour))
+	})
+	trashed := func() []string {
+		trash, err := store.GetTrash()
+		if err != nil {
+			t.Fatalf("get trash: %v", err)
+		}
+		var found []string
+		for _, e := range trash {
+			if e.Name == token {
+				if e.DeletedAt.IsZero() {
+					t.Fatalf("trashed expense %s without deletion time", e.ID)
+				}
+				found = append(found, e.ID)
+			}
+		}
+		slices.Sort(found)
+		return found
+	}
+	sorted := func(ids ...string) []string {
+		ids = slices.Clone(ids)
+		slices.Sort(ids)
+		return ids
+	}
+
+	if err := store.RemoveExpense(ids[0], 0); err != nil {
+		t.Fatalf("remove expense: %v", err)
+	}
+	if err := store.RemoveMultipleExpenses(ids[1:2]); err != nil {
+		t.Fatalf("remove multiple expenses: %v", err)
+	}
+	if err := store.RemoveExpense(ids[0], 0); err == nil {
+		t.Fatalf("expected removing a trashed expense to fail")
+	}
+	if got := trashed(); !slices.Equal(got, sorted(ids[0], ids[1])) {
+		t.Fatalf("trash: got %v", got)
+	}
+
+	// trashed expenses are out of every read
+	if live, _ := store.QueryExpenses(ExpenseFilter{Name: token}); len(live) != 1 || live[0].ID != ids[2] {
+		t.Fatalf("expected only the live expense, got %+v", live)
+	}
+	if _, err := store.GetExpense(ids[0]); err == nil {
+		t.Fatalf("expected a trashed expense to be hidden from GetExpense")
+	}
+	if err := store.UpdateExpense(ids[0], Expense{Name: token, Category: "Food", Amount: money("-9"), Currency: "usd", Date: day}); err == nil {
+		t.Fatalf("expected updating a trashed expense to fail")
+	}
+	if sums, _ := store.SumExpensesByCategory(ExpenseFilter{Name: token}); len(sums) != 1 || sums[0].Count != 1 {
+		t.Fatalf("expected sums over the live expense only, got %+v", sums)
+	}
+	tags, _ := store.GetTags()
+	if i := slices.IndexFunc(tags, func(tag Tag) bool { return tag.Name == "trash-"+token }); i == -1 || tags[i].Count != 1 {
+		t.Fatalf("expected the tag count to skip trashed expenses, got %+v", tags)
+	}
+
+	// restore and purge are all or nothing
+	if err := store.RestoreExpenses([]string{ids[0], ids[2]}); err == nil {
+		t.Fatalf("expected restoring a live expense to fail")
+	}
+	if got := trashed(); !slices.Equal(got, sorted(ids[0], ids[1])) {
+		t.Fatalf("failed restore changed the trash: %v", got)
+	}
+	if err := store.RestoreExpenses(ids[:1]); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if e, err := store.GetExpense(ids[0]); err != nil || !slices.Equal(e.Tags, []string{"trash-" + token}) {
+		t.Fatalf("restored expense: %+v (%v)", e, err)
+	}
+	if err := store.PurgeExpenses(ids[2:]); err == nil {
+		t.Fatalf("expected purging a live expense to fail")
+	}
+	if _, err := store.PurgeTrash(time.Now().Add(-time.Hour)); err != nil {
+		t.Fatalf("purge old trash: %v", err)
+	}
+	if got := trashed(); !slices.Equal(got, ids[1:2]) {
+		t.Fatalf("recent trash should survive the retention purge: %v", got)
+	}
+	if err := store.PurgeExpenses(ids[1:2]); err != nil {
+		t.Fatalf("purge: %v", err)
+	}
+	if err := store.RestoreExpenses(ids[1:2]); err == nil {
+		t.Fatalf("expected a purged expense to be gone")
+	}
+
+	if err := store.RemoveExpense(ids[0], 0); err != nil {
+		t.Fatalf("remove expense: %v", err)
+	}
+	purged, err := store.PurgeTrash(time.Now().Add(time.Second))
+	if err != nil || purged < 1 {
+		t.Fatalf("purge trash: %d (%v)", purged, err)
+	}
+	if got := trashed(); len(got) != 0 {
+		t.Fatalf("expected an empty trash, got %v", got)
+	}
+}
+
+func testQueryExpenses(t *testing.T, store Storage) {
+	// a unique token in every name keeps the assertions independent of other data
+	token := "qx" + uuid.New().String()[:8]
+	day := time.Date(2024, 5, 10, 12, 0, 0, 0, time.UTC)
+	fixtures := []Expense{
+		{Name: "Lunch " + token, Category: "Food", Amount: money("-15"), Currency: "ars", Date: day, Tags: []string{"work"}, Source: "TARJETA", Card: "Visa"},
+		{Name: "Dinner " + token, Category: "Food", Amount: money("-40"), Currency: "usd", Date: day.AddDate(0, 0, 1), Tags: []string{"family", "weekend"}, Source: "EFECTIVO"},
+		{Name: "Salary " + token, Category: "Income", Amount: money("2000"), Currency: "ars", Date: day.AddDate(0, 0, 5), Source: "CA"},
+		{Name: "Bus 100%_ " + token, Category: "Travel", Amount: money("-1"), Currency: "ars", Date: day.AddDate(0, 1, 0), RecurringID: uuid.New().String()},
+	}
+	var ids []string
+	for i := range fixtures {
+		fixtures[i].ID = uuid.New().String()
+		ids = append(ids, fixtures[i].ID)
+	}
+	if err := store.AddMultipleExpenses(fixtures); err != nil {
+		t.Fatalf("add fixtures: %v", err)
+	}
+	t.Cleanup(func() { _ = store.RemoveMultipleExpenses(ids) })
+
+	amount := func(v string) *Money { m := money(v); return &m }
+	boolean := func(v bool) *bool { return &v }
+	cases := []struct {
+		name   string
+		filter ExpenseFilter
+		want   []string
+	}{
+		{"all", ExpenseFilter{}, []string{"Bus 100%_", "Salary", "Dinner", "Lunch"}},
+		{"date range", ExpenseFilter{From: day.AddDate(0, 0, 1), To: day.AddDate(0, 0, 5)}, []string{"Salary", "Dinner"}},
+		{"categories", ExpenseFilter{Categories: []string{"Income", "Travel"}}, []string{"Bus 100%_", "Salary"}},
+		{"tags", ExpenseFilter{Tags: []string{"weekend", "work"}}, []string{"Dinner", "Lunch"}},
+		{"source", ExpenseFilter{Source: "EFECTIVO"}, []string{"Dinner"}},
+		{"card", ExpenseFilter{Card: "Visa"}, []string{"Lunch"}},
+		{"currency", ExpenseFilter{Currency: "usd"}, []string{"Dinner"}},
+		{"amount range", ExpenseFilter{MinAmount: amount("-20"), MaxAmount: amount("0")}, []string{"Bus 100%_", "Lunch"}},
+		{"amount bounds finer than cents", ExpenseFilter{MinAmount: amount("-15.001"), MaxAmount: amount("-14.999")}, []string{"Lunch"}},
+		{"amount bound beyond int64 cents", ExpenseFilter{MaxAmount: amount("-999999999999999999")}, nil},
+		{"recurring", ExpenseFilter{Recurring: boolean(true)}, []string{"Bus 100%_"}},
+		{"one-off", ExpenseFilter{Recurring: boolean(false), Currency: "ars"}, []string{"Salary", "Lunch"}},
+		{"name is case-insensitive", ExpenseFilter{Name: "DINNER " + token}, []string{"Dinner"}},
+		{"name wildcards are literal", ExpenseFilter{Name: "0%_ " + token}, []string{"Bus 100%_"}},
+		{"no match", ExpenseFilter{Categories: []string{"Food"}, Currency: "eur"}, nil},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if c.filter.Name == "" {
+				c.filter.Name = token
+			}
+			got, err := store.QueryExpenses(c.filter)
+			if err != nil {
+				t.Fatalf("query expenses: %v", err)
+			}
+			var names []string
+			for _, e := range got {
+				names = append(names, strings.TrimSuffix(e.Name, " "+token))
+			}
+			if !slices.Equal(names, c.want) {
+				t.Fatalf("got %v, want %v", names, c.want)
+			}
+		})
+	}
+}
+
+func testPaginationAndStreaming(t *testing.T, store Storage) {
+	token := "pg" + uuid.New().String()[:8]
+	day := time.Date(2024, 7, 1, 9, 0, 0, 0, time.UTC)
+	var fixtures []Expense
+	var ids []string
+	for i := range 7 {
+		// pairs share a timestamp so the id tie-breaker is exercised
+		e := Expense{ID: uuid.New().String(), Name: token, Category: "Food", Amount: money("-1"), Currency: "usd", Date: day.Add(time.Duration(i/2) * time.Hour)}
+		fixtures = append(fixtures, e)
+		ids = append(ids, e.ID)
+	}
+	if err := store.AddMultipleExpenses(fixtures); err != nil {
+		t.Fatalf("add fixtures: %v", err)
+	}
+	t.Cleanup(func() { _ = store.RemoveMultipleExpenses(ids) })
+
+	filter := ExpenseFilter{Name: token}
+	want, err := store.QueryExpenses(filter)
+	if err != nil || len(want) != len(fixtures) {
+		t.Fatalf("query expenses: %v (%d rows)", err, len(want))
+	}
+	idsOf := func(expenses []Expense) []string {
+		var out []string
+		for _, e := range expenses {
+			out = append(out, e.ID)
+		}
+		return out
+	}
+
+	var paged []Expense
+	var after *ExpenseCursor
+	for pages := 0; ; pages++ {
+		if pages > len(fixtures) {
+			t.Fatalf("pagination does not terminate")
+		}
+		page, err := store.QueryExpensesPage(filter, after, 3)
+		if err != nil {
+			t.Fatalf("query page: %v", err)
+		}
+		if len(page.Expenses) > 3 {
+			t.Fatalf("page larger than limit: %d", len(page.Expenses))
+		}
+		paged = append(paged, page.Expenses...)
+		if page.Next == nil {
+			break
+		}
+		// the cursor must survive its string round trip
+		cursor, err := ParseExpenseCursor(page.Next.String())
+		if err != nil {
+			t.Fatalf("parse cursor: %v", err)
+		}
+		after = &cursor
+	}
+	if !slices.Equal(idsOf(paged), idsOf(want)) {
+		t.Fatalf("paged listing differs from full listing:\n got %v\nwant %v", idsOf(paged), idsOf(want))
+	}
+
+	exact, err := store.QueryExpensesPage(filter, nil, len(fixtures))
+	if err != nil || len(exact.Expenses) != len(fixtures) || exact.Next != nil {
+		t.Fatalf("a page holding every row should be the last: %v (%+v)", err, exact.Next)
+	}
+
+	var streamed []Expense
+	if err := store.StreamExpenses(filter, func(e Expense) error {
+		streamed = append(streamed, e)
+		return nil
+	}); err != nil {
+		t.Fatalf("stream expenses: %v", err)
+	}
+	if !slices.Equal(idsOf(streamed), idsOf(want)) {
+		t.Fatalf("streamed listing differs from full listing")
+	}
+	stop := errors.New("stop")
+	calls := 0
+	if err := store.StreamExpenses(filter, func(Expense) error {
+		calls++
+		return stop
+	}); !errors.Is(err, stop) || calls != 1 {
+		t.Fatalf("stream should stop at the first callback error: %v after %d calls", err, calls)
+	}
+}
+
+func testRecurringUpdateAll(t *testing.T, store Storage) {
+	rule := newTestRule()
+	if err := store.AddRecurringExpense(rule); err != nil {
+		t.Fatalf("add recurring expense: %v", err)
+	}
+	t.Cleanup(func() { _ = store.RemoveRecurringExpense(rule.ID, true, 0) })
+
+	got, err := store.GetRecurringExpense(rule.ID)
+	if err != nil {
+		t.Fatalf("get recurring expense: %v", err)
+	}
+	if got.Name != rule.Name || got.Currency != rule.Currency || got.Occurrences != rule.Occurrences {
+		t.Fatalf("stored rule mismatch: got %+v", got)
+	}
+	instances := expensesForRule(t, store, rule.ID)
+	if len(instances) != 4 {
+		t.Fatalf("expected 4 generated instances, got %d", len(instances))
+	}
+
+	rule.Amount = money("-1200")
+	if err := store.UpdateRecurringExpense(rule.ID, rule, true); err != nil {
+		t.Fatalf("update recurring expense: %v", err)
+	}
+	instances = expensesForRule(t, store, rule.ID)
+	if len(instances) != 4 {
+		t.Fatalf("expected 4 instances after updateAll, got %d", len(instances))
+	}
+	for _, e := range instances {
+		if !e.Amount.Equal(money("-1200")) {
+			t.Fatalf("updateAll left instance %s with amount %v", e.ID, e.Amount)
+		}
+	}
+	if err := store.UpdateRecurringExpense(uuid.New().String(), rule, true); err == nil {
+		t.Fatalf("expected error updating a missing rule")
+	}
+}
+
+func testRecurringUpdateFuture(t *testing.T, store Storage) {
+	rule := newTestRule()
+	if err := store.AddRecurringExpense(rule); err != nil {
+		t.Fatalf("add recurring expense: %v", err)
+	}
+	t.Cleanup(func() { _ = store.RemoveRecurringExpense(rule.ID, true, 0) })
+
+	rule.Amount = money("-1500")
+	if err := store.UpdateRecurringExpense(rule.ID, rule, false); err != nil {
+		t.Fatalf("update recurring expense: %v", err)
+	}
+	instances := expensesForRule(t, store, rule.ID)
+	if len(instances) != 4 {
+		t.Fatalf("expected 4 instances after future update, got %d", len(instances))
+	}
+	now := time.Now()
+	for _, e := range instances {
+		want := money("-1000")
+		if e.Date.After(now) {
+			want = money("-1500")
+		}
+		if !e.Amount.Equal(want) {
+			t.Fatalf("instance on %v has amount %v, want %v", e.Date, e.Amount, want)
+		}
+	}
+}
+
+func testRecurringRemove(t *testing.T, store Storage) {
+	keepPast := newTestRule()
+	removeAll := newTestRule()
+	for _, rule := range []RecurringExpense{keepPast, removeAll} {
+		if err := store.AddRecurringExpense(rule); err != nil {
+			t.Fatalf("add recurring expense: %v", err)
+		}
+	}
+	t.Cleanup(func() {
+		var ids []string
+		for _, e := range expensesForRule(t, store, keepPast.ID) {
+			ids = append(ids, e.ID)
+		}
+		_ = store.RemoveMultipleExpenses(ids)
+	})
+
+	if err := store.RemoveRecurringExpense(keepPast.ID, false, 0); err != nil {
+		t.Fatalf("remove recurring expense: %v", err)
+	}
+	if _, err := store.GetRecurringExpense(keepPast.ID); err == nil {
+		t.Fatalf("expected removed rule to be gone")
+	}
+	if got := len(expensesForRule(t, store, keepPast.ID)); got != 3 {
+		t.Fatalf("expected 3 past instances to survive, got %d", got)
+	}
+
+	if err := store.RemoveRecurringExpense(removeAll.ID, true, 0); err != nil {
+		t.Fatalf("remove recurring expense with removeAll: %v", err)
+	}
+	if got := len(expensesForRule(t, store, removeAll.ID)); got != 0 {
+		t.Fatalf("expected removeAll to delete every instance, %d left", got)
+	}
+	if err := store.RemoveRecurringExpense(removeAll.ID, true, 0); err == nil {
+		t.Fatalf("expected error removing a missing rule")
+	}
+}
+
+func testRecurringMaterialization(t *testing.T, store Storage) {
+	rule := newTestRule()
+	rule.Occurrences = 0
+	if err := rule.Validate(); err != nil {
+		t.Fatalf("an indefinite rule should be valid: %v", err)
+	}
+	if err := store.AddRecurringExpense(rule); err != nil {
+		t.Fatalf("add recurring expense: %v", err)
+	}
+	t.Cleanup(func() { _ = store.RemoveRecurringExpense(rule.ID, true, 0) })
+
+	// only the occurrences up to the horizon are stored
+	horizon := RecurringHorizon(time.Now())
+	got, err := store.GetRecurringExpense(rule.ID)
+	if err != nil || got.MaterializedThrough == nil || !got.MaterializedThrough.Equal(horizon) {
+		t.Fatalf("expected the rule materialized through %v, got %+v (%v)", horizon, got, err)
+	}
+	stored := len(rule.Project(time.Time{}, horizon, nil))
+	if instances := expensesForRule(t, store, rule.ID); len(instances) != stored {
+		t.Fatalf("expected %d instances up to the horizon, got %d", stored, len(instances))
+	}
+
+	later := horizon.AddDate(0, 3, 0)
+	written, err := store.MaterializeRecurring(later)
+	if err != nil {
+		t.Fatalf("materialize: %v", err)
+	}
+	added := len(rule.Project(horizon, later, nil))
+	if instances := expensesForRule(t, store, rule.ID); written < added || len(instances) != stored+added {
+		t.Fatalf("expected %d more instances, wrote %d and have %d", added, written, len(instances))
+	}
+	if _, err := store.MaterializeRecurring(later); err != nil {
+		t.Fatalf("materialize again: %v", err)
+	}
+	if instances := expensesForRule(t, store, rule.ID); len(instances) != stored+added {
+		t.Fatalf("materializing twice wrote duplicates: %d instances", len(instances))
+	}
+
+	// an update regenerates the future occurrences up to the horizon again
+	got.Amount = money("-1100")
+	if err := store.UpdateRecurringExpense(rule.ID, got, false); err != nil {
+		t.Fatalf("update recurring expense: %v", err)
+	}
+	if instances := expensesForRule(t, store, rule.ID); len(instances) != stored {
+		t.Fatalf("expected %d instances after the update, got %d", stored, len(instances))
+	}
+
+	rule.Occurrences = 1
+	if err := rule.Validate(); err == nil {
+		t.Fatalf("expected a single occurrence to be rejected")
+	}
+}
+
+func testRecurrenceRules(t *testing.T, store Storage) {
+	day := func(m time.Month, d int) time.Time { return time.Date(2001, m, d, 0, 0, 0, 0, time.UTC) }
+	holidays := []Holiday{
+		{Date: day(time.March, 1).Add(15 * time.Hour), Name: "Feriado"},
+		{Date: day(time.April, 2), Name: "Malvinas"},
+	}
+	if err := store.SaveHolidays(holidays); err != nil {
+		t.Fatalf("save holidays: %v", err)
+	}
+	t.Cleanup(func() {
+		for _, h := range holidays {
+			_ = store.DeleteHoliday(h.Date)
+		}
+	})
+	// a second name for a date replaces the first
+	if err := store.SaveHolidays([]Holiday{{Date: day(time.April, 2), Name: "Dia del Veterano"}}); err != nil {
+		t.Fatalf("replace holiday: %v", err)
+	}
+	got, err := store.GetHolidays()
+	if err != nil {
+		t.Fatalf("get holidays: %v", err)
+	}
+	got = slices.DeleteFunc(got, func(h Holiday) bool { return h.Date.Year() != 2001 })
+	if len(got) != 2 || !got[0].Date.Equal(day(time.March, 1)) || got[1].Name != "Dia del Veterano" {
+		t.Fatalf("unexpected holidays: %+v", got)
+	}
+	if err := store.DeleteHoliday(day(time.May, 1)); err == nil {
+		t.Fatalf("expected deleting a missing holiday to fail")
+	}
+
+	// the first business day of march is friday 2nd, past the holiday on
+	// thursday 1st, and the one of april tuesday 3rd, past monday 2nd
+	rule := newTestRule()
+	rule.StartDate = day(time.March, 1)
+	rule.RRule = "FREQ=MONTHLY;BYDAY=MO,TU,WE,TH,FR;BYSETPOS=1;COUNT=3"
+	rule.BusinessDay = BusinessDayFollowing
+	if err := rule.Validate(); err != nil {
+		t.Fatalf("validate rule: %v", err)
+	}
+	if err := store.AddRecurringExpense(rule); err != nil {
+		t.Fatalf("add recurring expense: %v", err)
+	}
+	t.Cleanup(func() { _ = store.RemoveRecurringExpense(rule.ID, true, 0) })
+	stored, err := store.GetRecurringExpense(rule.ID)
+	if err != nil || stored.RRule != rule.RRule || stored.BusinessDay != BusinessDayFollowing || stored.Interval != "monthly" || stored.Occurrences != 3 {
+		t.Fatalf("expected the recurrence rule stored, got %+v (%v)", stored, err)
+	}
+	var dates []string
+	for _, e := range expensesForRule(t, store, rule.ID) {
+		dates = append(dates, e.Date.UTC().Format("2006-01-02"))
+	}
+	slices.Sort(dates)
+	if want := []string{"2001-03-02", "2001-04-03", "2001-05-01"}; !slices.Equal(dates, want) {
+		t.Fatalf("expected instances on %v, got %v", want, dates)
+	}
+}
+
+func testRecurringOverrides(t *testing.T, store Storage) {
+	rule := newTestRule()
+	if err := store.AddRecurringExpense(rule); err != nil {
+		t.Fatalf("add recurring expense: %v", err)
+	}
+	t.Cleanup(func() { _ = store.RemoveRecurringExpense(rule.ID, true, 0) })
+	byOccurrence := func() []Expense {
+		t.Helper()
+		instances := expensesForRule(t, store, rule.ID)
+		for _, e := range instances {
+			if e.Occurrence == nil {
+				t.Fatalf("instance %s has no occurrence", e.ID)
+			}
+		}
+		slices.SortFunc(instances, func(a, b Expense) int { return a.Occurrence.Compare(*b.Occurrence) })
+		return instances
+	}
+	instances := byOccurrence()
+	if len(instances) != 4 {
+		t.Fatalf("expected 4 generated instances, got %d", len(instances))
+	}
+	occurrence := *instances[1].Occurrence
+
+	if err := store.OverrideRecurringOccurrence(rule.ID, RecurringOverride{Occurrence: occurrence, Skip: true}, 0); err != nil {
+		t.Fatalf("skip occurrence: %v", err)
+	}
+	instances = byOccurrence()
+	if len(instances) != 3 || instances[1].Occurrence.Equal(occurrence) {
+		t.Fatalf("expected the occurrence skipped, got %+v", instances)
+	}
+
+	moved := occurrence.AddDate(0, 0, 3)
+	edit := RecurringOverride{Occurrence: occurrence, Name: "Renta ajustada", Amount: ptr(money("-900")), Date: &moved}
+	if err := store.OverrideRecurringOccurrence(rule.ID, edit, 0); err != nil {
+		t.Fatalf("edit occurrence: %v", err)
+	}
+	instances = byOccurrence()
+	if len(instances) != 4 || instances[1].Name != "Renta ajustada" || !instances[1].Amount.Equal(money("-900")) ||
+		!instances[1].Date.Equal(moved) || !instances[1].Occurrence.Equal(occurrence) {
+		t.Fatalf("expected the occurrence edited, got %+v", instances)
+	}
+
+	// the override outlives an update of the rule, and the amount change only
+	// reaches the occurrences from its date on
+	stored, err := store.GetRecurringExpense(rule.ID)
+	if err != nil || len(stored.Overrides) != 1 {
+		t.Fatalf("expected the override stored, got %+v (%v)", stored, err)
+	}
+	stored.Amount = money("-1200")
+	stored.AmountChanges = []AmountChange{{From: occurrence.AddDate(0, 0, 1), Amount: money("-1300")}}
+	stored.Overrides = nil
+	if err := store.UpdateRecurringExpense(rule.ID, stored, true); err != nil {
+		t.Fatalf("update recurring expense: %v", err)
+	}
+	instances = byOccurrence()
+	want := []string{"-1200", "-900", "-1300", "-1300"}
+	for i, e := range instances {
+		if i >= len(want) || !e.Amount.Equal(money(want[i])) {
+			t.Fatalf("expected amounts %v, got %+v", want, instances)
+		}
+	}
+	if len(instances) != len(want) || instances[1].Name != "Renta ajustada" {
+		t.Fatalf("expected the override kept by the update, got %+v", instances)
+	}
+
+	if err := store.OverrideRecurringOccurrence(rule.ID, RecurringOverride{Occurrence: occurrence}, 0); err != nil {
+		t.Fatalf("restore occurrence: %v", err)
+	}
+	instances = byOccurrence()
+	if len(instances) != 4 || instances[1].Name != rule.Name || !instances[1].Amount.Equal(money("-1200")) || !instances[1].Date.Equal(occurrence) {
+		t.Fatalf("expected the occurrence restored, got %+v", instances)
+	}
+	if stored, err := store.GetRecurringExpense(rule.ID); err != nil || len(stored.Overrides) != 0 || len(stored.AmountChanges) != 1 {
+		t.Fatalf("expected no overrides left, got %+v (%v)", stored, err)
+	}
+
+	if err := store.OverrideRecurringOccurrence(rule.ID, RecurringOverride{Occurrence: occurrence.Add(time.Hour), Skip: true}, 0); err == nil {
+		t.Fatalf("expected an error overriding a date the rule does not schedule")
+	}
+	if err := store.OverrideRecurringOccurrence(uuid.New().String(), RecurringOverride{Occurrence: occurrence, Skip: true}, 0); err == nil {
+		t.Fatalf("expected an error overriding a missing rule")
+	}
+
+	// occurrences only change through overrides while their rule exists; the
+	// past ones a removed rule keeps are plain expenses
+	direct := byOccurrence()[0]
+	direct.Name = "Changed"
+	if err := store.UpdateExpense(direct.ID, direct); err == nil {
+		t.Fatalf("expected the occurrence update refused")
+	}
+	if err := store.RemoveExpense(direct.ID, 0); err == nil {
+		t.Fatalf("expected the occurrence kept out of the trash")
+	}
+	if err := store.RemoveMultipleExpenses([]string{direct.ID}); err == nil {
+		t.Fatalf("expected the occurrence kept out of the trash")
+	}
+	if err := store.RemoveRecurringExpense(rule.ID, false, 0); err != nil {
+		t.Fatalf("remove recurring expense: %v", err)
+	}
+	if err := store.UpdateExpense(direct.ID, direct); err != nil {
+		t.Fatalf("update the expense of a removed rule: %v", err)
+	}
+}
+
+func testRecurringAccounts(t *testing.T, store Storage) {
+	token := uuid.New().String()[:8]
+	onAccount := func(rule RecurringExpense, accountID, source, card string) {
+		t.Helper()
+		stored, err := store.GetRecurringExpense(rule.ID)
+		if err != nil || stored.AccountID != accountID || stored.Source != source || stored.Card != card {
+			t.Fatalf("expected the rule on account %s (%s, %s), got %+v (%v)", accountID, source, card, stored, err)
+		}
+		for _, e := range expensesForRule(t, store, rule.ID) {
+			if e.AccountID != accountID || e.Source != source || e.Card != card {
+				t.Fatalf("expected instance on %v on account %s (%s, %s), got %+v", e.Date, accountID, source, card, e)
+			}
+		}
+	}
+
+	// a card subscription finds or creates its card like a legacy expense
+	card := "Visa " + token
+	rule := newTestRule()
+	rule.Source, rule.Card = "tarjeta", card
+	if err := store.AddRecurringExpense(rule); err != nil {
+		t.Fatalf("add recurring expense: %v", err)
+	}
+	t.Cleanup(func() { _ = store.RemoveRecurringExpense(rule.ID, true, 0) })
+	stored, err := store.GetRecurringExpense(rule.ID)
+	if err != nil || stored.AccountID == "" {
+		t.Fatalf("expected the rule on an account, got %+v (%v)", stored, err)
+	}
+	visa, err := store.GetAccount(stored.AccountID)
+	if err != nil || visa.Type != AccountTypeCreditCard || visa.Name != card {
+		t.Fatalf("unexpected account created from the card: %+v (%v)", visa, err)
+	}
+	onAccount(rule, visa.ID, SourceCreditCard, card)
+	if len(expensesForRule(t, store, rule.ID)) != 4 {
+		t.Fatalf("expected 4 generated instances")
+	}
+
+	// renaming the card follows through to the rule and its expenses
+	visa.Name = "Visa Gold " + token
+	if err := store.UpdateAccount(visa.ID, visa); err != nil {
+		t.Fatalf("update account: %v", err)
+	}
+	onAccount(rule, visa.ID, SourceCreditCard, visa.Name)
+
+	bank := Account{ID: uuid.New().String(), Name: "Banco " + token, Type: AccountTypeBank, Currency: "usd"}
+	if err := store.AddAccount(bank); err != nil {
+		t.Fatalf("add account: %v", err)
+	}
+	stored, _ = store.GetRecurringExpense(rule.ID)
+	stored.AccountID = bank.ID
+	if err := store.UpdateRecurringExpense(rule.ID, stored, false); err != nil {
+		t.Fatalf("update recurring expense: %v", err)
+	}
+	now := time.Now()
+	for _, e := range expensesForRule(t, store, rule.ID) {
+		want := visa.ID
+		if e.Date.After(now) {
+			want = bank.ID
+		}
+		if e.AccountID != want {
+			t.Fatalf("instance on %v is on account %s, want %s", e.Date, e.AccountID, want)
+		}
+	}
+	stored, _ = store.GetRecurringExpense(rule.ID)
+	if err := store.UpdateRecurringExpense(rule.ID, stored, true); err != nil {
+		t.Fatalf("update recurring expense: %v", err)
+	}
+	onAccount(rule, bank.ID, SourceBank, "")
+
+	other := newTestRule()
+	other.Currency, other.AccountID = "ars", bank.ID
+	if err := store.AddRecurringExpense(other); err == nil {
+		t.Fatalf("expected an account in another currency to be refused")
+	}
+	other.Currency, other.AccountID = "usd", "missing"
+	if err := store.AddRecurringExpense(other); err == nil {
+		t.Fatalf("expected a missing account to be refused")
+	}
+
+	// a rule keeps its account in use before it generates any expense, and
+	// the expenses it materializes later land on it
+	later := newTestRule()
+	later.StartDate = RecurringHorizon(time.Now()).AddDate(0, 1, 0)
+	later.AccountID = visa.ID
+	if err := store.AddRecurringExpense(later); err != nil {
+		t.Fatalf("add recurring expense: %v", err)
+	}
+	t.Cleanup(func() { _ = store.RemoveRecurringExpense(later.ID, true, 0) })
+	if n := len(expensesForRule(t, store, later.ID)); n != 0 {
+		t.Fatalf("expected no stored instances past the horizon, got %d", n)
+	}
+	if err := store.DeleteAccount(visa.ID); err == nil {
+		t.Fatalf("expected an account used by a recurring rule to be kept")
+	}
+	if _, err := store.MaterializeRecurring(later.StartDate.AddDate(0, 0, 1)); err != nil {
+		t.Fatalf("materialize recurring: %v", err)
+	}
+	onAccount(later, visa.ID, SourceCreditCard, visa.Name)
+	if n := len(expensesForRule(t, store, later.ID)); n != 1 {
+		t.Fatalf("expected the first occurrence materialized, got %d", n)
+	}
+}
+
+func testTags(t *testing.T, store Storage) {
+	token := "tg" + uuid.New().String()[:8]
+	tag := func(name string) string { return token + "-" + name }
+	tagsOf := func(id string) []string {
+		t.Helper()
+		e, err := store.GetExpense(id)
+		if err != nil {
+			t.Fatalf("get expense: %v", err)
+		}
+		return e.Tags
+	}
+	usage := func() map[string][2]int {
+		t.Helper()
+		tags, err := store.GetTags()
+		if err != nil {
+			t.Fatalf("get tags: %v", err)
+		}
+		out := map[string][2]int{}
+		for _, tg := range tags {
+			if strings.HasPrefix(tg.Name, token) {
+				out[strings.TrimPrefix(tg.Name, token+"-")] = [2]int{tg.Count, tg.RecurringCount}
+			}
+		}
+		return out
+	}
+
+	day := time.Now().Add(-time.Hour).Truncate(time.Second)
+	one := Expense{ID: uuid.New().String(), Name: "Tagged", Category: "Food", Amount: money("-1"), Currency: "usd", Date: day,
+		Tags: []string{tag("cafe"), tag("work"), tag("cafe")}}
+	two := Expense{ID: uuid.New().String(), Name: "Tagged", Category: "Food", Amount: money("-2"), Currency: "usd", Date: day,
+		Tags: []string{tag("coffee"), tag("cafe")}}
+	if err := store.AddMultipleExpenses([]Expense{one, two}); err != nil {
+		t.Fatalf("add expenses: %v", err)
+	}
+	t.Cleanup(func() { _ = store.RemoveMultipleExpenses([]string{one.ID, two.ID}) })
+	rule := newTestRule()
+	rule.Tags = []string{tag("work")}
+	if err := store.AddRecurringExpense(rule); err != nil {
+		t.Fatalf("add recurring expense: %v", err)
+	}
+	t.Cleanup(func() { _ = store.RemoveRecurringExpense(rule.ID, true, 0) })
+	if err := store.AddTag(tag("unused")); err != nil {
+		t.Fatalf("add tag: %v", err)
+	}
+	t.Cleanup(func() {
+		for _, name := range []string{"cafe", "work", "coffee", "unused", "office", "drinks"} {
+			_ = store.DeleteTag(tag(name))
+		}
+	})
+
+	if got := tagsOf(one.ID); !slices.Equal(got, []string{tag("cafe"), tag("work")}) {
+		t.Fatalf("repeated tags should collapse keeping order, got %v", got)
+	}
+	want := map[string][2]int{"cafe": {2, 0}, "work": {1 + rule.Occurrences, 1}, "coffee": {1, 0}, "unused": {0, 0}}
+	if got := usage(); !maps.Equal(got, want) {
+		t.Fatalf("usage counts: got %v, want %v", got, want)
+	}
+
+	if err := store.RenameTag(tag("work"), tag("office")); err != nil {
+		t.Fatalf("rename tag: %v", err)
+	}
+	if got := tagsOf(one.ID); !slices.Equal(got, []string{tag("cafe"), tag("office")}) {
+		t.Fatalf("rename did not reach the expense: %v", got)
+	}
+	if re, err := store.GetRecurringExpense(rule.ID); err != nil || !slices.Equal(re.Tags, []string{tag("office")}) {
+		t.Fatalf("rename did not reach the recurring rule: %v (%v)", re.Tags, err)
+	}
+	// every owner the cascade changes gets its own update entry
+	detail := "tag " + tag("work") + " renamed to " + tag("office")
+	for _, owner := range []AuditFilter{{Entity: AuditExpense, EntityID: one.ID, Limit: 1}, {Entity: AuditRecurring, EntityID: rule.ID, Limit: 1}} {
+		entries, err := store.GetAuditLog(owner)
+		if err != nil || len(entries) != 1 || entries[0].Action != AuditUpdate || entries[0].Detail != detail ||
+			!strings.Contains(string(entries[0].Before), tag("work")) || !strings.Contains(string(entries[0].After), tag("office")) {
+			t.Fatalf("expected the rename audited on %s, got %+v (%v)", owner.EntityID, entries, err)
+		}
+	}
+	if err := store.RenameTag(tag("cafe"), tag("coffee")); err == nil {
+		t.Fatalf("expected error renaming onto an existing tag")
+	}
+	if err := store.RenameTag(tag("missing"), tag("other")); err == nil {
+		t.Fatalf("expected error renaming a missing tag")
+	}
+
+	// two carries both tags; after the merge it holds drinks once
+	if err := store.MergeTags([]string{tag("cafe"), tag("coffee")}, tag("drinks")); err != nil {
+		t.Fatalf("merge tags: %v", err)
+	}
+	if got := tagsOf(two.ID); !slices.Equal(got, []string{tag("drinks")}) {
+		t.Fatalf("merge left %v", got)
+	}
+	if entries, err := store.GetAuditLog(AuditFilter{Entity: AuditExpense, EntityID: two.ID}); err != nil || len(entries) != 2 ||
+		entries[0].Detail != "tags "+tag("cafe")+", "+tag("coffee")+" merged into "+tag("drinks") {
+		t.Fatalf("expected the creation and a single merge entry, got %+v (%v)", entries, err)
+	}
+	if got := tagsOf(one.ID); !slices.Equal(got, []string{tag("drinks"), tag("office")}) {
+		t.Fatalf("merge left %v", got)
+	}
+	if err := store.MergeTags([]string{tag("missing")}, tag("drinks")); err == nil {
+		t.Fatalf("expected error merging a missing tag")
+	}
+
+	if err := store.DeleteTag(tag("office")); err != nil {
+		t.Fatalf("delete tag: %v", err)
+	}
+	if got := tagsOf(one.ID); !slices.Equal(got, []string{tag("drinks")}) {
+		t.Fatalf("delete did not reach the expense: %v", got)
+	}
+	if err := store.DeleteTag(tag("office")); err == nil {
+		t.Fatalf("expected error deleting a missing tag")
+	}
+	want = map[string][2]int{"drinks": {2, 0}, "unused": {0, 0}}
+	if got := usage(); !maps.Equal(got, want) {
+		t.Fatalf("usage counts after changes: got %v, want %v", got, want)
+	}
+}
+
+// keepExisting appends the stored categories missing from list, so a test
+// never drops a category that other expenses in the store still use
+func keepExisting(list, existing []Category) []Category {
+	list = slices.Clone(list)
+	for _, cat := range existing {
+		if !slices.ContainsFunc(list, func(c Category) bool { return c.Name == cat.Name }) {
+			cat.Parent = ""
+			list = append(list, cat)
+		}
+	}
+	return list
+}
+
+func testCategoryOrdering(t *testing.T, store Storage) {
+	original, err := store.GetCategories()
+	if err != nil {
+		t.Fatalf("get categories: %v", err)
+	}
+	if len(original) == 0 {
+		t.Fatalf("expected default categories to be seeded")
+	}
+	t.Cleanup(func() { _ = store.UpdateCategories(original, 0) })
+
+	want := keepExisting([]Category{
+		{Name: "Zeta", Color: "#112233", Icon: "star", Type: CategoryTypeExpense},
+		{Name: "Alpha", Type: CategoryTypeIncome, Archived: true},
+		{Name: "Mid", Icon: "bolt", Type: CategoryTypeBoth},
+	}, original)
+	if err := store.UpdateCategories(want, 0); err != nil {
+		t.Fatalf("update categories: %v", err)
+	}
+	got, err := store.GetCategories()
+	if err != nil {
+		t.Fatalf("get categories: %v", err)
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("categories order mismatch: got %v, want %v", got, want)
+	}
+
+	reordered := keepExisting([]Category{want[2], want[0], want[1]}, want)
+	reordered[1].Archived = true
+	reordered[2].Archived = false
+	if err := store.UpdateCategories(reordered, 0); err != nil {
+		t.Fatalf("reorder categories: %v", err)
+	}
+	config, err := store.GetConfig()
+	if err != nil {
+		t.Fatalf("get config: %v", err)
+	}
+	if !slices.Equal(config.Categories, reordered) {
+		t.Fatalf("config categories mismatch: got %v, want %v", config.Categories, reordered)
+	}
+
+	if err := store.UpdateCategories(nil, 0); err == nil {
+		t.Fatalf("expected error for empty category list")
+	}
+	if err := store.UpdateCategories([]Category{{Name: "Ok"}, {Name: " "}}, 0); err == nil {
+		t.Fatalf("expected error for blank category name")
+	}
+	if err := store.UpdateCategories(keepExisting([]Category{{Name: "Untyped"}}, original), 0); err != nil {
+		t.Fatalf("update untyped category: %v", err)
+	}
+	if got, _ := store.GetCategories(); len(got) == 0 || got[0].Name != "Untyped" || got[0].Type != CategoryTypeExpense {
+		t.Fatalf("expected a missing type to default to expense, got %+v", got)
+	}
+}
+
+func testCategoryTree(t *testing.T, store Storage) {
+	original, err := store.GetCategories()
+	if err != nil {
+		t.Fatalf("get categories: %v", err)
+	}
+	token := uuid.New().String()
+	rule := newTestRule()
+	rule.Category = "Delivery"
+	t.Cleanup(func() {
+		_ = store.RemoveRecurringExpense(rule.ID, true, 0)
+		if expenses, err := store.QueryExpenses(ExpenseFilter{Name: token}); err == nil {
+			var ids []string
+			for _, e := range expenses {
+				ids = append(ids, e.ID)
+			}
+			_ = store.RemoveMultipleExpenses(ids)
+		}
+		_ = store.UpdateCategories(original, 0)
+	})
+
+	tree := keepExisting([]Category{
+		{Name: "Dining", Type: CategoryTypeExpense},
+		{Name: "Restaurants", Type: CategoryTypeExpense, Parent: "Dining"},
+		{Name: "Sushi", Type: CategoryTypeExpense, Parent: "Restaurants"},
+		{Name: "Delivery", Type: CategoryTypeExpense, Parent: "Dining"},
+	}, original)
+	if err := store.UpdateCategories(tree, 0); err != nil {
+		t.Fatalf("save tree: %v", err)
+	}
+	if got, _ := store.GetCategories(); !slices.Equal(got, tree) {
+		t.Fatalf("tree round trip: got %+v, want %+v", got, tree)
+	}
+
+	day := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for _, e := range []Expense{
+		{Name: "Groceries " + token, Category: "Dining", Amount: money("-10"), Currency: "usd"},
+		{Name: "Sushi " + token, Category: "Sushi", Amount: money("-30"), Currency: "usd"},
+		{Name: "Sushi abroad " + token, Category: "Sushi", Amount: money("-5"), Currency: "eur"},
+		{Name: "Pizza " + token, Category: "Delivery", Amount: money("-12"), Currency: "usd"},
+	} {
+		e.ID, e.Date = uuid.New().String(), day
+		if err := store.AddExpense(e); err != nil {
+			t.Fatalf("add expense: %v", err)
+		}
+	}
+	if err := store.AddExpense(Expense{Name: "Legacy " + token, Category: "Gone", Amount: money("-1"), Currency: "usd", Date: day}); err == nil {
+		t.Fatalf("expected an unknown category to be rejected")
+	}
+	if err := store.AddRecurringExpense(RecurringExpense{ID: uuid.New().String(), Name: token, Category: "Gone", Amount: money("-1"),
+		StartDate: day, Interval: "monthly", Occurrences: 2}); err == nil {
+		t.Fatalf("expected a rule with an unknown category to be rejected")
+	}
+	if err := store.AddRecurringExpense(rule); err != nil {
+		t.Fatalf("add recurring expense: %v", err)
+	}
+
+	// renaming moves the expenses along and keeps the children attached
+	if err := store.RenameCategory("Dining", "Eating", 0); err != nil {
+		t.Fatalf("rename parent: %v", err)
+	}
+	renamed := slices.Clone(tree)
+	renamed[0].Name = "Eating"
+	renamed[1].Parent, renamed[3].Parent = "Eating", "Eating"
+	if got, _ := store.GetCategories(); !slices.Equal(got, renamed) {
+		t.Fatalf("after rename: got %+v, want %+v", got, renamed)
+	}
+	if moved, _ := store.QueryExpenses(ExpenseFilter{Name: token, Categories: []string{"Eating"}}); len(moved) != 1 {
+		t.Fatalf("expected the expense to follow the renamed category, got %+v", moved)
+	}
+	if err := store.RenameCategory("Eating", "Sushi", 0); err == nil {
+		t.Fatalf("expected a rename onto an existing category to fail")
+	}
+	if err := store.RenameCategory("Nowhere", "Somewhere", 0); err == nil {
+		t.Fatalf("expected a rename of a missing category to fail")
+	}
+
+	cycle := slices.Clone(renamed)
+	cycle[0].Parent = "Sushi"
+	if err := store.UpdateCategories(cycle, 0); err == nil {
+		t.Fatalf("expected a cycle to be rejected")
+	}
+	orphan := append(slices.Clone(renamed), Category{Name: "Lost", Parent: "Nowhere"})
+	if err := store.UpdateCategories(orphan, 0); err == nil {
+		t.Fatalf("expected an unknown parent to be rejected")
+	}
+	if err := store.UpdateCategories(slices.Delete(slices.Clone(renamed), 2, 3), 0); err == nil {
+		t.Fatalf("expected dropping a category in use from the list to be rejected")
+	}
+	if got, _ := store.GetCategories(); !slices.Equal(got, renamed) {
+		t.Fatalf("rejected updates changed the tree: %+v", got)
+	}
+
+	sums, err := store.SumExpensesByCategory(ExpenseFilter{Name: token})
+	if err != nil {
+		t.Fatalf("sum expenses: %v", err)
+	}
+	wantSums := []CategorySum{
+		{Category: "Delivery", Currency: "usd", Amount: money("-12.00"), Count: 1},
+		{Category: "Eating", Currency: "usd", Amount: money("-10.00"), Count: 1},
+		{Category: "Sushi", Currency: "eur", Amount: money("-5.00"), Count: 1},
+		{Category: "Sushi", Currency: "usd", Amount: money("-30.00"), Count: 1},
+	}
+	if !slices.Equal(sums, wantSums) {
+		t.Fatalf("sums: got %+v, want %+v", sums, wantSums)
+	}
+
+	totals, err := RollUpCategoryTotals(renamed, append(sums, CategorySum{Category: "Gone", Currency: "usd", Amount: money("-1.00"), Count: 1}))
+	if err != nil {
+		t.Fatalf("roll up totals: %v", err)
+	}
+	byName := map[string]CategoryTotal{}
+	for _, total := range totals {
+		byName[total.Category] = total
+	}
+	if len(totals) != len(renamed)+1 || totals[len(totals)-1].Category != "Gone" {
+		t.Fatalf("expected the list order plus the unknown category last, got %+v", totals)
+	}
+	eating := byName["Eating"]
+	if !maps.Equal(eating.Own, map[string]Money{"usd": money("-10.00")}) || !maps.Equal(eating.Total, map[string]Money{"usd": money("-52.00"), "eur": money("-5.00")}) ||
+		eating.Count != 1 || eating.TotalCount != 4 {
+		t.Fatalf("parent roll-up: %+v", eating)
+	}
+	restaurants := byName["Restaurants"]
+	if len(restaurants.Own) != 0 || !maps.Equal(restaurants.Total, map[string]Money{"usd": money("-30.00"), "eur": money("-5.00")}) || restaurants.TotalCount != 2 {
+		t.Fatalf("intermediate roll-up: %+v", restaurants)
+	}
+
+	// deleting lifts the subcategories and needs a target while in use
+	if err := store.DeleteCategory("Restaurants", "", 0); err != nil {
+		t.Fatalf("delete unused category: %v", err)
+	}
+	lifted := slices.Delete(slices.Clone(renamed), 1, 2)
+	lifted[1].Parent = "Eating"
+	if got, _ := store.GetCategories(); !slices.Equal(got, lifted) {
+		t.Fatalf("after delete: got %+v, want %+v", got, lifted)
+	}
+	if err := store.DeleteCategory("Delivery", "", 0); err == nil {
+		t.Fatalf("expected deleting a category used by a rule to fail")
+	}
+	if err := store.DeleteCategory("Sushi", "", 0); err == nil {
+		t.Fatalf("expected deleting a category in use to fail")
+	}
+	if err := store.DeleteCategory("Sushi", "Sushi", 0); err == nil {
+		t.Fatalf("expected reassigning a category to itself to fail")
+	}
+	if err := store.DeleteCategory("Sushi", "Nowhere", 0); err == nil {
+		t.Fatalf("expected reassigning to a missing category to fail")
+	}
+	if err := store.DeleteCategory("Delivery", "Sushi", 0); err != nil {
+		t.Fatalf("delete with reassignment: %v", err)
+	}
+	sums, _ = store.SumExpensesByCategory(ExpenseFilter{Name: token})
+	wantSums = []CategorySum{
+		{Category: "Eating", Currency: "usd", Amount: money("-10.00"), Count: 1},
+		{Category: "Sushi", Currency: "eur", Amount: money("-5.00"), Count: 1},
+		{Category: "Sushi", Currency: "usd", Amount: money("-42.00"), Count: 2},
+	}
+	if !slices.Equal(sums, wantSums) {
+		t.Fatalf("sums after reassignment: got %+v, want %+v", sums, wantSums)
+	}
+	if got, _ := store.GetRecurringExpense(rule.ID); got.Category != "Sushi" {
+		t.Fatalf("expected the rule to be reassigned, got %q", got.Category)
+	}
+	for _, e := range expensesForRule(t, store, rule.ID) {
+		if e.Category != "Sushi" {
+			t.Fatalf("expected generated instances to be reassigned, got %q", e.Category)
+		}
+	}
+}
+
+func testCurrencyAndStartDate(t *testing.T, store Storage) {
+	originalCurrency, err := store.GetCurrency()
+	if err != nil {
+		t.Fatalf("get currency: %v", err)
+	}
+	originalStartDate, err := store.GetStartDate()
+	if err != nil {
+		t.Fatalf("get start date: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = store.UpdateCurrency(originalCurrency)
+		_ = store.UpdateStartDate(originalStartDate)
+	})
+
+	if err := store.UpdateCurrency("xyz"); err == nil {
+		t.Fatalf("expected error for unsupported currency")
+	}
+	if err := store.UpdateCurrency("eur"); err != nil {
+		t.Fatalf("update currency: %v", err)
+	}
+	if currency, _ := store.GetCurrency(); currency != "eur" {
+		t.Fatalf("expected currency eur, got %s", currency)
+	}
+
+	for _, invalid := range []int{0, 32, -1} {
+		if err := store.UpdateStartDate(invalid); err == nil {
+			t.Fatalf("expected error for start date %d", invalid)
+		}
+	}
+	if err := store.UpdateStartDate(15); err != nil {
+		t.Fatalf("update start date: %v", err)
+	}
+	if startDate, _ := store.GetStartDate(); startDate != 15 {
+		t.Fatalf("expected start date 15, got %d", startDate)
+	}
+}
+
+// testBaseCurrencyAfterReopen checks that expense and rule writes default to
+// the configured currency after a restart, before anything reads the config
+func testBaseCurrencyAfterReopen(t *testing.T, store Storage, reopen func(t *testing.T, store Storage) Storage) {
+	original, err := store.GetCurrency()
+	if err != nil {
+		t.Fatalf("get currency: %v", err)
+	}
+	next := "eur"
+	if original == next {
+		next = "ars"
+	}
+	if err := store.UpdateCurrency(next); err != nil {
+		t.Fatalf("update currency: %v", err)
+	}
+	store = reopen(t, store)
+	t.Cleanup(func() { _ = store.UpdateCurrency(original) })
+
+	expense := Expense{ID: uuid.New().String(), Name: "Reopened", Category: "Food", Amount: money("-5"), Date: time.Now(), Rate: ptr(money("1.25"))}
+	if err := store.AddExpense(expense); err != nil {
+		t.Fatalf("add locked-rate expense after reopen: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = store.RemoveExpense(expense.ID, 0)
+		_ = store.PurgeExpenses([]string{expense.ID})
+	})
+	stored, err := store.GetExpense(expense.ID)
+	if err != nil || stored.Currency != next || stored.RateCurrency != next {
+		t.Fatalf("expected %s defaults, got %+v, %v", next, stored, err)
+	}
+	stored.Currency = ""
+	stored.RateCurrency = ""
+	if err := store.UpdateExpense(expense.ID, stored); err != nil {
+		t.Fatalf("update locked-rate expense after reopen: %v", err)
+	}
+	if updated, _ := store.GetExpense(expense.ID); updated.Currency != next || updated.RateCurrency != next {
+		t.Fatalf("expected %s defaults on update, got %+v", next, updated)
+	}
+
+	rule := newTestRule()
+	rule.Currency = ""
+	if err := store.AddRecurringExpense(rule); err != nil {
+		t.Fatalf("add rule after reopen: %v", err)
+	}
+	t.Cleanup(func() { _ = store.RemoveRecurringExpense(rule.ID, true, 0) })
+	if stored, err := store.GetRecurringExpense(rule.ID); err != nil || stored.Currency != next {
+		t.Fatalf("expected rule in %s, got %+v, %v", next, stored, err)
+	}
+}
+
+// auditActions lists the actions recorded for one entity, newest first
+func auditActions(t *testing.T, store Storage, entity, id string) ([]AuditEntry, []string) {
+	t.Helper()
+	entries, err := store.GetAuditLog(AuditFilter{Entity: entity, EntityID: id})
+	if err != nil {
+		t.Fatalf("get audit log: %v", err)
+	}
+	var actions []string
+	for _, e := range entries {
+		actions = append(actions, e.Action)
+	}
+	return entries, actions
+}
+
+func snapshotOf[T any](t *testing.T, data []byte) T {
+	t.Helper()
+	var v T
+	if err := json.Unmarshal(data, &v); err != nil {
+		t.Fatalf("decode snapshot %s: %v", data, err)
+	}
+	return v
+}
+
+func testAuditLog(t *testing.T, store Storage) {
+	day := time.Date(2024, 8, 1, 12, 0, 0, 0, time.UTC)
+	expense := Expense{ID: uuid.New().String(), Name: "Audited", Category: "Food", Amount: money("-10"), Currency: "usd", Date: day, Tags: []string{"audit"}}
+	if err := store.AddExpense(expense); err != nil {
+		t.Fatalf("add expense: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = store.RemoveExpense(expense.ID, 0)
+		_ = store.PurgeExpenses([]string{expense.ID})
+	})
+	updated := expense
+	updated.Name = "Audited again"
+	updated.Amount = money("-12")
+	if err := store.UpdateExpense(expense.ID, updated); err != nil {
+		t.Fatalf("update expense: %v", err)
+	}
+	bad := updated
+	bad.Category = "Missing " + uuid.New().String()
+	if err := store.UpdateExpense(expense.ID, bad); err == nil {
+		t.Fatalf("expected an unknown category to be refused")
+	}
+	if err := store.RemoveExpense(expense.ID, 0); err != nil {
+		t.Fatalf("remove expense: %v", err)
+	}
+	if err := store.RestoreExpenses([]string{expense.ID}); err != nil {
+		t.Fatalf("restore expense: %v", err)
+	}
+	if err := store.RemoveMultipleExpenses([]string{expense.ID}); err != nil {
+		t.Fatalf("remove expenses: %v", err)
+	}
+	if err := store.PurgeExpenses([]string{expense.ID}); err != nil {
+		t.Fatalf("purge expense: %v", err)
+	}
+
+	// the failed update leaves no trace and the purged expense keeps its history
+	entries, actions := auditActions(t, store, AuditExpense, expense.ID)
+	want := []string{AuditPurge, AuditDelete, AuditRestore, AuditDelete, AuditUpdate, AuditCreate}
+	if !slices.Equal(actions, want) {
+		t.Fatalf("expense history: got %v, want %v", actions, want)
+	}
+	create, update := entries[5], entries[4]
+	if create.Before != nil || snapshotOf[Expense](t, create.After).Name != "Audited" {
+		t.Fatalf("create entry snapshots: before %s after %s", create.Before, create.After)
+	}
+	if before, after := snapshotOf[Expense](t, update.Before), snapshotOf[Expense](t, update.After); !before.Amount.Equal(money("-10")) || !after.Amount.Equal(money("-12")) ||
+		after.Name != "Audited again" || !slices.Equal(after.Tags, []string{"audit"}) {
+		t.Fatalf("update entry snapshots: before %+v after %+v", before, after)
+	}
+	if entries[0].After != nil || snapshotOf[Expense](t, entries[0].Before).ID != expense.ID {
+		t.Fatalf("purge entry snapshots: before %s after %s", entries[0].Before, entries[0].After)
+	}
+	for i := 1; i < len(entries); i++ {
+		if entries[i].ID >= entries[i-1].ID || entries[i].At.After(entries[i-1].At) {
+			t.Fatalf("expected newest entries first, got %+v", entries)
+		}
+	}
+
+	// paging walks the same history with Before
+	page, err := store.GetAuditLog(AuditFilter{Entity: AuditExpense, EntityID: expense.ID, Limit: 2})
+	if err != nil || len(page) != 2 || page[1].ID != entries[1].ID {
+		t.Fatalf("first page: %+v, %v", page, err)
+	}
+	page, err = store.GetAuditLog(AuditFilter{Entity: AuditExpense, EntityID: expense.ID, Before: page[1].ID, Limit: 2})
+	if err != nil || len(page) != 2 || page[0].ID != entries[2].ID {
+		t.Fatalf("second page: %+v, %v", page, err)
+	}
+
+	// rewriting every instance of a rule is recorded on the rule
+	rule := newTestRule()
+	if err := store.AddRecurringExpense(rule); err != nil {
+		t.Fatalf("add recurring expense: %v", err)
+	}
+	rule.Amount = money("-1300")
+	if err := store.UpdateRecurringExpense(rule.ID, rule, true); err != nil {
+		t.Fatalf("update recurring expense: %v", err)
+	}
+	if err := store.RemoveRecurringExpense(rule.ID, true, 0); err != nil {
+		t.Fatalf("remove recurring expense: %v", err)
+	}
+	entries, actions = auditActions(t, store, AuditRecurring, rule.ID)
+	if !slices.Equal(actions, []string{AuditDelete, AuditUpdate, AuditCreate}) {
+		t.Fatalf("rule history: got %v", actions)
+	}
+	if entries[1].Detail != "4 instances removed, 4 generated" || entries[0].Detail != "4 instances removed" {
+		t.Fatalf("rule details: %q, %q", entries[1].Detail, entries[0].Detail)
+	}
+	if before, after := snapshotOf[RecurringExpense](t, entries[1].Before), snapshotOf[RecurringExpense](t, entries[1].After); !before.Amount.Equal(money("-1000")) || !after.Amount.Equal(money("-1300")) {
+		t.Fatalf("rule update snapshots: before %+v after %+v", before, after)
+	}
+
+	// categories and config
+	name := "Audit " + uuid.New().String()[:8]
+	categories, err := store.GetCategories()
+	if err != nil {
+		t.Fatalf("get categories: %v", err)
+	}
+	if err := store.UpdateCategories(append(categories, NewCategory(name)), 0); err != nil {
+		t.Fatalf("add category: %v", err)
+	}
+	filed := Expense{ID: uuid.New().String(), Name: "Filed", Category: name, Amount: money("-4"), Currency: "usd", Date: time.Now()}
+	if err := store.AddExpense(filed); err != nil {
+		t.Fatalf("add expense in category: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = store.RemoveExpense(filed.ID, 0)
+		_ = store.PurgeExpenses([]string{filed.ID})
+	})
+	if err := store.RenameCategory(name, name+" renamed", 0); err != nil {
+		t.Fatalf("rename category: %v", err)
+	}
+	if err := store.DeleteCategory(name+" renamed", "Food", 0); err != nil {
+		t.Fatalf("delete category: %v", err)
+	}
+	// the expenses a category change moves get their own history
+	entries, actions = auditActions(t, store, AuditExpense, filed.ID)
+	if !slices.Equal(actions, []string{AuditUpdate, AuditUpdate, AuditCreate}) ||
+		entries[1].Detail != fmt.Sprintf("category %s renamed to %s renamed", name, name) ||
+		entries[0].Detail != fmt.Sprintf("category %s renamed deleted, reassigned to Food", name) {
+		t.Fatalf("expense history across category changes: got %v, %+v", actions, entries)
+	}
+	if before, after := snapshotOf[Expense](t, entries[1].Before), snapshotOf[Expense](t, entries[1].After); before.Category != name || after.Category != name+" renamed" || after.Version != before.Version+1 {
+		t.Fatalf("rename cascade snapshots: before %+v after %+v", before, after)
+	}
+	entries, actions = auditActions(t, store, AuditCategory, name+" renamed")
+	if !slices.Equal(actions, []string{AuditDelete, AuditRename}) || entries[0].Detail != "reassigned to Food" {
+		t.Fatalf("category history: got %v, %+v", actions, entries)
+	}
+	if snapshotOf[Category](t, entries[1].Before).Name != name {
+		t.Fatalf("rename snapshot: %s", entries[1].Before)
+	}
+
+	original, err := store.GetCurrency()
+	if err != nil {
+		t.Fatalf("get currency: %v", err)
+	}
+	t.Cleanup(func() { _ = store.UpdateCurrency(original) })
+	next := "eur"
+	if original == next {
+		next = "ars"
+	}
+	if err := store.UpdateCurrency(next); err != nil {
+		t.Fatalf("update currency: %v", err)
+	}
+	entries, err = store.GetAuditLog(AuditFilter{Entity: AuditConfig, Limit: 1})
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("config history: %+v, %v", entries, err)
+	}
+	if before, after := snapshotOf[configSnapshot](t, entries[0].Before), snapshotOf[configSnapshot](t, entries[0].After); before.Currency != original || after.Currency != next {
+		t.Fatalf("config snapshots: before %+v after %+v", before, after)
+	}
+}
+
+// expectConflict fails unless err is a ConflictError at version current
+func expectConflict(t *testing.T, err error, current int64) {
+	t.Helper()
+	var conflict *ConflictError
+	if !errors.As(err, &conflict) || conflict.Current != current {
+		t.Fatalf("expected a conflict at version %d, got %v", current, err)
+	}
+}
+
+// testValidationErrors checks that writes the stored data refuses fail with
+// a ValidationError, which the API answers with 400
+func testValidationErrors(t *testing.T, store Storage) {
+	archived := Account{ID: uuid.New().String(), Name: "Archivada " + uuid.New().String()[:8], Type: AccountTypeCash, Currency: "usd", Archived: true}
+	if err := store.AddAccount(archived); err != nil {
+		t.Fatalf("add account: %v", err)
+	}
+	valid := Expense{Name: "Invalid", Category: "Food", Amount: money("-5"), Currency: "usd", Date: time.Now()}
+	for name, change := range map[string]func(e *Expense){
+		"unknown category":  func(e *Expense) { e.Category = "Nowhere " + uuid.New().String()[:8] },
+		"disabled currency": func(e *Expense) { e.Currency, e.Amount = "gbp", money("-5") },
+		"too precise":       func(e *Expense) { e.Amount = money("-5.001") },
+		"rate currency":     func(e *Expense) { e.Rate, e.RateCurrency = ptr(money("2")), "xyz" },
+		"missing account":   func(e *Expense) { e.AccountID = "missing" },
+		"archived account":  func(e *Expense) { e.AccountID = archived.ID },
+	} {
+		expense := valid
+		change(&expense)
+		var invalid *ValidationError
+		if err := store.AddExpense(expense); !errors.As(err, &invalid) {
+			t.Fatalf("%s: expected a validation error, got %v", name, err)
+		}
+	}
+	rule := newTestRule()
+	rule.Category = "Nowhere " + uuid.New().String()[:8]
+	var invalid *ValidationError
+	if err := store.AddRecurringExpense(rule); !errors.As(err, &invalid) {
+		t.Fatalf("expected a validation error for the rule, got %v", err)
+	}
+}
+
+func testVersions(t *testing.T, store Storage) {
+	expense := Expense{ID: uuid.New().String(), Name: "Versioned", Category: "Food", Amount: money("-5"), Currency: "usd", Date: time.Now(), Tags: []string{"v-" + uuid.New().String()[:8]}}
+	if err := store.AddExpense(expense); err != nil {
+		t.Fatalf("add expense: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = store.RemoveExpense(expense.ID, 0)
+		_ = store.PurgeExpenses([]string{expense.ID})
+	})
+	stored, err := store.GetExpense(expense.ID)
+	if err != nil || stored.Version != 1 {
+		t.Fatalf("new expense: %+v, %v", stored, err)
+	}
+	stored.Amount = money("-6")
+	if err := store.UpdateExpense(expense.ID, stored); err != nil {
+		t.Fatalf("update at version 1: %v", err)
+	}
+	// a second writer still holding version 1 loses
+	stored.Amount = money("-7")
+	expectConflict(t, store.UpdateExpense(expense.ID, stored), 2)
+	if got, _ := store.GetExpense(expense.ID); !got.Amount.Equal(money("-6")) || got.Version != 2 {
+		t.Fatalf("conflicting update was applied: %+v", got)
+	}
+	stored.Version = 0
+	if err := store.UpdateExpense(expense.ID, stored); err != nil {
+		t.Fatalf("unchecked update: %v", err)
+	}
+	// cascades from tags move the version too
+	if err := store.RenameTag(expense.Tags[0], expense.Tags[0]+"-renamed"); err != nil {
+		t.Fatalf("rename tag: %v", err)
+	}
+	if got, _ := store.GetExpense(expense.ID); got.Version != 4 {
+		t.Fatalf("expected the tag rename to bump the version to 4, got %d", got.Version)
+	}
+	missing := expense
+	missing.ID = uuid.New().String()
+	missing.Version = 1
+	if err := store.UpdateExpense(missing.ID, missing); err == nil {
+		t.Fatalf("expected an update of a missing expense to fail")
+	} else if errors.As(err, new(*ConflictError)) {
+		t.Fatalf("expected not found rather than a conflict, got %v", err)
+	}
+	expectConflict(t, store.RemoveExpense(expense.ID, 3), 4)
+	if err := store.RemoveExpense(expense.ID, 4); err != nil {
+		t.Fatalf("remove expense at version 4: %v", err)
+	}
+
+	rule := newTestRule()
+	if err := store.AddRecurringExpense(rule); err != nil {
+		t.Fatalf("add recurring expense: %v", err)
+	}
+	t.Cleanup(func() { _ = store.RemoveRecurringExpense(rule.ID, true, 0) })
+	rule.Version = 1
+	rule.Amount = money("-1100")
+	if err := store.UpdateRecurringExpense(rule.ID, rule, true); err != nil {
+		t.Fatalf("update rule at version 1: %v", err)
+	}
+	expectConflict(t, store.UpdateRecurringExpense(rule.ID, rule, true), 2)
+	if got, _ := store.GetRecurringExpense(rule.ID); !got.Amount.Equal(money("-1100")) || got.Version != 2 {
+		t.Fatalf("rule after conflict: %+v", got)
+	}
+	// overrides and removals check the version like updates
+	skip := RecurringOverride{Occurrence: *expensesForRule(t, store, rule.ID)[0].Occurrence, Skip: true}
+	expectConflict(t, store.OverrideRecurringOccurrence(rule.ID, skip, 1), 2)
+	if err := store.OverrideRecurringOccurrence(rule.ID, skip, 2); err != nil {
+		t.Fatalf("override at version 2: %v", err)
+	}
+	expectConflict(t, store.RemoveRecurringExpense(rule.ID, true, 2), 3)
+	if _, err := store.GetRecurringExpense(rule.ID); err != nil {
+		t.Fatalf("expected the rule kept after the conflict: %v", err)
+	}
+	if err := store.RemoveRecurringExpense(rule.ID, true, 3); err != nil {
+		t.Fatalf("remove rule at version 3: %v", err)
+	}
+
+	// the category list carries one version for every category write
+	version, err := store.CategoriesVersion()
+	if err != nil {
+		t.Fatalf("categories version: %v", err)
+	}
+	categories, err := store.GetCategories()
+	if err != nil {
+		t.Fatalf("get categories: %v", err)
+	}
+	name := "Versioned " + uuid.New().String()[:8]
+	if err := store.UpdateCategories(append(categories, NewCategory(name)), version); err != nil {
+		t.Fatalf("add category at version %d: %v", version, err)
+	}
+	expectConflict(t, store.RenameCategory(name, name+" renamed", version), version+1)
+	expectConflict(t, store.DeleteCategory(name, "Food", version), version+1)
+	if err := store.DeleteCategory(name, "Food", version+1); err != nil {
+		t.Fatalf("delete category at version %d: %v", version+1, err)
+	}
+	if next, _ := store.CategoriesVersion(); next != version+2 {
+		t.Fatalf("expected categories version %d, got %d", version+2, next)
+	}
+}
+
+func testExactAmounts(t *testing.T, store Storage) {
+	token := uuid.New().String()
+	day := time.Date(2024, 9, 1, 12, 0, 0, 0, time.UTC)
+	// beyond the old NUMERIC(10, 2) cap, and amounts a float64 sum would round
+	expenses := []Expense{
+		{ID: uuid.New().String(), Name: "Car " + token, Category: "Travel", Amount: money("-123456789.99"), Currency: "ars", Date: day},
+		{ID: uuid.New().String(), Name: "Fee " + token, Category: "Travel", Amount: money("-0.01"), Currency: "ars", Date: day},
+		{ID: uuid.New().String(), Name: "Dime " + token, Category: "Food", Amount: money("0.1"), Currency: "usd", Date: day},
+		{ID: uuid.New().String(), Name: "Fifth " + token, Category: "Food", Amount: money("0.2"), Currency: "usd", Date: day},
+	}
+	for _, e := range expenses {
+		if err := store.AddExpense(e); err != nil {
+			t.Fatalf("add expense: %v", err)
+		}
+		t.Cleanup(func() {
+			_ = store.RemoveExpense(e.ID, 0)
+			_ = store.PurgeExpenses([]string{e.ID})
+		})
+	}
+	got, err := store.GetExpense(expenses[0].ID)
+	if err != nil || got.Amount != NewMoney(-12345678999, 2) {
+		t.Fatalf("expected the amount in minor units, got %+v (%v)", got.Amount, err)
+	}
+	if data, _ := json.Marshal(got.Amount); string(data) != "-123456789.99" {
+		t.Fatalf("expected an exact JSON number, got %s", data)
+	}
+	sums, err := store.SumExpensesByCategory(ExpenseFilter{Name: token})
+	if err != nil {
+		t.Fatalf("sum expenses: %v", err)
+	}
+	wantSums := []CategorySum{
+		{Category: "Food", Currency: "usd", Amount: money("0.30"), Count: 2},
+		{Category: "Travel", Currency: "ars", Amount: money("-123456790.00"), Count: 2},
+	}
+	if !slices.Equal(sums, wantSums) {
+		t.Fatalf("sums: got %+v, want %+v", sums, wantSums)
+	}
+
+	// more decimals than the currency has are refused rather than rounded
+	tooPrecise := Expense{ID: uuid.New().String(), Name: "Fraction " + token, Category: "Food", Amount: money("1.005"), Currency: "usd", Date: day}
+	if err := store.AddExpense(tooPrecise); err == nil {
+		t.Fatalf("expected an amount with three decimals to be refused in usd")
+	}
+	trailing := tooPrecise
+	trailing.Amount = money("1.500")
+	if err := store.AddExpense(trailing); err != nil {
+		t.Fatalf("expected trailing zeros to be accepted: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = store.RemoveExpense(trailing.ID, 0)
+		_ = store.PurgeExpenses([]string{trailing.ID})
+	})
+	if got, _ := store.GetExpense(trailing.ID); got.Amount != NewMoney(150, 2) {
+		t.Fatalf("expected 1.500 stored as 150 cents, got %+v", got.Amount)
+	}
+}
+
+func testExchangeRates(t *testing.T, store Storage) {
+	march := func(day int) time.Time { return time.Date(2024, 3, day, 0, 0, 0, 0, time.UTC) }
+	rates := []ExchangeRate{
+		{Date: march(10).Add(15 * time.Hour), Currency: "USD", Quote: "ars", Rate: money("900")},
+		{Date: march(1), Currency: "usd", Quote: "ars", Rate: money("850.5")},
+		{Date: march(1), Currency: "eur", Quote: "usd", Rate: money("1.0825")},
+	}
+	if err := store.SaveExchangeRates(rates); err != nil {
+		t.Fatalf("save rates: %v", err)
+	}
+	t.Cleanup(func() {
+		for _, rate := range rates {
+			_ = store.DeleteExchangeRate(rate.Date, rate.Currency, rate.Quote)
+		}
+	})
+	if rates[0].Currency != "USD" {
+		t.Fatalf("expected the caller's rates to be left untouched")
+	}
+	// a second rate for a pair and day replaces the first
+	if err := store.SaveExchangeRates([]ExchangeRate{{Date: march(10), Currency: "usd", Quote: "ars", Rate: money("905.25")}}); err != nil {
+		t.Fatalf("replace rate: %v", err)
+	}
+	got, err := store.GetExchangeRates()
+	if err != nil {
+		t.Fatalf("get rates: %v", err)
+	}
+	want := []ExchangeRate{
+		{Date: march(1), Currency: "eur", Quote: "usd", Rate: money("1.0825")},
+		{Date: march(1), Currency: "usd", Quote: "ars", Rate: money("850.5")},
+		{Date: march(10), Currency: "usd", Quote: "ars", Rate: money("905.25")},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("rates: got %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if !got[i].Date.Equal(want[i].Date) || got[i].Currency != want[i].Currency || got[i].Quote != want[i].Quote || !got[i].Rate.Equal(want[i].Rate) {
+			t.Fatalf("rate %d: got %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	for _, invalid := range []ExchangeRate{
+		{Date: march(2), Currency: "usd", Quote: "usd", Rate: money("1")},
+		{Date: march(2), Currency: "usd", Quote: "ars", Rate: money("0")},
+		{Date: march(2), Currency: "usd", Quote: "xyz", Rate: money("1")},
+	} {
+		if err := store.SaveExchangeRates([]ExchangeRate{invalid}); err == nil {
+			t.Fatalf("expected %+v to be refused", invalid)
+		}
+	}
+	if err := store.DeleteExchangeRate(march(2), "usd", "ars"); err == nil {
+		t.Fatalf("expected deleting a missing rate to fail")
+	}
+	if err := store.DeleteExchangeRate(march(1), "eur", "usd"); err != nil {
+		t.Fatalf("delete rate: %v", err)
+	}
+	if got, _ := store.GetExchangeRates(); len(got) != 2 {
+		t.Fatalf("expected 2 rates after the delete, got %+v", got)
+	}
+
+	// a rate locked on an expense is stored exactly and can be cleared
+	expense := Expense{ID: uuid.New().String(), Name: "Hotel", Category: "Travel", Amount: money("-120"), Currency: "usd",
+		Date: march(5), Rate: ptr(money("1012.345")), RateCurrency: "ARS"}
+	if err := store.AddExpense(expense); err != nil {
+		t.Fatalf("add expense with rate: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = store.RemoveExpense(expense.ID, 0)
+		_ = store.PurgeExpenses([]string{expense.ID})
+	})
+	stored, err := store.GetExpense(expense.ID)
+	if err != nil || stored.Rate == nil || stored.Rate.String() != "1012.345" || stored.RateCurrency != "ars" {
+		t.Fatalf("expected the locked rate 1012.345 ars, got %+v (%v)", stored, err)
+	}
+	if converted, ok := NewRateTable(got).Convert(stored, "ars"); !ok || converted != NewMoney(-12148140, 2) {
+		t.Fatalf("expected the locked rate to win over the table, got %v (%v)", converted, ok)
+	}
+	stored.Rate = nil
+	if err := store.UpdateExpense(expense.ID, stored); err != nil {
+		t.Fatalf("clear rate: %v", err)
+	}
+	if cleared, _ := store.GetExpense(expense.ID); cleared.Rate != nil || cleared.RateCurrency != "" {
+		t.Fatalf("expected the rate to be cleared, got %+v", cleared)
+	}
+	if converted, ok := NewRateTable(got).Convert(stored, "ars"); !ok || converted != NewMoney(-10206000, 2) {
+		t.Fatalf("expected the table rate of march 1st, got %v (%v)", converted, ok)
+	}
+}
+
+func testEnabledCurrencies(t *testing.T, store Storage) {
+	original, err := store.GetEnabledCurrencies()
+	if err != nil {
+		t.Fatalf("get enabled currencies: %v", err)
+	}
+	for _, code := range DefaultCurrencies {
+		if !slices.Contains(original, code) {
+			t.Fatalf("expected %s enabled by default, got %v", code, original)
+		}
+	}
+	t.Cleanup(func() { _ = store.UpdateEnabledCurrencies(original) })
+	day := time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)
+	taxi := Expense{ID: uuid.New().String(), Name: "Taxi " + uuid.New().String(), Category: "Travel", Amount: money("-1500"), Currency: "CLP", Date: day}
+	if err := store.AddExpense(taxi); err == nil {
+		t.Fatalf("expected an expense in a disabled currency to be refused")
+	}
+
+	enabled := append(slices.Clone(original), "clp", "BRL")
+	for _, invalid := range [][]string{nil, append(slices.Clone(enabled), "xyz"), append(slices.Clone(enabled), "clp")} {
+		if err := store.UpdateEnabledCurrencies(invalid); err == nil {
+			t.Fatalf("expected %v to be refused", invalid)
+		}
+	}
+	if err := store.UpdateEnabledCurrencies(enabled); err != nil {
+		t.Fatalf("enable currencies: %v", err)
+	}
+	if got, _ := store.GetEnabledCurrencies(); !slices.Equal(got, append(slices.Clone(original), "clp", "brl")) {
+		t.Fatalf("expected the list lowercased in order, got %v", got)
+	}
+	entries, err := store.GetAuditLog(AuditFilter{Entity: AuditConfig, EntityID: "currencies", Limit: 1})
+	if err != nil || len(entries) != 1 || snapshotOf[[]string](t, entries[0].After)[len(enabled)-1] != "brl" {
+		t.Fatalf("expected the change in the audit log, got %+v (%v)", entries, err)
+	}
+
+	if err := store.AddExpense(taxi); err != nil {
+		t.Fatalf("add clp expense: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = store.RemoveExpense(taxi.ID, 0)
+		_ = store.PurgeExpenses([]string{taxi.ID})
+	})
+	got, err := store.GetExpense(taxi.ID)
+	if err != nil || got.Currency != "clp" || got.Amount != NewMoney(-1500, 0) {
+		t.Fatalf("expected 1500 clp kept without decimals, got %+v (%v)", got, err)
+	}
+	cheap, err := store.QueryExpenses(ExpenseFilter{Name: taxi.Name, MaxAmount: ptr(money("-1499.5"))})
+	if err != nil || len(cheap) != 1 {
+		t.Fatalf("expected amount filters to honour clp decimals, got %+v (%v)", cheap, err)
+	}
+	rule := newTestRule()
+	rule.Currency = "brl"
+	if err := store.AddRecurringExpense(rule); err != nil {
+		t.Fatalf("add brl rule: %v", err)
+	}
+	t.Cleanup(func() { _ = store.RemoveRecurringExpense(rule.ID, true, 0) })
+	rule.Currency = "gbp"
+	if err := store.UpdateRecurringExpense(rule.ID, rule, true); err == nil {
+		t.Fatalf("expected a rule in a disabled currency to be refused")
+	}
+
+	// the base currency and every currency in use, trash included, stay enabled
+	if err := store.UpdateEnabledCurrencies([]string{"usd", "ars", "eur", "brl"}); err == nil {
+		t.Fatalf("expected disabling a currency with expenses to be refused")
+	}
+	if err := store.RemoveExpense(taxi.ID, 0); err != nil {
+		t.Fatalf("trash clp expense: %v", err)
+	}
+	if err := store.UpdateEnabledCurrencies([]string{"usd", "ars", "eur", "brl"}); err == nil {
+		t.Fatalf("expected disabling a currency with trashed expenses to be refused")
+	}
+	if err := store.UpdateEnabledCurrencies([]string{"usd", "ars", "eur", "clp"}); err == nil {
+		t.Fatalf("expected disabling a currency with recurring rules to be refused")
+	}
+	base, _ := store.GetCurrency()
+	without := slices.DeleteFunc(slices.Clone(enabled), func(code string) bool { return strings.EqualFold(code, base) })
+	if err := store.UpdateEnabledCurrencies(without); err == nil {
+		t.Fatalf("expected disabling the base currency to be refused")
+	}
+	if err := store.UpdateCurrency("gbp"); err == nil {
+		t.Fatalf("expected a disabled base currency to be refused")
+	}
+}
+
+func testCPIIndexes(t *testing.T, store Storage) {
+	month := func(m time.Month) time.Time { return time.Date(2023, m, 1, 0, 0, 0, 0, time.UTC) }
+	indexes := []CPIIndex{
+		{Currency: "ARS", Month: month(2).Add(20 * 24 * time.Hour), Value: money("1381.1601")},
+		{Currency: "ars", Month: month(1), Value: money("1269.6901")},
+		{Currency: "usd", Month: month(1), Value: money("300.536")},
+	}
+	if err := store.SaveCPIIndexes(indexes); err != nil {
+		t.Fatalf("save cpi indexes: %v", err)
+	}
+	t.Cleanup(func() {
+		for _, index := range indexes {
+			_ = store.DeleteCPIIndex(index.Currency, index.Month)
+		}
+	})
+	if indexes[0].Currency != "ARS" {
+		t.Fatalf("expected the caller's indexes to be left untouched")
+	}
+	// a second value for a currency and month replaces the first
+	if err := store.SaveCPIIndexes([]CPIIndex{{Currency: "ars", Month: month(2), Value: money("1381.2")}}); err != nil {
+		t.Fatalf("replace cpi index: %v", err)
+	}
+	got, err := store.GetCPIIndexes()
+	if err != nil {
+		t.Fatalf("get cpi indexes: %v", err)
+	}
+	got = slices.DeleteFunc(got, func(index CPIIndex) bool { return index.Month.Year() != 2023 })
+	want := []CPIIndex{
+		{Currency: "ars", Month: month(1), Value: money("1269.6901")},
+		{Currency: "ars", Month: month(2), Value: money("1381.2")},
+		{Currency: "usd", Month: month(1), Value: money("300.536")},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d indexes, got %+v", len(want), got)
+	}
+	for i := range want {
+		if got[i].Currency != want[i].Currency || !got[i].Month.Equal(want[i].Month) || !got[i].Value.Equal(want[i].Value) {
+			t.Fatalf("index %d: got %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	for _, invalid := range []CPIIndex{
+		{Currency: "xyz", Month: month(3), Value: money("1")},
+		{Currency: "ars", Month: month(3), Value: money("-1")},
+		{Currency: "ars", Value: money("1")},
+	} {
+		if err := store.SaveCPIIndexes([]CPIIndex{invalid}); err == nil {
+			t.Fatalf("expected %+v to be refused", invalid)
+		}
+	}
+	if err := store.DeleteCPIIndex("ars", month(3)); err == nil {
+		t.Fatalf("expected an error deleting a missing index")
+	}
+	if err := store.DeleteCPIIndex("USD", month(1).Add(48*time.Hour)); err != nil {
+		t.Fatalf("delete cpi index: %v", err)
+	}
+}
+
+func testCurrencyExchanges(t *testing.T, store Storage) {
+	date := time.Date(2023, 5, 10, 15, 0, 0, 0, time.UTC)
+	if err := store.AddExpense(Expense{Name: "Lunch", Category: "Food", Amount: money("-5000"), Currency: "ars", Date: date}); err != nil {
+		t.Fatalf("add expense: %v", err)
+	}
+	for _, invalid := range []CurrencyExchange{
+		{FromCurrency: "ars", FromAmount: money("100000"), ToCurrency: "ars", ToAmount: money("100"), Date: date},
+		{FromCurrency: "ars", FromAmount: money("-100000"), ToCurrency: "usd", ToAmount: money("100"), Date: date},
+		{FromCurrency: "ars", FromAmount: money("100000"), ToCurrency: "usd", ToAmount: money("100.001"), Date: date},
+		{FromCurrency: "ars", FromAmount: money("100000"), ToCurrency: "gbp", ToAmount: money("100"), Date: date},
+		{FromCurrency: "ars", FromAmount: money("100000"), ToCurrency: "usd", ToAmount: money("100")},
+	} {
+		if err := store.AddCurrencyExchange(invalid); err == nil {
+			t.Fatalf("expected %+v to be refused", invalid)
+		}
+	}
+	exchange := CurrencyExchange{Name: "Dolares", FromCurrency: "ARS", FromAmount: money("123456.78"), ToCurrency: "usd", ToAmount: money("150"), Date: date}
+	if err := store.AddCurrencyExchange(exchange); err != nil {
+		t.Fatalf("add currency exchange: %v", err)
+	}
+	exchanges, err := store.GetCurrencyExchanges()
+	if err != nil || len(exchanges) != 1 {
+		t.Fatalf("expected one exchange, got %+v (%v)", exchanges, err)
+	}
+	x := exchanges[0]
+	t.Cleanup(func() { _ = store.RemoveCurrencyExchange(x.ID) })
+	if x.FromCurrency != "ars" || x.FromAmount.String() != "123456.78" || x.ToAmount.String() != "150.00" || x.Rate.String() != "823.045200" {
+		t.Fatalf("unexpected exchange: %+v", x)
+	}
+	if got, err := store.GetCurrencyExchange(x.ID); err != nil || got.OutgoingID != x.OutgoingID || !got.Date.Equal(date) {
+		t.Fatalf("get currency exchange: %+v (%v)", got, err)
+	}
+
+	legs, err := store.QueryExpenses(ExpenseFilter{Exchanges: ptr(true)})
+	if err != nil || len(legs) != 2 {
+		t.Fatalf("expected two legs, got %+v (%v)", legs, err)
+	}
+	for _, leg := range legs {
+		if leg.ExchangeID != x.ID || leg.Category != "" || leg.Name != "Dolares" {
+			t.Fatalf("unexpected leg: %+v", leg)
+		}
+		if (leg.ID == x.OutgoingID && leg.Amount.String() != "-123456.78") || (leg.ID == x.IncomingID && leg.Amount.String() != "150.00") {
+			t.Fatalf("unexpected leg amount: %+v", leg)
+		}
+	}
+	if others, err := store.QueryExpenses(ExpenseFilter{Exchanges: ptr(false)}); err != nil || len(others) != 1 || others[0].Name != "Lunch" {
+		t.Fatalf("expected only the lunch outside exchanges, got %+v (%v)", others, err)
+	}
+	if sums, err := store.SumExpensesByCategory(ExpenseFilter{Exchanges: ptr(false)}); err != nil || len(sums) != 1 || sums[0].Category != "Food" {
+		t.Fatalf("expected legs out of the category sums, got %+v (%v)", sums, err)
+	}
+
+	// the effective rate feeds the conversion data
+	rates, err := store.GetExchangeRates()
+	if err != nil {
+		t.Fatalf("get exchange rates: %v", err)
+	}
+	table := NewRateTable(rates)
+	if rate, ok := table.Lookup("usd", "ars", date); !ok || rate.FloatString(4) != "823.0452" {
+		t.Fatalf("expected the effective rate in the rate table, got %v", rate)
+	}
+	t.Cleanup(func() { _ = store.DeleteExchangeRate(date, "usd", "ars") })
+
+	// legs only change through their exchange
+	leg := legs[0]
+	leg.Category = "Food"
+	if err := store.UpdateExpense(leg.ID, leg); err == nil {
+		t.Fatalf("expected editing a leg to be refused")
+	}
+	if err := store.RemoveExpense(leg.ID, 0); err == nil {
+		t.Fatalf("expected trashing a leg to be refused")
+	}
+	if err := store.RemoveMultipleExpenses([]string{legs[1].ID}); err == nil {
+		t.Fatalf("expected trashing a leg in bulk to be refused")
+	}
+	if err := store.UpdateEnabledCurrencies([]string{"ars", "eur"}); err == nil {
+		t.Fatalf("expected usd to stay enabled while a leg uses it")
+	}
+
+	if err := store.RemoveCurrencyExchange(x.ID); err != nil {
+		t.Fatalf("remove currency exchange: %v", err)
+	}
+	if err := store.RemoveCurrencyExchange(x.ID); err == nil {
+		t.Fatalf("expected an error removing a missing exchange")
+	}
+	if remaining, err := store.QueryExpenses(ExpenseFilter{Exchanges: ptr(true)}); err != nil || len(remaining) != 0 {
+		t.Fatalf("expected the legs gone with the exchange, got %+v (%v)", remaining, err)
+	}
+	if trash, err := store.GetTrash(); err != nil || len(trash) != 0 {
+		t.Fatalf("expected the legs deleted for good, got %+v (%v)", trash, err)
+	}
+	entries, err := store.GetAuditLog(AuditFilter{Entity: AuditExchange, EntityID: x.ID})
+	if err != nil || len(entries) != 2 || entries[0].Action != AuditDelete || entries[1].Action != AuditCreate {
+		t.Fatalf("unexpected exchange history: %+v (%v)", entries, err)
+	}
+}
+
+// testExchangeAccounts moves money between a peso and a dollar account with
+// an exchange and checks both balances
+func testExchangeAccounts(t *testing.T, store Storage) {
+	token := uuid.New().String()[:8]
+	date := time.Date(2023, 5, 12, 15, 0, 0, 0, time.UTC)
+	pesos := Account{ID: uuid.New().String(), Name: "Pesos " + token, Type: AccountTypeBank, Currency: "ars", OpeningBalance: money("200000")}
+	dollars := Account{ID: uuid.New().String(), Name: "Dolares " + token, Type: AccountTypeCash, Currency: "usd"}
+	archived := Account{ID: uuid.New().String(), Name: "Viejo " + token, Type: AccountTypeCash, Currency: "usd", Archived: true}
+	for _, a := range []Account{pesos, dollars, archived} {
+		if err := store.AddAccount(a); err != nil {
+			t.Fatalf("add account: %v", err)
+		}
+	}
+	exchange := CurrencyExchange{Name: "Dolares " + token, FromCurrency: "ars", FromAmount: money("100000"), ToCurrency: "usd", ToAmount: money("100"), Date: date}
+	for _, accounts := range [][2]string{{dollars.ID, dollars.ID}, {pesos.ID, archived.ID}, {pesos.ID, "missing"}} {
+		invalid := exchange
+		invalid.FromAccountID, invalid.ToAccountID = accounts[0], accounts[1]
+		if err := store.AddCurrencyExchange(invalid); err == nil {
+			t.Fatalf("expected accounts %v to be refused", accounts)
+		}
+	}
+	exchange.ID = uuid.New().String()
+	exchange.FromAccountID, exchange.ToAccountID = pesos.ID, dollars.ID
+	if err := store.AddCurrencyExchange(exchange); err != nil {
+		t.Fatalf("add currency exchange: %v", err)
+	}
+	t.Cleanup(func() { _ = store.RemoveCurrencyExchange(exchange.ID) })
+	x, err := store.GetCurrencyExchange(exchange.ID)
+	if err != nil || x.FromAccountID != pesos.ID || x.ToAccountID != dollars.ID {
+		t.Fatalf("expected the accounts on the exchange, got %+v (%v)", x, err)
+	}
+	if out, err := store.GetExpense(x.OutgoingID); err != nil || out.AccountID != pesos.ID || out.Source != SourceBank {
+		t.Fatalf("expected the outgoing leg on the peso account, got %+v (%v)", out, err)
+	}
+	if in, err := store.GetExpense(x.IncomingID); err != nil || in.AccountID != dollars.ID || in.Source != SourceCash {
+		t.Fatalf("expected the incoming leg on the dollar account, got %+v (%v)", in, err)
+	}
+
+	balanceOf := func(id string) AccountBalance {
+		t.Helper()
+		balances, err := store.GetAccountBalances()
+		if err != nil {
+			t.Fatalf("get account balances: %v", err)
+		}
+		for _, b := range balances {
+			if b.ID == id {
+				return b
+			}
+		}
+		t.Fatalf("account %s has no balance", id)
+		return AccountBalance{}
+	}
+	if b := balanceOf(pesos.ID); b.Balance.String() != "100000.00" || b.Count != 1 {
+		t.Fatalf("unexpected peso balance: %+v", b)
+	}
+	if b := balanceOf(dollars.ID); b.Balance.String() != "100.00" || b.Count != 1 {
+		t.Fatalf("unexpected dollar balance: %+v", b)
+	}
+	if err := store.DeleteAccount(dollars.ID); err == nil {
+		t.Fatalf("expected an account with an exchange leg to stay")
+	}
+
+	if err := store.RemoveCurrencyExchange(exchange.ID); err != nil {
+		t.Fatalf("remove currency exchange: %v", err)
+	}
+	if b := balanceOf(pesos.ID); b.Balance.String() != "200000.00" || b.Count != 0 {
+		t.Fatalf("expected the peso balance back, got %+v", b)
+	}
+}
+
+func testAccounts(t *testing.T, store Storage) {
+	token := uuid.New().String()[:8]
+	day := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	for _, invalid := range []Account{
+		{Name: " ", Type: AccountTypeBank, Currency: "ars"},
+		{Name: "Banco " + token, Type: "savings", Currency: "ars"},
+		{Name: "Banco " + token, Type: AccountTypeBank, Currency: "gbp"},
+		{Name: "Banco " + token, Type: AccountTypeBank, Currency: "ars", OpeningBalance: money("0.001")},
+	} {
+		if err := store.AddAccount(invalid); err == nil {
+			t.Fatalf("expected %+v to be refused", invalid)
+		}
+	}
+	bank := Account{ID: uuid.New().String(), Name: "Banco " + token, Type: "BANK", Currency: "ars", OpeningBalance: money("1000")}
+	if err := store.AddAccount(bank); err != nil {
+		t.Fatalf("add account: %v", err)
+	}
+	if err := store.AddAccount(Account{Name: "banco  " + token, Type: AccountTypeCash, Currency: "ars"}); err == nil {
+		t.Fatalf("expected a name taken in the currency to be refused, ignoring case")
+	}
+	if err := store.AddAccount(Account{Name: "Banco " + token, Type: AccountTypeBank, Currency: "usd"}); err != nil {
+		t.Fatalf("the same name in another currency is a different account: %v", err)
+	}
+	if got, err := store.GetAccount(bank.ID); err != nil || got.Type != AccountTypeBank || got.OpeningBalance.String() != "1000.00" {
+		t.Fatalf("get account: %+v (%v)", got, err)
+	}
+
+	// an explicit account wins over the legacy fields, which follow it
+	rent := Expense{Name: "Rent " + token, Category: "Rent", Amount: money("-300"), Currency: "ars", Date: day, AccountID: bank.ID, Source: "TARJETA", Card: "Amex"}
+	if err := store.AddExpense(rent); err != nil {
+		t.Fatalf("add expense with account: %v", err)
+	}
+	if err := store.AddExpense(Expense{Name: "Taxi " + token, Category: "Travel", Amount: money("-5"), Currency: "usd", Date: day, AccountID: bank.ID}); err == nil {
+		t.Fatalf("expected an account in another currency to be refused")
+	}
+	if err := store.AddExpense(Expense{Name: "Taxi " + token, Category: "Travel", Amount: money("-5"), Currency: "ars", Date: day, AccountID: "missing"}); err == nil {
+		t.Fatalf("expected a missing account to be refused")
+	}
+	// legacy writes find or create the account their source and card stand for
+	card := "Visa " + token
+	legacy := []Expense{
+		{Name: "Lunch " + token, Category: "Food", Amount: money("-20"), Currency: "ars", Date: day, Source: "TARJETA", Card: card},
+		{Name: "Dinner " + token, Category: "Food", Amount: money("-30"), Currency: "ars", Date: day, Source: "tarjeta", Card: " " + strings.ToLower(card) + " "},
+		{Name: "Salary " + token, Category: "Income", Amount: money("500"), Currency: "ars", Date: day},
+	}
+	if err := store.AddMultipleExpenses(legacy); err != nil {
+		t.Fatalf("add legacy expenses: %v", err)
+	}
+	byName := map[string]Expense{}
+	expenses, err := store.QueryExpenses(ExpenseFilter{Name: token})
+	if err != nil {
+		t.Fatalf("query expenses: %v", err)
+	}
+	for _, e := range expenses {
+		byName[strings.TrimSuffix(e.Name, " "+token)] = e
+	}
+	if e := byName["Rent"]; e.AccountID != bank.ID || e.Source != SourceBank || e.Card != "" {
+		t.Fatalf("expected the rent on the bank account, got %+v", e)
+	}
+	lunch, dinner := byName["Lunch"], byName["Dinner"]
+	if lunch.AccountID == "" || dinner.AccountID != lunch.AccountID || dinner.Card != card || dinner.Source != SourceCreditCard {
+		t.Fatalf("expected both card expenses on one account, got %+v and %+v", lunch, dinner)
+	}
+	if e := byName["Salary"]; e.AccountID != "" || e.Source != "" {
+		t.Fatalf("expected no account without source and card, got %+v", e)
+	}
+	visa, err := store.GetAccount(lunch.AccountID)
+	if err != nil || visa.Type != AccountTypeCreditCard || visa.Name != card || visa.Currency != "ars" {
+		t.Fatalf("unexpected account created from the card: %+v (%v)", visa, err)
+	}
+	if onCard, err := store.QueryExpenses(ExpenseFilter{Account: visa.ID}); err != nil || len(onCard) != 2 {
+		t.Fatalf("expected two expenses on the card, got %+v (%v)", onCard, err)
+	}
+
+	balances, err := store.GetAccountBalances()
+	if err != nil {
+		t.Fatalf("get account balances: %v", err)
+	}
+	for _, b := range balances {
+		switch b.ID {
+		case bank.ID:
+			if b.Balance.String() != "700.00" || b.Count != 1 {
+				t.Fatalf("unexpected bank balance: %+v", b)
+			}
+		case visa.ID:
+			if b.Balance.String() != "-50.00" || b.Count != 2 {
+				t.Fatalf("unexpected card balance: %+v", b)
+			}
+		}
+	}
+
+	// renaming the card rewrites the legacy fields of its expenses
+	visa.Name = "Visa Gold " + token
+	if err := store.UpdateAccount(visa.ID, visa); err != nil {
+		t.Fatalf("update account: %v", err)
+	}
+	if got, err := store.GetExpense(lunch.ID); err != nil || got.Card != visa.Name || got.Version != lunch.Version+1 {
+		t.Fatalf("expected the card renamed on the expense, got %+v (%v)", got, err)
+	}
+	visa.Currency = "usd"
+	if err := store.UpdateAccount(visa.ID, visa); err == nil {
+		t.Fatalf("expected the currency of an account in use to stay")
+	}
+	if err := store.UpdateEnabledCurrencies([]string{"ars", "eur"}); err == nil {
+		t.Fatalf("expected usd to stay enabled while an account uses it")
+	}
+	if err := store.DeleteAccount(visa.ID); err == nil {
+		t.Fatalf("expected deleting an account in use to be refused")
+	}
+
+	// archived accounts stay on their expenses but take no new ones
+	visa.Currency, visa.Archived = "ars", true
+	if err := store.UpdateAccount(visa.ID, visa); err != nil {
+		t.Fatalf("archive account: %v", err)
+	}
+	if err := store.AddExpense(Expense{Name: "Bus " + token, Category: "Travel", Amount: money("-1"), Currency: "ars", Date: day, AccountID: visa.ID}); err == nil {
+		t.Fatalf("expected an archived account to be refused")
+	}
+	edited, err := store.GetExpense(lunch.ID)
+	if err != nil {
+		t.Fatalf("get expense: %v", err)
+	}
+	edited.Amount = money("-25")
+	if err := store.UpdateExpense(lunch.ID, edited); err != nil {
+		t.Fatalf("expected an expense to keep its archived account: %v", err)
+	}
+	if accounts, err := store.GetAccounts(); err != nil || accounts[len(accounts)-1].ID != visa.ID {
+		t.Fatalf("expected archived accounts listed last, got %+v (%v)", accounts, err)
+	}
+
+	unused := Account{Name: "Efectivo " + token, Type: AccountTypeCash, Currency: "eur"}
+	if err := store.AddAccount(unused); err != nil {
+		t.Fatalf("add account: %v", err)
+	}
+	accounts, _ := store.GetAccounts()
+	for _, a := range accounts {
+		if a.Name == unused.Name {
+			unused = a
+		}
+	}
+	if err := store.DeleteAccount(unused.ID); err != nil {
+		t.Fatalf("delete unused account: %v", err)
+	}
+	if _, err := store.GetAccount(unused.ID); err == nil {
+		t.Fatalf("expected the account gone")
+	}
+	entries, err := store.GetAuditLog(AuditFilter{Entity: AuditAccount, EntityID: visa.ID})
+	if err != nil || len(entries) != 3 || entries[2].Action != AuditCreate || entries[2].Detail == "" {
+		t.Fatalf("unexpected account history: %+v (%v)", entries, err)
+	}
+}
+
+func ptr[T any](v T) *T { return &v }
+
+func testTransactionTypes(t *testing.T, store Storage) {
+	token := uuid.New().String()[:8]
+	day := time.Date(2023, 7, 1, 12, 0, 0, 0, time.UTC)
+	bank := Account{ID: uuid.New().String(), Name: "Banco " + token, Type: AccountTypeBank, Currency: "ars", OpeningBalance: money("1000")}
+	cash := Account{ID: uuid.New().String(), Name: "Efectivo " + token, Type: AccountTypeCash, Currency: "ars"}
+	dollars := Account{ID: uuid.New().String(), Name: "Dolares " + token, Type: AccountTypeCash, Currency: "usd"}
+	for _, a := range []Account{bank, cash, dollars} {
+		if err := store.AddAccount(a); err != nil {
+			t.Fatalf("add account: %v", err)
+		}
+	}
+
+	// the type defaults from the sign and has to agree with it
+	for _, invalid := range []Expense{
+		{Name: "Refund " + token, Category: "Food", Amount: money("20"), Currency: "ars", Date: day, Type: TransactionTypeExpense},
+		{Name: "Salary " + token, Category: "Income", Amount: money("-20"), Currency: "ars", Date: day, Type: TransactionTypeIncome},
+		{Name: "Loan " + token, Category: "Food", Amount: money("-20"), Currency: "ars", Date: day, Type: "loan"},
+		{Name: "Withdrawal " + token, Amount: money("100"), Currency: "ars", Date: day, Type: TransactionTypeTransfer, AccountID: bank.ID},
+		{Name: "Withdrawal " + token, Amount: money("100"), Currency: "ars", Date: day, Type: TransactionTypeTransfer, AccountID: bank.ID, ToAccountID: bank.ID},
+		{Name: "Withdrawal " + token, Amount: money("100"), Currency: "ars", Date: day, Type: TransactionTypeTransfer, AccountID: bank.ID, ToAccountID: dollars.ID},
+	} {
+		if err := store.AddExpense(invalid); err == nil {
+			t.Fatalf("expected %+v to be refused", invalid)
+		}
+	}
+	movements := []Expense{
+		{Name: "Lunch " + token, Category: "Food", Amount: money("-50"), Currency: "ars", Date: day, AccountID: bank.ID},
+		{Name: "Salary " + token, Category: "Income", Amount: money("300"), Currency: "ars", Date: day, AccountID: bank.ID},
+		// the category of a transfer is dropped and its amount leaves the source account
+		{Name: "Withdrawal " + token, Category: "Food", Amount: money("200"), Currency: "ars", Date: day, Type: "Transfer", AccountID: bank.ID, ToAccountID: cash.ID},
+	}
+	for _, e := range movements {
+		if err := store.AddExpense(e); err != nil {
+			t.Fatalf("add %s: %v", e.Name, err)
+		}
+	}
+	byName := map[string]Expense{}
+	expenses, err := store.QueryExpenses(ExpenseFilter{Name: token})
+	if err != nil {
+		t.Fatalf("query expenses: %v", err)
+	}
+	for _, e := range expenses {
+		byName[strings.TrimSuffix(e.Name, " "+token)] = e
+	}
+	if byName["Lunch"].Type != TransactionTypeExpense || byName["Salary"].Type != TransactionTypeIncome {
+		t.Fatalf("expected the types from the sign, got %+v", expenses)
+	}
+	withdrawal := byName["Withdrawal"]
+	if withdrawal.Type != TransactionTypeTransfer || withdrawal.Amount.String() != "-200.00" || withdrawal.Category != "" || withdrawal.ToAccountID != cash.ID {
+		t.Fatalf("unexpected transfer: %+v", withdrawal)
+	}
+
+	excluded := false
+	if spent, err := store.QueryExpenses(ExpenseFilter{Name: token, Transfers: &excluded}); err != nil || len(spent) != 2 {
+		t.Fatalf("expected the transfer left out, got %+v (%v)", spent, err)
+	}
+	if incomes, err := store.QueryExpenses(ExpenseFilter{Name: token, Types: []string{TransactionTypeIncome}}); err != nil || len(incomes) != 1 || incomes[0].Name != "Salary "+token {
+		t.Fatalf("expected only the salary, got %+v (%v)", incomes, err)
+	}
+	if inCash, err := store.QueryExpenses(ExpenseFilter{Account: cash.ID}); err != nil || len(inCash) != 1 || inCash[0].ID != withdrawal.ID {
+		t.Fatalf("expected the transfer on its destination, got %+v (%v)", inCash, err)
+	}
+	balances, err := store.GetAccountBalances()
+	if err != nil {
+		t.Fatalf("get account balances: %v", err)
+	}
+	for _, b := range balances {
+		switch b.ID {
+		case bank.ID:
+			if b.Balance.String() != "1050.00" || b.Count != 3 {
+				t.Fatalf("unexpected bank balance: %+v", b)
+			}
+		case cash.ID:
+			if b.Balance.String() != "200.00" || b.Count != 1 {
+				t.Fatalf("unexpected cash balance: %+v", b)
+			}
+		}
+	}
+
+	// the destination is in use, and an edit may turn the transfer back into an expense
+	if err := store.DeleteAccount(cash.ID); err == nil {
+		t.Fatalf("expected the destination of a transfer to stay")
+	}
+	withdrawal.Type, withdrawal.Category, withdrawal.ToAccountID = TransactionTypeExpense, "Food", ""
+	if err := store.UpdateExpense(withdrawal.ID, withdrawal); err != nil {
+		t.Fatalf("update transfer: %v", err)
+	}
+	if got, err := store.GetExpense(withdrawal.ID); err != nil || got.Type != TransactionTypeExpense || got.ToAccountID != "" || got.Category != "Food" {
+		t.Fatalf("unexpected expense after edit: %+v (%v)", got, err)
+	}
+	if err := store.DeleteAccount(cash.ID); err != nil {
+		t.Fatalf("delete unused account: %v", err)
+	}
+}
+
+func testCardStatements(t *testing.T, store Storage) {
+	token := uuid.New().String()[:8]
+	bank := Account{ID: uuid.New().String(), Name: "Banco " + token, Type: AccountTypeBank, Currency: "ars", ClosingDay: 25, DueDay: 5}
+	visa := Account{ID: uuid.New().String(), Name: "Visa " + token, Type: AccountTypeCreditCard, Currency: "ars", ClosingDay: 31, DueDay: 10}
+	for _, invalid := range []Account{
+		{Name: "Master " + token, Type: AccountTypeCreditCard, Currency: "ars", ClosingDay: 32, DueDay: 10},
+		{Name: "Master " + token, Type: AccountTypeCreditCard, Currency: "ars", ClosingDay: 25},
+	} {
+		if err := store.AddAccount(invalid); err == nil {
+			t.Fatalf("expected %+v to be refused", invalid)
+		}
+	}
+	for _, a := range []Account{bank, visa} {
+		if err := store.AddAccount(a); err != nil {
+			t.Fatalf("add account: %v", err)
+		}
+	}
+	// only credit cards keep a cycle
+	if got, err := store.GetAccount(bank.ID); err != nil || got.ClosingDay != 0 || got.DueDay != 0 {
+		t.Fatalf("expected the bank without a cycle, got %+v (%v)", got, err)
+	}
+	stored, err := store.GetAccount(visa.ID)
+	if err != nil || stored.ClosingDay != 31 || stored.DueDay != 10 || !stored.HasCycle() {
+		t.Fatalf("expected the card cycle stored, got %+v (%v)", stored, err)
+	}
+
+	date := func(s string) time.Time {
+		d, err := time.Parse("2006-01-02", s)
+		if err != nil {
+			t.Fatalf("parse %s: %v", s, err)
+		}
+		return d.Add(15 * time.Hour)
+	}
+	movements := []Expense{
+		{Name: "Groceries " + token, Category: "Food", Amount: money("-100"), Currency: "ars", Date: date("2024-01-31"), AccountID: visa.ID},
+		{Name: "Dinner " + token, Category: "Food", Amount: money("-50"), Currency: "ars", Date: date("2024-02-01"), AccountID: visa.ID},
+		{Name: "Refund " + token, Category: "Food", Amount: money("10"), Currency: "ars", Date: date("2024-02-29"), AccountID: visa.ID},
+		// paid after the january closing, so it pays that statement
+		{Name: "Payment " + token, Type: TransactionTypeTransfer, Amount: money("100"), Currency: "ars", Date: date("2024-02-08"), AccountID: bank.ID, ToAccountID: visa.ID},
+	}
+	for _, e := range movements {
+		if err := store.AddExpense(e); err != nil {
+			t.Fatalf("add %s: %v", e.Name, err)
+		}
+	}
+	expenses, err := store.QueryExpenses(ExpenseFilter{Account: visa.ID})
+	if err != nil {
+		t.Fatalf("query expenses: %v", err)
+	}
+	statements, err := CardStatements(stored, expenses)
+	if err != nil {
+		t.Fatalf("statements: %v", err)
+	}
+	if len(statements) != 2 {
+		t.Fatalf("expected two statements, got %+v", statements)
+	}
+	february, january := statements[0], statements[1]
+	day := func(d time.Time) string { return d.Format("2006-01-02") }
+	if day(january.Start) != "2024-01-01" || day(january.Closing) != "2024-01-31" || day(january.Due) != "2024-02-10" {
+		t.Fatalf("unexpected january cycle: %+v", january)
+	}
+	if len(january.Purchases) != 1 || january.Total.String() != "100.00" || january.Paid.String() != "100.00" {
+		t.Fatalf("unexpected january statement: %+v", january)
+	}
+	// a 31st closing falls on the last day of shorter months
+	if day(february.Start) != "2024-02-01" || day(february.Closing) != "2024-02-29" || day(february.Due) != "2024-03-10" {
+		t.Fatalf("unexpected february cycle: %+v", february)
+	}
+	if len(february.Purchases) != 2 || february.Purchases[0].Name != "Refund "+token || february.Total.String() != "40.00" || february.Paid.String() != "0.00" {
+		t.Fatalf("unexpected february statement: %+v", february)
+	}
+	if _, err := CardStatements(bank, nil); err == nil {
+		t.Fatalf("expected statements refused without a cycle")
+	}
+}
+
+func testInstallmentPurchases(t *testing.T, store Storage) {
+	token := uuid.New().String()[:8]
+	bank := Account{ID: uuid.New().String(), Name: "Banco " + token, Type: AccountTypeBank, Currency: "ars"}
+	visa := Account{ID: uuid.New().String(), Name: "Visa " + token, Type: AccountTypeCreditCard, Currency: "ars", ClosingDay: 25, DueDay: 5}
+	for _, a := range []Account{bank, visa} {
+		if err := store.AddAccount(a); err != nil {
+			t.Fatalf("add account: %v", err)
+		}
+	}
+	bought := time.Date(2024, 1, 26, 15, 0, 0, 0, time.UTC)
+	tv := InstallmentPurchase{Name: "TV " + token, Category: "Shopping", AccountID: visa.ID, Total: money("100"), Installments: 3, Date: bought}
+	for _, invalid := range []InstallmentPurchase{
+		{Name: "TV " + token, Category: "Shopping", AccountID: bank.ID, Total: money("100"), Installments: 3, Date: bought},
+		{Name: "TV " + token, Category: "Shopping", AccountID: visa.ID, Total: money("100"), Installments: 0, Date: bought},
+		{Name: "TV " + token, Category: "Shopping", AccountID: visa.ID, Total: money("100"), Interest: money("-1"), Installments: 3, Date: bought},
+		{Name: "TV " + token, Category: "Missing", AccountID: visa.ID, Total: money("100"), Installments: 3, Date: bought},
+		// bought after the january closing, so january is too early
+		{Name: "TV " + token, Category: "Shopping", AccountID: visa.ID, Total: money("100"), Installments: 3, Date: bought, FirstMonth: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+	} {
+		if err := store.AddInstallmentPurchase(invalid); err == nil {
+			t.Fatalf("expected %+v to be refused", invalid)
+		}
+	}
+	if err := store.AddInstallmentPurchase(tv); err != nil {
+		t.Fatalf("add purchase: %v", err)
+	}
+	purchases, err := store.GetInstallmentPurchases()
+	if err != nil || len(purchases) != 1 {
+		t.Fatalf("expected one purchase, got %+v (%v)", purchases, err)
+	}
+	stored := purchases[0]
+	if stored.Currency != "ars" || stored.FirstMonth.Format("2006-01") != "2024-02" || stored.PaidOffAt != nil {
+		t.Fatalf("unexpected purchase: %+v", stored)
+	}
+
+	// one installment per statement, on its closing day, the leftover cent first
+	installments, err := store.QueryExpenses(ExpenseFilter{Installment: stored.ID})
+	if err != nil || len(installments) != 3 {
+		t.Fatalf("expected three installments, got %+v (%v)", installments, err)
+	}
+	var got []string
+	for _, e := range installments {
+		got = append(got, e.Date.Format("2006-01-02")+" "+e.Amount.String()+" "+e.Name)
+	}
+	want := []string{
+		"2024-04-25 -33.33 TV " + token + " (3/3)",
+		"2024-03-25 -33.33 TV " + token + " (2/3)",
+		"2024-02-25 -33.34 TV " + token + " (1/3)",
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("got installments %v, want %v", got, want)
+	}
+	if first := installments[2]; first.AccountID != visa.ID || first.Card != visa.Name || first.Category != "Shopping" || first.Type != TransactionTypeExpense {
+		t.Fatalf("unexpected installment: %+v", first)
+	}
+
+	// installments only change through their purchase
+	changed := installments[0]
+	changed.Name = "Changed"
+	if err := store.UpdateExpense(changed.ID, changed); err == nil {
+		t.Fatalf("expected the installment update refused")
+	}
+	if err := store.RemoveExpense(changed.ID, 0); err == nil {
+		t.Fatalf("expected the installment kept out of the trash")
+	}
+
+	// renames reach the purchase, so its payoff charge files under the new name
+	renamed := "Compras " + token
+	if err := store.RenameCategory("Shopping", renamed, 0); err != nil {
+		t.Fatalf("rename category: %v", err)
+	}
+	t.Cleanup(func() { _ = store.RenameCategory(renamed, "Shopping", 0) })
+	if p, err := store.GetInstallmentPurchase(stored.ID); err != nil || p.Category != renamed {
+		t.Fatalf("expected the purchase moved to %s, got %+v (%v)", renamed, p, err)
+	}
+	if err := store.DeleteCategory(renamed, "", 0); err == nil {
+		t.Fatalf("expected a category used by a purchase kept")
+	}
+
+	// paid off late at night west of UTC, already march 2nd in UTC
+	paidOff := time.Date(2024, 3, 1, 22, 0, 0, 0, time.FixedZone("-03", -3*60*60))
+	if err := store.PayOffInstallmentPurchase(stored.ID, paidOff); err != nil {
+		t.Fatalf("pay off: %v", err)
+	}
+	if err := store.PayOffInstallmentPurchase(stored.ID, paidOff); err == nil {
+		t.Fatalf("expected a second payoff refused")
+	}
+	if p, err := store.GetInstallmentPurchase(stored.ID); err != nil || p.PaidOffAt == nil || !p.PaidOffAt.Equal(paidOff) {
+		t.Fatalf("expected the payoff date stored, got %+v (%v)", p, err)
+	}
+	installments, err = store.QueryExpenses(ExpenseFilter{Installment: stored.ID})
+	if err != nil || len(installments) != 2 {
+		t.Fatalf("expected the first installment and the payoff, got %+v (%v)", installments, err)
+	}
+	if payoff := installments[0]; payoff.Amount.String() != "-66.66" || !payoff.Date.Equal(paidOff) || payoff.AccountID != visa.ID || payoff.Category != renamed {
+		t.Fatalf("unexpected payoff: %+v", payoff)
+	}
+	day := time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC)
+	if charged, err := store.QueryExpenses(ExpenseFilter{Installment: stored.ID, From: day, To: day.Add(24*time.Hour - time.Second)}); err != nil || len(charged) != 1 {
+		t.Fatalf("expected the payoff on march 2nd UTC, got %+v (%v)", charged, err)
+	}
+	entries, err := store.GetAuditLog(AuditFilter{Entity: AuditInstallment, EntityID: stored.ID})
+	if err != nil || len(entries) != 3 || entries[0].Detail != "paid off" || entries[1].Detail != "category Shopping renamed to "+renamed {
+		t.Fatalf("expected the purchase, its category and its payoff audited, got %+v (%v)", entries, err)
+	}
+
+	if err := store.RemoveInstallmentPurchase(stored.ID); err != nil {
+		t.Fatalf("remove purchase: %v", err)
+	}
+	if left, err := store.QueryExpenses(ExpenseFilter{Installment: stored.ID}); err != nil || len(left) != 0 {
+		t.Fatalf("expected the installments gone, got %+v (%v)", left, err)
+	}
+	if _, err := store.GetInstallmentPurchase(stored.ID); err == nil {
+		t.Fatalf("expected the purchase gone")
+	}
+}
@@ -0,0 +1,156 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+)
+
+// CPIIndex is the consumer price index of a currency for one month
+type CPIIndex struct {
+	Currency string    `json:"currency"`
+	Month    time.Time `json:"month"` // midnight UTC of the first day of the month
+	Value    Money     `json:"value"` // exact decimal, any base
+}
+
+// Validate lowercases the currency and truncates the date to its month
+func (c *CPIIndex) Validate() error {
+	currency, err := ValidateCurrencyCode(c.Currency)
+	if err != nil {
+		return err
+	}
+	c.Currency = currency
+	if c.Value.Sign() <= 0 {
+		return fmt.Errorf("cpi index must be positive")
+	}
+	if c.Month.IsZero() {
+		return fmt.Errorf("cpi index 'month' cannot be empty")
+	}
+	c.Month = CPIMonth(c.Month)
+	return nil
+}
+
+// CPIMonth keeps the calendar month of t as midnight UTC of its first day
+func CPIMonth(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+func compareCPIIndexes(a, b CPIIndex) int {
+	if c := strings.Compare(a.Currency, b.Currency); c != 0 {
+		return c
+	}
+	return a.Month.Compare(b.Month)
+}
+
+// CPITable re-expresses amounts in the prices of a reference month
+type CPITable struct {
+	series map[string]map[time.Time]Money
+}
+
+func NewCPITable(indexes []CPIIndex) *CPITable {
+	t := &CPITable{series: map[string]map[time.Time]Money{}}
+	for _, index := range indexes {
+		if t.series[index.Currency] == nil {
+			t.series[index.Currency] = map[time.Time]Money{}
+		}
+		t.series[index.Currency][CPIMonth(index.Month)] = index.Value
+	}
+	return t
+}
+
+// Index returns the index of currency for the month of date
+func (t *CPITable) Index(currency string, date time.Time) (Money, bool) {
+	value, ok := t.series[currency][CPIMonth(date.UTC())]
+	return value, ok
+}
+
+// Latest returns the most recent month indexed for currency
+func (t *CPITable) Latest(currency string) (time.Time, bool) {
+	var latest time.Time
+	for month := range t.series[currency] {
+		if month.After(latest) {
+			latest = month
+		}
+	}
+	return latest, !latest.IsZero()
+}
+
+// Adjust re-expresses an amount of currency spent on date in the prices of
+// the reference month, rounded to the decimals of the currency; false when
+// either month has no index
+func (t *CPITable) Adjust(amount Money, currency string, date, reference time.Time) (Money, bool) {
+	then, ok := t.Index(currency, date)
+	if !ok {
+		return Money{}, false
+	}
+	now, ok := t.Index(currency, reference)
+	if !ok {
+		return Money{}, false
+	}
+	factor := new(big.Rat).Quo(now.rat(), then.rat())
+	adjusted, err := moneyFromRat(new(big.Rat).Mul(amount.rat(), factor), CurrencyDecimals(currency))
+	if err != nil {
+		return Money{}, false
+	}
+	return adjusted, true
+}
+
+// listCPIIndexes returns every stored index ordered by currency and month
+func (d sqlDialect) listCPIIndexes(db *sql.DB) ([]CPIIndex, error) {
+	rows, err := db.Query(`SELECT currency, month, value FROM cpi_indexes ORDER BY currency, month`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query cpi indexes: %v", err)
+	}
+	defer rows.Close()
+	var indexes []CPIIndex
+	for rows.Next() {
+		var index CPIIndex
+		var value string
+		if err := rows.Scan(&index.Currency, &index.Month, &value); err != nil {
+			return nil, fmt.Errorf("failed to scan cpi index: %v", err)
+		}
+		if index.Value, err = ParseMoney(value); err != nil {
+			return nil, fmt.Errorf("failed to parse cpi index of %s: %v", index.Currency, err)
+		}
+		index.Month = index.Month.UTC()
+		indexes = append(indexes, index)
+	}
+	return indexes, rows.Err()
+}
+
+// saveCPIIndexes upserts the indexes in one transaction, replacing the value
+// already stored for a currency and month
+func (d sqlDialect) saveCPIIndexes(db *sql.DB, indexes []CPIIndex) error {
+	indexes = slices.Clone(indexes)
+	for i := range indexes {
+		if err := indexes[i].Validate(); err != nil {
+			return err
+		}
+	}
+	upsert := fmt.Sprintf(`INSERT INTO cpi_indexes (currency, month, value) VALUES (%s, %s, %s)
+		ON CONFLICT (currency, month) DO UPDATE SET value = EXCLUDED.value`,
+		d.placeholder(1), d.placeholder(2), d.placeholder(3))
+	return withTx(db, func(tx *sql.Tx) error {
+		for _, index := range indexes {
+			if _, err := tx.Exec(upsert, index.Currency, index.Month, index.Value.String()); err != nil {
+				return fmt.Errorf("failed to save cpi index of %s: %v", index.Currency, err)
+			}
+		}
+		return nil
+	})
+}
+
+func (d sqlDialect) deleteCPIIndex(db *sql.DB, currency string, month time.Time) error {
+	query := fmt.Sprintf(`DELETE FROM cpi_indexes WHERE currency = %s AND month = %s`, d.placeholder(1), d.placeholder(2))
+	res, err := db.Exec(query, strings.ToLower(currency), CPIMonth(month))
+	if err != nil {
+		return fmt.Errorf("failed to delete cpi index: %v", err)
+	}
+	if rowsAffected, _ := res.RowsAffected(); rowsAffected == 0 {
+		return fmt.Errorf("cpi index of %s for %s not found", currency, month.Format("2006-01"))
+	}
+	return nil
+}
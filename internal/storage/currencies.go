@@ -0,0 +1,372 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// CurrencyInfo is an entry of the ISO 4217 catalog
+type CurrencyInfo struct {
+	Code     string `json:"code"` // alphabetic code in lowercase, as stored on expenses
+	Symbol   string `json:"symbol"`
+	Name     string `json:"name"`
+	Decimals int    `json:"decimals"` // minor units
+}
+
+// DefaultCurrencies are the currencies enabled on a new install
+var DefaultCurrencies = []string{"ars", "usd", "eur"}
+
+// currencyCatalog lists the active ISO 4217 currencies and funds with a minor
+// unit; precious metals and testing codes are left out
+var currencyCatalog = []CurrencyInfo{
+	{"aed", "د.إ", "UAE Dirham", 2},
+	{"afn", "؋", "Afghani", 2},
+	{"all", "L", "Lek", 2},
+	{"amd", "֏", "Armenian Dram", 2},
+	{"ang", "ƒ", "Netherlands Antillean Guilder", 2},
+	{"aoa", "Kz", "Kwanza", 2},
+	{"ars", "$", "Argentine Peso", 2},
+	{"aud", "A$", "Australian Dollar", 2},
+	{"awg", "ƒ", "Aruban Florin", 2},
+	{"azn", "₼", "Azerbaijan Manat", 2},
+	{"bam", "KM", "Convertible Mark", 2},
+	{"bbd", "Bds$", "Barbados Dollar", 2},
+	{"bdt", "৳", "Taka", 2},
+	{"bgn", "лв", "Bulgarian Lev", 2},
+	{"bhd", "BD", "Bahraini Dinar", 3},
+	{"bif", "FBu", "Burundi Franc", 0},
+	{"bmd", "$", "Bermudian Dollar", 2},
+	{"bnd", "B$", "Brunei Dollar", 2},
+	{"bob", "Bs", "Boliviano", 2},
+	{"bov", "BOV", "Mvdol", 2},
+	{"brl", "R$", "Brazilian Real", 2},
+	{"bsd", "B$", "Bahamian Dollar", 2},
+	{"btn", "Nu.", "Ngultrum", 2},
+	{"bwp", "P", "Pula", 2},
+	{"byn", "Br", "Belarusian Ruble", 2},
+	{"bzd", "BZ$", "Belize Dollar", 2},
+	{"cad", "CA$", "Canadian Dollar", 2},
+	{"cdf", "FC", "Congolese Franc", 2},
+	{"che", "CHE", "WIR Euro", 2},
+	{"chf", "CHF", "Swiss Franc", 2},
+	{"chw", "CHW", "WIR Franc", 2},
+	{"clf", "UF", "Unidad de Fomento", 4},
+	{"clp", "$", "Chilean Peso", 0},
+	{"cny", "¥", "Yuan Renminbi", 2},
+	{"cop", "$", "Colombian Peso", 2},
+	{"cou", "COU", "Unidad de Valor Real", 2},
+	{"crc", "₡", "Costa Rican Colon", 2},
+	{"cup", "$", "Cuban Peso", 2},
+	{"cve", "Esc", "Cabo Verde Escudo", 2},
+	{"czk", "Kč", "Czech Koruna", 2},
+	{"djf", "Fdj", "Djibouti Franc", 0},
+	{"dkk", "kr", "Danish Krone", 2},
+	{"dop", "RD$", "Dominican Peso", 2},
+	{"dzd", "DA", "Algerian Dinar", 2},
+	{"egp", "E£", "Egyptian Pound", 2},
+	{"ern", "Nfk", "Nakfa", 2},
+	{"etb", "Br", "Ethiopian Birr", 2},
+	{"eur", "€", "Euro", 2},
+	{"fjd", "FJ$", "Fiji Dollar", 2},
+	{"fkp", "£", "Falkland Islands Pound", 2},
+	{"gbp", "£", "Pound Sterling", 2},
+	{"gel", "₾", "Lari", 2},
+	{"ghs", "GH₵", "Ghana Cedi", 2},
+	{"gip", "£", "Gibraltar Pound", 2},
+	{"gmd", "D", "Dalasi", 2},
+	{"gnf", "FG", "Guinean Franc", 0},
+	{"gtq", "Q", "Quetzal", 2},
+	{"gyd", "G$", "Guyana Dollar", 2},
+	{"hkd", "HK$", "Hong Kong Dollar", 2},
+	{"hnl", "L", "Lempira", 2},
+	{"htg", "G", "Gourde", 2},
+	{"huf", "Ft", "Forint", 2},
+	{"idr", "Rp", "Rupiah", 2},
+	{"ils", "₪", "New Israeli Sheqel", 2},
+	{"inr", "₹", "Indian Rupee", 2},
+	{"iqd", "ع.د", "Iraqi Dinar", 3},
+	{"irr", "﷼", "Iranian Rial", 2},
+	{"isk", "kr", "Iceland Krona", 0},
+	{"jmd", "J$", "Jamaican Dollar", 2},
+	{"jod", "JD", "Jordanian Dinar", 3},
+	{"jpy", "¥", "Yen", 0},
+	{"kes", "KSh", "Kenyan Shilling", 2},
+	{"kgs", "с", "Som", 2},
+	{"khr", "៛", "Riel", 2},
+	{"kmf", "CF", "Comorian Franc", 0},
+	{"kpw", "₩", "North Korean Won", 2},
+	{"krw", "₩", "Won", 0},
+	{"kwd", "KD", "Kuwaiti Dinar", 3},
+	{"kyd", "CI$", "Cayman Islands Dollar", 2},
+	{"kzt", "₸", "Tenge", 2},
+	{"lak", "₭", "Lao Kip", 2},
+	{"lbp", "L£", "Lebanese Pound", 2},
+	{"lkr", "Rs", "Sri Lanka Rupee", 2},
+	{"lrd", "L$", "Liberian Dollar", 2},
+	{"lsl", "L", "Loti", 2},
+	{"lyd", "LD", "Libyan Dinar", 3},
+	{"mad", "DH", "Moroccan Dirham", 2},
+	{"mdl", "L", "Moldovan Leu", 2},
+	{"mga", "Ar", "Malagasy Ariary", 2},
+	{"mkd", "ден", "Denar", 2},
+	{"mmk", "K", "Kyat", 2},
+	{"mnt", "₮", "Tugrik", 2},
+	{"mop", "MOP$", "Pataca", 2},
+	{"mru", "UM", "Ouguiya", 2},
+	{"mur", "Rs", "Mauritius Rupee", 2},
+	{"mvr", "Rf", "Rufiyaa", 2},
+	{"mwk", "MK", "Malawi Kwacha", 2},
+	{"mxn", "$", "Mexican Peso", 2},
+	{"mxv", "MXV", "Mexican Unidad de Inversion (UDI)", 2},
+	{"myr", "RM", "Malaysian Ringgit", 2},
+	{"mzn", "MT", "Mozambique Metical", 2},
+	{"nad", "N$", "Namibia Dollar", 2},
+	{"ngn", "₦", "Naira", 2},
+	{"nio", "C$", "Cordoba Oro", 2},
+	{"nok", "kr", "Norwegian Krone", 2},
+	{"npr", "Rs", "Nepalese Rupee", 2},
+	{"nzd", "NZ$", "New Zealand Dollar", 2},
+	{"omr", "OMR", "Rial Omani", 3},
+	{"pab", "B/.", "Balboa", 2},
+	{"pen", "S/", "Sol", 2},
+	{"pgk", "K", "Kina", 2},
+	{"php", "₱", "Philippine Peso", 2},
+	{"pkr", "Rs", "Pakistan Rupee", 2},
+	{"pln", "zł", "Zloty", 2},
+	{"pyg", "₲", "Guarani", 0},
+	{"qar", "QR", "Qatari Rial", 2},
+	{"ron", "lei", "Romanian Leu", 2},
+	{"rsd", "din", "Serbian Dinar", 2},
+	{"rub", "₽", "Russian Ruble", 2},
+	{"rwf", "FRw", "Rwanda Franc", 0},
+	{"sar", "SR", "Saudi Riyal", 2},
+	{"sbd", "SI$", "Solomon Islands Dollar", 2},
+	{"scr", "SR", "Seychelles Rupee", 2},
+	{"sdg", "SDG", "Sudanese Pound", 2},
+	{"sek", "kr", "Swedish Krona", 2},
+	{"sgd", "S$", "Singapore Dollar", 2},
+	{"shp", "£", "Saint Helena Pound", 2},
+	{"sle", "Le", "Leone", 2},
+	{"sos", "Sh", "Somali Shilling", 2},
+	{"srd", "$", "Surinam Dollar", 2},
+	{"ssp", "£", "South Sudanese Pound", 2},
+	{"stn", "Db", "Dobra", 2},
+	{"svc", "₡", "El Salvador Colon", 2},
+	{"syp", "£S", "Syrian Pound", 2},
+	{"szl", "E", "Lilangeni", 2},
+	{"thb", "฿", "Baht", 2},
+	{"tjs", "SM", "Somoni", 2},
+	{"tmt", "m", "Turkmenistan New Manat", 2},
+	{"tnd", "DT", "Tunisian Dinar", 3},
+	{"top", "T$", "Pa'anga", 2},
+	{"try", "₺", "Turkish Lira", 2},
+	{"ttd", "TT$", "Trinidad and Tobago Dollar", 2},
+	{"twd", "NT$", "New Taiwan Dollar", 2},
+	{"tzs", "TSh", "Tanzanian Shilling", 2},
+	{"uah", "₴", "Hryvnia", 2},
+	{"ugx", "USh", "Uganda Shilling", 0},
+	{"usd", "$", "US Dollar", 2},
+	{"usn", "USN", "US Dollar (Next day)", 2},
+	{"uyi", "UYI", "Uruguay Peso en Unidades Indexadas (UI)", 0},
+	{"uyu", "$U", "Peso Uruguayo", 2},
+	{"uyw", "UYW", "Unidad Previsional", 4},
+	{"uzs", "soʻm", "Uzbekistan Sum", 2},
+	{"ved", "Bs.D", "Bolivar Soberano (digital)", 2},
+	{"ves", "Bs.S", "Bolivar Soberano", 2},
+	{"vnd", "₫", "Dong", 0},
+	{"vuv", "VT", "Vatu", 0},
+	{"wst", "WS$", "Tala", 2},
+	{"xaf", "FCFA", "CFA Franc BEAC", 0},
+	{"xcd", "EC$", "East Caribbean Dollar", 2},
+	{"xcg", "Cg", "Caribbean Guilder", 2},
+	{"xof", "CFA", "CFA Franc BCEAO", 0},
+	{"xpf", "₣", "CFP Franc", 0},
+	{"yer", "﷼", "Yemeni Rial", 2},
+	{"zar", "R", "Rand", 2},
+	{"zmw", "ZK", "Zambian Kwacha", 2},
+	{"zwg", "ZiG", "Zimbabwe Gold", 2},
+}
+
+var currencyIndex = func() map[string]CurrencyInfo {
+	index := make(map[string]CurrencyInfo, len(currencyCatalog))
+	for _, currency := range currencyCatalog {
+		index[currency.Code] = currency
+	}
+	return index
+}()
+
+// CurrencyCatalog returns every known currency ordered by code
+func CurrencyCatalog() []CurrencyInfo {
+	return slices.Clone(currencyCatalog)
+}
+
+// LookupCurrency finds a currency by code, in any case
+func LookupCurrency(code string) (CurrencyInfo, bool) {
+	currency, ok := currencyIndex[strings.ToLower(strings.TrimSpace(code))]
+	return currency, ok
+}
+
+// ValidateCurrencyCode lowercases a code and checks it against the catalog
+func ValidateCurrencyCode(code string) (string, error) {
+	currency, ok := LookupCurrency(code)
+	if !ok {
+		return "", fmt.Errorf("invalid currency: '%s'", code)
+	}
+	return currency.Code, nil
+}
+
+// NormalizeCurrencyList checks a list of currencies about to be enabled and
+// returns it lowercased, in the given order
+func NormalizeCurrencyList(codes []string) ([]string, error) {
+	if len(codes) == 0 {
+		return nil, fmt.Errorf("at least one currency must be enabled")
+	}
+	normalized := make([]string, 0, len(codes))
+	for _, code := range codes {
+		valid, err := ValidateCurrencyCode(code)
+		if err != nil {
+			return nil, err
+		}
+		if slices.Contains(normalized, valid) {
+			return nil, fmt.Errorf("currency %s is listed twice", valid)
+		}
+		normalized = append(normalized, valid)
+	}
+	return normalized, nil
+}
+
+// listEnabledCurrencies reads the enabled currencies in display order
+func (d sqlDialect) listEnabledCurrencies(q interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}) ([]string, error) {
+	rows, err := q.Query(`SELECT code FROM enabled_currencies ORDER BY position ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query enabled currencies: %v", err)
+	}
+	defer rows.Close()
+	var codes []string
+	for rows.Next() {
+		var code string
+		if err := rows.Scan(&code); err != nil {
+			return nil, fmt.Errorf("failed to scan enabled currency: %v", err)
+		}
+		codes = append(codes, code)
+	}
+	return codes, rows.Err()
+}
+
+// saveEnabledCurrencies replaces the enabled set; the base currency and every
+// currency used by an expense, trashed ones included, or a recurring rule
+// must stay enabled
+func (d sqlDialect) saveEnabledCurrencies(db *sql.DB, codes []string) error {
+	codes, err := NormalizeCurrencyList(codes)
+	if err != nil {
+		return err
+	}
+	return withTx(db, func(tx *sql.Tx) error {
+		before, err := d.listEnabledCurrencies(tx)
+		if err != nil {
+			return err
+		}
+		var base string
+		err = tx.QueryRow(`SELECT currency FROM config WHERE id = 'default'`).Scan(&base)
+		if err != nil && err != sql.ErrNoRows {
+			return fmt.Errorf("failed to get config from db: %v", err)
+		}
+		if base != "" && !slices.Contains(codes, base) {
+			return fmt.Errorf("currency %s is the base currency and cannot be disabled", base)
+		}
+		rows, err := tx.Query(`SELECT currency FROM expenses UNION SELECT currency FROM recurring_expenses UNION SELECT currency FROM accounts`)
+		if err != nil {
+			return fmt.Errorf("failed to check currencies in use: %v", err)
+		}
+		var used []string
+		for rows.Next() {
+			var code string
+			if err := rows.Scan(&code); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan currency in use: %v", err)
+			}
+			used = append(used, code)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to check currencies in use: %v", err)
+		}
+		for _, code := range used {
+			if !slices.Contains(codes, code) {
+				return fmt.Errorf("currency %s is still in use and cannot be disabled", code)
+			}
+		}
+		if _, err := tx.Exec(`DELETE FROM enabled_currencies`); err != nil {
+			return fmt.Errorf("failed to clear enabled currencies: %v", err)
+		}
+		insert := fmt.Sprintf(`INSERT INTO enabled_currencies (code, position) VALUES (%s, %s)`, d.placeholder(1), d.placeholder(2))
+		for i, code := range codes {
+			if _, err := tx.Exec(insert, code, i+1); err != nil {
+				return fmt.Errorf("failed to enable currency %s: %v", code, err)
+			}
+		}
+		return d.recordAudit(tx, auditChange{entity: AuditConfig, id: "currencies", action: AuditUpdate, before: before, after: codes})
+	})
+}
+
+// requireCurrency fails unless code is enabled; expense and rule writes call
+// it inside their transaction
+func (d sqlDialect) requireCurrency(tx *sql.Tx, code string) error {
+	var enabled int
+	err := tx.QueryRow(fmt.Sprintf(`SELECT COUNT(1) FROM enabled_currencies WHERE code = %s`, d.placeholder(1)), code).Scan(&enabled)
+	if err != nil {
+		return fmt.Errorf("failed to check currency %s: %v", code, err)
+	}
+	if enabled == 0 {
+		return invalid(fmt.Errorf("currency %s is not enabled", code))
+	}
+	return nil
+}
+
+// baseCurrency reads the configured currency inside tx so writes agree with
+// the committed config; before GetConfig seeds the row it is the default
+func (d sqlDialect) baseCurrency(tx *sql.Tx) (string, error) {
+	var currency string
+	err := tx.QueryRow(`SELECT currency FROM config WHERE id = 'default'`).Scan(&currency)
+	if err == sql.ErrNoRows {
+		var base Config
+		base.SetBaseConfig()
+		return base.Currency, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get config from db: %v", err)
+	}
+	return currency, nil
+}
+
+// normalizeExpense defaults the currency to the base one and validates the
+// amount, locked rate and type ahead of an expense write
+func (d sqlDialect) normalizeExpense(tx *sql.Tx, e *Expense) error {
+	base, err := d.baseCurrency(tx)
+	if err != nil {
+		return err
+	}
+	if e.Currency == "" {
+		e.Currency = base
+	}
+	if err := e.normalizeAmount(); err != nil {
+		return invalid(err)
+	}
+	if err := e.validateLockedRate(base); err != nil {
+		return invalid(err)
+	}
+	return invalid(e.normalizeType())
+}
+
+// currencyEnabled reports whether code is in the enabled set
+func (d sqlDialect) currencyEnabled(db *sql.DB, code string) (bool, error) {
+	codes, err := d.listEnabledCurrencies(db)
+	if err != nil {
+		return false, err
+	}
+	return slices.Contains(codes, code), nil
+}
@@ -0,0 +1,556 @@
+package storage
+
+import "database/sql"
+
+// postgresMigrations is the ordered schema history of the postgres backend.
+// Never edit an applied migration; append a new one instead.
+var postgresMigrations = []Migration{
+	{
+		// adopts databases created before versioned migrations, hence IF NOT EXISTS
+		Version: 1,
+		Name:    "initial_schema",
+		Up: func(tx *sql.Tx) error {
+			return execStatements(tx,
+				createExpensesTableSQL,
+				createRecurringExpensesTableSQL,
+				createConfigTableSQL,
+				createCategoriesTableSQL,
+				"ALTER TABLE expenses ADD COLUMN IF NOT EXISTS source VARCHAR(50)",
+				"ALTER TABLE expenses ADD COLUMN IF NOT EXISTS card VARCHAR(100)",
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execStatements(tx,
+				"DROP TABLE IF EXISTS categories",
+				"DROP TABLE IF EXISTS config",
+				"DROP TABLE IF EXISTS recurring_expenses",
+				"DROP TABLE IF EXISTS expenses",
+			)
+		},
+	},
+	{
+		Version: 2,
+		Name:    "retire_config_categories",
+		Up: func(tx *sql.Tx) error {
+			if err := moveConfigCategories(tx, postgresPlaceholder); err != nil {
+				return err
+			}
+			return execStatements(tx, "ALTER TABLE config DROP COLUMN IF EXISTS categories")
+		},
+		Down: func(tx *sql.Tx) error {
+			if err := execStatements(tx, "ALTER TABLE config ADD COLUMN IF NOT EXISTS categories TEXT NOT NULL DEFAULT '[]'"); err != nil {
+				return err
+			}
+			return restoreConfigCategories(tx, postgresPlaceholder)
+		},
+	}, {
+		Version: 3,
+		Name:    "expense_query_indexes",
+		Up: func(tx *sql.Tx) error {
+			return execStatements(tx, expenseQueryIndexes...)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execStatements(tx, dropExpenseQueryIndexes...)
+		},
+	},
+	{
+		// tags move from JSON columns to a catalog linked to expenses and rules
+		Version: 4,
+		Name:    "normalize_tags",
+		Up: func(tx *sql.Tx) error {
+			err := execStatements(tx,
+				`CREATE TABLE IF NOT EXISTS tags (
+					id SERIAL PRIMARY KEY,
+					name TEXT NOT NULL UNIQUE,
+					created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+				)`,
+				`CREATE TABLE IF NOT EXISTS expense_tags (
+					expense_id VARCHAR(36) NOT NULL REFERENCES expenses(id) ON DELETE CASCADE,
+					tag_id INTEGER NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+					position INTEGER NOT NULL,
+					PRIMARY KEY (expense_id, tag_id)
+				)`,
+				`CREATE TABLE IF NOT EXISTS recurring_expense_tags (
+					recurring_id VARCHAR(36) NOT NULL REFERENCES recurring_expenses(id) ON DELETE CASCADE,
+					tag_id INTEGER NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+					position INTEGER NOT NULL,
+					PRIMARY KEY (recurring_id, tag_id)
+				)`,
+				"CREATE INDEX IF NOT EXISTS idx_expense_tags_tag ON expense_tags (tag_id)",
+				"CREATE INDEX IF NOT EXISTS idx_recurring_expense_tags_tag ON recurring_expense_tags (tag_id)",
+			)
+			if err != nil {
+				return err
+			}
+			if err := moveTagsToLinks(tx, postgresDialect); err != nil {
+				return err
+			}
+			return execStatements(tx,
+				"ALTER TABLE expenses DROP COLUMN IF EXISTS tags",
+				"ALTER TABLE recurring_expenses DROP COLUMN IF EXISTS tags",
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			err := execStatements(tx,
+				"ALTER TABLE expenses ADD COLUMN IF NOT EXISTS tags TEXT",
+				"ALTER TABLE recurring_expenses ADD COLUMN IF NOT EXISTS tags TEXT",
+			)
+			if err != nil {
+				return err
+			}
+			if err := restoreTagColumns(tx, postgresDialect); err != nil {
+				return err
+			}
+			return execStatements(tx,
+				"DROP TABLE IF EXISTS recurring_expense_tags",
+				"DROP TABLE IF EXISTS expense_tags",
+				"DROP TABLE IF EXISTS tags",
+			)
+		},
+	},
+	{
+		// categories carry display metadata and an income/expense type
+		Version: 5,
+		Name:    "category_metadata",
+		Up: func(tx *sql.Tx) error {
+			err := execStatements(tx,
+				"ALTER TABLE categories ADD COLUMN IF NOT EXISTS color VARCHAR(7) NOT NULL DEFAULT ''",
+				"ALTER TABLE categories ADD COLUMN IF NOT EXISTS icon VARCHAR(64) NOT NULL DEFAULT ''",
+				"ALTER TABLE categories ADD COLUMN IF NOT EXISTS type VARCHAR(16) NOT NULL DEFAULT 'expense'",
+				"ALTER TABLE categories ADD COLUMN IF NOT EXISTS archived BOOLEAN NOT NULL DEFAULT FALSE",
+			)
+			if err != nil {
+				return err
+			}
+			return decorateDefaultCategories(tx, postgresDialect)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execStatements(tx,
+				"ALTER TABLE categories DROP COLUMN IF EXISTS archived",
+				"ALTER TABLE categories DROP COLUMN IF EXISTS type",
+				"ALTER TABLE categories DROP COLUMN IF EXISTS icon",
+				"ALTER TABLE categories DROP COLUMN IF EXISTS color",
+			)
+		},
+	},
+	{
+		// subcategories point at their parent; deleting a parent lifts its children to the top level
+		Version: 6,
+		Name:    "category_hierarchy",
+		Up: func(tx *sql.Tx) error {
+			return execStatements(tx,
+				"ALTER TABLE categories ADD COLUMN IF NOT EXISTS parent_id INTEGER REFERENCES categories(id) ON DELETE SET NULL",
+				"CREATE INDEX IF NOT EXISTS idx_categories_parent ON categories (parent_id)",
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execStatements(tx,
+				"DROP INDEX IF EXISTS idx_categories_parent",
+				"ALTER TABLE categories DROP COLUMN IF EXISTS parent_id",
+			)
+		},
+	}, {
+		// expenses may only reference stored categories from now on, so the
+		// names older rows used without a table entry are registered
+		Version: 7,
+		Name:    "register_used_categories",
+		Up: func(tx *sql.Tx) error {
+			return registerUsedCategories(tx, postgresDialect)
+		},
+		Down: func(tx *sql.Tx) error {
+			// registered categories are indistinguishable from user ones and stay
+			return nil
+		},
+	}, {
+		// removed expenses stay in the table until restored or purged
+		Version: 8,
+		Name:    "expense_trash",
+		Up: func(tx *sql.Tx) error {
+			return execStatements(tx,
+				"ALTER TABLE expenses ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ",
+				"CREATE INDEX IF NOT EXISTS idx_expenses_deleted_at ON expenses (deleted_at)",
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			// going back to hard deletes empties the trash
+			return execStatements(tx,
+				"DELETE FROM expenses WHERE deleted_at IS NOT NULL",
+				"DROP INDEX IF EXISTS idx_expenses_deleted_at",
+				"ALTER TABLE expenses DROP COLUMN IF EXISTS deleted_at",
+			)
+		},
+	}, {
+		// before/after snapshots are JSON text, like the legacy config columns
+		Version: 9,
+		Name:    "audit_log",
+		Up: func(tx *sql.Tx) error {
+			return execStatements(tx,
+				`CREATE TABLE IF NOT EXISTS audit_log (
+					id BIGSERIAL PRIMARY KEY,
+					at TIMESTAMPTZ NOT NULL,
+					entity TEXT NOT NULL,
+					entity_id TEXT NOT NULL DEFAULT '',
+					action TEXT NOT NULL,
+					detail TEXT NOT NULL DEFAULT '',
+					before_data TEXT,
+					after_data TEXT
+				)`,
+				"CREATE INDEX IF NOT EXISTS idx_audit_log_entity ON audit_log (entity, entity_id, id)",
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execStatements(tx, "DROP TABLE IF EXISTS audit_log")
+		},
+	}, {
+		// optimistic concurrency: rows carry a version and the category list
+		// a counter in the versions table
+		Version: 10,
+		Name:    "row_versions",
+		Up: func(tx *sql.Tx) error {
+			return execStatements(tx,
+				"ALTER TABLE expenses ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1",
+				"ALTER TABLE recurring_expenses ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1",
+				`CREATE TABLE IF NOT EXISTS versions (
+					name TEXT PRIMARY KEY,
+					version BIGINT NOT NULL
+				)`,
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execStatements(tx,
+				"DROP TABLE IF EXISTS versions",
+				"ALTER TABLE recurring_expenses DROP COLUMN IF EXISTS version",
+				"ALTER TABLE expenses DROP COLUMN IF EXISTS version",
+			)
+		},
+	}, {
+		// amounts become integer minor units, lifting the NUMERIC(10, 2) cap;
+		// ars, usd and eur, the only currencies accepted so far, all have two
+		// decimals
+		Version: 11,
+		Name:    "exact_amounts",
+		Up: func(tx *sql.Tx) error {
+			return execStatements(tx,
+				"ALTER TABLE expenses ALTER COLUMN amount TYPE BIGINT USING ROUND(amount * 100)::BIGINT",
+				"ALTER TABLE recurring_expenses ALTER COLUMN amount TYPE BIGINT USING ROUND(amount * 100)::BIGINT",
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execStatements(tx,
+				"ALTER TABLE expenses ALTER COLUMN amount TYPE NUMERIC(10, 2) USING amount / 100.0",
+				"ALTER TABLE recurring_expenses ALTER COLUMN amount TYPE NUMERIC(10, 2) USING amount / 100.0",
+			)
+		},
+	}, {
+		// dated exchange rates and an optional rate locked on each expense
+		Version: 12,
+		Name:    "exchange_rates",
+		Up: func(tx *sql.Tx) error {
+			return execStatements(tx,
+				`CREATE TABLE IF NOT EXISTS exchange_rates (
+					date TIMESTAMPTZ NOT NULL,
+					currency VARCHAR(3) NOT NULL,
+					quote VARCHAR(3) NOT NULL,
+					rate NUMERIC NOT NULL,
+					PRIMARY KEY (currency, quote, date)
+				)`,
+				"ALTER TABLE expenses ADD COLUMN IF NOT EXISTS rate NUMERIC",
+				"ALTER TABLE expenses ADD COLUMN IF NOT EXISTS rate_currency VARCHAR(3)",
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execStatements(tx,
+				"ALTER TABLE expenses DROP COLUMN IF EXISTS rate_currency",
+				"ALTER TABLE expenses DROP COLUMN IF EXISTS rate",
+				"DROP TABLE IF EXISTS exchange_rates",
+			)
+		},
+	}, {
+		// currencies of the ISO 4217 catalog enabled for expenses and rules,
+		// seeded with the ones supported before the catalog
+		Version: 13,
+		Name:    "enabled_currencies",
+		Up: func(tx *sql.Tx) error {
+			return execStatements(tx,
+				`CREATE TABLE IF NOT EXISTS enabled_currencies (
+					code VARCHAR(3) PRIMARY KEY,
+					position INTEGER NOT NULL
+				)`,
+				`INSERT INTO enabled_currencies (code, position) VALUES ('ars', 1), ('usd', 2), ('eur', 3)
+					ON CONFLICT (code) DO NOTHING`,
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execStatements(tx, "DROP TABLE IF EXISTS enabled_currencies")
+		},
+	}, {
+		// monthly consumer price indexes for real-terms reports
+		Version: 14,
+		Name:    "cpi_indexes",
+		Up: func(tx *sql.Tx) error {
+			return execStatements(tx,
+				`CREATE TABLE IF NOT EXISTS cpi_indexes (
+					currency VARCHAR(3) NOT NULL,
+					month TIMESTAMPTZ NOT NULL,
+					value NUMERIC NOT NULL,
+					PRIMARY KEY (currency, month)
+				)`,
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execStatements(tx, "DROP TABLE IF EXISTS cpi_indexes")
+		},
+	}, {
+		// currency exchanges and the expense legs they own
+		Version: 15,
+		Name:    "currency_exchanges",
+		Up: func(tx *sql.Tx) error {
+			return execStatements(tx,
+				`CREATE TABLE IF NOT EXISTS currency_exchanges (
+					id VARCHAR(36) PRIMARY KEY,
+					name VARCHAR(255) NOT NULL,
+					date TIMESTAMPTZ NOT NULL,
+					from_currency VARCHAR(3) NOT NULL,
+					from_amount BIGINT NOT NULL,
+					to_currency VARCHAR(3) NOT NULL,
+					to_amount BIGINT NOT NULL,
+					rate NUMERIC NOT NULL,
+					outgoing_id VARCHAR(36) NOT NULL,
+					incoming_id VARCHAR(36) NOT NULL
+				)`,
+				"ALTER TABLE expenses ADD COLUMN IF NOT EXISTS exchange_id VARCHAR(36)",
+				"CREATE INDEX IF NOT EXISTS idx_expenses_exchange_id ON expenses (exchange_id)",
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execStatements(tx,
+				"DELETE FROM expenses WHERE exchange_id IS NOT NULL",
+				"DROP INDEX IF EXISTS idx_expenses_exchange_id",
+				"ALTER TABLE expenses DROP COLUMN IF EXISTS exchange_id",
+				"DROP TABLE IF EXISTS currency_exchanges",
+			)
+		},
+	}, {
+		// accounts replace the free-text source and card of expenses
+		Version: 16,
+		Name:    "accounts",
+		Up: func(tx *sql.Tx) error {
+			err := execStatements(tx,
+				`CREATE TABLE IF NOT EXISTS accounts (
+					id VARCHAR(36) PRIMARY KEY,
+					name VARCHAR(255) NOT NULL,
+					type VARCHAR(20) NOT NULL,
+					currency VARCHAR(3) NOT NULL,
+					opening_balance BIGINT NOT NULL DEFAULT 0,
+					archived BOOLEAN NOT NULL DEFAULT FALSE
+				)`,
+				"ALTER TABLE expenses ADD COLUMN IF NOT EXISTS account_id VARCHAR(36)",
+				"CREATE INDEX IF NOT EXISTS idx_expenses_account_id ON expenses (account_id)",
+			)
+			if err != nil {
+				return err
+			}
+			return mapLegacyAccounts(tx, postgresDialect)
+		},
+		Down: func(tx *sql.Tx) error {
+			// source and card keep the values derived from the accounts
+			return execStatements(tx,
+				"DROP INDEX IF EXISTS idx_expenses_account_id",
+				"ALTER TABLE expenses DROP COLUMN IF EXISTS account_id",
+				"DROP TABLE IF EXISTS accounts",
+			)
+		},
+	}, {
+		// explicit transaction types, with transfers between two accounts
+		Version: 17,
+		Name:    "transaction_types",
+		Up: func(tx *sql.Tx) error {
+			return execStatements(tx,
+				"ALTER TABLE expenses ADD COLUMN IF NOT EXISTS type VARCHAR(20) NOT NULL DEFAULT 'expense'",
+				"ALTER TABLE expenses ADD COLUMN IF NOT EXISTS to_account_id VARCHAR(36)",
+				"UPDATE expenses SET type = 'income' WHERE amount > 0",
+				"UPDATE expenses SET type = 'transfer' WHERE COALESCE(exchange_id, '') <> ''",
+				"CREATE INDEX IF NOT EXISTS idx_expenses_to_account_id ON expenses (to_account_id)",
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			// transfers stay as plain movements out of their source account
+			return execStatements(tx,
+				"DROP INDEX IF EXISTS idx_expenses_to_account_id",
+				"ALTER TABLE expenses DROP COLUMN IF EXISTS to_account_id",
+				"ALTER TABLE expenses DROP COLUMN IF EXISTS type",
+			)
+		},
+	}, {
+		// statement closing and due days of credit cards
+		Version: 18,
+		Name:    "card_cycles",
+		Up: func(tx *sql.Tx) error {
+			return execStatements(tx,
+				"ALTER TABLE accounts ADD COLUMN IF NOT EXISTS closing_day INTEGER NOT NULL DEFAULT 0",
+				"ALTER TABLE accounts ADD COLUMN IF NOT EXISTS due_day INTEGER NOT NULL DEFAULT 0",
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execStatements(tx,
+				"ALTER TABLE accounts DROP COLUMN IF EXISTS due_day",
+				"ALTER TABLE accounts DROP COLUMN IF EXISTS closing_day",
+			)
+		},
+	}, {
+		// installment purchases on credit cards and the expenses they own
+		Version: 19,
+		Name:    "installment_purchases",
+		Up: func(tx *sql.Tx) error {
+			return execStatements(tx,
+				`CREATE TABLE IF NOT EXISTS installment_purchases (
+					id VARCHAR(36) PRIMARY KEY,
+					name VARCHAR(255) NOT NULL,
+					category VARCHAR(255) NOT NULL,
+					account_id VARCHAR(36) NOT NULL,
+					currency VARCHAR(3) NOT NULL,
+					total BIGINT NOT NULL,
+					interest BIGINT NOT NULL DEFAULT 0,
+					installments INTEGER NOT NULL,
+					date TIMESTAMPTZ NOT NULL,
+					first_month TIMESTAMPTZ NOT NULL,
+					paid_off_at TIMESTAMPTZ
+				)`,
+				"ALTER TABLE expenses ADD COLUMN IF NOT EXISTS installment_id VARCHAR(36)",
+				"CREATE INDEX IF NOT EXISTS idx_expenses_installment_id ON expenses (installment_id)",
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execStatements(tx,
+				"DELETE FROM expenses WHERE installment_id IS NOT NULL",
+				"DROP INDEX IF EXISTS idx_expenses_installment_id",
+				"ALTER TABLE expenses DROP COLUMN IF EXISTS installment_id",
+				"DROP TABLE IF EXISTS installment_purchases",
+			)
+		},
+	}, {
+		// how far ahead the occurrences of each recurring rule are stored; the
+		// rules so far had every occurrence written when added
+		Version: 20,
+		Name:    "recurring_horizon",
+		Up: func(tx *sql.Tx) error {
+			return execStatements(tx,
+				"ALTER TABLE recurring_expenses ADD COLUMN materialized_through TIMESTAMP",
+				`UPDATE recurring_expenses SET materialized_through = COALESCE(
+					(SELECT MAX(date) FROM expenses WHERE expenses.recurring_id = recurring_expenses.id), start_date)`,
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execStatements(tx, "ALTER TABLE recurring_expenses DROP COLUMN materialized_through")
+		},
+	}, {
+		// recurrence rules and business day adjustments of recurring rules,
+		// and the holidays those move occurrences off
+		Version: 21,
+		Name:    "recurrence_rules",
+		Up: func(tx *sql.Tx) error {
+			return execStatements(tx,
+				"ALTER TABLE recurring_expenses ADD COLUMN IF NOT EXISTS rrule TEXT NOT NULL DEFAULT ''",
+				"ALTER TABLE recurring_expenses ADD COLUMN IF NOT EXISTS business_day TEXT NOT NULL DEFAULT ''",
+				`CREATE TABLE IF NOT EXISTS holidays (
+					date TIMESTAMPTZ PRIMARY KEY,
+					name TEXT NOT NULL DEFAULT ''
+				)`,
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execStatements(tx,
+				"DROP TABLE IF EXISTS holidays",
+				"ALTER TABLE recurring_expenses DROP COLUMN IF EXISTS business_day",
+				"ALTER TABLE recurring_expenses DROP COLUMN IF EXISTS rrule",
+			)
+		},
+	}, {
+		// per occurrence overrides and amount schedules of recurring rules, and
+		// the scheduled date generated expenses are overridden by
+		Version: 22,
+		Name:    "recurring_overrides",
+		Up: func(tx *sql.Tx) error {
+			return execStatements(tx,
+				"ALTER TABLE recurring_expenses ADD COLUMN IF NOT EXISTS amount_changes TEXT NOT NULL DEFAULT '[]'",
+				"ALTER TABLE recurring_expenses ADD COLUMN IF NOT EXISTS overrides TEXT NOT NULL DEFAULT '[]'",
+				"ALTER TABLE expenses ADD COLUMN IF NOT EXISTS occurrence TIMESTAMPTZ",
+				"UPDATE expenses SET occurrence = date WHERE recurring_id IS NOT NULL AND recurring_id <> ''",
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execStatements(tx,
+				"ALTER TABLE expenses DROP COLUMN IF EXISTS occurrence",
+				"ALTER TABLE recurring_expenses DROP COLUMN IF EXISTS overrides",
+				"ALTER TABLE recurring_expenses DROP COLUMN IF EXISTS amount_changes",
+			)
+		},
+	}, {
+		// the account, source and card recurring rules copy to the expenses
+		// they generate; existing rules keep generating expenses without one
+		Version: 23,
+		Name:    "recurring_accounts",
+		Up: func(tx *sql.Tx) error {
+			return execStatements(tx,
+				"ALTER TABLE recurring_expenses ADD COLUMN IF NOT EXISTS source TEXT NOT NULL DEFAULT ''",
+				"ALTER TABLE recurring_expenses ADD COLUMN IF NOT EXISTS card TEXT NOT NULL DEFAULT ''",
+				"ALTER TABLE recurring_expenses ADD COLUMN IF NOT EXISTS account_id VARCHAR(36)",
+				"CREATE INDEX IF NOT EXISTS idx_recurring_expenses_account_id ON recurring_expenses (account_id)",
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execStatements(tx,
+				"DROP INDEX IF EXISTS idx_recurring_expenses_account_id",
+				"ALTER TABLE recurring_expenses DROP COLUMN IF EXISTS account_id",
+				"ALTER TABLE recurring_expenses DROP COLUMN IF EXISTS card",
+				"ALTER TABLE recurring_expenses DROP COLUMN IF EXISTS source",
+			)
+		},
+	}, {
+		// the accounts the legs of a currency exchange move; existing
+		// exchanges stay without one
+		Version: 24,
+		Name:    "exchange_accounts",
+		Up: func(tx *sql.Tx) error {
+			return execStatements(tx,
+				"ALTER TABLE currency_exchanges ADD COLUMN IF NOT EXISTS from_account_id VARCHAR(36) NOT NULL DEFAULT ''",
+				"ALTER TABLE currency_exchanges ADD COLUMN IF NOT EXISTS to_account_id VARCHAR(36) NOT NULL DEFAULT ''",
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execStatements(tx,
+				"ALTER TABLE currency_exchanges DROP COLUMN IF EXISTS to_account_id",
+				"ALTER TABLE currency_exchanges DROP COLUMN IF EXISTS from_account_id",
+			)
+		},
+	}, {
+		// recurring_horizon added materialized_through without a time zone,
+		// unlike every other date; the stored values were written in UTC. The
+		// check keeps the step safe on databases where the column is missing
+		// or already converted.
+		Version: 25,
+		Name:    "recurring_horizon_timestamptz",
+		Up: func(tx *sql.Tx) error {
+			return execStatements(tx, `DO $$
+				BEGIN
+					IF EXISTS (SELECT 1 FROM information_schema.columns WHERE table_schema = current_schema()
+						AND table_name = 'recurring_expenses' AND column_name = 'materialized_through'
+						AND data_type = 'timestamp without time zone') THEN
+						ALTER TABLE recurring_expenses ALTER COLUMN materialized_through TYPE TIMESTAMPTZ
+							USING materialized_through AT TIME ZONE 'UTC';
+					END IF;
+				END $$`)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execStatements(tx, `DO $$
+				BEGIN
+					IF EXISTS (SELECT 1 FROM information_schema.columns WHERE table_schema = current_schema()
+						AND table_name = 'recurring_expenses' AND column_name = 'materialized_through'
+						AND data_type = 'timestamp with time zone') THEN
+						ALTER TABLE recurring_expenses ALTER COLUMN materialized_through TYPE TIMESTAMP
+							USING materialized_through AT TIME ZONE 'UTC';
+					END IF;
+				END $$`)
+		},
+	},
+}
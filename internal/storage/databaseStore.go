@@ -5,8 +5,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
-	"slices"
-	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -15,8 +13,7 @@ import (
 
 // databaseStore implements the Storage interface for PostgreSQL.
 type databaseStore struct {
-	db       *sql.DB
-	defaults map[string]string // allows reusing defaults without querying for config
+	db *sql.DB
 }
 
 // SQL queries as constants for reusability and clarity.
@@ -66,6 +63,17 @@ const (
 )
 
 func InitializePostgresStore(baseConfig SystemConfig) (Storage, error) {
+	db, err := openPostgresDB(baseConfig)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := newMigrator(db, postgresMigrations, postgresPlaceholder).Up(); err != nil {
+		return nil, fmt.Errorf("failed to migrate database: %v", err)
+	}
+	return &databaseStore{db: db}, nil
+}
+
+func openPostgresDB(baseConfig SystemConfig) (*sql.DB, error) {
 	dbURL := makeDBURL(baseConfig)
 	db, err := sql.Open("postgres", dbURL)
 	if err != nil {
@@ -75,117 +83,37 @@ func InitializePostgresStore(baseConfig SystemConfig) (Storage, error) {
 		return nil, fmt.Errorf("failed to ping PostgreSQL database: %v", err)
 	}
 	log.Println("Connected to PostgreSQL database")
-
-	if err := createTables(db); err != nil {
-		return nil, fmt.Errorf("failed to create database tables: %v", err)
-	}
-	if err := ensureCategoriesTable(db); err != nil {
-		return nil, fmt.Errorf("failed to seed categories table: %v", err)
-	}
-	return &databaseStore{db: db, defaults: map[string]string{}}, nil
+	return db, nil
 }
 
 func makeDBURL(baseConfig SystemConfig) string {
 	return fmt.Sprintf("postgres://%s:%s@%s?sslmode=%s", baseConfig.StorageUser, baseConfig.StoragePass, baseConfig.StorageURL, baseConfig.StorageSSL)
 }
 
-func createTables(db *sql.DB) error {
-	for _, query := range []string{createExpensesTableSQL, createRecurringExpensesTableSQL, createConfigTableSQL, createCategoriesTableSQL} {
-		if _, err := db.Exec(query); err != nil {
-			return err
-		}
-	}
-	// ensure columns exist for backward compatibility
-	alterStmts := []string{
-		"ALTER TABLE expenses ADD COLUMN IF NOT EXISTS source VARCHAR(50)",
-		"ALTER TABLE expenses ADD COLUMN IF NOT EXISTS card VARCHAR(100)",
-	}
-	for _, stmt := range alterStmts {
-		if _, err := db.Exec(stmt); err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
-func ensureCategoriesTable(db *sql.DB) error {
-	var count int
-	if err := db.QueryRow(`SELECT COUNT(1) FROM categories`).Scan(&count); err != nil {
-		return err
-	}
-	if count > 0 {
-		return nil
-	}
-
-	var categories []string
-	var categoriesStr string
-	err := db.QueryRow(`SELECT categories FROM config WHERE id = 'default'`).Scan(&categoriesStr)
-	if err == nil {
-		if unmarshalErr := json.Unmarshal([]byte(categoriesStr), &categories); unmarshalErr != nil {
-			categories = nil
-		}
-	}
-	if len(categories) == 0 {
-		categories = defaultCategories
-	}
-	return seedCategories(db, categories)
-}
-
-func seedCategories(db *sql.DB, categories []string) error {
-	tx, err := db.Begin()
-	if err != nil {
-		return err
-	}
-	defer func() {
-		if err != nil {
-			_ = tx.Rollback()
-		}
-	}()
-
-	for i, name := range categories {
-		if _, err = tx.Exec(
-			`INSERT INTO categories (name, position) VALUES ($1, $2)
-			 ON CONFLICT (name) DO UPDATE SET position = EXCLUDED.position`,
-			name, i+1,
-		); err != nil {
-			return err
-		}
-	}
-	return tx.Commit()
-}
-
 func (s *databaseStore) Close() error {
 	return s.db.Close()
 }
 
+// categories live in their own table; config only keeps the scalar settings
 func (s *databaseStore) saveConfig(config *Config) error {
-	categoriesJSON, err := json.Marshal(config.Categories)
-	if err != nil {
-		return fmt.Errorf("failed to marshal categories: %v", err)
-	}
 	query := `
-		INSERT INTO config (id, categories, currency, start_date)
-		VALUES ('default', $1, $2, $3)
+		INSERT INTO config (id, currency, start_date)
+		VALUES ('default', $1, $2)
 		ON CONFLICT (id) DO UPDATE SET
-			categories = EXCLUDED.categories,
 			currency = EXCLUDED.currency,
 			start_date = EXCLUDED.start_date;
 	`
-	_, err = s.db.Exec(query, string(categoriesJSON), config.Currency, config.StartDate)
-	s.defaults["currency"] = config.Currency
-	s.defaults["start_date"] = fmt.Sprintf("%d", config.StartDate)
+	_, err := s.db.Exec(query, config.Currency, config.StartDate)
 	return err
 }
 
-func (s *databaseStore) updateConfig(updater func(c *Config) error) error {
-	config, err := s.GetConfig()
-	if err != nil {
+// updateConfig records the change in the audit log; GetConfig seeds the row on first use
+func (s *databaseStore) updateConfig(updater func(c *configSnapshot)) error {
+	if _, err := s.GetConfig(); err != nil {
 		return err
 	}
-	if err := updater(config); err != nil {
-		return err
-	}
-	return s.saveConfig(config)
+	_, err := postgresDialect.updateConfig(s.db, updater)
+	return err
 }
 
 func (s *databaseStore) GetConfig() (*Config, error) {
@@ -194,32 +122,28 @@ func (s *databaseStore) GetConfig() (*Config, error) {
 	var startDate int
 	err := s.db.QueryRow(query).Scan(&currency, &startDate)
 
-	if err != nil {
-		if err == sql.ErrNoRows {
-			config := &Config{}
-			config.SetBaseConfig()
-			if err := s.saveConfig(config); err != nil {
-				return nil, fmt.Errorf("failed to save initial default config: %v", err)
-			}
-			return config, nil
+	if err == sql.ErrNoRows {
+		base := &Config{}
+		base.SetBaseConfig()
+		if err := s.saveConfig(base); err != nil {
+			return nil, fmt.Errorf("failed to save initial default config: %v", err)
 		}
+		currency, startDate = base.Currency, base.StartDate
+	} else if err != nil {
 		return nil, fmt.Errorf("failed to get config from db: %v", err)
 	}
 
 	var config Config
 	config.Currency = currency
 	config.StartDate = startDate
-	categories, err := s.getCategoriesFromTable()
+	categories, err := s.GetCategories()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get categories from db: %v", err)
 	}
-	if len(categories) == 0 {
-		categories = defaultCategories
-		if seedErr := seedCategories(s.db, categories); seedErr != nil {
-			return nil, fmt.Errorf("failed to seed categories: %v", seedErr)
-		}
-	}
 	config.Categories = categories
+	if config.Currencies, err = postgresDialect.listEnabledCurrencies(s.db); err != nil {
+		return nil, err
+	}
 
 	recurring, err := s.GetRecurringExpenses()
 	if err != nil {
@@ -230,108 +154,24 @@ func (s *databaseStore) GetConfig() (*Config, error) {
 	return &config, nil
 }
 
-func (s *databaseStore) GetCategories() ([]string, error) {
-	categories, err := s.getCategoriesFromTable()
-	if err != nil {
-		return nil, err
-	}
-	if len(categories) == 0 {
-		categories = defaultCategories
-		if seedErr := seedCategories(s.db, categories); seedErr != nil {
-			return nil, seedErr
-		}
-	}
-	return categories, nil
+func (s *databaseStore) GetCategories() ([]Category, error) {
+	return postgresDialect.getCategories(s.db)
 }
 
-func (s *databaseStore) UpdateCategories(categories []string) error {
-	if err := s.updateCategoriesTable(categories); err != nil {
-		return err
-	}
-	return s.updateConfig(func(c *Config) error {
-		c.Categories = categories
-		return nil
-	})
+func (s *databaseStore) CategoriesVersion() (int64, error) {
+	return postgresDialect.readVersion(s.db, categoriesVersion)
 }
 
-func (s *databaseStore) getCategoriesFromTable() ([]string, error) {
-	rows, err := s.db.Query(`SELECT name FROM categories ORDER BY position ASC`)
-	if err != nil {
-		log.Printf("[DEBUG] getCategoriesFromTable query error: %v", err)
-		return nil, err
-	}
-	defer rows.Close()
-
-	var categories []string
-	for rows.Next() {
-		var name string
-		if err := rows.Scan(&name); err != nil {
-			log.Printf("[DEBUG] getCategoriesFromTable scan error: %v", err)
-			return nil, err
-		}
-		categories = append(categories, name)
-	}
-	if err := rows.Err(); err != nil {
-		log.Printf("[DEBUG] getCategoriesFromTable rows error: %v", err)
-		return nil, err
-	}
-	log.Printf("[DEBUG] getCategoriesFromTable returned %d categories: %v", len(categories), categories)
-	return categories, nil
+func (s *databaseStore) UpdateCategories(categories []Category, version int64) error {
+	return postgresDialect.saveCategories(s.db, categories, version)
 }
 
-func (s *databaseStore) updateCategoriesTable(categories []string) error {
-	if len(categories) == 0 {
-		return fmt.Errorf("categories cannot be empty")
-	}
-
-	// Validate that no category is empty
-	for _, cat := range categories {
-		if strings.TrimSpace(cat) == "" {
-			return fmt.Errorf("category names cannot be empty")
-		}
-	}
-
-	log.Printf("[DEBUG] updateCategoriesTable called with %d categories: %v", len(categories), categories)
-
-	tx, err := s.db.Begin()
-	if err != nil {
-		log.Printf("[DEBUG] updateCategoriesTable begin transaction error: %v", err)
-		return err
-	}
-	defer func() {
-		if err != nil {
-			log.Printf("[DEBUG] updateCategoriesTable rolling back transaction due to error: %v", err)
-			_ = tx.Rollback()
-		}
-	}()
-
-	for i, name := range categories {
-		log.Printf("[DEBUG] updateCategoriesTable inserting category %d: %s", i+1, name)
-		if _, err = tx.Exec(
-			`INSERT INTO categories (name, position) VALUES ($1, $2)
-			 ON CONFLICT (name) DO UPDATE SET position = EXCLUDED.position`,
-			name, i+1,
-		); err != nil {
-			log.Printf("[DEBUG] updateCategoriesTable insert error for category %s: %v", name, err)
-			return err
-		}
-	}
-
-	log.Printf("[DEBUG] updateCategoriesTable deleting categories not in list")
-	// Delete categories that are not in the new list
-	// Using a safer approach with explicit list building
-	if _, err = tx.Exec(`DELETE FROM categories WHERE NOT (name = ANY($1))`, pq.Array(categories)); err != nil {
-		log.Printf("[DEBUG] updateCategoriesTable delete error: %v", err)
-		return fmt.Errorf("failed to delete removed categories: %v", err)
-	}
-
-	if err = tx.Commit(); err != nil {
-		log.Printf("[DEBUG] updateCategoriesTable commit error: %v", err)
-		return fmt.Errorf("failed to commit category update: %v", err)
-	}
+func (s *databaseStore) RenameCategory(from, to string, version int64) error {
+	return postgresDialect.renameCategory(s.db, from, to, version)
+}
 
-	log.Printf("[DEBUG] updateCategoriesTable successfully updated categories")
-	return nil
+func (s *databaseStore) DeleteCategory(name, reassignTo string, version int64) error {
+	return postgresDialect.deleteCategory(s.db, name, reassignTo, version)
 }
 
 func (s *databaseStore) GetCurrency() (string, error) {
@@ -343,15 +183,29 @@ func (s *databaseStore) GetCurrency() (string, error) {
 }
 
 func (s *databaseStore) UpdateCurrency(currency string) error {
-	if !slices.Contains(SupportedCurrencies, currency) {
+	if enabled, err := postgresDialect.currencyEnabled(s.db, currency); err != nil {
+		return err
+	} else if !enabled {
 		return fmt.Errorf("invalid currency: %s", currency)
 	}
-	return s.updateConfig(func(c *Config) error {
+	return s.updateConfig(func(c *configSnapshot) {
 		c.Currency = currency
-		return nil
 	})
 }
 
+func (s *databaseStore) GetEnabledCurrencies() ([]string, error) {
+	return postgresDialect.listEnabledCurrencies(s.db)
+}
+
+// UpdateEnabledCurrencies checks the list against the base currency, so the
+// config row is seeded first
+func (s *databaseStore) UpdateEnabledCurrencies(codes []string) error {
+	if _, err := s.GetConfig(); err != nil {
+		return err
+	}
+	return postgresDialect.saveEnabledCurrencies(s.db, codes)
+}
+
 func (s *databaseStore) GetStartDate() (int, error) {
 	config, err := s.GetConfig()
 	if err != nil {
@@ -364,9 +218,8 @@ func (s *databaseStore) UpdateStartDate(startDate int) error {
 	if startDate < 1 || startDate > 31 {
 		return fmt.Errorf("invalid start date: %d", startDate)
 	}
-	return s.updateConfig(func(c *Config) error {
+	return s.updateConfig(func(c *configSnapshot) {
 		c.StartDate = startDate
-		return nil
 	})
 }
 
@@ -376,21 +229,40 @@ func scanExpense(scanner interface{ Scan(...any) error }) (Expense, error) {
 	var recurringID sql.NullString
 	var source sql.NullString
 	var card sql.NullString
+	var rate, rateCurrency, exchangeID, accountID, toAccountID, installmentID sql.NullString
+	var occurrence sql.NullTime
 	err := scanner.Scan(
 		&expense.ID,
 		&recurringID,
 		&expense.Name,
 		&expense.Category,
-		&expense.Amount,
+		&expense.Amount.Units,
 		&expense.Currency,
 		&expense.Date,
 		&tagsStr,
 		&source,
 		&card,
+		&expense.Version,
+		&rate,
+		&rateCurrency,
+		&exchangeID,
+		&accountID,
+		&expense.Type,
+		&toAccountID,
+		&installmentID,
+		&occurrence,
 	)
 	if err != nil {
 		return Expense{}, err
 	}
+	if rate.Valid {
+		locked, err := ParseMoney(rate.String)
+		if err != nil {
+			return Expense{}, fmt.Errorf("failed to parse rate of expense %s: %v", expense.ID, err)
+		}
+		expense.Rate, expense.RateCurrency = &locked, rateCurrency.String
+	}
+	expense.Amount.Scale = CurrencyDecimals(expense.Currency)
 	if recurringID.Valid {
 		expense.RecurringID = recurringID.String
 	}
@@ -400,6 +272,13 @@ func scanExpense(scanner interface{ Scan(...any) error }) (Expense, error) {
 	if card.Valid {
 		expense.Card = card.String
 	}
+	expense.ExchangeID = exchangeID.String
+	expense.AccountID = accountID.String
+	expense.ToAccountID = toAccountID.String
+	expense.InstallmentID = installmentID.String
+	if occurrence.Valid {
+		expense.Occurrence = &occurrence.Time
+	}
 	if tagsStr.Valid && tagsStr.String != "" {
 		if err := json.Unmarshal([]byte(tagsStr.String), &expense.Tags); err != nil {
 			return Expense{}, fmt.Errorf("failed to parse tags for expense %s: %v", expense.ID, err)
@@ -408,27 +287,56 @@ func scanExpense(scanner interface{ Scan(...any) error }) (Expense, error) {
 	return expense, nil
 }
 
+func (s *databaseStore) GetTags() ([]Tag, error) {
+	return postgresDialect.listTags(s.db)
+}
+
+func (s *databaseStore) AddTag(name string) error {
+	return postgresDialect.addTag(s.db, name)
+}
+
+func (s *databaseStore) RenameTag(from, to string) error {
+	return postgresDialect.renameTag(s.db, from, to)
+}
+
+func (s *databaseStore) MergeTags(sources []string, target string) error {
+	return postgresDialect.mergeTags(s.db, sources, target)
+}
+
+func (s *databaseStore) DeleteTag(name string) error {
+	return postgresDialect.deleteTag(s.db, name)
+}
+
 func (s *databaseStore) GetAllExpenses() ([]Expense, error) {
-	query := `SELECT id, recurring_id, name, category, amount, currency, date, tags, source, card FROM expenses ORDER BY date DESC`
-	rows, err := s.db.Query(query)
-	if err != nil {
-		return nil, fmt.Errorf("failed to query expenses: %v", err)
-	}
-	defer rows.Close()
+	return s.QueryExpenses(ExpenseFilter{})
+}
 
+func (s *databaseStore) QueryExpenses(filter ExpenseFilter) ([]Expense, error) {
 	var expenses []Expense
-	for rows.Next() {
-		expense, err := scanExpense(rows)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan expense: %v", err)
-		}
-		expenses = append(expenses, expense)
+	err := s.StreamExpenses(filter, func(e Expense) error {
+		expenses = append(expenses, e)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 	return expenses, nil
 }
 
+func (s *databaseStore) QueryExpensesPage(filter ExpenseFilter, after *ExpenseCursor, limit int) (ExpensePage, error) {
+	return postgresDialect.queryExpensePage(s.db, filter, after, limit)
+}
+
+func (s *databaseStore) StreamExpenses(filter ExpenseFilter, fn func(Expense) error) error {
+	return postgresDialect.streamExpenseRows(s.db, filter, nil, 0, fn)
+}
+
+func (s *databaseStore) SumExpensesByCategory(filter ExpenseFilter) ([]CategorySum, error) {
+	return postgresDialect.sumExpensesByCategory(s.db, filter)
+}
+
 func (s *databaseStore) GetExpense(id string) (Expense, error) {
-	query := `SELECT id, recurring_id, name, category, amount, currency, date, tags, source, card FROM expenses WHERE id = $1`
+	query := `SELECT ` + postgresDialect.expenseColumns() + ` FROM expenses WHERE id = $1 AND deleted_at IS NULL`
 	expense, err := scanExpense(s.db.QueryRow(query, id))
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -440,66 +348,108 @@ func (s *databaseStore) GetExpense(id string) (Expense, error) {
 }
 
 func (s *databaseStore) AddExpense(expense Expense) error {
+	return withTx(s.db, func(tx *sql.Tx) error {
+		return s.insertExpense(tx, expense, nil)
+	})
+}
+
+func (s *databaseStore) insertExpense(tx *sql.Tx, expense Expense, cache tagIDs) error {
 	if expense.ID == "" {
 		expense.ID = uuid.New().String()
 	}
-	if expense.Currency == "" {
-		expense.Currency = s.defaults["currency"]
+	if err := postgresDialect.normalizeExpense(tx, &expense); err != nil {
+		return err
 	}
 	if expense.Date.IsZero() {
 		expense.Date = time.Now()
 	}
-	tagsJSON, err := json.Marshal(expense.Tags)
-	if err != nil {
+	if err := postgresDialect.requireExpenseCategory(tx, expense); err != nil {
 		return err
 	}
-	query := `
-		INSERT INTO expenses (id, recurring_id, name, category, amount, currency, date, tags, source, card)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
-	`
-	_, err = s.db.Exec(query, expense.ID, expense.RecurringID, expense.Name, expense.Category, expense.Amount, expense.Currency, expense.Date, string(tagsJSON), expense.Source, expense.Card)
-	return err
-}
-
-func (s *databaseStore) UpdateExpense(id string, expense Expense) error {
-	tagsJSON, err := json.Marshal(expense.Tags)
-	if err != nil {
+	if err := postgresDialect.requireCurrency(tx, expense.Currency); err != nil {
 		return err
 	}
-	// TODO: revisit to maybe remove this later, might not be a good default for update
-	if expense.Currency == "" {
-		expense.Currency = s.defaults["currency"]
+	if err := postgresDialect.resolveAccount(tx, &expense, Expense{}); err != nil {
+		return err
 	}
 	query := `
-		UPDATE expenses
-		SET name = $1, category = $2, amount = $3, currency = $4, date = $5, tags = $6, recurring_id = $7, source = $8, card = $9
-		WHERE id = $10
+		INSERT INTO expenses (id, recurring_id, name, category, amount, currency, date, source, card, rate, rate_currency, account_id, type, to_account_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
 	`
-	result, err := s.db.Exec(query, expense.Name, expense.Category, expense.Amount, expense.Currency, expense.Date, string(tagsJSON), expense.RecurringID, expense.Source, expense.Card, id)
-	if err != nil {
-		return fmt.Errorf("failed to update expense: %v", err)
-	}
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %v", err)
+	rate, rateCurrency := lockedRateArgs(expense)
+	if _, err := tx.Exec(query, expense.ID, expense.RecurringID, expense.Name, expense.Category, expense.Amount.Units, expense.Currency, expense.Date, expense.Source, expense.Card, rate, rateCurrency, expense.AccountID, expense.Type, expense.ToAccountID); err != nil {
+		return err
 	}
-	if rowsAffected == 0 {
-		return fmt.Errorf("expense with ID %s not found", id)
+	if err := postgresDialect.writeTagLinks(tx, expenseTagLink, expense.ID, expense.Tags, cache); err != nil {
+		return err
 	}
-	return nil
+	expense.Tags = normalizeTags(expense.Tags)
+	expense.Version = 1
+	return postgresDialect.recordAudit(tx, auditChange{entity: AuditExpense, id: expense.ID, action: AuditCreate, after: expense})
 }
 
-func (s *databaseStore) RemoveExpense(id string) error {
-	query := `DELETE FROM expenses WHERE id = $1`
-	result, err := s.db.Exec(query, id)
-	if err != nil {
-		return fmt.Errorf("failed to delete expense: %v", err)
-	}
-	rowsAffected, err := result.RowsAffected()
+func (s *databaseStore) UpdateExpense(id string, expense Expense) error {
+	return withTx(s.db, func(tx *sql.Tx) error {
+		// TODO: revisit to maybe remove this later, might not be a good default for update
+		if err := postgresDialect.normalizeExpense(tx, &expense); err != nil {
+			return err
+		}
+		if err := postgresDialect.requireExpenseCategory(tx, expense); err != nil {
+			return err
+		}
+		if err := postgresDialect.requireCurrency(tx, expense.Currency); err != nil {
+			return err
+		}
+		before, err := postgresDialect.loadExpense(tx, id)
+		if err != nil && err != sql.ErrNoRows {
+			return fmt.Errorf("failed to read expense: %v", err)
+		}
+		if err := generatedExpenseError(before); err != nil {
+			return err
+		}
+		if err := postgresDialect.ruleOccurrence(tx, before); err != nil {
+			return err
+		}
+		if err := postgresDialect.resolveAccount(tx, &expense, before); err != nil {
+			return err
+		}
+		match, matchArgs := postgresDialect.versionMatch(expense.Version, 15)
+		query := `
+			UPDATE expenses
+			SET name = $1, category = $2, amount = $3, currency = $4, date = $5, recurring_id = $6, source = $7, card = $8,
+				rate = $9, rate_currency = $10, account_id = $11, type = $12, to_account_id = $13, version = version + 1
+			WHERE id = $14 AND deleted_at IS NULL` + match
+		rate, rateCurrency := lockedRateArgs(expense)
+		args := []any{expense.Name, expense.Category, expense.Amount.Units, expense.Currency, expense.Date, expense.RecurringID, expense.Source, expense.Card, rate, rateCurrency, expense.AccountID, expense.Type, expense.ToAccountID, id}
+		result, err := tx.Exec(query, append(args, matchArgs...)...)
+		if err != nil {
+			return fmt.Errorf("failed to update expense: %v", err)
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to get rows affected: %v", err)
+		}
+		if rowsAffected == 0 {
+			return postgresDialect.rowConflict(tx, "expenses", AuditExpense, id, fmt.Errorf("expense with ID %s not found", id))
+		}
+		if err := postgresDialect.writeTagLinks(tx, expenseTagLink, id, expense.Tags, nil); err != nil {
+			return err
+		}
+		after, err := postgresDialect.loadExpense(tx, id)
+		if err != nil {
+			return fmt.Errorf("failed to read updated expense: %v", err)
+		}
+		return postgresDialect.recordAudit(tx, auditChange{entity: AuditExpense, id: id, action: AuditUpdate, before: before, after: after})
+	})
+}
+
+// RemoveExpense moves an expense to the trash
+func (s *databaseStore) RemoveExpense(id string, version int64) error {
+	moved, err := postgresDialect.trashExpenses(s.db, []string{id}, version)
 	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %v", err)
+		return err
 	}
-	if rowsAffected == 0 {
+	if moved == 0 {
 		return fmt.Errorf("expense with ID %s not found", id)
 	}
 	return nil
@@ -509,34 +459,159 @@ func (s *databaseStore) AddMultipleExpenses(expenses []Expense) error {
 	if len(expenses) == 0 {
 		return nil
 	}
-	// use the same addexpense method
-	for _, exp := range expenses {
-		if err := s.AddExpense(exp); err != nil {
-			return err
+	return withTx(s.db, func(tx *sql.Tx) error {
+		cache := tagIDs{}
+		for _, exp := range expenses {
+			if err := s.insertExpense(tx, exp, cache); err != nil {
+				return err
+			}
 		}
-	}
-	return nil
+		return nil
+	})
 }
 
 func (s *databaseStore) RemoveMultipleExpenses(ids []string) error {
-	if len(ids) == 0 {
-		return nil
-	}
-	query := `DELETE FROM expenses WHERE id = ANY($1)`
-	_, err := s.db.Exec(query, pq.Array(ids))
-	if err != nil {
-		return fmt.Errorf("failed to delete multiple expenses: %v", err)
-	}
-	return nil
+	_, err := postgresDialect.trashExpenses(s.db, ids, 0)
+	return err
+}
+
+func (s *databaseStore) GetTrash() ([]TrashedExpense, error) {
+	return postgresDialect.listTrash(s.db)
+}
+
+func (s *databaseStore) RestoreExpenses(ids []string) error {
+	return postgresDialect.restoreExpenses(s.db, ids)
+}
+
+func (s *databaseStore) PurgeExpenses(ids []string) error {
+	return postgresDialect.purgeExpenses(s.db, ids)
+}
+
+func (s *databaseStore) PurgeTrash(before time.Time) (int, error) {
+	return postgresDialect.purgeTrash(s.db, before)
+}
+
+func (s *databaseStore) GetAuditLog(filter AuditFilter) ([]AuditEntry, error) {
+	return postgresDialect.queryAudit(s.db, filter)
+}
+
+func (s *databaseStore) GetExchangeRates() ([]ExchangeRate, error) {
+	return postgresDialect.listExchangeRates(s.db)
+}
+
+func (s *databaseStore) SaveExchangeRates(rates []ExchangeRate) error {
+	return postgresDialect.saveExchangeRates(s.db, rates)
+}
+
+func (s *databaseStore) DeleteExchangeRate(date time.Time, currency, quote string) error {
+	return postgresDialect.deleteExchangeRate(s.db, date, currency, quote)
+}
+
+func (s *databaseStore) GetCPIIndexes() ([]CPIIndex, error) {
+	return postgresDialect.listCPIIndexes(s.db)
+}
+
+func (s *databaseStore) SaveCPIIndexes(indexes []CPIIndex) error {
+	return postgresDialect.saveCPIIndexes(s.db, indexes)
+}
+
+func (s *databaseStore) DeleteCPIIndex(currency string, month time.Time) error {
+	return postgresDialect.deleteCPIIndex(s.db, currency, month)
+}
+
+func (s *databaseStore) GetHolidays() ([]Holiday, error) {
+	return postgresDialect.listHolidays(s.db)
+}
+
+func (s *databaseStore) SaveHolidays(holidays []Holiday) error {
+	return postgresDialect.saveHolidays(s.db, holidays)
+}
+
+func (s *databaseStore) DeleteHoliday(date time.Time) error {
+	return postgresDialect.deleteHoliday(s.db, date)
+}
+
+func (s *databaseStore) GetCurrencyExchanges() ([]CurrencyExchange, error) {
+	return postgresDialect.listExchanges(s.db)
+}
+
+func (s *databaseStore) GetCurrencyExchange(id string) (CurrencyExchange, error) {
+	return postgresDialect.getExchange(s.db, id)
+}
+
+func (s *databaseStore) AddCurrencyExchange(exchange CurrencyExchange) error {
+	return postgresDialect.addExchange(s.db, exchange)
+}
+
+func (s *databaseStore) RemoveCurrencyExchange(id string) error {
+	return postgresDialect.removeExchange(s.db, id)
+}
+
+func (s *databaseStore) GetInstallmentPurchases() ([]InstallmentPurchase, error) {
+	return postgresDialect.listInstallments(s.db)
+}
+
+func (s *databaseStore) GetInstallmentPurchase(id string) (InstallmentPurchase, error) {
+	return postgresDialect.getInstallment(s.db, id)
+}
+
+func (s *databaseStore) AddInstallmentPurchase(purchase InstallmentPurchase) error {
+	return postgresDialect.addInstallment(s.db, purchase)
+}
+
+func (s *databaseStore) PayOffInstallmentPurchase(id string, date time.Time) error {
+	return postgresDialect.payOffInstallment(s.db, id, date)
+}
+
+func (s *databaseStore) RemoveInstallmentPurchase(id string) error {
+	return postgresDialect.removeInstallment(s.db, id)
+}
+
+func (s *databaseStore) GetAccounts() ([]Account, error) {
+	return postgresDialect.listAccounts(s.db)
+}
+
+func (s *databaseStore) GetAccount(id string) (Account, error) {
+	return postgresDialect.getAccount(s.db, id)
+}
+
+func (s *databaseStore) AddAccount(account Account) error {
+	return postgresDialect.addAccount(s.db, account)
+}
+
+func (s *databaseStore) UpdateAccount(id string, account Account) error {
+	return postgresDialect.updateAccount(s.db, id, account)
+}
+
+func (s *databaseStore) DeleteAccount(id string) error {
+	return postgresDialect.deleteAccount(s.db, id)
+}
+
+func (s *databaseStore) GetAccountBalances() ([]AccountBalance, error) {
+	return postgresDialect.accountBalances(s.db)
 }
 
 func scanRecurringExpense(scanner interface{ Scan(...any) error }) (RecurringExpense, error) {
 	var re RecurringExpense
 	var tagsStr sql.NullString
-	err := scanner.Scan(&re.ID, &re.Name, &re.Amount, &re.Currency, &re.Category, &re.StartDate, &re.Interval, &re.Occurrences, &tagsStr)
+	var materialized sql.NullTime
+	var amountChanges, overrides string
+	var accountID sql.NullString
+	err := scanner.Scan(&re.ID, &re.Name, &re.Amount.Units, &re.Currency, &re.Category, &re.StartDate, &re.Interval, &re.Occurrences, &tagsStr, &re.Version, &materialized, &re.RRule, &re.BusinessDay, &amountChanges, &overrides, &re.Source, &re.Card, &accountID)
 	if err != nil {
 		return RecurringExpense{}, err
 	}
+	re.AccountID = accountID.String
+	if err := json.Unmarshal([]byte(amountChanges), &re.AmountChanges); err != nil {
+		return RecurringExpense{}, fmt.Errorf("failed to parse amount changes for recurring expense %s: %v", re.ID, err)
+	}
+	if err := json.Unmarshal([]byte(overrides), &re.Overrides); err != nil {
+		return RecurringExpense{}, fmt.Errorf("failed to parse overrides for recurring expense %s: %v", re.ID, err)
+	}
+	re.Amount.Scale = CurrencyDecimals(re.Currency)
+	if materialized.Valid {
+		re.MaterializedThrough = &materialized.Time
+	}
 	if tagsStr.Valid && tagsStr.String != "" {
 		if err := json.Unmarshal([]byte(tagsStr.String), &re.Tags); err != nil {
 			return RecurringExpense{}, fmt.Errorf("failed to parse tags for recurring expense %s: %v", re.ID, err)
@@ -546,7 +621,7 @@ func scanRecurringExpense(scanner interface{ Scan(...any) error }) (RecurringExp
 }
 
 func (s *databaseStore) GetRecurringExpenses() ([]RecurringExpense, error) {
-	query := `SELECT id, name, amount, currency, category, start_date, interval, occurrences, tags FROM recurring_expenses`
+	query := `SELECT ` + postgresDialect.recurringColumns() + ` FROM recurring_expenses`
 	rows, err := s.db.Query(query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query recurring expenses: %v", err)
@@ -564,7 +639,7 @@ func (s *databaseStore) GetRecurringExpenses() ([]RecurringExpense, error) {
 }
 
 func (s *databaseStore) GetRecurringExpense(id string) (RecurringExpense, error) {
-	query := `SELECT id, name, amount, category, start_date, interval, occurrences, tags FROM recurring_expenses WHERE id = $1`
+	query := `SELECT ` + postgresDialect.recurringColumns() + ` FROM recurring_expenses WHERE id = $1`
 	re, err := scanRecurringExpense(s.db.QueryRow(query, id))
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -586,37 +661,85 @@ func (s *databaseStore) AddRecurringExpense(recurringExpense RecurringExpense) e
 		recurringExpense.ID = uuid.New().String()
 	}
 	if recurringExpense.Currency == "" {
-		recurringExpense.Currency = s.defaults["currency"]
+		if recurringExpense.Currency, err = postgresDialect.baseCurrency(tx); err != nil {
+			return err
+		}
+	}
+	if err := recurringExpense.normalizeAmount(); err != nil {
+		return invalid(err)
+	}
+	if err := postgresDialect.requireCategory(tx, recurringExpense.Category); err != nil {
+		return err
+	}
+	if err := postgresDialect.requireCurrency(tx, recurringExpense.Currency); err != nil {
+		return err
+	}
+	err = recurringExpense.resolveAccount(func(e *Expense, current Expense) error {
+		return postgresDialect.resolveAccount(tx, e, current)
+	}, "")
+	if err != nil {
+		return err
 	}
-	tagsJSON, _ := json.Marshal(recurringExpense.Tags)
+	holidays, err := postgresDialect.loadHolidays(tx)
+	if err != nil {
+		return err
+	}
+	amountChanges, overrides, err := recurringExpense.scheduleJSON()
+	if err != nil {
+		return err
+	}
+	horizon := RecurringHorizon(time.Now())
+	recurringExpense.MaterializedThrough = &horizon
 	ruleQuery := `
-		INSERT INTO recurring_expenses (id, name, amount, currency, category, start_date, interval, occurrences, tags)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		INSERT INTO recurring_expenses (id, name, amount, currency, category, start_date, interval, occurrences, materialized_through, rrule, business_day, amount_changes, overrides, source, card, account_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
 	`
-	_, err = tx.Exec(ruleQuery, recurringExpense.ID, recurringExpense.Name, recurringExpense.Amount, recurringExpense.Currency, recurringExpense.Category, recurringExpense.StartDate, recurringExpense.Interval, recurringExpense.Occurrences, string(tagsJSON))
+	_, err = tx.Exec(ruleQuery, recurringExpense.ID, recurringExpense.Name, recurringExpense.Amount.Units, recurringExpense.Currency, recurringExpense.Category, recurringExpense.StartDate, recurringExpense.Interval, recurringExpense.Occurrences, horizon, recurringExpense.RRule, recurringExpense.BusinessDay, amountChanges, overrides, recurringExpense.Source, recurringExpense.Card, recurringExpense.AccountID)
 	if err != nil {
 		return fmt.Errorf("failed to insert recurring expense rule: %v", err)
 	}
+	if err := postgresDialect.writeTagLinks(tx, recurringTagLink, recurringExpense.ID, recurringExpense.Tags, nil); err != nil {
+		return err
+	}
+	instances := recurringExpense.instances(time.Time{}, horizon, holidays)
+	if err := copyExpenseInstances(tx, instances); err != nil {
+		return err
+	}
+	recurringExpense.Tags = normalizeTags(recurringExpense.Tags)
+	recurringExpense.Version = 1
+	err = postgresDialect.recordAudit(tx, auditChange{entity: AuditRecurring, id: recurringExpense.ID, action: AuditCreate,
+		detail: fmt.Sprintf("%d instances generated", len(instances)), after: recurringExpense})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
 
-	expensesToAdd := generateExpensesFromRecurring(recurringExpense, false)
-	if len(expensesToAdd) > 0 {
-		stmt, err := tx.Prepare(pq.CopyIn("expenses", "id", "recurring_id", "name", "category", "amount", "currency", "date", "tags"))
-		if err != nil {
-			return fmt.Errorf("failed to prepare copy in: %v", err)
-		}
-		defer stmt.Close()
-		for _, exp := range expensesToAdd {
-			expTagsJSON, _ := json.Marshal(exp.Tags)
-			_, err = stmt.Exec(exp.ID, exp.RecurringID, exp.Name, exp.Category, exp.Amount, exp.Currency, exp.Date, string(expTagsJSON))
-			if err != nil {
-				return fmt.Errorf("failed to execute copy in: %v", err)
-			}
+// copyExpenseInstances bulk loads generated instances with COPY, then links their tags
+func copyExpenseInstances(tx *sql.Tx, expenses []Expense) error {
+	if len(expenses) == 0 {
+		return nil
+	}
+	stmt, err := tx.Prepare(pq.CopyIn("expenses", "id", "recurring_id", "name", "category", "amount", "currency", "date", "type", "occurrence", "source", "card", "account_id"))
+	if err != nil {
+		return fmt.Errorf("failed to prepare copy in: %v", err)
+	}
+	defer stmt.Close()
+	for _, exp := range expenses {
+		if _, err := stmt.Exec(exp.ID, exp.RecurringID, exp.Name, exp.Category, exp.Amount.Units, exp.Currency, exp.Date, exp.Type, exp.Occurrence.UTC(), exp.Source, exp.Card, exp.AccountID); err != nil {
+			return fmt.Errorf("failed to execute copy in: %v", err)
 		}
-		if _, err = stmt.Exec(); err != nil {
-			return fmt.Errorf("failed to finalize copy in: %v", err)
+	}
+	if _, err := stmt.Exec(); err != nil {
+		return fmt.Errorf("failed to finalize copy in: %v", err)
+	}
+	cache := tagIDs{}
+	for _, exp := range expenses {
+		if err := postgresDialect.writeTagLinks(tx, expenseTagLink, exp.ID, exp.Tags, cache); err != nil {
+			return err
 		}
 	}
-	return tx.Commit()
+	return nil
 }
 
 func (s *databaseStore) UpdateRecurringExpense(id string, recurringExpense RecurringExpense, updateAll bool) error {
@@ -627,138 +750,133 @@ func (s *databaseStore) UpdateRecurringExpense(id string, recurringExpense Recur
 	defer tx.Rollback()
 	recurringExpense.ID = id // Ensure ID is preserved
 	if recurringExpense.Currency == "" {
-		recurringExpense.Currency = s.defaults["currency"]
+		if recurringExpense.Currency, err = postgresDialect.baseCurrency(tx); err != nil {
+			return err
+		}
 	}
-	tagsJSON, _ := json.Marshal(recurringExpense.Tags)
+	if err := recurringExpense.normalizeAmount(); err != nil {
+		return invalid(err)
+	}
+	if err := postgresDialect.requireCategory(tx, recurringExpense.Category); err != nil {
+		return err
+	}
+	if err := postgresDialect.requireCurrency(tx, recurringExpense.Currency); err != nil {
+		return err
+	}
+	before, err := postgresDialect.loadRecurring(tx, id)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("failed to read recurring expense rule: %v", err)
+	}
+	err = recurringExpense.resolveAccount(func(e *Expense, current Expense) error {
+		return postgresDialect.resolveAccount(tx, e, current)
+	}, before.AccountID)
+	if err != nil {
+		return err
+	}
+	holidays, err := postgresDialect.loadHolidays(tx)
+	if err != nil {
+		return err
+	}
+	// overrides only change one occurrence at a time
+	recurringExpense.Overrides = before.Overrides
+	amountChanges, _, err := recurringExpense.scheduleJSON()
+	if err != nil {
+		return err
+	}
+	horizon := RecurringHorizon(time.Now())
+	match, matchArgs := postgresDialect.versionMatch(recurringExpense.Version, 16)
 	ruleQuery := `
 		UPDATE recurring_expenses
-		SET name = $1, amount = $2, category = $3, start_date = $4, interval = $5, occurrences = $6, tags = $7, currency = $8
-		WHERE id = $9
-	`
-	res, err := tx.Exec(ruleQuery, recurringExpense.Name, recurringExpense.Amount, recurringExpense.Category, recurringExpense.StartDate, recurringExpense.Interval, recurringExpense.Occurrences, string(tagsJSON), recurringExpense.Currency, id)
+		SET name = $1, amount = $2, category = $3, start_date = $4, interval = $5, occurrences = $6, currency = $7, materialized_through = $8, rrule = $9, business_day = $10, amount_changes = $11, source = $12, card = $13, account_id = $14, version = version + 1
+		WHERE id = $15` + match
+	args := []any{recurringExpense.Name, recurringExpense.Amount.Units, recurringExpense.Category, recurringExpense.StartDate, recurringExpense.Interval, recurringExpense.Occurrences, recurringExpense.Currency, horizon, recurringExpense.RRule, recurringExpense.BusinessDay, amountChanges, recurringExpense.Source, recurringExpense.Card, recurringExpense.AccountID, id}
+	res, err := tx.Exec(ruleQuery, append(args, matchArgs...)...)
 	if err != nil {
 		return fmt.Errorf("failed to update recurring expense rule: %v", err)
 	}
 	rowsAffected, _ := res.RowsAffected()
 	if rowsAffected == 0 {
-		return fmt.Errorf("recurring expense with ID %s not found to update", id)
+		return postgresDialect.rowConflict(tx, "recurring_expenses", AuditRecurring, id, fmt.Errorf("recurring expense with ID %s not found to update", id))
+	}
+	if err := postgresDialect.writeTagLinks(tx, recurringTagLink, id, recurringExpense.Tags, nil); err != nil {
+		return err
 	}
 
 	var deleteQuery string
+	var from time.Time
 	if updateAll {
 		deleteQuery = `DELETE FROM expenses WHERE recurring_id = $1`
-		_, err = tx.Exec(deleteQuery, id)
+		res, err = tx.Exec(deleteQuery, id)
 	} else {
-		deleteQuery = `DELETE FROM expenses WHERE recurring_id = $1 AND date > $2`
-		_, err = tx.Exec(deleteQuery, id, time.Now())
+		from = time.Now()
+		deleteQuery = `DELETE FROM expenses WHERE recurring_id = $1 AND COALESCE(occurrence, date) > $2`
+		res, err = tx.Exec(deleteQuery, id, from)
 	}
 	if err != nil {
 		return fmt.Errorf("failed to delete old expense instances for update: %v", err)
 	}
+	removed, _ := res.RowsAffected()
 
-	expensesToAdd := generateExpensesFromRecurring(recurringExpense, !updateAll)
-	if len(expensesToAdd) > 0 {
-		stmt, err := tx.Prepare(pq.CopyIn("expenses", "id", "recurring_id", "name", "category", "amount", "currency", "date", "tags"))
-		if err != nil {
-			return fmt.Errorf("failed to prepare copy in for update: %v", err)
-		}
-		defer stmt.Close()
-		for _, exp := range expensesToAdd {
-			expTagsJSON, _ := json.Marshal(exp.Tags)
-			_, err = stmt.Exec(exp.ID, exp.RecurringID, exp.Name, exp.Category, exp.Amount, exp.Currency, exp.Date, string(expTagsJSON))
-			if err != nil {
-				return fmt.Errorf("failed to execute copy in for update: %v", err)
-			}
-		}
-		if _, err = stmt.Exec(); err != nil {
-			return fmt.Errorf("failed to finalize copy in for update: %v", err)
-		}
+	instances := recurringExpense.instances(from, horizon, holidays)
+	if err := copyExpenseInstances(tx, instances); err != nil {
+		return err
+	}
+	after, err := postgresDialect.loadRecurring(tx, id)
+	if err != nil {
+		return fmt.Errorf("failed to read updated recurring expense rule: %v", err)
+	}
+	err = postgresDialect.recordAudit(tx, auditChange{entity: AuditRecurring, id: id, action: AuditUpdate,
+		detail: fmt.Sprintf("%d instances removed, %d generated", removed, len(instances)), before: before, after: after})
+	if err != nil {
+		return err
 	}
 	return tx.Commit()
 }
 
-func (s *databaseStore) RemoveRecurringExpense(id string, removeAll bool) error {
+func (s *databaseStore) RemoveRecurringExpense(id string, removeAll bool, version int64) error {
 	tx, err := s.db.Begin()
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %v", err)
 	}
 	defer tx.Rollback()
-	res, err := tx.Exec(`DELETE FROM recurring_expenses WHERE id = $1`, id)
+	before, err := postgresDialect.loadRecurring(tx, id)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("failed to read recurring expense rule: %v", err)
+	}
+	match, matchArgs := postgresDialect.versionMatch(version, 2)
+	res, err := tx.Exec(`DELETE FROM recurring_expenses WHERE id = $1`+match, append([]any{id}, matchArgs...)...)
 	if err != nil {
 		return fmt.Errorf("failed to delete recurring expense rule: %v", err)
 	}
 	rowsAffected, _ := res.RowsAffected()
 	if rowsAffected == 0 {
-		return fmt.Errorf("recurring expense with ID %s not found", id)
+		return postgresDialect.rowConflict(tx, "recurring_expenses", AuditRecurring, id, fmt.Errorf("recurring expense with ID %s not found", id))
 	}
 
 	var deleteQuery string
 	if removeAll {
 		deleteQuery = `DELETE FROM expenses WHERE recurring_id = $1`
-		_, err = tx.Exec(deleteQuery, id)
+		res, err = tx.Exec(deleteQuery, id)
 	} else {
-		deleteQuery = `DELETE FROM expenses WHERE recurring_id = $1 AND date > $2`
-		_, err = tx.Exec(deleteQuery, id, time.Now())
+		deleteQuery = `DELETE FROM expenses WHERE recurring_id = $1 AND COALESCE(occurrence, date) > $2`
+		res, err = tx.Exec(deleteQuery, id, time.Now())
 	}
 	if err != nil {
 		return fmt.Errorf("failed to delete expense instances: %v", err)
 	}
+	removed, _ := res.RowsAffected()
+	err = postgresDialect.recordAudit(tx, auditChange{entity: AuditRecurring, id: id, action: AuditDelete,
+		detail: fmt.Sprintf("%d instances removed", removed), before: before})
+	if err != nil {
+		return err
+	}
 	return tx.Commit()
 }
 
-func generateExpensesFromRecurring(recExp RecurringExpense, fromToday bool) []Expense {
-	var expenses []Expense
-	currentDate := recExp.StartDate
-	today := time.Now()
-	occurrencesToGenerate := recExp.Occurrences
-	if fromToday {
-		for currentDate.Before(today) && (recExp.Occurrences == 0 || occurrencesToGenerate > 0) {
-			switch recExp.Interval {
-			case "daily":
-				currentDate = currentDate.AddDate(0, 0, 1)
-			case "weekly":
-				currentDate = currentDate.AddDate(0, 0, 7)
-			case "monthly":
-				currentDate = currentDate.AddDate(0, 1, 0)
-			case "yearly":
-				currentDate = currentDate.AddDate(1, 0, 0)
-			default:
-				return expenses // Stop if interval is invalid
-			}
-			if recExp.Occurrences > 0 {
-				occurrencesToGenerate--
-			}
-		}
-	}
-	limit := occurrencesToGenerate
-	// if recExp.Occurrences == 0 {
-	// 	limit = 2000 // Heuristic for "indefinite"
-	// }
-
-	for range limit {
-		expense := Expense{
-			ID:          uuid.New().String(),
-			RecurringID: recExp.ID,
-			Name:        recExp.Name,
-			Category:    recExp.Category,
-			Amount:      recExp.Amount,
-			Currency:    recExp.Currency,
-			Date:        currentDate,
-			Tags:        recExp.Tags,
-		}
-		expenses = append(expenses, expense)
-		switch recExp.Interval {
-		case "daily":
-			currentDate = currentDate.AddDate(0, 0, 1)
-		case "weekly":
-			currentDate = currentDate.AddDate(0, 0, 7)
-		case "monthly":
-			currentDate = currentDate.AddDate(0, 1, 0)
-		case "yearly":
-			currentDate = currentDate.AddDate(1, 0, 0)
-		default:
-			return expenses
-		}
-	}
-	return expenses
+func (s *databaseStore) OverrideRecurringOccurrence(id string, override RecurringOverride, version int64) error {
+	return postgresDialect.overrideOccurrence(s.db, id, override, version, copyExpenseInstances)
+}
+
+func (s *databaseStore) MaterializeRecurring(through time.Time) (int, error) {
+	return postgresDialect.materializeRecurring(s.db, through, copyExpenseInstances)
 }
@@ -0,0 +1,239 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CurrencyExchange is money moved between two currencies: FromAmount of
+// FromCurrency went out and ToAmount of ToCurrency came in. Each side is kept
+// as an expense leg so the movements per currency stay complete, but neither
+// leg is spending or income.
+type CurrencyExchange struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	Date         time.Time `json:"date"`
+	FromCurrency string    `json:"fromCurrency"`
+	FromAmount   Money     `json:"fromAmount"` // positive, in the minor units of FromCurrency once stored
+	ToCurrency   string    `json:"toCurrency"`
+	ToAmount     Money     `json:"toAmount"` // positive, in the minor units of ToCurrency once stored
+	// Rate is the effective rate, units of FromCurrency paid for one unit of
+	// ToCurrency; derived from the amounts
+	Rate       Money  `json:"rate"`
+	OutgoingID string `json:"outgoingId"` // leg with -FromAmount
+	IncomingID string `json:"incomingId"` // leg with +ToAmount
+	// FromAccountID and ToAccountID are the accounts the legs move, optional
+	// like the account of any expense
+	FromAccountID string `json:"fromAccountId,omitempty"`
+	ToAccountID   string `json:"toAccountId,omitempty"`
+}
+
+// exchangeRateDecimals is the precision of the effective rate of an exchange
+const exchangeRateDecimals = 6
+
+const defaultExchangeName = "Currency exchange"
+
+// Validate lowercases the currencies, brings the amounts to their minor units
+// and derives the effective rate
+func (x *CurrencyExchange) Validate() error {
+	x.Name = SanitizeString(x.Name)
+	if x.Name == "" {
+		x.Name = defaultExchangeName
+	}
+	from, err := ValidateCurrencyCode(x.FromCurrency)
+	if err != nil {
+		return err
+	}
+	to, err := ValidateCurrencyCode(x.ToCurrency)
+	if err != nil {
+		return err
+	}
+	if from == to {
+		return fmt.Errorf("currency exchange needs two different currencies, got %s twice", from)
+	}
+	x.FromCurrency, x.ToCurrency = from, to
+	if x.FromAmount.Sign() <= 0 || x.ToAmount.Sign() <= 0 {
+		return fmt.Errorf("currency exchange amounts must be positive")
+	}
+	if x.FromAmount, err = x.FromAmount.In(from); err != nil {
+		return err
+	}
+	if x.ToAmount, err = x.ToAmount.In(to); err != nil {
+		return err
+	}
+	if x.Date.IsZero() {
+		return fmt.Errorf("currency exchange 'date' cannot be empty")
+	}
+	x.Rate, err = moneyFromRat(new(big.Rat).Quo(x.FromAmount.rat(), x.ToAmount.rat()), exchangeRateDecimals)
+	if err != nil {
+		return err
+	}
+	if x.Rate.Sign() <= 0 {
+		return fmt.Errorf("currency exchange rate rounds to 0")
+	}
+	return nil
+}
+
+// legs returns the outgoing and incoming expenses of the exchange, assigning
+// ids to the exchange and its legs when missing; both legs are transfers
+func (x *CurrencyExchange) legs() []Expense {
+	for _, id := range []*string{&x.ID, &x.OutgoingID, &x.IncomingID} {
+		if *id == "" {
+			*id = uuid.New().String()
+		}
+	}
+	return []Expense{
+		{ID: x.OutgoingID, ExchangeID: x.ID, Name: x.Name, Amount: x.FromAmount.Neg(), Currency: x.FromCurrency, Date: x.Date, Version: 1, Type: TransactionTypeTransfer},
+		{ID: x.IncomingID, ExchangeID: x.ID, Name: x.Name, Amount: x.ToAmount, Currency: x.ToCurrency, Date: x.Date, Version: 1, Type: TransactionTypeTransfer},
+	}
+}
+
+// attachAccounts points the outgoing leg at FromAccountID and the incoming
+// one at ToAccountID, checked like the account of an expense; account looks
+// an account up by id
+func (x CurrencyExchange) attachAccounts(legs []Expense, account func(id string) (Account, error)) error {
+	for i, id := range []string{x.FromAccountID, x.ToAccountID} {
+		if id == "" {
+			continue
+		}
+		a, err := account(id)
+		if err != nil {
+			return err
+		}
+		if err := attachAccount(&legs[i], a, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// effectiveRate is what the exchange feeds into the conversion data: one unit
+// of ToCurrency in FromCurrency on the day of the exchange
+func (x CurrencyExchange) effectiveRate() ExchangeRate {
+	return ExchangeRate{Date: rateDay(x.Date), Currency: x.ToCurrency, Quote: x.FromCurrency, Rate: x.Rate}
+}
+
+// exchangeLegError refuses changes to one leg of an exchange on its own
+func exchangeLegError(e Expense) error {
+	return fmt.Errorf("expense %s is part of currency exchange %s; remove the exchange instead", e.ID, e.ExchangeID)
+}
+
+const exchangeColumns = "id, name, date, from_currency, from_amount, to_currency, to_amount, rate, outgoing_id, incoming_id, from_account_id, to_account_id"
+
+func scanExchange(scanner interface{ Scan(...any) error }) (CurrencyExchange, error) {
+	var x CurrencyExchange
+	var rate string
+	err := scanner.Scan(&x.ID, &x.Name, &x.Date, &x.FromCurrency, &x.FromAmount.Units, &x.ToCurrency, &x.ToAmount.Units, &rate, &x.OutgoingID, &x.IncomingID, &x.FromAccountID, &x.ToAccountID)
+	if err != nil {
+		return CurrencyExchange{}, err
+	}
+	if x.Rate, err = ParseMoney(rate); err != nil {
+		return CurrencyExchange{}, fmt.Errorf("failed to parse rate of currency exchange %s: %v", x.ID, err)
+	}
+	x.FromAmount.Scale = CurrencyDecimals(x.FromCurrency)
+	x.ToAmount.Scale = CurrencyDecimals(x.ToCurrency)
+	return x, nil
+}
+
+// listExchanges returns every currency exchange, newest first
+func (d sqlDialect) listExchanges(db *sql.DB) ([]CurrencyExchange, error) {
+	rows, err := db.Query(`SELECT ` + exchangeColumns + ` FROM currency_exchanges ORDER BY date DESC, id DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query currency exchanges: %v", err)
+	}
+	defer rows.Close()
+	var exchanges []CurrencyExchange
+	for rows.Next() {
+		x, err := scanExchange(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan currency exchange: %v", err)
+		}
+		exchanges = append(exchanges, x)
+	}
+	return exchanges, rows.Err()
+}
+
+func (d sqlDialect) getExchange(q interface {
+	QueryRow(string, ...any) *sql.Row
+}, id string) (CurrencyExchange, error) {
+	query := fmt.Sprintf(`SELECT %s FROM currency_exchanges WHERE id = %s`, exchangeColumns, d.placeholder(1))
+	x, err := scanExchange(q.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return CurrencyExchange{}, fmt.Errorf("currency exchange with ID %s not found", id)
+	} else if err != nil {
+		return CurrencyExchange{}, fmt.Errorf("failed to get currency exchange: %v", err)
+	}
+	return x, nil
+}
+
+// addExchange stores the exchange with its two legs and upserts its effective
+// rate, all in one transaction
+func (d sqlDialect) addExchange(db *sql.DB, x CurrencyExchange) error {
+	if err := x.Validate(); err != nil {
+		return err
+	}
+	legs := x.legs()
+	return withTx(db, func(tx *sql.Tx) error {
+		for _, currency := range []string{x.FromCurrency, x.ToCurrency} {
+			if err := d.requireCurrency(tx, currency); err != nil {
+				return err
+			}
+		}
+		err := x.attachAccounts(legs, func(id string) (Account, error) { return d.requireAccount(tx, id) })
+		if err != nil {
+			return err
+		}
+		insert := fmt.Sprintf(`INSERT INTO currency_exchanges (%s) VALUES (%s, %s, %s, %s, %s, %s, %s, %s, %s, %s, %s, %s)`, exchangeColumns,
+			d.placeholder(1), d.placeholder(2), d.placeholder(3), d.placeholder(4), d.placeholder(5), d.placeholder(6),
+			d.placeholder(7), d.placeholder(8), d.placeholder(9), d.placeholder(10), d.placeholder(11), d.placeholder(12))
+		_, err = tx.Exec(insert, x.ID, x.Name, x.Date, x.FromCurrency, x.FromAmount.Units, x.ToCurrency, x.ToAmount.Units, x.Rate.String(), x.OutgoingID, x.IncomingID, x.FromAccountID, x.ToAccountID)
+		if err != nil {
+			return fmt.Errorf("failed to save currency exchange: %v", err)
+		}
+		insertLeg := fmt.Sprintf(`INSERT INTO expenses (id, recurring_id, name, category, amount, currency, date, source, card, account_id, exchange_id, type)
+			VALUES (%s, '', %s, '', %s, %s, %s, %s, %s, %s, %s, 'transfer')`,
+			d.placeholder(1), d.placeholder(2), d.placeholder(3), d.placeholder(4), d.placeholder(5),
+			d.placeholder(6), d.placeholder(7), d.placeholder(8), d.placeholder(9))
+		changes := []auditChange{{entity: AuditExchange, id: x.ID, action: AuditCreate, after: x}}
+		for _, leg := range legs {
+			if _, err := tx.Exec(insertLeg, leg.ID, leg.Name, leg.Amount.Units, leg.Currency, leg.Date, leg.Source, leg.Card, leg.AccountID, leg.ExchangeID); err != nil {
+				return fmt.Errorf("failed to save leg of currency exchange: %v", err)
+			}
+			changes = append(changes, auditChange{entity: AuditExpense, id: leg.ID, action: AuditCreate, after: leg})
+		}
+		if err := d.upsertRate(tx, x.effectiveRate()); err != nil {
+			return err
+		}
+		return d.recordAudit(tx, changes...)
+	})
+}
+
+// removeExchange deletes the exchange and both legs for good; the rate it
+// fed into the conversion data stays
+func (d sqlDialect) removeExchange(db *sql.DB, id string) error {
+	return withTx(db, func(tx *sql.Tx) error {
+		x, err := d.getExchange(tx, id)
+		if err != nil {
+			return err
+		}
+		legs, err := d.loadExpenses(tx, []string{x.OutgoingID, x.IncomingID})
+		if err != nil {
+			return err
+		}
+		changes := []auditChange{{entity: AuditExchange, id: id, action: AuditDelete, before: x}}
+		for _, leg := range legs {
+			changes = append(changes, auditChange{entity: AuditExpense, id: leg.ID, action: AuditPurge, before: leg})
+		}
+		if _, err := tx.Exec(fmt.Sprintf(`DELETE FROM expenses WHERE exchange_id = %s`, d.placeholder(1)), id); err != nil {
+			return fmt.Errorf("failed to delete legs of currency exchange: %v", err)
+		}
+		if _, err := tx.Exec(fmt.Sprintf(`DELETE FROM currency_exchanges WHERE id = %s`, d.placeholder(1)), id); err != nil {
+			return fmt.Errorf("failed to delete currency exchange: %v", err)
+		}
+		return d.recordAudit(tx, changes...)
+	})
+}
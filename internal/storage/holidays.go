@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Holiday is a day off besides weekends; recurring rules with a business day
+// adjustment move their occurrences off it
+type Holiday struct {
+	Date time.Time `json:"date"` // midnight UTC
+	Name string    `json:"name"`
+}
+
+// Validate keeps the calendar day of the date as midnight UTC
+func (h *Holiday) Validate() error {
+	if h.Date.IsZero() {
+		return fmt.Errorf("holiday 'date' cannot be empty")
+	}
+	h.Date = calendarDay(h.Date)
+	h.Name = SanitizeString(h.Name)
+	return nil
+}
+
+// calendarDay is the calendar day of t, in its own location, as midnight UTC
+func calendarDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// Holidays are the names of the days off by their calendar day
+type Holidays map[time.Time]string
+
+func NewHolidays(list []Holiday) Holidays {
+	holidays := make(Holidays, len(list))
+	for _, h := range list {
+		holidays[calendarDay(h.Date)] = h.Name
+	}
+	return holidays
+}
+
+// Name returns the holiday on the calendar day of t, if any
+func (h Holidays) Name(t time.Time) (string, bool) {
+	name, ok := h[calendarDay(t)]
+	return name, ok
+}
+
+// IsBusinessDay is false on weekends and holidays
+func (h Holidays) IsBusinessDay(t time.Time) bool {
+	if t.Weekday() == time.Saturday || t.Weekday() == time.Sunday {
+		return false
+	}
+	_, off := h.Name(t)
+	return !off
+}
+
+// adjust moves t to the following or preceding business day
+func (h Holidays) adjust(t time.Time, rule string) time.Time {
+	step := 1
+	if rule == BusinessDayPreceding {
+		step = -1
+	}
+	for range businessDaySlack {
+		if h.IsBusinessDay(t) {
+			break
+		}
+		t = t.AddDate(0, 0, step)
+	}
+	return t
+}
+
+// listHolidays returns every stored holiday by date
+func (d sqlDialect) listHolidays(q interface {
+	Query(string, ...any) (*sql.Rows, error)
+}) ([]Holiday, error) {
+	rows, err := q.Query(`SELECT date, name FROM holidays ORDER BY date`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query holidays: %v", err)
+	}
+	defer rows.Close()
+	var holidays []Holiday
+	for rows.Next() {
+		var h Holiday
+		if err := rows.Scan(&h.Date, &h.Name); err != nil {
+			return nil, fmt.Errorf("failed to scan holiday: %v", err)
+		}
+		h.Date = h.Date.UTC()
+		holidays = append(holidays, h)
+	}
+	return holidays, rows.Err()
+}
+
+// loadHolidays reads the calendar the occurrences of recurring rules move by
+func (d sqlDialect) loadHolidays(q interface {
+	Query(string, ...any) (*sql.Rows, error)
+}) (Holidays, error) {
+	list, err := d.listHolidays(q)
+	if err != nil {
+		return nil, err
+	}
+	return NewHolidays(list), nil
+}
+
+// saveHolidays upserts the holidays in one transaction, replacing the name
+// already stored for a date
+func (d sqlDialect) saveHolidays(db *sql.DB, holidays []Holiday) error {
+	holidays = slices.Clone(holidays)
+	for i := range holidays {
+		if err := holidays[i].Validate(); err != nil {
+			return err
+		}
+	}
+	upsert := fmt.Sprintf(`INSERT INTO holidays (date, name) VALUES (%s, %s)
+		ON CONFLICT (date) DO UPDATE SET name = EXCLUDED.name`,
+		d.placeholder(1), d.placeholder(2))
+	return withTx(db, func(tx *sql.Tx) error {
+		for _, h := range holidays {
+			if _, err := tx.Exec(upsert, h.Date, h.Name); err != nil {
+				return fmt.Errorf("failed to save holiday of %s: %v", h.Date.Format("2006-01-02"), err)
+			}
+		}
+		return nil
+	})
+}
+
+func (d sqlDialect) deleteHoliday(db *sql.DB, date time.Time) error {
+	res, err := db.Exec(fmt.Sprintf(`DELETE FROM holidays WHERE date = %s`, d.placeholder(1)), calendarDay(date))
+	if err != nil {
+		return fmt.Errorf("failed to delete holiday: %v", err)
+	}
+	if rowsAffected, _ := res.RowsAffected(); rowsAffected == 0 {
+		return fmt.Errorf("holiday on %s not found", date.Format("2006-01-02"))
+	}
+	return nil
+}
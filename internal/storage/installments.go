@@ -0,0 +1,373 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// InstallmentPurchase is a purchase on a credit card paid in monthly
+// installments (cuotas). Each installment is kept as an expense of the card,
+// so statements and totals see them, but they only change through the purchase.
+type InstallmentPurchase struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	Category     string    `json:"category"`
+	AccountID    string    `json:"accountId"` // the credit card
+	Currency     string    `json:"currency"`  // taken from the card
+	Total        Money     `json:"total"`     // price of the purchase, positive
+	Interest     Money     `json:"interest"`  // financing cost spread over the installments, zero when interest-free
+	Installments int       `json:"installments"`
+	Date         time.Time `json:"date"` // of the purchase
+	// FirstMonth is the statement month of the first installment, by default
+	// the statement the purchase falls in
+	FirstMonth time.Time `json:"firstMonth"`
+	// PaidOffAt is set once the installments left were charged together
+	PaidOffAt *time.Time `json:"paidOffAt,omitempty"`
+}
+
+const maxInstallments = 120
+
+// Validate sanitizes the name and category and checks the amounts and count;
+// the currency and first month are settled against the card by Schedule
+func (p *InstallmentPurchase) Validate() error {
+	p.Name = SanitizeString(p.Name)
+	if p.Name == "" {
+		return fmt.Errorf("installment purchase 'name' cannot be empty")
+	}
+	p.Category = SanitizeString(p.Category)
+	if p.Category == "" {
+		return fmt.Errorf("installment purchase 'category' cannot be empty")
+	}
+	if p.AccountID == "" {
+		return fmt.Errorf("installment purchase 'accountId' cannot be empty")
+	}
+	if p.Installments < 1 || p.Installments > maxInstallments {
+		return fmt.Errorf("installment purchase 'installments' must be between 1 and %d", maxInstallments)
+	}
+	if p.Total.Sign() <= 0 {
+		return fmt.Errorf("installment purchase 'total' must be positive")
+	}
+	if p.Interest.Sign() < 0 {
+		return fmt.Errorf("installment purchase 'interest' cannot be negative")
+	}
+	if p.Date.IsZero() {
+		return fmt.Errorf("installment purchase 'date' cannot be empty")
+	}
+	if !p.FirstMonth.IsZero() {
+		p.FirstMonth = CPIMonth(p.FirstMonth)
+	}
+	return nil
+}
+
+// Schedule attaches the purchase to its card and returns one expense per
+// installment, assigning ids when missing. An installment is dated on the
+// closing day of its statement month, or on the day of the purchase for a
+// card without a cycle; the total plus interest is split evenly, the
+// leftover minor units going to the first installments.
+func (p *InstallmentPurchase) Schedule(card Account) ([]Expense, error) {
+	if card.Type != AccountTypeCreditCard {
+		return nil, fmt.Errorf("account %s is not a credit card", card.Name)
+	}
+	if card.Archived {
+		return nil, fmt.Errorf("account %s is archived", card.Name)
+	}
+	p.Currency = card.Currency
+	var err error
+	if p.Total, err = p.Total.In(p.Currency); err != nil {
+		return nil, err
+	}
+	if p.Interest, err = p.Interest.In(p.Currency); err != nil {
+		return nil, err
+	}
+	date := p.Date.UTC()
+	purchaseDay := dayIn(date.Year(), date.Month(), date.Day())
+	if p.FirstMonth.IsZero() {
+		p.FirstMonth = CPIMonth(purchaseDay)
+		if card.HasCycle() {
+			closing, _ := card.StatementDates(purchaseDay)
+			p.FirstMonth = CPIMonth(closing)
+		}
+	}
+	if p.ID == "" {
+		p.ID = uuid.New().String()
+	}
+	financed, err := p.Total.Add(p.Interest)
+	if err != nil {
+		return nil, err
+	}
+	n := int64(p.Installments)
+	share, extra := financed.Units/n, financed.Units%n
+	source, cardName := card.legacyFields()
+	expenses := make([]Expense, 0, p.Installments)
+	for k := range p.Installments {
+		month := p.FirstMonth.AddDate(0, k, 0)
+		day := dayIn(month.Year(), month.Month(), date.Day())
+		if card.HasCycle() {
+			day = dayIn(month.Year(), month.Month(), card.ClosingDay)
+		}
+		if k == 0 && day.Before(purchaseDay) {
+			return nil, fmt.Errorf("the first installment of %s would fall before the purchase", p.Name)
+		}
+		units := share
+		if int64(k) < extra {
+			units++
+		}
+		expenses = append(expenses, p.installment(card, source, cardName, Expense{
+			Name:   fmt.Sprintf("%s (%d/%d)", p.Name, k+1, p.Installments),
+			Amount: Money{Units: -units, Scale: financed.Scale},
+			Date:   day.Add(12 * time.Hour),
+		}))
+	}
+	return expenses, nil
+}
+
+// installment fills an expense of the purchase on its card
+func (p InstallmentPurchase) installment(card Account, source, cardName string, e Expense) Expense {
+	e.ID = uuid.New().String()
+	e.InstallmentID = p.ID
+	e.Category = p.Category
+	e.Currency = p.Currency
+	e.AccountID = card.ID
+	e.Source, e.Card = source, cardName
+	e.Type = TransactionTypeExpense
+	e.Version = 1
+	return e
+}
+
+// payoff splits the installments of the purchase into those still to come
+// after date and returns them with the expense charging them all on date
+func (p InstallmentPurchase) payoff(card Account, installments []Expense, date time.Time) ([]Expense, Expense, error) {
+	if p.PaidOffAt != nil {
+		return nil, Expense{}, fmt.Errorf("installment purchase %s is already paid off", p.Name)
+	}
+	var pending []Expense
+	total := Money{Scale: CurrencyDecimals(p.Currency)}
+	for _, e := range installments {
+		if e.Date.After(date) {
+			pending = append(pending, e)
+			var err error
+			if total, err = total.Add(e.Amount); err != nil {
+				return nil, Expense{}, err
+			}
+		}
+	}
+	if len(pending) == 0 {
+		return nil, Expense{}, fmt.Errorf("installment purchase %s has no installments left after %s", p.Name, date.Format(time.DateOnly))
+	}
+	source, cardName := card.legacyFields()
+	charge := p.installment(card, source, cardName, Expense{
+		Name:   fmt.Sprintf("%s (cancelacion anticipada)", p.Name),
+		Amount: total,
+		Date:   date,
+	})
+	return pending, charge, nil
+}
+
+// generatedExpenseError refuses changes to an expense that only changes
+// through the currency exchange or installment purchase it belongs to
+func generatedExpenseError(e Expense) error {
+	switch {
+	case e.ExchangeID != "":
+		return exchangeLegError(e)
+	case e.InstallmentID != "":
+		return fmt.Errorf("expense %s is an installment of purchase %s; change the purchase instead", e.ID, e.InstallmentID)
+	}
+	return nil
+}
+
+const installmentColumns = "id, name, category, account_id, currency, total, interest, installments, date, first_month, paid_off_at"
+
+func scanInstallment(scanner interface{ Scan(...any) error }) (InstallmentPurchase, error) {
+	var p InstallmentPurchase
+	var paidOff sql.NullTime
+	err := scanner.Scan(&p.ID, &p.Name, &p.Category, &p.AccountID, &p.Currency, &p.Total.Units, &p.Interest.Units, &p.Installments, &p.Date, &p.FirstMonth, &paidOff)
+	if err != nil {
+		return InstallmentPurchase{}, err
+	}
+	p.Total.Scale = CurrencyDecimals(p.Currency)
+	p.Interest.Scale = p.Total.Scale
+	p.FirstMonth = CPIMonth(p.FirstMonth)
+	if paidOff.Valid {
+		p.PaidOffAt = &paidOff.Time
+	}
+	return p, nil
+}
+
+// listInstallments returns every installment purchase, newest first
+func (d sqlDialect) listInstallments(db *sql.DB) ([]InstallmentPurchase, error) {
+	rows, err := db.Query(`SELECT ` + installmentColumns + ` FROM installment_purchases ORDER BY date DESC, id DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query installment purchases: %v", err)
+	}
+	defer rows.Close()
+	var purchases []InstallmentPurchase
+	for rows.Next() {
+		p, err := scanInstallment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan installment purchase: %v", err)
+		}
+		purchases = append(purchases, p)
+	}
+	return purchases, rows.Err()
+}
+
+func (d sqlDialect) getInstallment(q interface {
+	QueryRow(string, ...any) *sql.Row
+}, id string) (InstallmentPurchase, error) {
+	query := fmt.Sprintf(`SELECT %s FROM installment_purchases WHERE id = %s`, installmentColumns, d.placeholder(1))
+	p, err := scanInstallment(q.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return InstallmentPurchase{}, fmt.Errorf("installment purchase with ID %s not found", id)
+	} else if err != nil {
+		return InstallmentPurchase{}, fmt.Errorf("failed to get installment purchase: %v", err)
+	}
+	return p, nil
+}
+
+// installmentExpenses loads the expenses of a purchase, oldest first
+func (d sqlDialect) installmentExpenses(tx *sql.Tx, id string) ([]Expense, error) {
+	rows, err := tx.Query(fmt.Sprintf(`SELECT id FROM expenses WHERE installment_id = %s ORDER BY date, id`, d.placeholder(1)), id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query installments: %v", err)
+	}
+	var ids []string
+	for rows.Next() {
+		var expenseID string
+		if err := rows.Scan(&expenseID); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan installment: %v", err)
+		}
+		ids = append(ids, expenseID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return d.loadExpenses(tx, ids)
+}
+
+func (d sqlDialect) insertInstallment(tx *sql.Tx, e Expense) error {
+	if err := d.requireCategory(tx, e.Category); err != nil {
+		return err
+	}
+	insert := fmt.Sprintf(`INSERT INTO expenses (id, recurring_id, name, category, amount, currency, date, source, card, account_id, type, installment_id)
+		VALUES (%s, '', %s, %s, %s, %s, %s, %s, %s, %s, 'expense', %s)`,
+		d.placeholder(1), d.placeholder(2), d.placeholder(3), d.placeholder(4), d.placeholder(5),
+		d.placeholder(6), d.placeholder(7), d.placeholder(8), d.placeholder(9), d.placeholder(10))
+	_, err := tx.Exec(insert, e.ID, e.Name, e.Category, e.Amount.Units, e.Currency, e.Date.UTC(), e.Source, e.Card, e.AccountID, e.InstallmentID)
+	if err != nil {
+		return fmt.Errorf("failed to save installment: %v", err)
+	}
+	return nil
+}
+
+// addInstallment stores the purchase with all its installments in one transaction
+func (d sqlDialect) addInstallment(db *sql.DB, p InstallmentPurchase) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	return withTx(db, func(tx *sql.Tx) error {
+		card, err := d.getAccount(tx, p.AccountID)
+		if err != nil {
+			return err
+		}
+		installments, err := p.Schedule(card)
+		if err != nil {
+			return err
+		}
+		if err := d.requireCurrency(tx, p.Currency); err != nil {
+			return err
+		}
+		if err := d.requireCategory(tx, p.Category); err != nil {
+			return err
+		}
+		insert := fmt.Sprintf(`INSERT INTO installment_purchases (%s) VALUES (%s, %s, %s, %s, %s, %s, %s, %s, %s, %s, NULL)`, installmentColumns,
+			d.placeholder(1), d.placeholder(2), d.placeholder(3), d.placeholder(4), d.placeholder(5),
+			d.placeholder(6), d.placeholder(7), d.placeholder(8), d.placeholder(9), d.placeholder(10))
+		_, err = tx.Exec(insert, p.ID, p.Name, p.Category, p.AccountID, p.Currency, p.Total.Units, p.Interest.Units, p.Installments, p.Date.UTC(), p.FirstMonth.UTC())
+		if err != nil {
+			return fmt.Errorf("failed to save installment purchase: %v", err)
+		}
+		changes := []auditChange{{entity: AuditInstallment, id: p.ID, action: AuditCreate, after: p}}
+		for _, e := range installments {
+			if err := d.insertInstallment(tx, e); err != nil {
+				return err
+			}
+			changes = append(changes, auditChange{entity: AuditExpense, id: e.ID, action: AuditCreate, after: e})
+		}
+		return d.recordAudit(tx, changes...)
+	})
+}
+
+// payOffInstallment replaces the installments after date with a single
+// expense charging them on date
+func (d sqlDialect) payOffInstallment(db *sql.DB, id string, date time.Time) error {
+	date = date.UTC()
+	return withTx(db, func(tx *sql.Tx) error {
+		before, err := d.getInstallment(tx, id)
+		if err != nil {
+			return err
+		}
+		card, err := d.getAccount(tx, before.AccountID)
+		if err != nil {
+			return err
+		}
+		installments, err := d.installmentExpenses(tx, id)
+		if err != nil {
+			return err
+		}
+		pending, charge, err := before.payoff(card, installments, date)
+		if err != nil {
+			return err
+		}
+		after := before
+		after.PaidOffAt = &date
+		var changes []auditChange
+		remove := fmt.Sprintf(`DELETE FROM expenses WHERE id = %s`, d.placeholder(1))
+		for _, e := range pending {
+			if _, err := tx.Exec(remove, e.ID); err != nil {
+				return fmt.Errorf("failed to delete installment: %v", err)
+			}
+			changes = append(changes, auditChange{entity: AuditExpense, id: e.ID, action: AuditPurge, before: e})
+		}
+		if err := d.insertInstallment(tx, charge); err != nil {
+			return err
+		}
+		update := fmt.Sprintf(`UPDATE installment_purchases SET paid_off_at = %s WHERE id = %s`, d.placeholder(1), d.placeholder(2))
+		if _, err := tx.Exec(update, date, id); err != nil {
+			return fmt.Errorf("failed to update installment purchase: %v", err)
+		}
+		changes = append(changes,
+			auditChange{entity: AuditExpense, id: charge.ID, action: AuditCreate, after: charge},
+			auditChange{entity: AuditInstallment, id: id, action: AuditUpdate, detail: "paid off", before: before, after: after})
+		return d.recordAudit(tx, changes...)
+	})
+}
+
+// removeInstallment deletes the purchase and all its installments for good
+func (d sqlDialect) removeInstallment(db *sql.DB, id string) error {
+	return withTx(db, func(tx *sql.Tx) error {
+		p, err := d.getInstallment(tx, id)
+		if err != nil {
+			return err
+		}
+		installments, err := d.installmentExpenses(tx, id)
+		if err != nil {
+			return err
+		}
+		changes := []auditChange{{entity: AuditInstallment, id: id, action: AuditDelete, before: p}}
+		for _, e := range installments {
+			changes = append(changes, auditChange{entity: AuditExpense, id: e.ID, action: AuditPurge, before: e})
+		}
+		if _, err := tx.Exec(fmt.Sprintf(`DELETE FROM expenses WHERE installment_id = %s`, d.placeholder(1)), id); err != nil {
+			return fmt.Errorf("failed to delete installments: %v", err)
+		}
+		if _, err := tx.Exec(fmt.Sprintf(`DELETE FROM installment_purchases WHERE id = %s`, d.placeholder(1)), id); err != nil {
+			return fmt.Errorf("failed to delete installment purchase: %v", err)
+		}
+		return d.recordAudit(tx, changes...)
+	})
+}
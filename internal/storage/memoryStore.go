@@ -0,0 +1,1740 @@
+package storage
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// memoryStore implements the Storage interface in process memory.
+// Nothing is persisted; it backs the conformance suite and the api tests.
+type memoryStore struct {
+	mu        sync.RWMutex
+	config    Config
+	expenses  map[string]Expense
+	recurring map[string]RecurringExpense
+	trash     map[string]TrashedExpense // soft-deleted expenses, out of every listing
+	tags      map[string]struct{}       // catalog, including tags no longer in use
+	audit     []AuditEntry              // oldest first
+	rates     map[rateKey]ExchangeRate
+	cpi       map[cpiKey]CPIIndex
+	holidays  Holidays
+	exchanges map[string]CurrencyExchange
+	accounts  map[string]Account
+
+	installments map[string]InstallmentPurchase
+
+	categoriesVersion int64
+}
+
+func NewMemoryStore() Storage {
+	s := &memoryStore{
+		expenses:  map[string]Expense{},
+		recurring: map[string]RecurringExpense{},
+		trash:     map[string]TrashedExpense{},
+		tags:      map[string]struct{}{},
+		rates:     map[rateKey]ExchangeRate{},
+		cpi:       map[cpiKey]CPIIndex{},
+		holidays:  Holidays{},
+		exchanges: map[string]CurrencyExchange{},
+		accounts:  map[string]Account{},
+
+		installments: map[string]InstallmentPurchase{},
+
+		categoriesVersion: 1,
+	}
+	s.config.SetBaseConfig()
+	s.config.Categories = slices.Clone(defaultCategories)
+	return s
+}
+
+// copies keep callers from mutating stored slices through returned values
+func copyExpense(e Expense) Expense {
+	e.Tags = slices.Clone(e.Tags)
+	if e.Rate != nil {
+		rate := *e.Rate
+		e.Rate = &rate
+	}
+	if e.Occurrence != nil {
+		occurrence := *e.Occurrence
+		e.Occurrence = &occurrence
+	}
+	return e
+}
+
+func copyRecurringExpense(re RecurringExpense) RecurringExpense {
+	re.Tags = slices.Clone(re.Tags)
+	if re.MaterializedThrough != nil {
+		through := *re.MaterializedThrough
+		re.MaterializedThrough = &through
+	}
+	re.AmountChanges = slices.Clone(re.AmountChanges)
+	re.Overrides = slices.Clone(re.Overrides)
+	for i, o := range re.Overrides {
+		if o.Amount != nil {
+			amount := *o.Amount
+			re.Overrides[i].Amount = &amount
+		}
+		if o.Date != nil {
+			date := *o.Date
+			re.Overrides[i].Date = &date
+		}
+	}
+	return re
+}
+
+func (s *memoryStore) Close() error {
+	return nil
+}
+
+// recordLocked appends audit entries; a snapshot that cannot be encoded
+// aborts the change like a failed insert in the SQL stores
+func (s *memoryStore) recordLocked(changes ...auditChange) error {
+	at := time.Now().UTC()
+	var entries []AuditEntry
+	for _, change := range changes {
+		entry, err := change.entry(at)
+		if err != nil {
+			return err
+		}
+		entry.ID = int64(len(s.audit) + len(entries) + 1)
+		entries = append(entries, entry)
+	}
+	s.audit = append(s.audit, entries...)
+	return nil
+}
+
+func (s *memoryStore) GetAuditLog(filter AuditFilter) ([]AuditEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var entries []AuditEntry
+	for i := len(s.audit) - 1; i >= 0; i-- {
+		if filter.Limit > 0 && len(entries) == filter.Limit {
+			break
+		}
+		if filter.Matches(s.audit[i]) {
+			entries = append(entries, s.audit[i])
+		}
+	}
+	return entries, nil
+}
+
+func (s *memoryStore) GetConfig() (*Config, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	config := Config{
+		Categories:        slices.Clone(s.config.Categories),
+		Currency:          s.config.Currency,
+		Currencies:        slices.Clone(s.config.Currencies),
+		StartDate:         s.config.StartDate,
+		RecurringExpenses: s.recurringExpensesLocked(),
+	}
+	return &config, nil
+}
+
+func (s *memoryStore) GetCategories() ([]Category, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.Clone(s.config.Categories), nil
+}
+
+func (s *memoryStore) CategoriesVersion() (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.categoriesVersion, nil
+}
+
+// checkCategoriesVersionLocked mirrors the counter check of the SQL stores;
+// callers bump categoriesVersion once the change is applied
+func (s *memoryStore) checkCategoriesVersionLocked(version int64) error {
+	if version != 0 && version != s.categoriesVersion {
+		return &ConflictError{Entity: AuditCategory, Current: s.categoriesVersion}
+	}
+	return nil
+}
+
+func (s *memoryStore) UpdateCategories(categories []Category, version int64) error {
+	categories, err := normalizeCategoryList(categories)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.checkCategoriesVersionLocked(version); err != nil {
+		return err
+	}
+	for _, cat := range s.config.Categories {
+		if !slices.ContainsFunc(categories, func(c Category) bool { return c.Name == cat.Name }) && s.categoryUsageLocked(cat.Name) > 0 {
+			return fmt.Errorf("category %s is still in use and cannot be removed from the list", cat.Name)
+		}
+	}
+	if err := s.recordLocked(auditChange{entity: AuditCategory, action: AuditUpdate, before: s.config.Categories, after: categories}); err != nil {
+		return err
+	}
+	s.config.Categories = categories
+	s.categoriesVersion++
+	return nil
+}
+
+func (s *memoryStore) categoryIndexLocked(name string) int {
+	return slices.IndexFunc(s.config.Categories, func(c Category) bool { return c.Name == name })
+}
+
+// requireCategoryLocked mirrors the SQL check run before expense and rule writes
+func (s *memoryStore) requireCategoryLocked(name string) error {
+	if s.categoryIndexLocked(name) == -1 {
+		return invalid(fmt.Errorf("category %s not found", name))
+	}
+	return nil
+}
+
+// requireExpenseCategoryLocked mirrors sqlDialect.requireExpenseCategory
+func (s *memoryStore) requireExpenseCategoryLocked(e Expense) error {
+	if e.Type == TransactionTypeTransfer {
+		return nil
+	}
+	return s.requireCategoryLocked(e.Category)
+}
+
+func (s *memoryStore) categoryUsageLocked(name string) int {
+	used := 0
+	for _, e := range s.expenses {
+		if e.Category == name {
+			used++
+		}
+	}
+	// trashed expenses can be restored, so they keep their category in use
+	for _, e := range s.trash {
+		if e.Category == name {
+			used++
+		}
+	}
+	for _, re := range s.recurring {
+		if re.Category == name {
+			used++
+		}
+	}
+	for _, p := range s.installments {
+		if p.Category == name {
+			used++
+		}
+	}
+	return used
+}
+
+// reassignCategoryLocked files every expense, rule and purchase of from under
+// to, recording an update of each with detail
+func (s *memoryStore) reassignCategoryLocked(from, to, detail string) error {
+	if from == to {
+		return nil
+	}
+	var changes []auditChange
+	expenses := map[string]Expense{}
+	for id, e := range s.expenses {
+		if e.Category == from {
+			after := copyExpense(e)
+			after.Category = to
+			after.Version++
+			expenses[id] = after
+			changes = append(changes, auditChange{entity: AuditExpense, id: id, action: AuditUpdate, detail: detail, before: e, after: after})
+		}
+	}
+	trash := map[string]TrashedExpense{}
+	for id, e := range s.trash {
+		if e.Category == from {
+			after := e
+			after.Expense = copyExpense(e.Expense)
+			after.Category = to
+			after.Version++
+			trash[id] = after
+			changes = append(changes, auditChange{entity: AuditExpense, id: id, action: AuditUpdate, detail: detail, before: e.Expense, after: after.Expense})
+		}
+	}
+	rules := map[string]RecurringExpense{}
+	for id, re := range s.recurring {
+		if re.Category == from {
+			after := copyRecurringExpense(re)
+			after.Category = to
+			after.Version++
+			rules[id] = after
+			changes = append(changes, auditChange{entity: AuditRecurring, id: id, action: AuditUpdate, detail: detail, before: re, after: after})
+		}
+	}
+	purchases := map[string]InstallmentPurchase{}
+	for id, p := range s.installments {
+		if p.Category == from {
+			after := p
+			after.Category = to
+			purchases[id] = after
+			changes = append(changes, auditChange{entity: AuditInstallment, id: id, action: AuditUpdate, detail: detail, before: p, after: after})
+		}
+	}
+	if err := s.recordLocked(changes...); err != nil {
+		return err
+	}
+	for id, e := range expenses {
+		s.expenses[id] = e
+	}
+	for id, e := range trash {
+		s.trash[id] = e
+	}
+	for id, re := range rules {
+		s.recurring[id] = re
+	}
+	for id, p := range purchases {
+		s.installments[id] = p
+	}
+	return nil
+}
+
+func (s *memoryStore) RenameCategory(from, to string, version int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.checkCategoriesVersionLocked(version); err != nil {
+		return err
+	}
+	index := s.categoryIndexLocked(from)
+	if index == -1 {
+		return fmt.Errorf("category %s not found", from)
+	}
+	if s.categoryIndexLocked(to) != -1 && from != to {
+		return fmt.Errorf("category %s already exists", to)
+	}
+	categories := slices.Clone(s.config.Categories)
+	categories[index].Name = to
+	for i := range categories {
+		if categories[i].Parent == from {
+			categories[i].Parent = to
+		}
+	}
+	if err := s.recordLocked(auditChange{entity: AuditCategory, id: to, action: AuditRename, before: s.config.Categories[index], after: categories[index]}); err != nil {
+		return err
+	}
+	s.config.Categories = categories
+	s.categoriesVersion++
+	return s.reassignCategoryLocked(from, to, fmt.Sprintf("category %s renamed to %s", from, to))
+}
+
+func (s *memoryStore) DeleteCategory(name, reassignTo string, version int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.checkCategoriesVersionLocked(version); err != nil {
+		return err
+	}
+	index := s.categoryIndexLocked(name)
+	if index == -1 {
+		return fmt.Errorf("category %s not found", name)
+	}
+	if reassignTo == "" {
+		if used := s.categoryUsageLocked(name); used > 0 {
+			return fmt.Errorf("category %s is used by %d expenses and recurring rules", name, used)
+		}
+	} else if reassignTo == name {
+		return fmt.Errorf("category %s cannot be reassigned to itself", name)
+	} else if err := s.requireCategoryLocked(reassignTo); err != nil {
+		return err
+	}
+	if len(s.config.Categories) == 1 {
+		return fmt.Errorf("categories cannot be empty")
+	}
+	change := auditChange{entity: AuditCategory, id: name, action: AuditDelete, before: s.config.Categories[index]}
+	if reassignTo != "" {
+		change.detail = "reassigned to " + reassignTo
+	}
+	if err := s.recordLocked(change); err != nil {
+		return err
+	}
+	parent := s.config.Categories[index].Parent
+	categories := slices.Delete(slices.Clone(s.config.Categories), index, index+1)
+	for i := range categories {
+		if categories[i].Parent == name {
+			categories[i].Parent = parent
+		}
+	}
+	s.config.Categories = categories
+	s.categoriesVersion++
+	if reassignTo != "" {
+		return s.reassignCategoryLocked(name, reassignTo, fmt.Sprintf("category %s deleted, reassigned to %s", name, reassignTo))
+	}
+	return nil
+}
+
+func (s *memoryStore) GetCurrency() (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.config.Currency, nil
+}
+
+func (s *memoryStore) UpdateCurrency(currency string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.requireCurrencyLocked(currency); err != nil {
+		return fmt.Errorf("invalid currency: %s", currency)
+	}
+	return s.updateConfigLocked(func(c *configSnapshot) {
+		c.Currency = currency
+	})
+}
+
+func (s *memoryStore) GetEnabledCurrencies() ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.Clone(s.config.Currencies), nil
+}
+
+func (s *memoryStore) UpdateEnabledCurrencies(codes []string) error {
+	codes, err := NormalizeCurrencyList(codes)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !slices.Contains(codes, s.config.Currency) {
+		return fmt.Errorf("currency %s is the base currency and cannot be disabled", s.config.Currency)
+	}
+	var used []string
+	for _, e := range s.expenses {
+		used = append(used, e.Currency)
+	}
+	for _, t := range s.trash {
+		used = append(used, t.Currency)
+	}
+	for _, re := range s.recurring {
+		used = append(used, re.Currency)
+	}
+	for _, a := range s.accounts {
+		used = append(used, a.Currency)
+	}
+	for _, code := range used {
+		if !slices.Contains(codes, code) {
+			return fmt.Errorf("currency %s is still in use and cannot be disabled", code)
+		}
+	}
+	if err := s.recordLocked(auditChange{entity: AuditConfig, id: "currencies", action: AuditUpdate, before: s.config.Currencies, after: codes}); err != nil {
+		return err
+	}
+	s.config.Currencies = codes
+	return nil
+}
+
+// requireCurrencyLocked mirrors the SQL check run before expense and rule writes
+func (s *memoryStore) requireCurrencyLocked(code string) error {
+	if !slices.Contains(s.config.Currencies, code) {
+		return invalid(fmt.Errorf("currency %s is not enabled", code))
+	}
+	return nil
+}
+
+func (s *memoryStore) GetStartDate() (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.config.StartDate, nil
+}
+
+func (s *memoryStore) UpdateStartDate(startDate int) error {
+	if startDate < 1 || startDate > 31 {
+		return fmt.Errorf("invalid start date: %d", startDate)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.updateConfigLocked(func(c *configSnapshot) {
+		c.StartDate = startDate
+	})
+}
+
+func (s *memoryStore) updateConfigLocked(updater func(c *configSnapshot)) error {
+	before := configSnapshot{Currency: s.config.Currency, StartDate: s.config.StartDate}
+	after := before
+	updater(&after)
+	if err := s.recordLocked(auditChange{entity: AuditConfig, action: AuditUpdate, before: before, after: after}); err != nil {
+		return err
+	}
+	s.config.Currency, s.config.StartDate = after.Currency, after.StartDate
+	return nil
+}
+
+func (s *memoryStore) GetAllExpenses() ([]Expense, error) {
+	return s.QueryExpenses(ExpenseFilter{})
+}
+
+func (s *memoryStore) QueryExpenses(filter ExpenseFilter) ([]Expense, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.queryLocked(filter, nil), nil
+}
+
+func (s *memoryStore) QueryExpensesPage(filter ExpenseFilter, after *ExpenseCursor, limit int) (ExpensePage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return pageOf(s.queryLocked(filter, after), limit), nil
+}
+
+func (s *memoryStore) SumExpensesByCategory(filter ExpenseFilter) ([]CategorySum, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	index := map[[2]string]int{}
+	var sums []CategorySum
+	for _, e := range s.queryLocked(filter, nil) {
+		key := [2]string{e.Category, e.Currency}
+		i, ok := index[key]
+		if !ok {
+			i = len(sums)
+			index[key] = i
+			sums = append(sums, CategorySum{Category: e.Category, Currency: e.Currency, Amount: Money{Scale: CurrencyDecimals(e.Currency)}})
+		}
+		amount, err := sums[i].Amount.Add(e.Amount)
+		if err != nil {
+			return nil, err
+		}
+		sums[i].Amount = amount
+		sums[i].Count++
+	}
+	slices.SortFunc(sums, func(a, b CategorySum) int {
+		return cmp.Or(strings.Compare(a.Category, b.Category), strings.Compare(a.Currency, b.Currency))
+	})
+	return sums, nil
+}
+
+// StreamExpenses works on a snapshot so fn runs without holding the lock
+func (s *memoryStore) StreamExpenses(filter ExpenseFilter, fn func(Expense) error) error {
+	expenses, _ := s.QueryExpenses(filter)
+	for _, e := range expenses {
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// queryLocked returns copies of the matching expenses in listing order
+func (s *memoryStore) queryLocked(filter ExpenseFilter, after *ExpenseCursor) []Expense {
+	var expenses []Expense
+	for _, e := range s.expenses {
+		if filter.Matches(e) && (after == nil || after.precedes(e)) {
+			expenses = append(expenses, copyExpense(e))
+		}
+	}
+	slices.SortFunc(expenses, compareExpenses)
+	return expenses
+}
+
+func (s *memoryStore) GetExpense(id string) (Expense, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	expense, ok := s.expenses[id]
+	if !ok {
+		return Expense{}, fmt.Errorf("expense with ID %s not found", id)
+	}
+	return copyExpense(expense), nil
+}
+
+// registerTagsLocked normalizes tags the way the SQL link tables do and adds them to the catalog
+func (s *memoryStore) registerTagsLocked(tags []string) []string {
+	tags = normalizeTags(tags)
+	for _, tag := range tags {
+		s.tags[tag] = struct{}{}
+	}
+	return tags
+}
+
+// rewriteTagsLocked maps every tag of every expense and rule, recording an
+// update of each one that changes; mapping to "" drops the tag
+func (s *memoryStore) rewriteTagsLocked(detail string, rewrite func(tag string) string) error {
+	apply := func(tags []string) []string {
+		var out []string
+		for _, tag := range tags {
+			out = append(out, rewrite(tag))
+		}
+		return normalizeTags(out)
+	}
+	var changes []auditChange
+	expenses := map[string]Expense{}
+	for id, e := range s.expenses {
+		if tags := apply(e.Tags); !slices.Equal(tags, e.Tags) {
+			after := copyExpense(e)
+			after.Tags = tags
+			after.Version++
+			expenses[id] = after
+			changes = append(changes, auditChange{entity: AuditExpense, id: id, action: AuditUpdate, detail: detail, before: e, after: after})
+		}
+	}
+	trash := map[string]TrashedExpense{}
+	for id, e := range s.trash {
+		if tags := apply(e.Tags); !slices.Equal(tags, e.Tags) {
+			after := e
+			after.Expense = copyExpense(e.Expense)
+			after.Tags = tags
+			after.Version++
+			trash[id] = after
+			changes = append(changes, auditChange{entity: AuditExpense, id: id, action: AuditUpdate, detail: detail, before: e.Expense, after: after.Expense})
+		}
+	}
+	rules := map[string]RecurringExpense{}
+	for id, re := range s.recurring {
+		if tags := apply(re.Tags); !slices.Equal(tags, re.Tags) {
+			after := copyRecurringExpense(re)
+			after.Tags = tags
+			after.Version++
+			rules[id] = after
+			changes = append(changes, auditChange{entity: AuditRecurring, id: id, action: AuditUpdate, detail: detail, before: re, after: after})
+		}
+	}
+	if err := s.recordLocked(changes...); err != nil {
+		return err
+	}
+	for id, e := range expenses {
+		s.expenses[id] = e
+	}
+	for id, e := range trash {
+		s.trash[id] = e
+	}
+	for id, re := range rules {
+		s.recurring[id] = re
+	}
+	return nil
+}
+
+func (s *memoryStore) GetTags() ([]Tag, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	counts := map[string]*Tag{}
+	for name := range s.tags {
+		counts[name] = &Tag{Name: name}
+	}
+	for _, e := range s.expenses {
+		for _, tag := range e.Tags {
+			counts[tag].Count++
+		}
+	}
+	for _, re := range s.recurring {
+		for _, tag := range re.Tags {
+			counts[tag].RecurringCount++
+		}
+	}
+	var tags []Tag
+	for _, tag := range counts {
+		tags = append(tags, *tag)
+	}
+	slices.SortFunc(tags, func(a, b Tag) int { return strings.Compare(a.Name, b.Name) })
+	return tags, nil
+}
+
+func (s *memoryStore) AddTag(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.registerTagsLocked([]string{name})
+	return nil
+}
+
+func (s *memoryStore) RenameTag(from, to string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tags[from]; !ok {
+		return fmt.Errorf("tag %s not found", from)
+	}
+	if _, ok := s.tags[to]; ok && from != to {
+		return fmt.Errorf("tag %s already exists", to)
+	}
+	err := s.rewriteTagsLocked(fmt.Sprintf("tag %s renamed to %s", from, to), func(tag string) string {
+		if tag == from {
+			return to
+		}
+		return tag
+	})
+	if err != nil {
+		return err
+	}
+	delete(s.tags, from)
+	s.tags[to] = struct{}{}
+	return nil
+}
+
+func (s *memoryStore) MergeTags(sources []string, target string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, source := range sources {
+		if _, ok := s.tags[source]; !ok {
+			return fmt.Errorf("tag %s not found", source)
+		}
+	}
+	err := s.rewriteTagsLocked(mergeDetail(sources, target), func(tag string) string {
+		if slices.Contains(sources, tag) {
+			return target
+		}
+		return tag
+	})
+	if err != nil {
+		return err
+	}
+	for _, source := range sources {
+		delete(s.tags, source)
+	}
+	s.tags[target] = struct{}{}
+	return nil
+}
+
+func (s *memoryStore) DeleteTag(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tags[name]; !ok {
+		return fmt.Errorf("tag %s not found", name)
+	}
+	err := s.rewriteTagsLocked(fmt.Sprintf("tag %s deleted", name), func(tag string) string {
+		if tag == name {
+			return ""
+		}
+		return tag
+	})
+	if err != nil {
+		return err
+	}
+	delete(s.tags, name)
+	return nil
+}
+
+func (s *memoryStore) AddExpense(expense Expense) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addExpenseLocked(expense)
+}
+
+func (s *memoryStore) addExpenseLocked(expense Expense) error {
+	if expense.ID == "" {
+		expense.ID = uuid.New().String()
+	}
+	if _, exists := s.expenses[expense.ID]; exists {
+		return fmt.Errorf("expense with ID %s already exists", expense.ID)
+	}
+	if _, trashed := s.trash[expense.ID]; trashed {
+		return fmt.Errorf("expense with ID %s already exists in trash", expense.ID)
+	}
+	if err := expense.normalizeType(); err != nil {
+		return invalid(err)
+	}
+	if err := s.requireExpenseCategoryLocked(expense); err != nil {
+		return err
+	}
+	if expense.Currency == "" {
+		expense.Currency = s.config.Currency
+	}
+	if err := expense.normalizeAmount(); err != nil {
+		return invalid(err)
+	}
+	if err := s.requireCurrencyLocked(expense.Currency); err != nil {
+		return err
+	}
+	if err := expense.validateLockedRate(s.config.Currency); err != nil {
+		return invalid(err)
+	}
+	if err := s.resolveAccountLocked(&expense, Expense{}); err != nil {
+		return err
+	}
+	if expense.Date.IsZero() {
+		expense.Date = time.Now()
+	}
+	expense.Tags = s.registerTagsLocked(expense.Tags)
+	expense.Version = 1
+	// legs and installments only come in through their exchange or purchase
+	expense.ExchangeID, expense.InstallmentID = "", ""
+	if err := s.recordLocked(auditChange{entity: AuditExpense, id: expense.ID, action: AuditCreate, after: expense}); err != nil {
+		return err
+	}
+	s.expenses[expense.ID] = copyExpense(expense)
+	return nil
+}
+
+func (s *memoryStore) UpdateExpense(id string, expense Expense) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	before, ok := s.expenses[id]
+	if !ok {
+		return fmt.Errorf("expense with ID %s not found", id)
+	}
+	if err := generatedExpenseError(before); err != nil {
+		return err
+	}
+	if err := s.ruleOccurrenceLocked(before); err != nil {
+		return err
+	}
+	if err := expense.normalizeType(); err != nil {
+		return invalid(err)
+	}
+	if err := s.requireExpenseCategoryLocked(expense); err != nil {
+		return err
+	}
+	if expense.Version != 0 && expense.Version != before.Version {
+		return &ConflictError{Entity: AuditExpense, ID: id, Current: before.Version}
+	}
+	expense.Version = before.Version + 1
+	if expense.Currency == "" {
+		expense.Currency = s.config.Currency
+	}
+	if err := expense.normalizeAmount(); err != nil {
+		return invalid(err)
+	}
+	if err := s.requireCurrencyLocked(expense.Currency); err != nil {
+		return err
+	}
+	if err := expense.validateLockedRate(s.config.Currency); err != nil {
+		return invalid(err)
+	}
+	if err := s.resolveAccountLocked(&expense, before); err != nil {
+		return err
+	}
+	expense.ID = id
+	expense.ExchangeID, expense.InstallmentID = "", ""
+	expense.Tags = s.registerTagsLocked(expense.Tags)
+	if err := s.recordLocked(auditChange{entity: AuditExpense, id: id, action: AuditUpdate, before: before, after: expense}); err != nil {
+		return err
+	}
+	s.expenses[id] = copyExpense(expense)
+	return nil
+}
+
+// ruleOccurrenceLocked mirrors the SQL check refusing changes to an
+// occurrence of a rule that still exists
+func (s *memoryStore) ruleOccurrenceLocked(e Expense) error {
+	if _, ok := s.recurring[e.RecurringID]; e.RecurringID != "" && ok {
+		return occurrenceError(e)
+	}
+	return nil
+}
+
+// RemoveExpense moves an expense to the trash
+func (s *memoryStore) RemoveExpense(id string, version int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.expenses[id]
+	if !ok {
+		return fmt.Errorf("expense with ID %s not found", id)
+	}
+	if version != 0 && version != e.Version {
+		return &ConflictError{Entity: AuditExpense, ID: id, Current: e.Version}
+	}
+	return s.trashLocked([]string{id}, time.Now())
+}
+
+// trashLocked moves the live expenses among ids to the trash, skipping the rest
+func (s *memoryStore) trashLocked(ids []string, now time.Time) error {
+	var changes []auditChange
+	for _, id := range ids {
+		if e, ok := s.expenses[id]; ok {
+			if err := generatedExpenseError(e); err != nil {
+				return err
+			}
+			if err := s.ruleOccurrenceLocked(e); err != nil {
+				return err
+			}
+			changes = append(changes, auditChange{entity: AuditExpense, id: id, action: AuditDelete, before: e})
+		}
+	}
+	if err := s.recordLocked(changes...); err != nil {
+		return err
+	}
+	for _, change := range changes {
+		s.trash[change.id] = TrashedExpense{Expense: s.expenses[change.id], DeletedAt: now}
+		delete(s.expenses, change.id)
+	}
+	return nil
+}
+
+func (s *memoryStore) AddMultipleExpenses(expenses []Expense) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// a failure midway leaves nothing behind, like the SQL transaction
+	mark, tags := len(s.audit), maps.Clone(s.tags)
+	for _, exp := range expenses {
+		if err := s.addExpenseLocked(exp); err != nil {
+			s.undoCreatesLocked(mark, tags)
+			return err
+		}
+	}
+	return nil
+}
+
+// undoCreatesLocked drops the expenses and accounts created since the audit
+// log held mark entries and puts back the tag catalog
+func (s *memoryStore) undoCreatesLocked(mark int, tags map[string]struct{}) {
+	for _, entry := range s.audit[mark:] {
+		switch entry.Entity {
+		case AuditExpense:
+			delete(s.expenses, entry.EntityID)
+		case AuditAccount:
+			delete(s.accounts, entry.EntityID)
+		}
+	}
+	s.audit = s.audit[:mark]
+	s.tags = tags
+}
+
+func (s *memoryStore) RemoveMultipleExpenses(ids []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.trashLocked(ids, time.Now())
+}
+
+func (s *memoryStore) GetTrash() ([]TrashedExpense, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var trash []TrashedExpense
+	for _, e := range s.trash {
+		e.Expense = copyExpense(e.Expense)
+		trash = append(trash, e)
+	}
+	slices.SortFunc(trash, func(a, b TrashedExpense) int {
+		return cmp.Or(b.DeletedAt.Compare(a.DeletedAt), strings.Compare(b.ID, a.ID))
+	})
+	return trash, nil
+}
+
+// requireTrashedLocked mirrors the all-or-nothing check of the SQL stores
+func (s *memoryStore) requireTrashedLocked(ids []string) error {
+	missing := 0
+	for _, id := range ids {
+		if _, ok := s.trash[id]; !ok {
+			missing++
+		}
+	}
+	if missing > 0 {
+		return fmt.Errorf("%d of %d expenses not found in trash", missing, len(ids))
+	}
+	return nil
+}
+
+func (s *memoryStore) RestoreExpenses(ids []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.requireTrashedLocked(ids); err != nil {
+		return err
+	}
+	changes := make([]auditChange, len(ids))
+	for i, id := range ids {
+		changes[i] = auditChange{entity: AuditExpense, id: id, action: AuditRestore, after: s.trash[id].Expense}
+	}
+	if err := s.recordLocked(changes...); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		s.expenses[id] = s.trash[id].Expense
+		delete(s.trash, id)
+	}
+	return nil
+}
+
+func (s *memoryStore) PurgeExpenses(ids []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.requireTrashedLocked(ids); err != nil {
+		return err
+	}
+	return s.purgeLocked(ids)
+}
+
+func (s *memoryStore) purgeLocked(ids []string) error {
+	changes := make([]auditChange, len(ids))
+	for i, id := range ids {
+		changes[i] = auditChange{entity: AuditExpense, id: id, action: AuditPurge, before: s.trash[id].Expense}
+	}
+	if err := s.recordLocked(changes...); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		delete(s.trash, id)
+	}
+	return nil
+}
+
+func (s *memoryStore) PurgeTrash(before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ids []string
+	for id, e := range s.trash {
+		if e.DeletedAt.Before(before) {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	if err := s.purgeLocked(ids); err != nil {
+		return 0, err
+	}
+	return len(ids), nil
+}
+
+// rateKey identifies the rate of a pair on one day
+type rateKey struct {
+	currency, quote string
+	date            time.Time
+}
+
+func (s *memoryStore) GetExchangeRates() ([]ExchangeRate, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rates := make([]ExchangeRate, 0, len(s.rates))
+	for _, rate := range s.rates {
+		rates = append(rates, rate)
+	}
+	slices.SortFunc(rates, compareRates)
+	return rates, nil
+}
+
+func (s *memoryStore) SaveExchangeRates(rates []ExchangeRate) error {
+	rates = slices.Clone(rates)
+	for i := range rates {
+		if err := rates[i].Validate(); err != nil {
+			return err
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, rate := range rates {
+		s.rates[rateKey{rate.Currency, rate.Quote, rate.Date}] = rate
+	}
+	return nil
+}
+
+func (s *memoryStore) DeleteExchangeRate(date time.Time, currency, quote string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := rateKey{strings.ToLower(currency), strings.ToLower(quote), rateDay(date)}
+	if _, ok := s.rates[key]; !ok {
+		return fmt.Errorf("exchange rate %s/%s on %s not found", currency, quote, date.Format(time.DateOnly))
+	}
+	delete(s.rates, key)
+	return nil
+}
+
+type cpiKey struct {
+	currency string
+	month    time.Time
+}
+
+func (s *memoryStore) GetCPIIndexes() ([]CPIIndex, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	indexes := make([]CPIIndex, 0, len(s.cpi))
+	for _, index := range s.cpi {
+		indexes = append(indexes, index)
+	}
+	slices.SortFunc(indexes, compareCPIIndexes)
+	return indexes, nil
+}
+
+func (s *memoryStore) SaveCPIIndexes(indexes []CPIIndex) error {
+	indexes = slices.Clone(indexes)
+	for i := range indexes {
+		if err := indexes[i].Validate(); err != nil {
+			return err
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, index := range indexes {
+		s.cpi[cpiKey{index.Currency, index.Month}] = index
+	}
+	return nil
+}
+
+func (s *memoryStore) DeleteCPIIndex(currency string, month time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := cpiKey{strings.ToLower(currency), CPIMonth(month)}
+	if _, ok := s.cpi[key]; !ok {
+		return fmt.Errorf("cpi index of %s for %s not found", currency, month.Format("2006-01"))
+	}
+	delete(s.cpi, key)
+	return nil
+}
+
+func (s *memoryStore) GetHolidays() ([]Holiday, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	holidays := make([]Holiday, 0, len(s.holidays))
+	for date, name := range s.holidays {
+		holidays = append(holidays, Holiday{Date: date, Name: name})
+	}
+	slices.SortFunc(holidays, func(a, b Holiday) int { return a.Date.Compare(b.Date) })
+	return holidays, nil
+}
+
+func (s *memoryStore) SaveHolidays(holidays []Holiday) error {
+	holidays = slices.Clone(holidays)
+	for i := range holidays {
+		if err := holidays[i].Validate(); err != nil {
+			return err
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, h := range holidays {
+		s.holidays[h.Date] = h.Name
+	}
+	return nil
+}
+
+func (s *memoryStore) DeleteHoliday(date time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	day := calendarDay(date)
+	if _, ok := s.holidays[day]; !ok {
+		return fmt.Errorf("holiday on %s not found", date.Format("2006-01-02"))
+	}
+	delete(s.holidays, day)
+	return nil
+}
+
+func (s *memoryStore) GetCurrencyExchanges() ([]CurrencyExchange, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var exchanges []CurrencyExchange
+	for _, x := range s.exchanges {
+		exchanges = append(exchanges, x)
+	}
+	slices.SortFunc(exchanges, func(a, b CurrencyExchange) int {
+		return cmp.Or(b.Date.Compare(a.Date), strings.Compare(b.ID, a.ID))
+	})
+	return exchanges, nil
+}
+
+func (s *memoryStore) GetCurrencyExchange(id string) (CurrencyExchange, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	x, ok := s.exchanges[id]
+	if !ok {
+		return CurrencyExchange{}, fmt.Errorf("currency exchange with ID %s not found", id)
+	}
+	return x, nil
+}
+
+func (s *memoryStore) AddCurrencyExchange(exchange CurrencyExchange) error {
+	if err := exchange.Validate(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, currency := range []string{exchange.FromCurrency, exchange.ToCurrency} {
+		if err := s.requireCurrencyLocked(currency); err != nil {
+			return err
+		}
+	}
+	legs := exchange.legs()
+	err := exchange.attachAccounts(legs, func(id string) (Account, error) {
+		a, ok := s.accounts[id]
+		if !ok {
+			return Account{}, invalid(fmt.Errorf("account with ID %s not found", id))
+		}
+		return a, nil
+	})
+	if err != nil {
+		return err
+	}
+	if _, exists := s.exchanges[exchange.ID]; exists {
+		return fmt.Errorf("currency exchange with ID %s already exists", exchange.ID)
+	}
+	changes := []auditChange{{entity: AuditExchange, id: exchange.ID, action: AuditCreate, after: exchange}}
+	for _, leg := range legs {
+		if _, exists := s.expenses[leg.ID]; exists {
+			return fmt.Errorf("expense with ID %s already exists", leg.ID)
+		}
+		changes = append(changes, auditChange{entity: AuditExpense, id: leg.ID, action: AuditCreate, after: leg})
+	}
+	if err := s.recordLocked(changes...); err != nil {
+		return err
+	}
+	for _, leg := range legs {
+		s.expenses[leg.ID] = leg
+	}
+	s.exchanges[exchange.ID] = exchange
+	rate := exchange.effectiveRate()
+	s.rates[rateKey{rate.Currency, rate.Quote, rate.Date}] = rate
+	return nil
+}
+
+// RemoveCurrencyExchange deletes the exchange and both legs for good; the
+// rate it fed into the conversion data stays
+func (s *memoryStore) RemoveCurrencyExchange(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	x, ok := s.exchanges[id]
+	if !ok {
+		return fmt.Errorf("currency exchange with ID %s not found", id)
+	}
+	changes := []auditChange{{entity: AuditExchange, id: id, action: AuditDelete, before: x}}
+	for _, legID := range []string{x.OutgoingID, x.IncomingID} {
+		if leg, ok := s.expenses[legID]; ok {
+			changes = append(changes, auditChange{entity: AuditExpense, id: legID, action: AuditPurge, before: leg})
+		}
+	}
+	if err := s.recordLocked(changes...); err != nil {
+		return err
+	}
+	delete(s.expenses, x.OutgoingID)
+	delete(s.expenses, x.IncomingID)
+	delete(s.exchanges, id)
+	return nil
+}
+
+func (s *memoryStore) GetInstallmentPurchases() ([]InstallmentPurchase, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var purchases []InstallmentPurchase
+	for _, p := range s.installments {
+		purchases = append(purchases, p)
+	}
+	slices.SortFunc(purchases, func(a, b InstallmentPurchase) int {
+		return cmp.Or(b.Date.Compare(a.Date), strings.Compare(b.ID, a.ID))
+	})
+	return purchases, nil
+}
+
+func (s *memoryStore) GetInstallmentPurchase(id string) (InstallmentPurchase, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	p, ok := s.installments[id]
+	if !ok {
+		return InstallmentPurchase{}, fmt.Errorf("installment purchase with ID %s not found", id)
+	}
+	return p, nil
+}
+
+func (s *memoryStore) AddInstallmentPurchase(purchase InstallmentPurchase) error {
+	if err := purchase.Validate(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	card, ok := s.accounts[purchase.AccountID]
+	if !ok {
+		return fmt.Errorf("account with ID %s not found", purchase.AccountID)
+	}
+	installments, err := purchase.Schedule(card)
+	if err != nil {
+		return err
+	}
+	if err := s.requireCurrencyLocked(purchase.Currency); err != nil {
+		return err
+	}
+	if err := s.requireCategoryLocked(purchase.Category); err != nil {
+		return err
+	}
+	if _, exists := s.installments[purchase.ID]; exists {
+		return fmt.Errorf("installment purchase with ID %s already exists", purchase.ID)
+	}
+	changes := []auditChange{{entity: AuditInstallment, id: purchase.ID, action: AuditCreate, after: purchase}}
+	for _, e := range installments {
+		changes = append(changes, auditChange{entity: AuditExpense, id: e.ID, action: AuditCreate, after: e})
+	}
+	if err := s.recordLocked(changes...); err != nil {
+		return err
+	}
+	for _, e := range installments {
+		s.expenses[e.ID] = e
+	}
+	s.installments[purchase.ID] = purchase
+	return nil
+}
+
+// installmentsLocked returns the expenses of a purchase, oldest first
+func (s *memoryStore) installmentsLocked(id string) []Expense {
+	var installments []Expense
+	for _, e := range s.expenses {
+		if e.InstallmentID == id {
+			installments = append(installments, e)
+		}
+	}
+	slices.SortFunc(installments, func(a, b Expense) int {
+		return cmp.Or(a.Date.Compare(b.Date), strings.Compare(a.ID, b.ID))
+	})
+	return installments
+}
+
+// PayOffInstallmentPurchase replaces the installments after date with a
+// single expense charging them on date
+func (s *memoryStore) PayOffInstallmentPurchase(id string, date time.Time) error {
+	date = date.UTC()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	before, ok := s.installments[id]
+	if !ok {
+		return fmt.Errorf("installment purchase with ID %s not found", id)
+	}
+	card, ok := s.accounts[before.AccountID]
+	if !ok {
+		return fmt.Errorf("account with ID %s not found", before.AccountID)
+	}
+	pending, charge, err := before.payoff(card, s.installmentsLocked(id), date)
+	if err != nil {
+		return err
+	}
+	if err := s.requireCategoryLocked(charge.Category); err != nil {
+		return err
+	}
+	after := before
+	after.PaidOffAt = &date
+	var changes []auditChange
+	for _, e := range pending {
+		changes = append(changes, auditChange{entity: AuditExpense, id: e.ID, action: AuditPurge, before: e})
+	}
+	changes = append(changes,
+		auditChange{entity: AuditExpense, id: charge.ID, action: AuditCreate, after: charge},
+		auditChange{entity: AuditInstallment, id: id, action: AuditUpdate, detail: "paid off", before: before, after: after})
+	if err := s.recordLocked(changes...); err != nil {
+		return err
+	}
+	for _, e := range pending {
+		delete(s.expenses, e.ID)
+	}
+	s.expenses[charge.ID] = charge
+	s.installments[id] = after
+	return nil
+}
+
+// RemoveInstallmentPurchase deletes the purchase and all its installments for good
+func (s *memoryStore) RemoveInstallmentPurchase(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.installments[id]
+	if !ok {
+		return fmt.Errorf("installment purchase with ID %s not found", id)
+	}
+	installments := s.installmentsLocked(id)
+	changes := []auditChange{{entity: AuditInstallment, id: id, action: AuditDelete, before: p}}
+	for _, e := range installments {
+		changes = append(changes, auditChange{entity: AuditExpense, id: e.ID, action: AuditPurge, before: e})
+	}
+	if err := s.recordLocked(changes...); err != nil {
+		return err
+	}
+	for _, e := range installments {
+		delete(s.expenses, e.ID)
+	}
+	delete(s.installments, id)
+	return nil
+}
+
+func (s *memoryStore) accountsLocked() []Account {
+	var accounts []Account
+	for _, a := range s.accounts {
+		accounts = append(accounts, a)
+	}
+	slices.SortFunc(accounts, compareAccounts)
+	return accounts
+}
+
+func (s *memoryStore) GetAccounts() ([]Account, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.accountsLocked(), nil
+}
+
+func (s *memoryStore) GetAccount(id string) (Account, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	a, ok := s.accounts[id]
+	if !ok {
+		return Account{}, fmt.Errorf("account with ID %s not found", id)
+	}
+	return a, nil
+}
+
+func (s *memoryStore) AddAccount(account Account) error {
+	if err := account.Validate(); err != nil {
+		return err
+	}
+	if account.ID == "" {
+		account.ID = uuid.New().String()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.accounts[account.ID]; exists {
+		return fmt.Errorf("account with ID %s already exists", account.ID)
+	}
+	if err := s.requireCurrencyLocked(account.Currency); err != nil {
+		return err
+	}
+	if err := requireUniqueAccount(s.accountsLocked(), account); err != nil {
+		return err
+	}
+	if err := s.recordLocked(auditChange{entity: AuditAccount, id: account.ID, action: AuditCreate, after: account}); err != nil {
+		return err
+	}
+	s.accounts[account.ID] = account
+	return nil
+}
+
+// accountUsageLocked counts the expenses of an account, trashed ones and
+// recurring rules included
+func (s *memoryStore) accountUsageLocked(id string) int {
+	used := 0
+	for _, re := range s.recurring {
+		if re.AccountID == id {
+			used++
+		}
+	}
+	for _, e := range s.expenses {
+		if e.AccountID == id || e.ToAccountID == id {
+			used++
+		}
+	}
+	for _, t := range s.trash {
+		if t.AccountID == id || t.ToAccountID == id {
+			used++
+		}
+	}
+	return used
+}
+
+func (s *memoryStore) UpdateAccount(id string, account Account) error {
+	if err := account.Validate(); err != nil {
+		return err
+	}
+	account.ID = id
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	before, ok := s.accounts[id]
+	if !ok {
+		return fmt.Errorf("account with ID %s not found", id)
+	}
+	if account.Currency != before.Currency {
+		if used := s.accountUsageLocked(id); used > 0 {
+			return fmt.Errorf("account %s is used by %d expenses; its currency cannot change", before.Name, used)
+		}
+		if err := s.requireCurrencyLocked(account.Currency); err != nil {
+			return err
+		}
+	}
+	if err := requireUniqueAccount(s.accountsLocked(), account); err != nil {
+		return err
+	}
+	if err := s.recordLocked(auditChange{entity: AuditAccount, id: id, action: AuditUpdate, before: before, after: account}); err != nil {
+		return err
+	}
+	s.accounts[id] = account
+	source, card := account.legacyFields()
+	for eid, e := range s.expenses {
+		if e.AccountID == id && (e.Source != source || e.Card != card) {
+			e.Source, e.Card = source, card
+			e.Version++
+			s.expenses[eid] = e
+		}
+	}
+	for eid, t := range s.trash {
+		if t.AccountID == id && (t.Source != source || t.Card != card) {
+			t.Source, t.Card = source, card
+			t.Version++
+			s.trash[eid] = t
+		}
+	}
+	for rid, re := range s.recurring {
+		if re.AccountID == id && (re.Source != source || re.Card != card) {
+			re.Source, re.Card = source, card
+			re.Version++
+			s.recurring[rid] = re
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) DeleteAccount(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	before, ok := s.accounts[id]
+	if !ok {
+		return fmt.Errorf("account with ID %s not found", id)
+	}
+	if used := s.accountUsageLocked(id); used > 0 {
+		return fmt.Errorf("account %s is used by %d expenses; archive it instead", before.Name, used)
+	}
+	if err := s.recordLocked(auditChange{entity: AuditAccount, id: id, action: AuditDelete, before: before}); err != nil {
+		return err
+	}
+	delete(s.accounts, id)
+	return nil
+}
+
+func (s *memoryStore) GetAccountBalances() ([]AccountBalance, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var balances []AccountBalance
+	for _, a := range s.accountsLocked() {
+		balance := AccountBalance{Account: a, Balance: a.OpeningBalance}
+		for _, e := range s.expenses {
+			if e.AccountID == a.ID || e.ToAccountID == a.ID {
+				balance.Balance.Units += e.AccountAmount(a.ID).Units
+				balance.Count++
+			}
+		}
+		balances = append(balances, balance)
+	}
+	return balances, nil
+}
+
+// resolveAccountLocked mirrors sqlDialect.resolveAccount
+func (s *memoryStore) resolveAccountLocked(e *Expense, current Expense) error {
+	if e.Type == TransactionTypeTransfer {
+		to, ok := s.accounts[e.ToAccountID]
+		if !ok {
+			return invalid(fmt.Errorf("account with ID %s not found", e.ToAccountID))
+		}
+		if err := attachDestination(e, to, current.ToAccountID); err != nil {
+			return err
+		}
+	}
+	if e.AccountID == "" {
+		legacy, ok := legacyAccount(e.Source, e.Card, e.Currency)
+		if !ok {
+			e.Source, e.Card = "", ""
+			return nil
+		}
+		a, found := findAccount(s.accountsLocked(), legacy.Name, legacy.Currency)
+		if !found {
+			a = legacy
+			a.ID = uuid.New().String()
+			a.OpeningBalance = Money{Scale: CurrencyDecimals(a.Currency)}
+			if err := s.recordLocked(auditChange{entity: AuditAccount, id: a.ID, action: AuditCreate, detail: "created from expense source", after: a}); err != nil {
+				return err
+			}
+			s.accounts[a.ID] = a
+		}
+		return attachAccount(e, a, current.AccountID)
+	}
+	a, ok := s.accounts[e.AccountID]
+	if !ok {
+		return invalid(fmt.Errorf("account with ID %s not found", e.AccountID))
+	}
+	return attachAccount(e, a, current.AccountID)
+}
+
+func (s *memoryStore) recurringExpensesLocked() []RecurringExpense {
+	var recurringExpenses []RecurringExpense
+	for _, re := range s.recurring {
+		recurringExpenses = append(recurringExpenses, copyRecurringExpense(re))
+	}
+	slices.SortFunc(recurringExpenses, func(a, b RecurringExpense) int {
+		return a.StartDate.Compare(b.StartDate)
+	})
+	return recurringExpenses
+}
+
+func (s *memoryStore) GetRecurringExpenses() ([]RecurringExpense, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.recurringExpensesLocked(), nil
+}
+
+func (s *memoryStore) GetRecurringExpense(id string) (RecurringExpense, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	re, ok := s.recurring[id]
+	if !ok {
+		return RecurringExpense{}, fmt.Errorf("recurring expense with ID %s not found", id)
+	}
+	return copyRecurringExpense(re), nil
+}
+
+func (s *memoryStore) AddRecurringExpense(recurringExpense RecurringExpense) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if recurringExpense.ID == "" {
+		recurringExpense.ID = uuid.New().String()
+	}
+	if _, exists := s.recurring[recurringExpense.ID]; exists {
+		return fmt.Errorf("recurring expense with ID %s already exists", recurringExpense.ID)
+	}
+	if err := s.requireCategoryLocked(recurringExpense.Category); err != nil {
+		return err
+	}
+	if recurringExpense.Currency == "" {
+		recurringExpense.Currency = s.config.Currency
+	}
+	if err := recurringExpense.normalizeAmount(); err != nil {
+		return invalid(err)
+	}
+	if err := s.requireCurrencyLocked(recurringExpense.Currency); err != nil {
+		return err
+	}
+	if err := recurringExpense.resolveAccount(s.resolveAccountLocked, ""); err != nil {
+		return err
+	}
+	recurringExpense.Tags = s.registerTagsLocked(recurringExpense.Tags)
+	recurringExpense.Version = 1
+	horizon := RecurringHorizon(time.Now())
+	recurringExpense.MaterializedThrough = &horizon
+	instances := recurringExpense.instances(time.Time{}, horizon, s.holidays)
+	err := s.recordLocked(auditChange{entity: AuditRecurring, id: recurringExpense.ID, action: AuditCreate,
+		detail: fmt.Sprintf("%d instances generated", len(instances)), after: recurringExpense})
+	if err != nil {
+		return err
+	}
+	s.recurring[recurringExpense.ID] = copyRecurringExpense(recurringExpense)
+	for _, exp := range instances {
+		exp.Version = 1
+		s.expenses[exp.ID] = copyExpense(exp)
+	}
+	return nil
+}
+
+// removeInstancesLocked drops generated instances of a rule, either all of them
+// or only the ones scheduled in the future, and returns how many went
+func (s *memoryStore) removeInstancesLocked(recurringID string, all bool) int {
+	now := time.Now()
+	future := func(exp Expense) bool {
+		if exp.Occurrence != nil {
+			return exp.Occurrence.After(now)
+		}
+		return exp.Date.After(now)
+	}
+	removed := 0
+	for id, exp := range s.expenses {
+		if exp.RecurringID != recurringID {
+			continue
+		}
+		if all || future(exp) {
+			delete(s.expenses, id)
+			removed++
+		}
+	}
+	for id, exp := range s.trash {
+		if exp.RecurringID == recurringID && (all || future(exp.Expense)) {
+			delete(s.trash, id)
+			removed++
+		}
+	}
+	return removed
+}
+
+func (s *memoryStore) UpdateRecurringExpense(id string, recurringExpense RecurringExpense, updateAll bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	before, ok := s.recurring[id]
+	if !ok {
+		return fmt.Errorf("recurring expense with ID %s not found to update", id)
+	}
+	if err := s.requireCategoryLocked(recurringExpense.Category); err != nil {
+		return err
+	}
+	if recurringExpense.Version != 0 && recurringExpense.Version != before.Version {
+		return &ConflictError{Entity: AuditRecurring, ID: id, Current: before.Version}
+	}
+	recurringExpense.Version = before.Version + 1
+	recurringExpense.ID = id
+	if recurringExpense.Currency == "" {
+		recurringExpense.Currency = s.config.Currency
+	}
+	if err := recurringExpense.normalizeAmount(); err != nil {
+		return invalid(err)
+	}
+	if err := s.requireCurrencyLocked(recurringExpense.Currency); err != nil {
+		return err
+	}
+	if err := recurringExpense.resolveAccount(s.resolveAccountLocked, before.AccountID); err != nil {
+		return err
+	}
+	recurringExpense.Tags = s.registerTagsLocked(recurringExpense.Tags)
+	// overrides only change one occurrence at a time
+	recurringExpense.Overrides = before.Overrides
+	horizon := RecurringHorizon(time.Now())
+	recurringExpense.MaterializedThrough = &horizon
+	s.recurring[id] = copyRecurringExpense(recurringExpense)
+	var from time.Time
+	if !updateAll {
+		from = time.Now()
+	}
+	removed := s.removeInstancesLocked(id, updateAll)
+	instances := recurringExpense.instances(from, horizon, s.holidays)
+	for _, exp := range instances {
+		exp.Version = 1
+		s.expenses[exp.ID] = copyExpense(exp)
+	}
+	return s.recordLocked(auditChange{entity: AuditRecurring, id: id, action: AuditUpdate,
+		detail: fmt.Sprintf("%d instances removed, %d generated", removed, len(instances)), before: before, after: recurringExpense})
+}
+
+func (s *memoryStore) OverrideRecurringOccurrence(id string, override RecurringOverride, version int64) error {
+	if err := override.Validate(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	before, ok := s.recurring[id]
+	if !ok {
+		return fmt.Errorf("recurring expense with ID %s not found", id)
+	}
+	if version != 0 && version != before.Version {
+		return &ConflictError{Entity: AuditRecurring, ID: id, Current: before.Version}
+	}
+	if !before.Schedules(override.Occurrence, s.holidays) {
+		return fmt.Errorf("recurring expense %s has no occurrence on %s", id, override.Occurrence.Format(time.RFC3339))
+	}
+	if err := override.normalizeAmount(before.Currency); err != nil {
+		return err
+	}
+	after := copyRecurringExpense(before)
+	after.Overrides = before.withOverride(override)
+	after.Version++
+	err := s.recordLocked(auditChange{entity: AuditRecurring, id: id, action: AuditUpdate,
+		detail: overrideDetail(override), before: before, after: after})
+	if err != nil {
+		return err
+	}
+	s.recurring[id] = after
+	for expenseID, exp := range s.expenses {
+		if exp.RecurringID == id && exp.Occurrence != nil && exp.Occurrence.Equal(override.Occurrence) {
+			delete(s.expenses, expenseID)
+		}
+	}
+	for expenseID, exp := range s.trash {
+		if exp.RecurringID == id && exp.Occurrence != nil && exp.Occurrence.Equal(override.Occurrence) {
+			delete(s.trash, expenseID)
+		}
+	}
+	if after.MaterializedThrough != nil && !override.Occurrence.After(*after.MaterializedThrough) {
+		for _, exp := range after.instances(override.Occurrence.Add(-time.Nanosecond), override.Occurrence, s.holidays) {
+			exp.Version = 1
+			s.expenses[exp.ID] = copyExpense(exp)
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) MaterializeRecurring(through time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	through = through.UTC()
+	written := 0
+	for _, re := range s.recurringExpensesLocked() {
+		after, ok := re.pending(through)
+		if !ok {
+			continue
+		}
+		for _, exp := range re.instances(after, through, s.holidays) {
+			exp.Version = 1
+			s.expenses[exp.ID] = copyExpense(exp)
+			written++
+		}
+		re.MaterializedThrough = &through
+		s.recurring[re.ID] = re
+	}
+	return written, nil
+}
+
+func (s *memoryStore) RemoveRecurringExpense(id string, removeAll bool, version int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	before, ok := s.recurring[id]
+	if !ok {
+		return fmt.Errorf("recurring expense with ID %s not found", id)
+	}
+	if version != 0 && version != before.Version {
+		return &ConflictError{Entity: AuditRecurring, ID: id, Current: before.Version}
+	}
+	delete(s.recurring, id)
+	removed := s.removeInstancesLocked(id, removeAll)
+	return s.recordLocked(auditChange{entity: AuditRecurring, id: id, action: AuditDelete,
+		detail: fmt.Sprintf("%d instances removed", removed), before: before})
+}
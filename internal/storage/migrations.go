@@ -0,0 +1,266 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+)
+
+// Migration is a numbered, reversible schema change. Up and Down run inside
+// the same transaction that records the version in schema_migrations.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *sql.Tx) error
+	Down    func(tx *sql.Tx) error
+}
+
+// MigrationStatus reports whether a known migration has been applied
+type MigrationStatus struct {
+	Version   int       `json:"version"`
+	Name      string    `json:"name"`
+	Applied   bool      `json:"applied"`
+	AppliedAt time.Time `json:"appliedAt,omitempty"`
+}
+
+// Migrator applies and rolls back the migrations of a SQL backend
+type Migrator struct {
+	db          *sql.DB
+	migrations  []Migration
+	placeholder func(n int) string // bind parameter syntax of the backend
+}
+
+func newMigrator(db *sql.DB, migrations []Migration, placeholder func(n int) string) *Migrator {
+	sorted := slices.Clone(migrations)
+	slices.SortFunc(sorted, func(a, b Migration) int { return a.Version - b.Version })
+	return &Migrator{db: db, migrations: sorted, placeholder: placeholder}
+}
+
+func postgresPlaceholder(n int) string { return fmt.Sprintf("$%d", n) }
+func sqlitePlaceholder(int) string     { return "?" }
+
+// InitializeMigrator opens the configured SQL backend without applying any migration
+func InitializeMigrator() (*Migrator, error) {
+	baseConfig, err := loadSystemConfig()
+	if err != nil {
+		return nil, err
+	}
+	switch baseConfig.StorageType {
+	case BackendTypeSQLite:
+		db, err := openSQLiteDB(baseConfig)
+		if err != nil {
+			return nil, err
+		}
+		return newMigrator(db, sqliteMigrations, sqlitePlaceholder), nil
+	default:
+		db, err := openPostgresDB(baseConfig)
+		if err != nil {
+			return nil, err
+		}
+		return newMigrator(db, postgresMigrations, postgresPlaceholder), nil
+	}
+}
+
+func (m *Migrator) Close() error {
+	return m.db.Close()
+}
+
+// execStatements runs each statement in order, stopping at the first failure
+func execStatements(tx *sql.Tx, statements ...string) error {
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Migrator) ensureMigrationsTable() error {
+	_, err := m.db.Exec(`
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMP NOT NULL
+	);`)
+	return err
+}
+
+func (m *Migrator) appliedVersions() (map[int]time.Time, error) {
+	if err := m.ensureMigrationsTable(); err != nil {
+		return nil, fmt.Errorf("failed to create schema_migrations table: %v", err)
+	}
+	rows, err := m.db.Query(`SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query schema_migrations: %v", err)
+	}
+	defer rows.Close()
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan schema_migrations: %v", err)
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// Status lists every known migration with its applied state
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	applied, err := m.appliedVersions()
+	if err != nil {
+		return nil, err
+	}
+	var statuses []MigrationStatus
+	for _, mig := range m.migrations {
+		appliedAt, ok := applied[mig.Version]
+		statuses = append(statuses, MigrationStatus{Version: mig.Version, Name: mig.Name, Applied: ok, AppliedAt: appliedAt})
+	}
+	return statuses, nil
+}
+
+// Up applies every pending migration in version order and returns the ones it applied
+func (m *Migrator) Up() ([]MigrationStatus, error) {
+	applied, err := m.appliedVersions()
+	if err != nil {
+		return nil, err
+	}
+	var done []MigrationStatus
+	for _, mig := range m.migrations {
+		if _, ok := applied[mig.Version]; ok {
+			continue
+		}
+		insert := fmt.Sprintf(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (%s, %s, %s)`,
+			m.placeholder(1), m.placeholder(2), m.placeholder(3))
+		now := time.Now().UTC()
+		if err := m.inTx(mig.Up, insert, mig.Version, mig.Name, now); err != nil {
+			return done, fmt.Errorf("migration %d (%s) failed: %v", mig.Version, mig.Name, err)
+		}
+		log.Printf("Applied migration %d (%s)\n", mig.Version, mig.Name)
+		done = append(done, MigrationStatus{Version: mig.Version, Name: mig.Name, Applied: true, AppliedAt: now})
+	}
+	return done, nil
+}
+
+// Down rolls back the latest `steps` applied migrations and returns the ones it reverted
+func (m *Migrator) Down(steps int) ([]MigrationStatus, error) {
+	applied, err := m.appliedVersions()
+	if err != nil {
+		return nil, err
+	}
+	var done []MigrationStatus
+	for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		mig := m.migrations[i]
+		if _, ok := applied[mig.Version]; !ok {
+			continue
+		}
+		if mig.Down == nil {
+			return done, fmt.Errorf("migration %d (%s) cannot be rolled back", mig.Version, mig.Name)
+		}
+		remove := fmt.Sprintf(`DELETE FROM schema_migrations WHERE version = %s`, m.placeholder(1))
+		if err := m.inTx(mig.Down, remove, mig.Version); err != nil {
+			return done, fmt.Errorf("rollback of migration %d (%s) failed: %v", mig.Version, mig.Name, err)
+		}
+		log.Printf("Rolled back migration %d (%s)\n", mig.Version, mig.Name)
+		done = append(done, MigrationStatus{Version: mig.Version, Name: mig.Name})
+	}
+	return done, nil
+}
+
+// inTx runs a migration step and its bookkeeping statement atomically
+func (m *Migrator) inTx(step func(tx *sql.Tx) error, bookkeeping string, args ...any) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+	if err := step(tx); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(bookkeeping, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// moveConfigCategories seeds the categories table from the legacy config.categories
+// JSON column (or the defaults) when the table is still empty
+func moveConfigCategories(tx *sql.Tx, placeholder func(n int) string) error {
+	var count int
+	if err := tx.QueryRow(`SELECT COUNT(1) FROM categories`).Scan(&count); err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	var categories []string
+	var categoriesStr string
+	if err := tx.QueryRow(`SELECT categories FROM config WHERE id = 'default'`).Scan(&categoriesStr); err == nil {
+		if unmarshalErr := json.Unmarshal([]byte(categoriesStr), &categories); unmarshalErr != nil {
+			categories = nil
+		}
+	}
+	if len(categories) == 0 {
+		categories = categoryNames(defaultCategories)
+	}
+	insert := fmt.Sprintf(`INSERT INTO categories (name, position) VALUES (%s, %s)
+		ON CONFLICT (name) DO UPDATE SET position = EXCLUDED.position`, placeholder(1), placeholder(2))
+	for i, name := range categories {
+		if _, err := tx.Exec(insert, name, i+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreConfigCategories writes the categories table back into the legacy JSON column
+func restoreConfigCategories(tx *sql.Tx, placeholder func(n int) string) error {
+	rows, err := tx.Query(`SELECT name FROM categories ORDER BY position ASC`)
+	if err != nil {
+		return err
+	}
+	var categories []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		categories = append(categories, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	categoriesJSON, err := json.Marshal(categories)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(fmt.Sprintf(`UPDATE config SET categories = %s`, placeholder(1)), string(categoriesJSON))
+	return err
+}
+
+// shared by both SQL backends; the syntax is identical
+var expenseQueryIndexes = []string{
+	"CREATE INDEX IF NOT EXISTS idx_expenses_date ON expenses (date DESC, id DESC)",
+	"CREATE INDEX IF NOT EXISTS idx_expenses_category_date ON expenses (category, date DESC)",
+	"CREATE INDEX IF NOT EXISTS idx_expenses_currency_date ON expenses (currency, date DESC)",
+	"CREATE INDEX IF NOT EXISTS idx_expenses_source_date ON expenses (source, date DESC)",
+	"CREATE INDEX IF NOT EXISTS idx_expenses_card_date ON expenses (card, date DESC)",
+	"CREATE INDEX IF NOT EXISTS idx_expenses_recurring_id ON expenses (recurring_id)",
+	"CREATE INDEX IF NOT EXISTS idx_expenses_amount ON expenses (amount)",
+}
+
+var dropExpenseQueryIndexes = []string{
+	"DROP INDEX IF EXISTS idx_expenses_date",
+	"DROP INDEX IF EXISTS idx_expenses_category_date",
+	"DROP INDEX IF EXISTS idx_expenses_currency_date",
+	"DROP INDEX IF EXISTS idx_expenses_source_date",
+	"DROP INDEX IF EXISTS idx_expenses_card_date",
+	"DROP INDEX IF EXISTS idx_expenses_recurring_id",
+	"DROP INDEX IF EXISTS idx_expenses_amount",
+}
@@ -0,0 +1,604 @@
+package storage
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestSQLiteMigrationsUpDownStatus(t *testing.T) {
+	db, err := openSQLiteDB(SystemConfig{StorageURL: t.TempDir(), StorageType: BackendTypeSQLite})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	migrator := newMigrator(db, sqliteMigrations, sqlitePlaceholder)
+
+	statuses, err := migrator.Status()
+	if err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	if len(statuses) != len(sqliteMigrations) {
+		t.Fatalf("expected %d migrations, got %d", len(sqliteMigrations), len(statuses))
+	}
+	for _, st := range statuses {
+		if st.Applied {
+			t.Fatalf("migration %d should be pending on a fresh database", st.Version)
+		}
+	}
+
+	applied, err := migrator.Up()
+	if err != nil {
+		t.Fatalf("up: %v", err)
+	}
+	if len(applied) != len(sqliteMigrations) {
+		t.Fatalf("expected every migration to apply, got %d", len(applied))
+	}
+	if again, err := migrator.Up(); err != nil || len(again) != 0 {
+		t.Fatalf("second up should be a no-op: %v (%d applied)", err, len(again))
+	}
+
+	// legacy column is gone and categories were seeded into their table
+	var categories []string
+	rows, err := db.Query(`SELECT name FROM categories ORDER BY position`)
+	if err != nil {
+		t.Fatalf("query categories: %v", err)
+	}
+	for rows.Next() {
+		var name string
+		rows.Scan(&name)
+		categories = append(categories, name)
+	}
+	rows.Close()
+	if !slices.Equal(categories, categoryNames(defaultCategories)) {
+		t.Fatalf("expected default categories, got %v", categories)
+	}
+	if _, err := db.Exec(`SELECT categories FROM config`); err == nil {
+		t.Fatalf("expected config.categories column to be dropped")
+	}
+
+	// rolling back the retirement restores the JSON column from the table
+	if _, err := db.Exec(`INSERT INTO config (id, currency, start_date) VALUES ('default', 'usd', 1)`); err != nil {
+		t.Fatalf("insert config: %v", err)
+	}
+	// roll back everything above the initial schema; the retirement is reverted last
+	reverted, err := migrator.Down(len(sqliteMigrations) - 1)
+	if err != nil || len(reverted) != len(sqliteMigrations)-1 || reverted[len(reverted)-1].Name != "retire_config_categories" {
+		t.Fatalf("down: %v (%v)", err, reverted)
+	}
+	var categoriesJSON string
+	if err := db.QueryRow(`SELECT categories FROM config WHERE id = 'default'`).Scan(&categoriesJSON); err != nil {
+		t.Fatalf("read restored categories column: %v", err)
+	}
+	var restored []string
+	if err := json.Unmarshal([]byte(categoriesJSON), &restored); err != nil || !slices.Equal(restored, categoryNames(defaultCategories)) {
+		t.Fatalf("unexpected restored categories %q: %v", categoriesJSON, err)
+	}
+
+	statuses, _ = migrator.Status()
+	if !statuses[0].Applied || statuses[1].Applied {
+		t.Fatalf("unexpected status after down: %+v", statuses)
+	}
+	if _, err := migrator.Up(); err != nil {
+		t.Fatalf("re-apply: %v", err)
+	}
+}
+
+func TestSQLiteMigrationAdoptsLegacyCategories(t *testing.T) {
+	db, err := openSQLiteDB(SystemConfig{StorageURL: t.TempDir(), StorageType: BackendTypeSQLite})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	// a database created before migrations existed, with categories only in config
+	for _, stmt := range []string{createSQLiteExpensesTableSQL, createSQLiteRecurringExpensesTableSQL, createSQLiteConfigTableSQL, createSQLiteCategoriesTableSQL} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("create legacy schema: %v", err)
+		}
+	}
+	if _, err := db.Exec(`INSERT INTO config (id, categories, currency, start_date) VALUES ('default', '["Mate","Income"]', 'ars', 5)`); err != nil {
+		t.Fatalf("insert legacy config: %v", err)
+	}
+	// expenses could name categories missing from the list
+	if _, err := db.Exec(`INSERT INTO expenses (id, name, category, amount, currency, date) VALUES ('e1', 'Termo', 'Yerba', -1, 'ars', '2024-01-01 00:00:00+00:00')`); err != nil {
+		t.Fatalf("insert legacy expense: %v", err)
+	}
+
+	if _, err := newMigrator(db, sqliteMigrations, sqlitePlaceholder).Up(); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+	store := &sqliteStore{db: db}
+	config, err := store.GetConfig()
+	if err != nil {
+		t.Fatalf("get config: %v", err)
+	}
+	if !slices.Equal(categoryNames(config.Categories), []string{"Mate", "Income", "Yerba"}) || config.Currency != "ars" || config.StartDate != 5 {
+		t.Fatalf("legacy config not carried over: %+v", config)
+	}
+	// only categories named like a default one pick up its metadata
+	want := []Category{{Name: "Mate", Type: CategoryTypeExpense}, NewCategory("Income"), {Name: "Yerba", Type: CategoryTypeExpense}}
+	if !slices.Equal(config.Categories, want) || want[1].Type != CategoryTypeIncome {
+		t.Fatalf("category metadata: got %+v, want %+v", config.Categories, want)
+	}
+}
+
+func TestSQLiteMigrationMovesTagsToLinks(t *testing.T) {
+	db, err := openSQLiteDB(SystemConfig{StorageURL: t.TempDir(), StorageType: BackendTypeSQLite})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	migrator := newMigrator(db, sqliteMigrations, sqlitePlaceholder)
+
+	// stop right before normalize_tags and store tags the legacy way
+	if _, err := newMigrator(db, sqliteMigrations[:3], sqlitePlaceholder).Up(); err != nil {
+		t.Fatalf("up to 3: %v", err)
+	}
+	legacy := []string{
+		`INSERT INTO expenses (id, name, category, amount, currency, date, tags) VALUES ('e1', 'Lunch', 'Food', -1, 'usd', '2024-01-01 00:00:00+00:00', '["work","food","work"]')`,
+		`INSERT INTO expenses (id, name, category, amount, currency, date, tags) VALUES ('e2', 'Bus', 'Travel', -1, 'usd', '2024-01-02 00:00:00+00:00', 'not json')`,
+		`INSERT INTO recurring_expenses (id, name, amount, currency, category, start_date, interval, occurrences, tags) VALUES ('r1', 'Rent', -1, 'usd', 'Rent', '2024-01-01 00:00:00+00:00', 'monthly', 2, '["home"]')`,
+	}
+	for _, stmt := range legacy {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("insert legacy rows: %v", err)
+		}
+	}
+	if _, err := migrator.Up(); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+
+	store := &sqliteStore{db: db}
+	if e, err := store.GetExpense("e1"); err != nil || !slices.Equal(e.Tags, []string{"work", "food"}) {
+		t.Fatalf("expense tags not carried over: %v (%v)", e.Tags, err)
+	}
+	if e, err := store.GetExpense("e2"); err != nil || len(e.Tags) != 0 {
+		t.Fatalf("unreadable tags should be dropped: %v (%v)", e.Tags, err)
+	}
+	tags, err := store.GetTags()
+	if err != nil {
+		t.Fatalf("get tags: %v", err)
+	}
+	want := []Tag{{Name: "food", Count: 1}, {Name: "home", RecurringCount: 1}, {Name: "work", Count: 1}}
+	if !slices.Equal(tags, want) {
+		t.Fatalf("got tags %+v, want %+v", tags, want)
+	}
+
+	if _, err := migrator.Down(len(sqliteMigrations) - 3); err != nil {
+		t.Fatalf("down: %v", err)
+	}
+	var tagsJSON string
+	if err := db.QueryRow(`SELECT tags FROM expenses WHERE id = 'e1'`).Scan(&tagsJSON); err != nil || tagsJSON != `["work","food"]` {
+		t.Fatalf("tags column not restored: %q (%v)", tagsJSON, err)
+	}
+}
+
+func TestSQLiteMigrationStoresMinorUnits(t *testing.T) {
+	db, err := openSQLiteDB(SystemConfig{StorageURL: t.TempDir(), StorageType: BackendTypeSQLite})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	migrator := newMigrator(db, sqliteMigrations, sqlitePlaceholder)
+
+	// stop right before exact_amounts, while amounts are still REAL
+	if _, err := newMigrator(db, sqliteMigrations[:10], sqlitePlaceholder).Up(); err != nil {
+		t.Fatalf("up to 10: %v", err)
+	}
+	legacy := []string{
+		`INSERT INTO expenses (id, name, category, amount, currency, date) VALUES ('e1', 'Lunch', 'Food', -12.34, 'ars', '2024-01-01 00:00:00+00:00')`,
+		`INSERT INTO recurring_expenses (id, name, amount, currency, category, start_date, interval, occurrences) VALUES ('r1', 'Rent', -1000.1, 'usd', 'Rent', '2024-01-01 00:00:00+00:00', 'monthly', 2)`,
+	}
+	for _, stmt := range legacy {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("insert legacy rows: %v", err)
+		}
+	}
+	if _, err := migrator.Up(); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+	var units int64
+	if err := db.QueryRow(`SELECT amount FROM expenses WHERE id = 'e1'`).Scan(&units); err != nil || units != -1234 {
+		t.Fatalf("expected -1234 minor units, got %d (%v)", units, err)
+	}
+	store := &sqliteStore{db: db}
+	if re, err := store.GetRecurringExpense("r1"); err != nil || re.Amount.String() != "-1000.10" {
+		t.Fatalf("rule amount not carried over: %v (%v)", re.Amount, err)
+	}
+
+	// back to 10, undoing exact_amounts and everything after it
+	if _, err := migrator.Down(len(sqliteMigrations) - 10); err != nil {
+		t.Fatalf("down: %v", err)
+	}
+	var amount float64
+	if err := db.QueryRow(`SELECT amount FROM expenses WHERE id = 'e1'`).Scan(&amount); err != nil || amount != -12.34 {
+		t.Fatalf("expected -12.34 after down, got %v (%v)", amount, err)
+	}
+}
+
+func TestSQLiteMigrationMapsLegacyAccounts(t *testing.T) {
+	db, err := openSQLiteDB(SystemConfig{StorageURL: t.TempDir(), StorageType: BackendTypeSQLite})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	migrator := newMigrator(db, sqliteMigrations, sqlitePlaceholder)
+
+	// stop right before accounts, while source and card are free text
+	if _, err := newMigrator(db, sqliteMigrations[:15], sqlitePlaceholder).Up(); err != nil {
+		t.Fatalf("up to 15: %v", err)
+	}
+	legacy := []string{
+		`INSERT INTO expenses (id, name, category, amount, currency, date, source, card) VALUES ('e1', 'Lunch', 'Food', -100, 'ars', '2024-01-01 00:00:00+00:00', 'TARJETA', 'Visa')`,
+		`INSERT INTO expenses (id, name, category, amount, currency, date, source, card) VALUES ('e2', 'Dinner', 'Food', -200, 'ars', '2024-01-02 00:00:00+00:00', 'TARJETA', 'visa')`,
+		`INSERT INTO expenses (id, name, category, amount, currency, date, source, card, deleted_at) VALUES ('e3', 'Taxi', 'Travel', -300, 'ars', '2024-01-03 00:00:00+00:00', 'EFECTIVO', '', '2024-02-01 00:00:00+00:00')`,
+		`INSERT INTO expenses (id, name, category, amount, currency, date, source, card) VALUES ('e4', 'Salary', 'Income', 5000, 'usd', '2024-01-04 00:00:00+00:00', 'CA', '')`,
+		`INSERT INTO expenses (id, name, category, amount, currency, date) VALUES ('e5', 'Gift', 'Income', 100, 'usd', '2024-01-05 00:00:00+00:00')`,
+	}
+	for _, stmt := range legacy {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("insert legacy rows: %v", err)
+		}
+	}
+	if _, err := migrator.Up(); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+
+	store := &sqliteStore{db: db}
+	accounts, err := store.GetAccounts()
+	if err != nil {
+		t.Fatalf("get accounts: %v", err)
+	}
+	var got []string
+	for _, a := range accounts {
+		got = append(got, a.Name+"/"+a.Type+"/"+a.Currency)
+	}
+	want := []string{"Caja de ahorro/bank/usd", "Efectivo/cash/ars", "Visa/credit_card/ars"}
+	if !slices.Equal(got, want) {
+		t.Fatalf("got accounts %v, want %v", got, want)
+	}
+	lunch, err := store.GetExpense("e1")
+	if err != nil {
+		t.Fatalf("get expense: %v", err)
+	}
+	if dinner, err := store.GetExpense("e2"); err != nil || dinner.AccountID != lunch.AccountID || dinner.Card != "Visa" {
+		t.Fatalf("expected both cards on one account, got %+v (%v)", dinner, err)
+	}
+	if gift, err := store.GetExpense("e5"); err != nil || gift.AccountID != "" {
+		t.Fatalf("expected no account without source, got %+v (%v)", gift, err)
+	}
+	var trashed string
+	if err := db.QueryRow(`SELECT account_id FROM expenses WHERE id = 'e3'`).Scan(&trashed); err != nil || trashed == "" {
+		t.Fatalf("expected trashed expenses mapped too: %q (%v)", trashed, err)
+	}
+
+	// back to 15, undoing accounts and everything after it
+	if _, err := migrator.Down(len(sqliteMigrations) - 15); err != nil {
+		t.Fatalf("down: %v", err)
+	}
+	if _, err := db.Exec(`SELECT account_id FROM expenses`); err == nil {
+		t.Fatalf("expected expenses.account_id to be dropped")
+	}
+}
+
+func TestSQLiteMigrationTypesTransactions(t *testing.T) {
+	db, err := openSQLiteDB(SystemConfig{StorageURL: t.TempDir(), StorageType: BackendTypeSQLite})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	migrator := newMigrator(db, sqliteMigrations, sqlitePlaceholder)
+
+	// stop right before transaction types, while the sign tells them apart
+	if _, err := newMigrator(db, sqliteMigrations[:16], sqlitePlaceholder).Up(); err != nil {
+		t.Fatalf("up to 16: %v", err)
+	}
+	legacy := []string{
+		`INSERT INTO expenses (id, name, category, amount, currency, date) VALUES ('e1', 'Lunch', 'Food', -100, 'usd', '2024-01-01 00:00:00+00:00')`,
+		`INSERT INTO expenses (id, name, category, amount, currency, date) VALUES ('e2', 'Salary', 'Income', 5000, 'usd', '2024-01-02 00:00:00+00:00')`,
+		`INSERT INTO expenses (id, name, category, amount, currency, date, exchange_id) VALUES ('e3', 'Exchange', '', 1000, 'usd', '2024-01-03 00:00:00+00:00', 'x1')`,
+	}
+	for _, stmt := range legacy {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("insert legacy rows: %v", err)
+		}
+	}
+	if _, err := migrator.Up(); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+	store := &sqliteStore{db: db}
+	for id, want := range map[string]string{"e1": TransactionTypeExpense, "e2": TransactionTypeIncome, "e3": TransactionTypeTransfer} {
+		if e, err := store.GetExpense(id); err != nil || e.Type != want {
+			t.Fatalf("expected %s to be %s, got %+v (%v)", id, want, e, err)
+		}
+	}
+
+	// back to 16, undoing transaction types and everything after it
+	if _, err := migrator.Down(len(sqliteMigrations) - 16); err != nil {
+		t.Fatalf("down: %v", err)
+	}
+	if _, err := db.Exec(`SELECT type FROM expenses`); err == nil {
+		t.Fatalf("expected expenses.type to be dropped")
+	}
+}
+
+func TestSQLiteMigrationCardCycles(t *testing.T) {
+	db, err := openSQLiteDB(SystemConfig{StorageURL: t.TempDir(), StorageType: BackendTypeSQLite})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	migrator := newMigrator(db, sqliteMigrations, sqlitePlaceholder)
+
+	if _, err := newMigrator(db, sqliteMigrations[:17], sqlitePlaceholder).Up(); err != nil {
+		t.Fatalf("up to 17: %v", err)
+	}
+	if _, err := db.Exec(`INSERT INTO accounts (id, name, type, currency, opening_balance, archived) VALUES ('a1', 'Visa', 'credit_card', 'ars', 0, false)`); err != nil {
+		t.Fatalf("insert account: %v", err)
+	}
+	if _, err := migrator.Up(); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+	store := &sqliteStore{db: db}
+	visa, err := store.GetAccount("a1")
+	if err != nil || visa.ClosingDay != 0 || visa.DueDay != 0 {
+		t.Fatalf("expected existing cards without a cycle, got %+v (%v)", visa, err)
+	}
+	visa.ClosingDay, visa.DueDay = 25, 5
+	if err := store.UpdateAccount("a1", visa); err != nil {
+		t.Fatalf("set cycle: %v", err)
+	}
+
+	// back to 17, undoing card cycles and everything after it
+	if _, err := migrator.Down(len(sqliteMigrations) - 17); err != nil {
+		t.Fatalf("down: %v", err)
+	}
+	if _, err := db.Exec(`SELECT closing_day FROM accounts`); err == nil {
+		t.Fatalf("expected accounts.closing_day to be dropped")
+	}
+}
+
+func TestSQLiteMigrationInstallmentPurchases(t *testing.T) {
+	db, err := openSQLiteDB(SystemConfig{StorageURL: t.TempDir(), StorageType: BackendTypeSQLite})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	migrator := newMigrator(db, sqliteMigrations, sqlitePlaceholder)
+	if _, err := migrator.Up(); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+	store := &sqliteStore{db: db}
+	visa := Account{ID: uuid.New().String(), Name: "Visa", Type: AccountTypeCreditCard, Currency: "usd"}
+	if err := store.AddAccount(visa); err != nil {
+		t.Fatalf("add account: %v", err)
+	}
+	purchase := InstallmentPurchase{Name: "TV", Category: "Shopping", AccountID: visa.ID, Total: MustParseMoney("300"), Installments: 3, Date: time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC)}
+	if err := store.AddInstallmentPurchase(purchase); err != nil {
+		t.Fatalf("add purchase: %v", err)
+	}
+	if err := store.AddExpense(Expense{Name: "Lunch", Category: "Food", Amount: MustParseMoney("-10"), Currency: "usd", Date: purchase.Date}); err != nil {
+		t.Fatalf("add expense: %v", err)
+	}
+
+	// rolling back drops the installments along with the purchases
+	if _, err := migrator.Down(len(sqliteMigrations) - 18); err != nil {
+		t.Fatalf("down: %v", err)
+	}
+	if _, err := db.Exec(`SELECT installment_id FROM expenses`); err == nil {
+		t.Fatalf("expected expenses.installment_id to be dropped")
+	}
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(1) FROM expenses`).Scan(&count); err != nil || count != 1 {
+		t.Fatalf("expected only the plain expense left, got %d (%v)", count, err)
+	}
+}
+
+func TestSQLiteMigrationRecurringHorizon(t *testing.T) {
+	db, err := openSQLiteDB(SystemConfig{StorageURL: t.TempDir(), StorageType: BackendTypeSQLite})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	migrator := newMigrator(db, sqliteMigrations, sqlitePlaceholder)
+
+	if _, err := newMigrator(db, sqliteMigrations[:19], sqlitePlaceholder).Up(); err != nil {
+		t.Fatalf("up to 19: %v", err)
+	}
+	for _, stmt := range []string{
+		`INSERT INTO recurring_expenses (id, name, amount, currency, category, start_date, interval, occurrences) VALUES ('r1', 'Rent', -100, 'usd', 'Rent', '2024-01-01 00:00:00+00:00', 'monthly', 2)`,
+		`INSERT INTO expenses (id, recurring_id, name, category, amount, currency, date) VALUES ('e1', 'r1', 'Rent', 'Rent', -100, 'usd', '2024-01-01 00:00:00+00:00')`,
+		`INSERT INTO expenses (id, recurring_id, name, category, amount, currency, date) VALUES ('e2', 'r1', 'Rent', 'Rent', -100, 'usd', '2024-02-01 00:00:00+00:00')`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+	}
+	if _, err := migrator.Up(); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+	store := &sqliteStore{db: db}
+	rule, err := store.GetRecurringExpense("r1")
+	if err != nil || rule.MaterializedThrough == nil || !rule.MaterializedThrough.Equal(time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected the rule materialized through its last instance, got %+v (%v)", rule, err)
+	}
+	// the occurrences written when the rule was added are not written twice
+	if written, err := store.MaterializeRecurring(time.Now().AddDate(1, 0, 0)); err != nil || written != 0 {
+		t.Fatalf("expected nothing left to materialize, got %d (%v)", written, err)
+	}
+
+	if _, err := migrator.Down(len(sqliteMigrations) - 19); err != nil {
+		t.Fatalf("down: %v", err)
+	}
+	if _, err := db.Exec(`SELECT materialized_through FROM recurring_expenses`); err == nil {
+		t.Fatalf("expected recurring_expenses.materialized_through to be dropped")
+	}
+}
+
+func TestSQLiteMigrationRecurrenceRules(t *testing.T) {
+	db, err := openSQLiteDB(SystemConfig{StorageURL: t.TempDir(), StorageType: BackendTypeSQLite})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	migrator := newMigrator(db, sqliteMigrations, sqlitePlaceholder)
+
+	if _, err := newMigrator(db, sqliteMigrations[:20], sqlitePlaceholder).Up(); err != nil {
+		t.Fatalf("up to 20: %v", err)
+	}
+	_, err = db.Exec(`INSERT INTO recurring_expenses (id, name, amount, currency, category, start_date, interval, occurrences, materialized_through)
+		VALUES ('r1', 'Rent', -100, 'usd', 'Rent', '2025-01-31 00:00:00+00:00', 'monthly', 2, '2025-02-28 00:00:00+00:00')`)
+	if err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+	if _, err := migrator.Up(); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+	store := &sqliteStore{db: db}
+	rule, err := store.GetRecurringExpense("r1")
+	if err != nil || rule.RRule != "" || rule.BusinessDay != "" || rule.Interval != "monthly" {
+		t.Fatalf("expected the rule kept on its interval, got %+v (%v)", rule, err)
+	}
+	if err := store.SaveHolidays([]Holiday{{Date: time.Date(2025, 3, 3, 0, 0, 0, 0, time.UTC), Name: "Carnaval"}}); err != nil {
+		t.Fatalf("save holiday: %v", err)
+	}
+
+	if _, err := migrator.Down(len(sqliteMigrations) - 20); err != nil {
+		t.Fatalf("down: %v", err)
+	}
+	if _, err := db.Exec(`SELECT rrule, business_day FROM recurring_expenses`); err == nil {
+		t.Fatalf("expected the recurrence rule columns to be dropped")
+	}
+	if _, err := db.Exec(`SELECT date FROM holidays`); err == nil {
+		t.Fatalf("expected holidays to be dropped")
+	}
+}
+
+func TestSQLiteMigrationRecurringOverrides(t *testing.T) {
+	db, err := openSQLiteDB(SystemConfig{StorageURL: t.TempDir(), StorageType: BackendTypeSQLite})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	migrator := newMigrator(db, sqliteMigrations, sqlitePlaceholder)
+
+	if _, err := newMigrator(db, sqliteMigrations[:21], sqlitePlaceholder).Up(); err != nil {
+		t.Fatalf("up to 21: %v", err)
+	}
+	for _, stmt := range []string{
+		`INSERT INTO recurring_expenses (id, name, amount, currency, category, start_date, interval, occurrences, materialized_through)
+			VALUES ('r1', 'Rent', -100, 'usd', 'Rent', '2025-01-01 00:00:00+00:00', 'monthly', 2, '2025-02-01 00:00:00+00:00')`,
+		`INSERT INTO expenses (id, recurring_id, name, category, amount, currency, date) VALUES ('e1', 'r1', 'Rent', 'Rent', -100, 'usd', '2025-01-01 00:00:00+00:00')`,
+		`INSERT INTO expenses (id, name, category, amount, currency, date) VALUES ('e2', 'Lunch', 'Food', -10, 'usd', '2025-01-02 00:00:00+00:00')`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+	}
+	if _, err := migrator.Up(); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+	store := &sqliteStore{db: db}
+	rule, err := store.GetRecurringExpense("r1")
+	if err != nil || rule.AmountChanges == nil || len(rule.AmountChanges) != 0 || len(rule.Overrides) != 0 {
+		t.Fatalf("expected empty schedules on the existing rule, got %+v (%v)", rule, err)
+	}
+	instance, err := store.GetExpense("e1")
+	if err != nil || instance.Occurrence == nil || !instance.Occurrence.Equal(instance.Date) {
+		t.Fatalf("expected the instance backfilled with its occurrence, got %+v (%v)", instance, err)
+	}
+	if manual, err := store.GetExpense("e2"); err != nil || manual.Occurrence != nil {
+		t.Fatalf("expected no occurrence on a manual expense, got %+v (%v)", manual, err)
+	}
+
+	if _, err := migrator.Down(len(sqliteMigrations) - 21); err != nil {
+		t.Fatalf("down: %v", err)
+	}
+	if _, err := db.Exec(`SELECT amount_changes, overrides FROM recurring_expenses`); err == nil {
+		t.Fatalf("expected the schedule columns to be dropped")
+	}
+	if _, err := db.Exec(`SELECT occurrence FROM expenses`); err == nil {
+		t.Fatalf("expected the occurrence column to be dropped")
+	}
+}
+
+func TestSQLiteMigrationRecurringAccounts(t *testing.T) {
+	db, err := openSQLiteDB(SystemConfig{StorageURL: t.TempDir(), StorageType: BackendTypeSQLite})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	migrator := newMigrator(db, sqliteMigrations, sqlitePlaceholder)
+
+	if _, err := newMigrator(db, sqliteMigrations[:22], sqlitePlaceholder).Up(); err != nil {
+		t.Fatalf("up to 22: %v", err)
+	}
+	_, err = db.Exec(`INSERT INTO recurring_expenses (id, name, amount, currency, category, start_date, interval, occurrences, materialized_through)
+		VALUES ('r1', 'Netflix', -100, 'usd', 'Entertainment', '2025-01-01 00:00:00+00:00', 'monthly', 2, '2025-02-01 00:00:00+00:00')`)
+	if err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+	if _, err := migrator.Up(); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+	store := &sqliteStore{db: db}
+	rule, err := store.GetRecurringExpense("r1")
+	if err != nil || rule.AccountID != "" || rule.Source != "" || rule.Card != "" {
+		t.Fatalf("expected the existing rule without an account, got %+v (%v)", rule, err)
+	}
+
+	if _, err := migrator.Down(len(sqliteMigrations) - 22); err != nil {
+		t.Fatalf("down: %v", err)
+	}
+	if _, err := db.Exec(`SELECT source, card, account_id FROM recurring_expenses`); err == nil {
+		t.Fatalf("expected the account columns to be dropped")
+	}
+}
+
+func TestSQLiteMigrationExchangeAccounts(t *testing.T) {
+	db, err := openSQLiteDB(SystemConfig{StorageURL: t.TempDir(), StorageType: BackendTypeSQLite})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	migrator := newMigrator(db, sqliteMigrations, sqlitePlaceholder)
+
+	if _, err := newMigrator(db, sqliteMigrations[:23], sqlitePlaceholder).Up(); err != nil {
+		t.Fatalf("up to 23: %v", err)
+	}
+	_, err = db.Exec(`INSERT INTO currency_exchanges (id, name, date, from_currency, from_amount, to_currency, to_amount, rate, outgoing_id, incoming_id)
+		VALUES ('x1', 'Dolares', '2025-01-01 00:00:00+00:00', 'ars', 10000000, 'usd', 10000, '1000.000000', 'o1', 'i1')`)
+	if err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+	if _, err := migrator.Up(); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+	store := &sqliteStore{db: db}
+	x, err := store.GetCurrencyExchange("x1")
+	if err != nil || x.FromAccountID != "" || x.ToAccountID != "" {
+		t.Fatalf("expected the existing exchange without accounts, got %+v (%v)", x, err)
+	}
+
+	if _, err := migrator.Down(len(sqliteMigrations) - 23); err != nil {
+		t.Fatalf("down: %v", err)
+	}
+	if _, err := db.Exec(`SELECT from_account_id, to_account_id FROM currency_exchanges`); err == nil {
+		t.Fatalf("expected the account columns to be dropped")
+	}
+}
+
+func TestMigrationListsPaired(t *testing.T) {
+	if len(sqliteMigrations) != len(postgresMigrations) {
+		t.Fatalf("expected as many sqlite as postgres migrations, got %d and %d", len(sqliteMigrations), len(postgresMigrations))
+	}
+	for i, m := range sqliteMigrations {
+		if other := postgresMigrations[i]; m.Version != other.Version || m.Name != other.Name {
+			t.Fatalf("migration %d differs: sqlite %d %s, postgres %d %s", i, m.Version, m.Name, other.Version, other.Name)
+		}
+	}
+}
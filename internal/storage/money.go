@@ -0,0 +1,276 @@
+package storage
+
+import (
+	"fmt"
+	"math/big"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Money is an exact decimal amount, Units × 10^-Scale. Amounts of expenses
+// and recurring rules are kept at the decimal places of their currency, so
+// their Units are minor units: -1250 at scale 2 is -12.50 usd.
+type Money struct {
+	Units int64
+	Scale int
+}
+
+// maxMoneyDigits keeps every parsed amount within int64
+const maxMoneyDigits = 18
+
+// CurrencyDecimals returns the minor unit of a currency in the catalog;
+// unknown codes use 2
+func CurrencyDecimals(currency string) int {
+	if info, ok := LookupCurrency(currency); ok {
+		return info.Decimals
+	}
+	return 2
+}
+
+func NewMoney(units int64, scale int) Money {
+	return Money{Units: units, Scale: scale}
+}
+
+// ParseMoney reads a plain decimal such as "-12.50" exactly; exponents and
+// thousands separators are refused
+func ParseMoney(s string) (Money, error) {
+	text := strings.TrimSpace(s)
+	digits := text
+	if strings.HasPrefix(digits, "-") || strings.HasPrefix(digits, "+") {
+		digits = digits[1:]
+	}
+	whole, fraction, hasPoint := strings.Cut(digits, ".")
+	if whole == "" && fraction == "" || hasPoint && fraction == "" {
+		return Money{}, fmt.Errorf("invalid amount %q", s)
+	}
+	for _, part := range []string{whole, fraction} {
+		if strings.Trim(part, "0123456789") != "" {
+			return Money{}, fmt.Errorf("invalid amount %q", s)
+		}
+	}
+	all := strings.TrimLeft(whole+fraction, "0")
+	if len(all) > maxMoneyDigits {
+		return Money{}, fmt.Errorf("amount %q has more than %d digits", s, maxMoneyDigits)
+	}
+	units := int64(0)
+	if all != "" {
+		var err error
+		if units, err = strconv.ParseInt(all, 10, 64); err != nil {
+			return Money{}, fmt.Errorf("invalid amount %q", s)
+		}
+	}
+	if strings.HasPrefix(text, "-") {
+		units = -units
+	}
+	return Money{Units: units, Scale: len(fraction)}, nil
+}
+
+// MustParseMoney is ParseMoney for constants; it panics on invalid input
+func MustParseMoney(s string) Money {
+	m, err := ParseMoney(s)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+func (m Money) String() string {
+	units := strconv.FormatInt(m.Units, 10)
+	sign := ""
+	if m.Units < 0 {
+		sign, units = "-", units[1:]
+	}
+	if m.Scale <= 0 {
+		return sign + units
+	}
+	if len(units) <= m.Scale {
+		units = strings.Repeat("0", m.Scale-len(units)+1) + units
+	}
+	return sign + units[:len(units)-m.Scale] + "." + units[len(units)-m.Scale:]
+}
+
+// MarshalJSON writes the amount as a JSON number with all of its decimals
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON reads a JSON number, or a string holding one, without going
+// through float64
+func (m *Money) UnmarshalJSON(data []byte) error {
+	text := string(data)
+	if text == "null" {
+		return nil
+	}
+	if unquoted, err := strconv.Unquote(text); err == nil {
+		text = unquoted
+	}
+	parsed, err := ParseMoney(text)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+func (m Money) IsZero() bool { return m.Units == 0 }
+
+func (m Money) Sign() int {
+	switch {
+	case m.Units < 0:
+		return -1
+	case m.Units > 0:
+		return 1
+	}
+	return 0
+}
+
+func (m Money) Neg() Money {
+	return Money{Units: -m.Units, Scale: m.Scale}
+}
+
+func (m Money) rat() *big.Rat {
+	return new(big.Rat).SetFrac(big.NewInt(m.Units), new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(m.Scale)), nil))
+}
+
+// Cmp compares amounts regardless of their scales
+func (m Money) Cmp(other Money) int {
+	return m.rat().Cmp(other.rat())
+}
+
+// Equal reports whether both amounts are the same number; 1.5 equals 1.50
+func (m Money) Equal(other Money) bool {
+	return m.Cmp(other) == 0
+}
+
+// Rescale returns the same amount with scale decimals, failing when digits
+// would be lost or the units would overflow
+func (m Money) Rescale(scale int) (Money, error) {
+	if scale < 0 {
+		return Money{}, fmt.Errorf("invalid scale %d", scale)
+	}
+	units := new(big.Int).Mul(big.NewInt(m.Units), new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil))
+	units, rem := units.QuoRem(units, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(m.Scale)), nil), new(big.Int))
+	if rem.Sign() != 0 {
+		return Money{}, fmt.Errorf("amount %s has more than %d decimal places", m, scale)
+	}
+	if !units.IsInt64() {
+		return Money{}, fmt.Errorf("amount %s is too large", m)
+	}
+	return Money{Units: units.Int64(), Scale: scale}, nil
+}
+
+// In normalizes the amount to the minor units of currency
+func (m Money) In(currency string) (Money, error) {
+	normalized, err := m.Rescale(CurrencyDecimals(currency))
+	if err != nil {
+		return Money{}, fmt.Errorf("invalid %s amount: %v", strings.ToLower(currency), err)
+	}
+	return normalized, nil
+}
+
+// Add sums two amounts at the larger of their scales, failing when either
+// amount or the sum no longer fits
+func (m Money) Add(other Money) (Money, error) {
+	scale := max(m.Scale, other.Scale)
+	a, err := m.Rescale(scale)
+	if err != nil {
+		return Money{}, err
+	}
+	b, err := other.Rescale(scale)
+	if err != nil {
+		return Money{}, err
+	}
+	sum := a.Units + b.Units
+	if b.Units > 0 && sum < a.Units || b.Units < 0 && sum > a.Units {
+		return Money{}, fmt.Errorf("sum of %s and %s is too large", m, other)
+	}
+	return Money{Units: sum, Scale: scale}, nil
+}
+
+// normalizeAmount checks the currency against the catalog and brings the
+// amount of an expense to its minor units
+func (e *Expense) normalizeAmount() error {
+	currency, err := ValidateCurrencyCode(e.Currency)
+	if err != nil {
+		return err
+	}
+	e.Currency = currency
+	amount, err := e.Amount.In(e.Currency)
+	if err != nil {
+		return err
+	}
+	e.Amount = amount
+	return nil
+}
+
+func (re *RecurringExpense) normalizeAmount() error {
+	currency, err := ValidateCurrencyCode(re.Currency)
+	if err != nil {
+		return err
+	}
+	re.Currency = currency
+	amount, err := re.Amount.In(re.Currency)
+	if err != nil {
+		return err
+	}
+	re.Amount = amount
+	re.AmountChanges = slices.Clone(re.AmountChanges)
+	for i := range re.AmountChanges {
+		if re.AmountChanges[i].Amount, err = re.AmountChanges[i].Amount.In(re.Currency); err != nil {
+			return err
+		}
+	}
+	re.Overrides = slices.Clone(re.Overrides)
+	for i := range re.Overrides {
+		if err := re.Overrides[i].normalizeAmount(re.Currency); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// amountAtScale is the amount column expressed in units of 10^-scale, so
+// thresholds compare alike across currencies with different minor units;
+// scale must be at least the decimals of every currency
+func amountAtScale(scale int) string {
+	factor := func(decimals int) string {
+		return "1" + strings.Repeat("0", scale-decimals)
+	}
+	var cases []string
+	for _, currency := range currencyCatalog {
+		if currency.Decimals != 2 {
+			cases = append(cases, fmt.Sprintf("WHEN '%s' THEN %s", currency.Code, factor(currency.Decimals)))
+		}
+	}
+	if len(cases) == 0 {
+		if scale == 2 {
+			return "amount"
+		}
+		return "amount * " + factor(2)
+	}
+	return fmt.Sprintf("amount * CASE currency %s ELSE %s END", strings.Join(cases, " "), factor(2))
+}
+
+// maxCurrencyDecimals is the largest minor unit in the catalog
+func maxCurrencyDecimals() int {
+	largest := 2
+	for _, currency := range currencyCatalog {
+		largest = max(largest, currency.Decimals)
+	}
+	return largest
+}
+
+// moneyFromRat rounds an exact value to scale decimals, halves away from zero
+func moneyFromRat(r *big.Rat, scale int) (Money, error) {
+	scaled := new(big.Rat).Mul(r, new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil)))
+	units, rem := new(big.Int).QuoRem(scaled.Num(), scaled.Denom(), new(big.Int))
+	// |rem| / denom >= 1/2 rounds away from zero
+	if new(big.Int).Mul(new(big.Int).Abs(rem), big.NewInt(2)).Cmp(scaled.Denom()) >= 0 {
+		units.Add(units, big.NewInt(int64(scaled.Num().Sign())))
+	}
+	if !units.IsInt64() {
+		return Money{}, fmt.Errorf("amount %s is too large", scaled.FloatString(0))
+	}
+	return Money{Units: units.Int64(), Scale: scale}, nil
+}
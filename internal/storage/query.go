@@ -0,0 +1,311 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ExpenseFilter narrows an expense listing; zero-valued fields do not filter
+type ExpenseFilter struct {
+	From        time.Time // inclusive
+	To          time.Time // inclusive
+	Categories  []string  // any of
+	Tags        []string  // expense has any of these tags
+	Source      string
+	Card        string
+	Account     string   // account id, on either side of a transfer
+	Types       []string // any of expense, income and transfer
+	Currency    string
+	MinAmount   *Money
+	MaxAmount   *Money
+	Recurring   *bool  // true: only generated by a recurring rule, false: only one-off
+	Exchanges   *bool  // true: only legs of currency exchanges, false: none of them
+	Transfers   *bool  // true: only transfers, exchange legs included, false: none of them
+	Installment string // id of an installment purchase
+	Name        string // case-insensitive substring
+}
+
+// Matches reports whether an expense passes the filter; backends without a
+// query language (memory) use it directly
+func (f ExpenseFilter) Matches(e Expense) bool {
+	if !f.From.IsZero() && e.Date.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && e.Date.After(f.To) {
+		return false
+	}
+	if len(f.Categories) > 0 && !slices.Contains(f.Categories, e.Category) {
+		return false
+	}
+	if len(f.Tags) > 0 && !slices.ContainsFunc(e.Tags, func(tag string) bool { return slices.Contains(f.Tags, tag) }) {
+		return false
+	}
+	if f.Source != "" && e.Source != f.Source {
+		return false
+	}
+	if f.Card != "" && e.Card != f.Card {
+		return false
+	}
+	if f.Account != "" && e.AccountID != f.Account && e.ToAccountID != f.Account {
+		return false
+	}
+	if len(f.Types) > 0 && !slices.Contains(f.Types, e.Type) {
+		return false
+	}
+	if f.Currency != "" && e.Currency != f.Currency {
+		return false
+	}
+	if f.MinAmount != nil && e.Amount.Cmp(*f.MinAmount) < 0 {
+		return false
+	}
+	if f.MaxAmount != nil && e.Amount.Cmp(*f.MaxAmount) > 0 {
+		return false
+	}
+	if f.Recurring != nil && (e.RecurringID != "") != *f.Recurring {
+		return false
+	}
+	if f.Installment != "" && e.InstallmentID != f.Installment {
+		return false
+	}
+	if f.Exchanges != nil && (e.ExchangeID != "") != *f.Exchanges {
+		return false
+	}
+	if f.Transfers != nil && (e.Type == TransactionTypeTransfer) != *f.Transfers {
+		return false
+	}
+	if f.Name != "" && !strings.Contains(strings.ToLower(e.Name), strings.ToLower(f.Name)) {
+		return false
+	}
+	return true
+}
+
+// expense listings are ordered newest first with the id as tie-breaker
+func compareExpenses(a, b Expense) int {
+	if c := b.Date.Compare(a.Date); c != 0 {
+		return c
+	}
+	return strings.Compare(b.ID, a.ID)
+}
+
+// ExpenseCursor is the keyset position of the last expense of a page
+type ExpenseCursor struct {
+	Date time.Time
+	ID   string
+}
+
+// CursorAfter returns the cursor that continues a listing after e
+func CursorAfter(e Expense) *ExpenseCursor {
+	return &ExpenseCursor{Date: e.Date, ID: e.ID}
+}
+
+// precedes reports whether e comes after the cursor in listing order
+func (c ExpenseCursor) precedes(e Expense) bool {
+	return compareExpenses(Expense{Date: c.Date, ID: c.ID}, e) < 0
+}
+
+// String encodes the cursor as an opaque URL-safe token
+func (c ExpenseCursor) String() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(c.Date.UTC().Format(time.RFC3339Nano) + "|" + c.ID))
+}
+
+// ParseExpenseCursor decodes a token produced by ExpenseCursor.String
+func ParseExpenseCursor(token string) (ExpenseCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return ExpenseCursor{}, fmt.Errorf("invalid cursor: %s", token)
+	}
+	date, id, ok := strings.Cut(string(raw), "|")
+	if !ok || id == "" {
+		return ExpenseCursor{}, fmt.Errorf("invalid cursor: %s", token)
+	}
+	parsed, err := time.Parse(time.RFC3339Nano, date)
+	if err != nil {
+		return ExpenseCursor{}, fmt.Errorf("invalid cursor: %s", token)
+	}
+	return ExpenseCursor{Date: parsed, ID: id}, nil
+}
+
+// ExpensePage is one page of a keyset-paginated listing
+type ExpensePage struct {
+	Expenses []Expense
+	Next     *ExpenseCursor // nil on the last page
+}
+
+// pageOf trims a result fetched with limit+1 rows into a page
+func pageOf(expenses []Expense, limit int) ExpensePage {
+	if limit <= 0 || len(expenses) <= limit {
+		return ExpensePage{Expenses: expenses}
+	}
+	expenses = expenses[:limit]
+	return ExpensePage{Expenses: expenses, Next: CursorAfter(expenses[limit-1])}
+}
+
+// sqlDialect captures the syntax differences between the SQL backends
+type sqlDialect struct {
+	placeholder func(n int) string
+	like        string                    // case-insensitive LIKE operator
+	tagsJSON    func(link tagLink) string // JSON array of the owner row's tag names, in order
+}
+
+var postgresDialect = sqlDialect{
+	placeholder: postgresPlaceholder,
+	like:        "ILIKE",
+	tagsJSON: func(link tagLink) string {
+		return fmt.Sprintf(`(SELECT COALESCE(json_agg(t.name ORDER BY l.position), '[]')::text FROM %s l JOIN tags t ON t.id = l.tag_id WHERE l.%s = %s.id)`,
+			link.table, link.owner, link.ownerTable)
+	},
+}
+
+var sqliteDialect = sqlDialect{
+	placeholder: sqlitePlaceholder,
+	like:        "LIKE",
+	tagsJSON: func(link tagLink) string {
+		return fmt.Sprintf(`(SELECT json_group_array(t.name ORDER BY l.position) FROM %s l JOIN tags t ON t.id = l.tag_id WHERE l.%s = %s.id)`,
+			link.table, link.owner, link.ownerTable)
+	},
+}
+
+// escapeLike makes user input literal inside a LIKE pattern using '\' as escape
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// expenseWhere renders the filter, and the keyset position when after is set,
+// as a WHERE clause and its bound arguments
+func (d sqlDialect) expenseWhere(f ExpenseFilter, after *ExpenseCursor) (string, []any) {
+	// trashed expenses never show up in listings
+	conds := []string{"deleted_at IS NULL"}
+	var args []any
+	bind := func(v any) string {
+		args = append(args, v)
+		return d.placeholder(len(args))
+	}
+	bindAll := func(values []string) []string {
+		var placeholders []string
+		for _, v := range values {
+			placeholders = append(placeholders, bind(v))
+		}
+		return placeholders
+	}
+
+	if !f.From.IsZero() {
+		conds = append(conds, "date >= "+bind(f.From.UTC()))
+	}
+	if !f.To.IsZero() {
+		conds = append(conds, "date <= "+bind(f.To.UTC()))
+	}
+	if len(f.Categories) > 0 {
+		conds = append(conds, fmt.Sprintf("category IN (%s)", strings.Join(bindAll(f.Categories), ", ")))
+	}
+	if len(f.Tags) > 0 {
+		conds = append(conds, tagsMatch(bindAll(f.Tags)))
+	}
+	if f.Source != "" {
+		conds = append(conds, "source = "+bind(f.Source))
+	}
+	if f.Card != "" {
+		conds = append(conds, "card = "+bind(f.Card))
+	}
+	if f.Account != "" {
+		conds = append(conds, fmt.Sprintf("(account_id = %s OR to_account_id = %s)", bind(f.Account), bind(f.Account)))
+	}
+	if len(f.Types) > 0 {
+		conds = append(conds, fmt.Sprintf("type IN (%s)", strings.Join(bindAll(f.Types), ", ")))
+	}
+	if f.Currency != "" {
+		conds = append(conds, "currency = "+bind(f.Currency))
+	}
+	if f.MinAmount != nil {
+		conds = append(conds, amountBound(">=", *f.MinAmount, bind))
+	}
+	if f.MaxAmount != nil {
+		conds = append(conds, amountBound("<=", *f.MaxAmount, bind))
+	}
+	if f.Recurring != nil {
+		if *f.Recurring {
+			conds = append(conds, "COALESCE(recurring_id, '') <> ''")
+		} else {
+			conds = append(conds, "COALESCE(recurring_id, '') = ''")
+		}
+	}
+	if f.Installment != "" {
+		conds = append(conds, "installment_id = "+bind(f.Installment))
+	}
+	if f.Exchanges != nil {
+		if *f.Exchanges {
+			conds = append(conds, "COALESCE(exchange_id, '') <> ''")
+		} else {
+			conds = append(conds, "COALESCE(exchange_id, '') = ''")
+		}
+	}
+	if f.Transfers != nil {
+		if *f.Transfers {
+			conds = append(conds, "type = 'transfer'")
+		} else {
+			conds = append(conds, "type <> 'transfer'")
+		}
+	}
+	if f.Name != "" {
+		conds = append(conds, fmt.Sprintf(`name %s %s ESCAPE '\'`, d.like, bind("%"+escapeLike(f.Name)+"%")))
+	}
+	if after != nil {
+		conds = append(conds, fmt.Sprintf("(date, id) < (%s, %s)", bind(after.Date.UTC()), bind(after.ID)))
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+// streamExpenseRows runs a listing query against either SQL backend and hands
+// each row to fn as it is scanned; a limit <= 0 means no limit
+func (d sqlDialect) streamExpenseRows(db *sql.DB, f ExpenseFilter, after *ExpenseCursor, limit int, fn func(Expense) error) error {
+	where, args := d.expenseWhere(f, after)
+	query := `SELECT ` + d.expenseColumns() + ` FROM expenses` + where + ` ORDER BY date DESC, id DESC`
+	if limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", limit)
+	}
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query expenses: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		expense, err := scanExpense(rows)
+		if err != nil {
+			return fmt.Errorf("failed to scan expense: %v", err)
+		}
+		if err := fn(expense); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// queryExpensePage fetches one extra row to learn whether another page follows
+func (d sqlDialect) queryExpensePage(db *sql.DB, f ExpenseFilter, after *ExpenseCursor, limit int) (ExpensePage, error) {
+	var expenses []Expense
+	err := d.streamExpenseRows(db, f, after, limit+1, func(e Expense) error {
+		expenses = append(expenses, e)
+		return nil
+	})
+	if err != nil {
+		return ExpensePage{}, err
+	}
+	return pageOf(expenses, limit), nil
+}
+
+// amountBound compares the amount column, held in minor units, with an exact
+// bound; a bound beyond int64 at the common scale decides the condition alone
+func amountBound(op string, bound Money, bind func(any) string) string {
+	scale := max(bound.Scale, maxCurrencyDecimals())
+	scaled, err := bound.Rescale(scale)
+	if err != nil {
+		if (bound.Sign() > 0) == (op == "<=") {
+			return "1 = 1"
+		}
+		return "1 = 0"
+	}
+	return amountAtScale(scale) + " " + op + " " + bind(scaled.Units)
+}
@@ -0,0 +1,218 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ExchangeRate is the value of one unit of Currency in Quote, in effect from
+// Date until the next rate of the same pair
+type ExchangeRate struct {
+	Date     time.Time `json:"date"` // midnight UTC of the first day the rate applies
+	Currency string    `json:"currency"`
+	Quote    string    `json:"quote"`
+	Rate     Money     `json:"rate"` // exact decimal, not tied to the decimals of a currency
+}
+
+// Validate lowercases the pair and truncates the date to its day
+func (r *ExchangeRate) Validate() error {
+	r.Currency = strings.ToLower(strings.TrimSpace(r.Currency))
+	r.Quote = strings.ToLower(strings.TrimSpace(r.Quote))
+	for _, currency := range []string{r.Currency, r.Quote} {
+		if _, ok := LookupCurrency(currency); !ok {
+			return fmt.Errorf("invalid currency: '%s'", currency)
+		}
+	}
+	if r.Currency == r.Quote {
+		return fmt.Errorf("exchange rate needs two different currencies, got %s twice", r.Currency)
+	}
+	if r.Rate.Sign() <= 0 {
+		return fmt.Errorf("exchange rate must be positive")
+	}
+	if r.Date.IsZero() {
+		return fmt.Errorf("exchange rate 'date' cannot be empty")
+	}
+	r.Date = rateDay(r.Date)
+	return nil
+}
+
+// rateDay keeps the calendar day of t as midnight UTC
+func rateDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func compareRates(a, b ExchangeRate) int {
+	if c := strings.Compare(a.Currency, b.Currency); c != 0 {
+		return c
+	}
+	if c := strings.Compare(a.Quote, b.Quote); c != 0 {
+		return c
+	}
+	return a.Date.Compare(b.Date)
+}
+
+// validateLockedRate checks the optional rate locked on an expense; its quote
+// currency defaults to base
+func (e *Expense) validateLockedRate(base string) error {
+	if e.Rate == nil {
+		e.RateCurrency = ""
+		return nil
+	}
+	if e.Rate.Sign() <= 0 {
+		return fmt.Errorf("expense 'rate' must be positive")
+	}
+	e.RateCurrency = strings.ToLower(strings.TrimSpace(e.RateCurrency))
+	if e.RateCurrency == "" {
+		e.RateCurrency = base
+	}
+	if _, ok := LookupCurrency(e.RateCurrency); !ok {
+		return fmt.Errorf("invalid rate currency: '%s'", e.RateCurrency)
+	}
+	return nil
+}
+
+// RateTable converts amounts with a set of exchange rates
+type RateTable struct {
+	pairs map[[2]string][]ExchangeRate // oldest first
+}
+
+func NewRateTable(rates []ExchangeRate) *RateTable {
+	t := &RateTable{pairs: map[[2]string][]ExchangeRate{}}
+	for _, rate := range rates {
+		key := [2]string{rate.Currency, rate.Quote}
+		t.pairs[key] = append(t.pairs[key], rate)
+	}
+	for _, pair := range t.pairs {
+		slices.SortFunc(pair, compareRates)
+	}
+	return t
+}
+
+// effective returns the latest rate of a pair dated on or before date
+func (t *RateTable) effective(currency, quote string, date time.Time) (ExchangeRate, bool) {
+	pair := t.pairs[[2]string{currency, quote}]
+	i, _ := slices.BinarySearchFunc(pair, date, func(r ExchangeRate, d time.Time) int {
+		if r.Date.After(d) {
+			return 1
+		}
+		return -1
+	})
+	if i == 0 {
+		return ExchangeRate{}, false
+	}
+	return pair[i-1], true
+}
+
+// Lookup returns the rate in effect on date for one unit of currency in quote.
+// The most recent of the direct pair and the inverse pair wins, the direct one
+// on the same day.
+func (t *RateTable) Lookup(currency, quote string, date time.Time) (*big.Rat, bool) {
+	if currency == quote {
+		return big.NewRat(1, 1), true
+	}
+	direct, hasDirect := t.effective(currency, quote, date)
+	inverse, hasInverse := t.effective(quote, currency, date)
+	switch {
+	case hasDirect && (!hasInverse || !inverse.Date.After(direct.Date)):
+		return direct.Rate.rat(), true
+	case hasInverse:
+		return new(big.Rat).Inv(inverse.Rate.rat()), true
+	}
+	return nil, false
+}
+
+// Convert returns the amount of an expense in base, using the rate locked on
+// the expense when it quotes base and the table otherwise; false when no rate
+// applies
+func (t *RateTable) Convert(e Expense, base string) (Money, bool) {
+	rate, ok := t.Lookup(e.Currency, base, e.Date)
+	if e.Rate != nil && e.RateCurrency == base && e.Currency != base {
+		rate, ok = e.Rate.rat(), true
+	}
+	if !ok {
+		return Money{}, false
+	}
+	converted, err := moneyFromRat(new(big.Rat).Mul(e.Amount.rat(), rate), CurrencyDecimals(base))
+	if err != nil {
+		return Money{}, false
+	}
+	return converted, true
+}
+
+// listExchangeRates returns every stored rate ordered by pair and date
+func (d sqlDialect) listExchangeRates(db *sql.DB) ([]ExchangeRate, error) {
+	rows, err := db.Query(`SELECT date, currency, quote, rate FROM exchange_rates ORDER BY currency, quote, date`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query exchange rates: %v", err)
+	}
+	defer rows.Close()
+	var rates []ExchangeRate
+	for rows.Next() {
+		var rate ExchangeRate
+		var value string
+		if err := rows.Scan(&rate.Date, &rate.Currency, &rate.Quote, &value); err != nil {
+			return nil, fmt.Errorf("failed to scan exchange rate: %v", err)
+		}
+		if rate.Rate, err = ParseMoney(value); err != nil {
+			return nil, fmt.Errorf("failed to parse exchange rate %s/%s: %v", rate.Currency, rate.Quote, err)
+		}
+		rate.Date = rate.Date.UTC()
+		rates = append(rates, rate)
+	}
+	return rates, rows.Err()
+}
+
+// saveExchangeRates upserts the rates in one transaction, replacing the rate
+// of a pair already stored for the same day
+func (d sqlDialect) saveExchangeRates(db *sql.DB, rates []ExchangeRate) error {
+	rates = slices.Clone(rates)
+	for i := range rates {
+		if err := rates[i].Validate(); err != nil {
+			return err
+		}
+	}
+	return withTx(db, func(tx *sql.Tx) error {
+		for _, rate := range rates {
+			if err := d.upsertRate(tx, rate); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// upsertRate stores a validated rate, replacing the one of the same pair and day
+func (d sqlDialect) upsertRate(tx *sql.Tx, rate ExchangeRate) error {
+	upsert := fmt.Sprintf(`INSERT INTO exchange_rates (date, currency, quote, rate) VALUES (%s, %s, %s, %s)
+		ON CONFLICT (currency, quote, date) DO UPDATE SET rate = EXCLUDED.rate`,
+		d.placeholder(1), d.placeholder(2), d.placeholder(3), d.placeholder(4))
+	if _, err := tx.Exec(upsert, rate.Date, rate.Currency, rate.Quote, rate.Rate.String()); err != nil {
+		return fmt.Errorf("failed to save exchange rate %s/%s: %v", rate.Currency, rate.Quote, err)
+	}
+	return nil
+}
+
+func (d sqlDialect) deleteExchangeRate(db *sql.DB, date time.Time, currency, quote string) error {
+	query := fmt.Sprintf(`DELETE FROM exchange_rates WHERE date = %s AND currency = %s AND quote = %s`,
+		d.placeholder(1), d.placeholder(2), d.placeholder(3))
+	res, err := db.Exec(query, rateDay(date), strings.ToLower(currency), strings.ToLower(quote))
+	if err != nil {
+		return fmt.Errorf("failed to delete exchange rate: %v", err)
+	}
+	if rowsAffected, _ := res.RowsAffected(); rowsAffected == 0 {
+		return fmt.Errorf("exchange rate %s/%s on %s not found", currency, quote, date.Format(time.DateOnly))
+	}
+	return nil
+}
+
+// lockedRateArgs are the values of the rate and rate_currency columns
+func lockedRateArgs(e Expense) (any, any) {
+	if e.Rate == nil {
+		return nil, nil
+	}
+	return e.Rate.String(), e.RateCurrency
+}
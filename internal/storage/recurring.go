@@ -0,0 +1,373 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RecurringHorizon is how far ahead occurrences of recurring rules are kept
+// as expenses: up to the start of the month after the next one. Later
+// occurrences are written as the horizon rolls forward.
+func RecurringHorizon(now time.Time) time.Time {
+	now = now.UTC()
+	return time.Date(now.Year(), now.Month()+2, 1, 0, 0, 0, 0, time.UTC)
+}
+
+// recurrence is the rule of the expense; without an RRule the Interval and
+// Occurrences read as its FREQ and COUNT
+func (re RecurringExpense) recurrence() (recurrence, error) {
+	if re.RRule != "" {
+		return parseRRule(re.RRule)
+	}
+	switch re.Interval {
+	case "daily", "weekly", "monthly", "yearly":
+		return recurrence{freq: strings.ToUpper(re.Interval), interval: 1, count: re.Occurrences, clamp: true}, nil
+	}
+	return recurrence{}, fmt.Errorf("invalid interval: '%s'", re.Interval)
+}
+
+// AmountChange sets the amount of the occurrences of a rule scheduled from
+// a date on, such as a rent raise mid-contract
+type AmountChange struct {
+	From   time.Time `json:"from"`
+	Amount Money     `json:"amount"` // in the minor units of the rule's currency once stored
+}
+
+// RecurringOverride edits or skips the occurrence of a rule scheduled on
+// Occurrence, which stays an occurrence of the rule
+type RecurringOverride struct {
+	Occurrence time.Time  `json:"occurrence"`
+	Skip       bool       `json:"skip,omitempty"`
+	Name       string     `json:"name,omitempty"`
+	Amount     *Money     `json:"amount,omitempty"`
+	Date       *time.Time `json:"date,omitempty"` // moves the occurrence
+}
+
+// Validate drops the edits of a skipped occurrence
+func (o *RecurringOverride) Validate() error {
+	if o.Occurrence.IsZero() {
+		return fmt.Errorf("override 'occurrence' cannot be empty")
+	}
+	o.Name = SanitizeString(o.Name)
+	if o.Date != nil && o.Date.IsZero() {
+		o.Date = nil
+	}
+	if o.Skip {
+		o.Name, o.Amount, o.Date = "", nil, nil
+	}
+	return nil
+}
+
+// Empty is true for an override changing nothing
+func (o RecurringOverride) Empty() bool {
+	return !o.Skip && o.Name == "" && o.Amount == nil && o.Date == nil
+}
+
+func (o *RecurringOverride) normalizeAmount(currency string) error {
+	if o.Amount == nil {
+		return nil
+	}
+	amount, err := o.Amount.In(currency)
+	if err != nil {
+		return err
+	}
+	o.Amount = &amount
+	return nil
+}
+
+// scheduleJSON encodes the amount changes and overrides of the rule for
+// their columns
+func (re RecurringExpense) scheduleJSON() (string, string, error) {
+	amountChanges, err := json.Marshal(nonNil(re.AmountChanges))
+	if err != nil {
+		return "", "", fmt.Errorf("failed to encode amount changes: %v", err)
+	}
+	overrides, err := json.Marshal(nonNil(re.Overrides))
+	if err != nil {
+		return "", "", fmt.Errorf("failed to encode overrides: %v", err)
+	}
+	return string(amountChanges), string(overrides), nil
+}
+
+// nonNil keeps an empty list encoded as [] rather than null
+func nonNil[T any](list []T) []T {
+	if list == nil {
+		return []T{}
+	}
+	return list
+}
+
+// amountOn is the amount of the occurrence scheduled on date
+func (re RecurringExpense) amountOn(date time.Time) Money {
+	amount := re.Amount
+	for _, change := range re.AmountChanges {
+		if change.From.After(date) {
+			break
+		}
+		amount = change.Amount
+	}
+	return amount
+}
+
+func (re RecurringExpense) override(occurrence time.Time) (RecurringOverride, bool) {
+	for _, o := range re.Overrides {
+		if o.Occurrence.Equal(occurrence) {
+			return o, true
+		}
+	}
+	return RecurringOverride{}, false
+}
+
+// withOverride replaces the override of its occurrence, dropping it when
+// it changes nothing
+func (re RecurringExpense) withOverride(override RecurringOverride) []RecurringOverride {
+	overrides := slices.DeleteFunc(slices.Clone(re.Overrides), func(o RecurringOverride) bool {
+		return o.Occurrence.Equal(override.Occurrence)
+	})
+	if !override.Empty() {
+		overrides = append(overrides, override)
+	}
+	slices.SortFunc(overrides, func(a, b RecurringOverride) int { return a.Occurrence.Compare(b.Occurrence) })
+	return overrides
+}
+
+// Schedules reports whether the rule has an occurrence on date
+func (re RecurringExpense) Schedules(date time.Time, holidays Holidays) bool {
+	rule, err := re.recurrence()
+	if err != nil {
+		return false
+	}
+	dates := rule.dates(re.StartDate, date, re.BusinessDay, holidays)
+	return len(dates) > 0 && dates[len(dates)-1].Equal(date)
+}
+
+// Project returns the occurrences of the rule scheduled after `after` and up
+// to through, as expenses without ids, with the amount changes and
+// overrides applied; a zero after starts at the first one. Holidays only
+// matter to a rule with a business day adjustment.
+func (re RecurringExpense) Project(after, through time.Time, holidays Holidays) []Expense {
+	rule, err := re.recurrence()
+	if err != nil {
+		return nil
+	}
+	var expenses []Expense
+	for _, date := range rule.dates(re.StartDate, through, re.BusinessDay, holidays) {
+		if !date.After(after) {
+			continue
+		}
+		occurrence := date
+		e := Expense{
+			RecurringID: re.ID,
+			Name:        re.Name,
+			Category:    re.Category,
+			Amount:      re.amountOn(date),
+			Currency:    re.Currency,
+			Date:        date,
+			Tags:        re.Tags,
+			AccountID:   re.AccountID,
+			Source:      re.Source,
+			Card:        re.Card,
+			Occurrence:  &occurrence,
+		}
+		if o, ok := re.override(date); ok {
+			if o.Skip {
+				continue
+			}
+			if o.Name != "" {
+				e.Name = o.Name
+			}
+			if o.Amount != nil {
+				e.Amount = *o.Amount
+			}
+			if o.Date != nil {
+				e.Date = *o.Date
+			}
+		}
+		e.Type = typeOfAmount(e.Amount)
+		expenses = append(expenses, e)
+	}
+	return expenses
+}
+
+// resolveAccount points the rule at an account the way resolve points an
+// expense; current is the account the rule had before the change
+func (re *RecurringExpense) resolveAccount(resolve func(*Expense, Expense) error, current string) error {
+	e := Expense{Currency: re.Currency, Type: typeOfAmount(re.Amount), AccountID: re.AccountID, Source: re.Source, Card: re.Card}
+	if err := resolve(&e, Expense{AccountID: current}); err != nil {
+		return err
+	}
+	re.AccountID, re.Source, re.Card = e.AccountID, e.Source, e.Card
+	return nil
+}
+
+// instances are the occurrences to store, with fresh ids
+func (re RecurringExpense) instances(after, through time.Time, holidays Holidays) []Expense {
+	expenses := re.Project(after, through, holidays)
+	for i := range expenses {
+		expenses[i].ID = uuid.New().String()
+	}
+	return expenses
+}
+
+// pending is where materializing a rule up to through resumes, and whether
+// anything is left to write
+func (re RecurringExpense) pending(through time.Time) (time.Time, bool) {
+	if re.MaterializedThrough == nil {
+		return time.Time{}, true
+	}
+	return *re.MaterializedThrough, re.MaterializedThrough.Before(through)
+}
+
+// materializeRecurring writes the occurrences of every rule dated after its
+// watermark and up to through, then moves the watermark; insert is the bulk
+// loader of the backend. A rule edited meanwhile is skipped, its edit having
+// regenerated the instances.
+func (d sqlDialect) materializeRecurring(db *sql.DB, through time.Time, insert func(*sql.Tx, []Expense) error) (int, error) {
+	through = through.UTC()
+	written := 0
+	err := withTx(db, func(tx *sql.Tx) error {
+		rows, err := tx.Query(`SELECT ` + d.recurringColumns() + ` FROM recurring_expenses`)
+		if err != nil {
+			return fmt.Errorf("failed to query recurring expenses: %v", err)
+		}
+		var rules []RecurringExpense
+		for rows.Next() {
+			re, err := scanRecurringExpense(rows)
+			if err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan recurring expense: %v", err)
+			}
+			rules = append(rules, re)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		holidays, err := d.loadHolidays(tx)
+		if err != nil {
+			return err
+		}
+		update := fmt.Sprintf(`UPDATE recurring_expenses SET materialized_through = %s WHERE id = %s AND version = %s`,
+			d.placeholder(1), d.placeholder(2), d.placeholder(3))
+		for _, re := range rules {
+			after, ok := re.pending(through)
+			if !ok {
+				continue
+			}
+			res, err := tx.Exec(update, through, re.ID, re.Version)
+			if err != nil {
+				return fmt.Errorf("failed to move recurring expense horizon: %v", err)
+			}
+			if n, _ := res.RowsAffected(); n == 0 {
+				continue
+			}
+			instances := re.instances(after, through, holidays)
+			if err := insert(tx, instances); err != nil {
+				return err
+			}
+			written += len(instances)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return written, nil
+}
+
+// occurrenceError refuses changes to an expense its rule still generates;
+// a later change of the rule would undo them, so they go through an override
+func occurrenceError(e Expense) error {
+	return fmt.Errorf("expense %s is an occurrence of recurring expense %s; override the occurrence instead", e.ID, e.RecurringID)
+}
+
+// ruleOccurrence returns occurrenceError when the rule of e still exists;
+// the kept instances of a removed rule are plain expenses
+func (d sqlDialect) ruleOccurrence(tx *sql.Tx, e Expense) error {
+	if e.RecurringID == "" {
+		return nil
+	}
+	var exists bool
+	query := fmt.Sprintf(`SELECT EXISTS (SELECT 1 FROM recurring_expenses WHERE id = %s)`, d.placeholder(1))
+	if err := tx.QueryRow(query, e.RecurringID).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to read recurring expense: %v", err)
+	}
+	if exists {
+		return occurrenceError(e)
+	}
+	return nil
+}
+
+// overrideOccurrence stores the override of one occurrence of a rule and
+// rewrites its expense when the occurrence is within the stored horizon
+func (d sqlDialect) overrideOccurrence(db *sql.DB, id string, override RecurringOverride, version int64, insert func(*sql.Tx, []Expense) error) error {
+	if err := override.Validate(); err != nil {
+		return err
+	}
+	return withTx(db, func(tx *sql.Tx) error {
+		before, err := d.loadRecurring(tx, id)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("recurring expense with ID %s not found", id)
+		} else if err != nil {
+			return fmt.Errorf("failed to read recurring expense rule: %v", err)
+		}
+		holidays, err := d.loadHolidays(tx)
+		if err != nil {
+			return err
+		}
+		if !before.Schedules(override.Occurrence, holidays) {
+			return fmt.Errorf("recurring expense %s has no occurrence on %s", id, override.Occurrence.Format(time.RFC3339))
+		}
+		if err := override.normalizeAmount(before.Currency); err != nil {
+			return err
+		}
+		after := before
+		after.Overrides = before.withOverride(override)
+		_, overrides, err := after.scheduleJSON()
+		if err != nil {
+			return err
+		}
+		match, matchArgs := d.versionMatch(version, 3)
+		res, err := tx.Exec(fmt.Sprintf(`UPDATE recurring_expenses SET overrides = %s, version = version + 1 WHERE id = %s`,
+			d.placeholder(1), d.placeholder(2))+match, append([]any{overrides, id}, matchArgs...)...)
+		if err != nil {
+			return fmt.Errorf("failed to save override: %v", err)
+		}
+		if rowsAffected, _ := res.RowsAffected(); rowsAffected == 0 {
+			return d.rowConflict(tx, "recurring_expenses", AuditRecurring, id, fmt.Errorf("recurring expense with ID %s not found", id))
+		}
+		after.Version++
+		_, err = tx.Exec(fmt.Sprintf(`DELETE FROM expenses WHERE recurring_id = %s AND occurrence = %s`,
+			d.placeholder(1), d.placeholder(2)), id, override.Occurrence.UTC())
+		if err != nil {
+			return fmt.Errorf("failed to delete overridden instance: %v", err)
+		}
+		var instances []Expense
+		if after.MaterializedThrough != nil && !override.Occurrence.After(*after.MaterializedThrough) {
+			instances = after.instances(override.Occurrence.Add(-time.Nanosecond), override.Occurrence, holidays)
+			if err := insert(tx, instances); err != nil {
+				return err
+			}
+		}
+		return d.recordAudit(tx, auditChange{entity: AuditRecurring, id: id, action: AuditUpdate,
+			detail: overrideDetail(override), before: before, after: after})
+	})
+}
+
+// overrideDetail describes an override for the audit log
+func overrideDetail(override RecurringOverride) string {
+	day := override.Occurrence.Format("2006-01-02")
+	switch {
+	case override.Skip:
+		return "occurrence of " + day + " skipped"
+	case override.Empty():
+		return "occurrence of " + day + " restored"
+	}
+	return "occurrence of " + day + " overridden"
+}
@@ -0,0 +1,376 @@
+package storage
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Business day adjustments of the occurrences of a recurring rule that fall
+// on a weekend or holiday
+const (
+	BusinessDayFollowing = "following" // moved to the next business day
+	BusinessDayPreceding = "preceding" // moved to the previous business day
+)
+
+// businessDaySlack bounds how far past the horizon an occurrence may fall and
+// still be moved back within it
+const businessDaySlack = 14
+
+// recurrence is an RFC 5545 RRULE limited to the parts a budget needs: FREQ,
+// INTERVAL, COUNT, UNTIL, BYDAY, BYMONTHDAY, BYMONTH and BYSETPOS; weeks
+// start on Monday
+type recurrence struct {
+	freq       string // DAILY, WEEKLY, MONTHLY or YEARLY
+	interval   int
+	count      int       // 0 recurs indefinitely or until
+	until      time.Time // inclusive, zero when unbounded
+	byDay      []weekdayNum
+	byMonthDay []int // negative ones count from the end of the month
+	byMonth    []time.Month
+	bySetPos   []int
+	// clamp moves a start day past the end of a month to its last day
+	// instead of skipping the month, as the older intervals do
+	clamp bool
+}
+
+// weekdayNum is an entry of BYDAY; n is the ordinal within the month,
+// negative from its end, or 0 for every such weekday
+type weekdayNum struct {
+	n   int
+	day time.Weekday
+}
+
+var rruleWeekdays = map[string]time.Weekday{
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+	"SU": time.Sunday,
+}
+
+// NormalizeRRule uppercases a rule and drops its "RRULE:" prefix
+func NormalizeRRule(rule string) string {
+	return strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(rule)), "RRULE:")
+}
+
+func parseRRule(rule string) (recurrence, error) {
+	r := recurrence{interval: 1}
+	seen := map[string]bool{}
+	for _, part := range strings.Split(NormalizeRRule(rule), ";") {
+		if part == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(part, "=")
+		if !ok || value == "" {
+			return recurrence{}, fmt.Errorf("invalid rrule part '%s'", part)
+		}
+		if seen[name] {
+			return recurrence{}, fmt.Errorf("rrule part %s given twice", name)
+		}
+		seen[name] = true
+		var err error
+		switch name {
+		case "FREQ":
+			switch value {
+			case "DAILY", "WEEKLY", "MONTHLY", "YEARLY":
+				r.freq = value
+			default:
+				err = fmt.Errorf("unsupported rrule FREQ '%s'. Must be one of DAILY, WEEKLY, MONTHLY or YEARLY", value)
+			}
+		case "INTERVAL":
+			r.interval, err = parseRRuleNumber(name, value, 1000, false)
+		case "COUNT":
+			r.count, err = parseRRuleNumber(name, value, 10000, false)
+		case "UNTIL":
+			r.until, err = parseRRuleUntil(value)
+		case "BYDAY":
+			r.byDay, err = parseRRuleByDay(value)
+		case "BYMONTHDAY":
+			r.byMonthDay, err = parseRRuleList(name, value, 31, true)
+		case "BYMONTH":
+			var months []int
+			months, err = parseRRuleList(name, value, 12, false)
+			for _, m := range months {
+				r.byMonth = append(r.byMonth, time.Month(m))
+			}
+		case "BYSETPOS":
+			r.bySetPos, err = parseRRuleList(name, value, 366, true)
+		case "WKST":
+			if value != "MO" {
+				err = fmt.Errorf("only WKST=MO is supported")
+			}
+		default:
+			err = fmt.Errorf("unsupported rrule part %s", name)
+		}
+		if err != nil {
+			return recurrence{}, err
+		}
+	}
+	switch {
+	case r.freq == "":
+		return recurrence{}, fmt.Errorf("rrule FREQ is required")
+	case r.count > 0 && !r.until.IsZero():
+		return recurrence{}, fmt.Errorf("rrule cannot have both COUNT and UNTIL")
+	case r.freq == "WEEKLY" && len(r.byMonthDay) > 0:
+		return recurrence{}, fmt.Errorf("rrule BYMONTHDAY is not allowed on a WEEKLY rule")
+	case r.freq == "YEARLY" && len(r.byDay) > 0 && len(r.byMonth) == 0:
+		return recurrence{}, fmt.Errorf("rrule BYDAY on a YEARLY rule needs BYMONTH")
+	case len(r.bySetPos) > 0 && len(r.byDay) == 0 && len(r.byMonthDay) == 0:
+		return recurrence{}, fmt.Errorf("rrule BYSETPOS needs BYDAY or BYMONTHDAY")
+	}
+	for _, d := range r.byDay {
+		if d.n != 0 && r.freq != "MONTHLY" && r.freq != "YEARLY" {
+			return recurrence{}, fmt.Errorf("rrule BYDAY ordinals are only allowed on MONTHLY and YEARLY rules")
+		}
+	}
+	return r, nil
+}
+
+func parseRRuleNumber(name, value string, max int, signed bool) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n == 0 || n > max || n < -max || (n < 0 && !signed) {
+		return 0, fmt.Errorf("invalid rrule %s '%s'", name, value)
+	}
+	return n, nil
+}
+
+func parseRRuleList(name, value string, max int, signed bool) ([]int, error) {
+	var list []int
+	for _, item := range strings.Split(value, ",") {
+		n, err := parseRRuleNumber(name, strings.TrimPrefix(item, "+"), max, signed)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, n)
+	}
+	return list, nil
+}
+
+func parseRRuleByDay(value string) ([]weekdayNum, error) {
+	var days []weekdayNum
+	for _, item := range strings.Split(value, ",") {
+		if len(item) < 2 {
+			return nil, fmt.Errorf("invalid rrule BYDAY '%s'", item)
+		}
+		day, ok := rruleWeekdays[item[len(item)-2:]]
+		if !ok {
+			return nil, fmt.Errorf("invalid rrule BYDAY '%s'", item)
+		}
+		entry := weekdayNum{day: day}
+		if ordinal := item[:len(item)-2]; ordinal != "" {
+			n, err := parseRRuleNumber("BYDAY", strings.TrimPrefix(ordinal, "+"), 5, true)
+			if err != nil {
+				return nil, err
+			}
+			entry.n = n
+		}
+		days = append(days, entry)
+	}
+	return days, nil
+}
+
+// parseRRuleUntil reads a UTC or floating date-time, taken as UTC, or a
+// date, which includes the whole day
+func parseRRuleUntil(value string) (time.Time, error) {
+	for _, layout := range []string{"20060102T150405Z", "20060102T150405"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	t, err := time.Parse("20060102", value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid rrule UNTIL '%s'", value)
+	}
+	return t.AddDate(0, 0, 1).Add(-time.Nanosecond), nil
+}
+
+// dates returns the occurrences from start up to through, moved off weekends
+// and holidays when adjust is set. With an adjustment, BYSETPOS picks among
+// the business days only, so BYDAY=MO,TU,WE,TH,FR;BYSETPOS=3 is the third
+// business day; COUNT and UNTIL apply to the dates before they move.
+func (r recurrence) dates(start, through time.Time, adjust string, holidays Holidays) []time.Time {
+	limit := through
+	if adjust != "" {
+		limit = through.AddDate(0, 0, businessDaySlack)
+	}
+	var dates []time.Time
+	counted := 0
+	for period := 0; ; period++ {
+		begin := r.periodStart(start, period)
+		if begin.After(limit) {
+			return dates
+		}
+		candidates := slices.DeleteFunc(r.expand(start, begin), func(d time.Time) bool { return d.Before(start) })
+		if adjust != "" && len(r.bySetPos) > 0 {
+			candidates = slices.DeleteFunc(candidates, func(d time.Time) bool { return !holidays.IsBusinessDay(d) })
+		}
+		for _, date := range r.setPos(candidates) {
+			if (!r.until.IsZero() && date.After(r.until)) || (r.count > 0 && counted == r.count) {
+				return dates
+			}
+			counted++
+			if adjust != "" {
+				date = holidays.adjust(date, adjust)
+			}
+			// adjusting keeps the dates in order, so none after this one is due
+			if date.After(through) {
+				return dates
+			}
+			// two dates may move onto the same business day
+			if len(dates) > 0 && !date.After(dates[len(dates)-1]) {
+				continue
+			}
+			dates = append(dates, date)
+		}
+	}
+}
+
+// periodStart is the first day of the nth period of the rule
+func (r recurrence) periodStart(start time.Time, n int) time.Time {
+	y, m, d := start.Date()
+	step := n * r.interval
+	switch r.freq {
+	case "DAILY":
+		return time.Date(y, m, d+step, 0, 0, 0, 0, start.Location())
+	case "WEEKLY":
+		monday := d - (int(start.Weekday())+6)%7
+		return time.Date(y, m, monday+7*step, 0, 0, 0, 0, start.Location())
+	case "MONTHLY":
+		return time.Date(y, m+time.Month(step), 1, 0, 0, 0, 0, start.Location())
+	default:
+		return time.Date(y+step, time.January, 1, 0, 0, 0, 0, start.Location())
+	}
+}
+
+// expand lists the candidate dates of the period beginning on begin, in
+// order and at the time of day of start
+func (r recurrence) expand(start, begin time.Time) []time.Time {
+	at := func(y int, m time.Month, d int) time.Time {
+		return time.Date(y, m, d, start.Hour(), start.Minute(), start.Second(), start.Nanosecond(), start.Location())
+	}
+	y, m, d := begin.Date()
+	var dates []time.Time
+	switch r.freq {
+	case "DAILY":
+		last := daysIn(y, m)
+		if r.inMonths(m) && r.matchMonthDay(d, last) && r.matchWeekday(y, m, d, last) {
+			dates = append(dates, at(y, m, d))
+		}
+	case "WEEKLY":
+		for i := range 7 {
+			date := at(y, m, d+i)
+			if r.inMonths(date.Month()) && r.onWeekday(date.Weekday(), start.Weekday()) {
+				dates = append(dates, date)
+			}
+		}
+	case "MONTHLY":
+		if r.inMonths(m) {
+			for _, day := range r.monthDays(y, m, start.Day()) {
+				dates = append(dates, at(y, m, day))
+			}
+		}
+	case "YEARLY":
+		months := r.byMonth
+		if len(months) == 0 {
+			months = []time.Month{start.Month()}
+		}
+		slices.Sort(months)
+		for _, month := range slices.Compact(months) {
+			for _, day := range r.monthDays(y, month, start.Day()) {
+				dates = append(dates, at(y, month, day))
+			}
+		}
+	}
+	return dates
+}
+
+// monthDays are the days of a month the rule falls on; without BYDAY or
+// BYMONTHDAY only the day of the start
+func (r recurrence) monthDays(y int, m time.Month, startDay int) []int {
+	last := daysIn(y, m)
+	if len(r.byDay) == 0 && len(r.byMonthDay) == 0 {
+		if startDay > last {
+			if !r.clamp {
+				return nil
+			}
+			startDay = last
+		}
+		return []int{startDay}
+	}
+	var days []int
+	for day := 1; day <= last; day++ {
+		if r.matchMonthDay(day, last) && r.matchWeekday(y, m, day, last) {
+			days = append(days, day)
+		}
+	}
+	return days
+}
+
+func (r recurrence) inMonths(m time.Month) bool {
+	return len(r.byMonth) == 0 || slices.Contains(r.byMonth, m)
+}
+
+func (r recurrence) matchMonthDay(day, last int) bool {
+	if len(r.byMonthDay) == 0 {
+		return true
+	}
+	for _, n := range r.byMonthDay {
+		if n == day || last+1+n == day {
+			return true
+		}
+	}
+	return false
+}
+
+// matchWeekday checks BYDAY, ordinals counting within the month
+func (r recurrence) matchWeekday(y int, m time.Month, day, last int) bool {
+	if len(r.byDay) == 0 {
+		return true
+	}
+	weekday := time.Date(y, m, day, 0, 0, 0, 0, time.UTC).Weekday()
+	for _, entry := range r.byDay {
+		if entry.day != weekday {
+			continue
+		}
+		if entry.n == 0 || entry.n == (day-1)/7+1 || entry.n == -((last-day)/7+1) {
+			return true
+		}
+	}
+	return false
+}
+
+// onWeekday checks BYDAY on a weekly rule, the weekday of the start by default
+func (r recurrence) onWeekday(weekday, startWeekday time.Weekday) bool {
+	if len(r.byDay) == 0 {
+		return weekday == startWeekday
+	}
+	return slices.ContainsFunc(r.byDay, func(entry weekdayNum) bool { return entry.day == weekday })
+}
+
+// setPos keeps the BYSETPOS positions of the candidates of a period
+func (r recurrence) setPos(candidates []time.Time) []time.Time {
+	if len(r.bySetPos) == 0 {
+		return candidates
+	}
+	var picked []time.Time
+	for _, pos := range r.bySetPos {
+		i := pos - 1
+		if pos < 0 {
+			i = len(candidates) + pos
+		}
+		if i >= 0 && i < len(candidates) {
+			picked = append(picked, candidates[i])
+		}
+	}
+	slices.SortFunc(picked, time.Time.Compare)
+	return slices.CompactFunc(picked, time.Time.Equal)
+}
+
+func daysIn(y int, m time.Month) int {
+	return time.Date(y, m+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
@@ -0,0 +1,566 @@
+package storage
+
+import "database/sql"
+
+// sqliteMigrations mirrors postgresMigrations for the SQLite backend.
+// Never edit an applied migration; append a new one instead.
+var sqliteMigrations = []Migration{
+	{
+		Version: 1,
+		Name:    "initial_schema",
+		Up: func(tx *sql.Tx) error {
+			return execStatements(tx,
+				createSQLiteExpensesTableSQL,
+				createSQLiteRecurringExpensesTableSQL,
+				createSQLiteConfigTableSQL,
+				createSQLiteCategoriesTableSQL,
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execStatements(tx,
+				"DROP TABLE IF EXISTS categories",
+				"DROP TABLE IF EXISTS config",
+				"DROP TABLE IF EXISTS recurring_expenses",
+				"DROP TABLE IF EXISTS expenses",
+			)
+		},
+	},
+	{
+		Version: 2,
+		Name:    "retire_config_categories",
+		Up: func(tx *sql.Tx) error {
+			if err := moveConfigCategories(tx, sqlitePlaceholder); err != nil {
+				return err
+			}
+			return execStatements(tx, "ALTER TABLE config DROP COLUMN categories")
+		},
+		Down: func(tx *sql.Tx) error {
+			if err := execStatements(tx, "ALTER TABLE config ADD COLUMN categories TEXT NOT NULL DEFAULT '[]'"); err != nil {
+				return err
+			}
+			return restoreConfigCategories(tx, sqlitePlaceholder)
+		},
+	}, {
+		Version: 3,
+		Name:    "expense_query_indexes",
+		Up: func(tx *sql.Tx) error {
+			return execStatements(tx, expenseQueryIndexes...)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execStatements(tx, dropExpenseQueryIndexes...)
+		},
+	},
+	{
+		// tags move from JSON columns to a catalog linked to expenses and rules
+		Version: 4,
+		Name:    "normalize_tags",
+		Up: func(tx *sql.Tx) error {
+			err := execStatements(tx,
+				`CREATE TABLE IF NOT EXISTS tags (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					name TEXT NOT NULL UNIQUE,
+					created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+				)`,
+				`CREATE TABLE IF NOT EXISTS expense_tags (
+					expense_id TEXT NOT NULL REFERENCES expenses(id) ON DELETE CASCADE,
+					tag_id INTEGER NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+					position INTEGER NOT NULL,
+					PRIMARY KEY (expense_id, tag_id)
+				)`,
+				`CREATE TABLE IF NOT EXISTS recurring_expense_tags (
+					recurring_id TEXT NOT NULL REFERENCES recurring_expenses(id) ON DELETE CASCADE,
+					tag_id INTEGER NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+					position INTEGER NOT NULL,
+					PRIMARY KEY (recurring_id, tag_id)
+				)`,
+				"CREATE INDEX IF NOT EXISTS idx_expense_tags_tag ON expense_tags (tag_id)",
+				"CREATE INDEX IF NOT EXISTS idx_recurring_expense_tags_tag ON recurring_expense_tags (tag_id)",
+			)
+			if err != nil {
+				return err
+			}
+			if err := moveTagsToLinks(tx, sqliteDialect); err != nil {
+				return err
+			}
+			return execStatements(tx,
+				"ALTER TABLE expenses DROP COLUMN tags",
+				"ALTER TABLE recurring_expenses DROP COLUMN tags",
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			err := execStatements(tx,
+				"ALTER TABLE expenses ADD COLUMN tags TEXT",
+				"ALTER TABLE recurring_expenses ADD COLUMN tags TEXT",
+			)
+			if err != nil {
+				return err
+			}
+			if err := restoreTagColumns(tx, sqliteDialect); err != nil {
+				return err
+			}
+			return execStatements(tx,
+				"DROP TABLE IF EXISTS recurring_expense_tags",
+				"DROP TABLE IF EXISTS expense_tags",
+				"DROP TABLE IF EXISTS tags",
+			)
+		},
+	},
+	{
+		// categories carry display metadata and an income/expense type
+		Version: 5,
+		Name:    "category_metadata",
+		Up: func(tx *sql.Tx) error {
+			err := execStatements(tx,
+				"ALTER TABLE categories ADD COLUMN color TEXT NOT NULL DEFAULT ''",
+				"ALTER TABLE categories ADD COLUMN icon TEXT NOT NULL DEFAULT ''",
+				"ALTER TABLE categories ADD COLUMN type TEXT NOT NULL DEFAULT 'expense'",
+				"ALTER TABLE categories ADD COLUMN archived BOOLEAN NOT NULL DEFAULT FALSE",
+			)
+			if err != nil {
+				return err
+			}
+			return decorateDefaultCategories(tx, sqliteDialect)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execStatements(tx,
+				"ALTER TABLE categories DROP COLUMN archived",
+				"ALTER TABLE categories DROP COLUMN type",
+				"ALTER TABLE categories DROP COLUMN icon",
+				"ALTER TABLE categories DROP COLUMN color",
+			)
+		},
+	},
+	{
+		// subcategories point at their parent; deleting a parent lifts its children to the top level
+		Version: 6,
+		Name:    "category_hierarchy",
+		Up: func(tx *sql.Tx) error {
+			return execStatements(tx,
+				"ALTER TABLE categories ADD COLUMN parent_id INTEGER REFERENCES categories(id) ON DELETE SET NULL",
+				"CREATE INDEX IF NOT EXISTS idx_categories_parent ON categories (parent_id)",
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			// SQLite cannot drop a column that is part of a foreign key, so the table is rebuilt
+			return execStatements(tx,
+				"DROP INDEX IF EXISTS idx_categories_parent",
+				`CREATE TABLE categories_flat (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					name TEXT NOT NULL UNIQUE,
+					position INTEGER NOT NULL,
+					created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+					color TEXT NOT NULL DEFAULT '',
+					icon TEXT NOT NULL DEFAULT '',
+					type TEXT NOT NULL DEFAULT 'expense',
+					archived BOOLEAN NOT NULL DEFAULT FALSE
+				)`,
+				`INSERT INTO categories_flat (id, name, position, created_at, color, icon, type, archived)
+					SELECT id, name, position, created_at, color, icon, type, archived FROM categories`,
+				"DROP TABLE categories",
+				"ALTER TABLE categories_flat RENAME TO categories",
+			)
+		},
+	}, {
+		// expenses may only reference stored categories from now on, so the
+		// names older rows used without a table entry are registered
+		Version: 7,
+		Name:    "register_used_categories",
+		Up: func(tx *sql.Tx) error {
+			return registerUsedCategories(tx, sqliteDialect)
+		},
+		Down: func(tx *sql.Tx) error {
+			// registered categories are indistinguishable from user ones and stay
+			return nil
+		},
+	}, {
+		// removed expenses stay in the table until restored or purged
+		Version: 8,
+		Name:    "expense_trash",
+		Up: func(tx *sql.Tx) error {
+			return execStatements(tx,
+				"ALTER TABLE expenses ADD COLUMN deleted_at TIMESTAMP",
+				"CREATE INDEX IF NOT EXISTS idx_expenses_deleted_at ON expenses (deleted_at)",
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			// going back to hard deletes empties the trash
+			return execStatements(tx,
+				"DELETE FROM expenses WHERE deleted_at IS NOT NULL",
+				"DROP INDEX IF EXISTS idx_expenses_deleted_at",
+				"ALTER TABLE expenses DROP COLUMN deleted_at",
+			)
+		},
+	}, {
+		// before/after snapshots are JSON text, like the legacy config columns
+		Version: 9,
+		Name:    "audit_log",
+		Up: func(tx *sql.Tx) error {
+			return execStatements(tx,
+				`CREATE TABLE IF NOT EXISTS audit_log (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					at TIMESTAMP NOT NULL,
+					entity TEXT NOT NULL,
+					entity_id TEXT NOT NULL DEFAULT '',
+					action TEXT NOT NULL,
+					detail TEXT NOT NULL DEFAULT '',
+					before_data TEXT,
+					after_data TEXT
+				)`,
+				"CREATE INDEX IF NOT EXISTS idx_audit_log_entity ON audit_log (entity, entity_id, id)",
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execStatements(tx, "DROP TABLE IF EXISTS audit_log")
+		},
+	}, {
+		// optimistic concurrency: rows carry a version and the category list
+		// a counter in the versions table
+		Version: 10,
+		Name:    "row_versions",
+		Up: func(tx *sql.Tx) error {
+			return execStatements(tx,
+				"ALTER TABLE expenses ADD COLUMN version INTEGER NOT NULL DEFAULT 1",
+				"ALTER TABLE recurring_expenses ADD COLUMN version INTEGER NOT NULL DEFAULT 1",
+				`CREATE TABLE IF NOT EXISTS versions (
+					name TEXT PRIMARY KEY,
+					version INTEGER NOT NULL
+				)`,
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execStatements(tx,
+				"DROP TABLE IF EXISTS versions",
+				"ALTER TABLE recurring_expenses DROP COLUMN version",
+				"ALTER TABLE expenses DROP COLUMN version",
+			)
+		},
+	}, {
+		// amounts become integer minor units; ars, usd and eur, the only
+		// currencies accepted so far, all have two decimals. SQLite cannot
+		// change a column type, so the column is rebuilt.
+		Version: 11,
+		Name:    "exact_amounts",
+		Up: func(tx *sql.Tx) error {
+			return execStatements(tx,
+				"DROP INDEX IF EXISTS idx_expenses_amount",
+				"ALTER TABLE expenses ADD COLUMN amount_minor INTEGER NOT NULL DEFAULT 0",
+				"UPDATE expenses SET amount_minor = CAST(ROUND(amount * 100) AS INTEGER)",
+				"ALTER TABLE expenses DROP COLUMN amount",
+				"ALTER TABLE expenses RENAME COLUMN amount_minor TO amount",
+				"CREATE INDEX IF NOT EXISTS idx_expenses_amount ON expenses (amount)",
+				"ALTER TABLE recurring_expenses ADD COLUMN amount_minor INTEGER NOT NULL DEFAULT 0",
+				"UPDATE recurring_expenses SET amount_minor = CAST(ROUND(amount * 100) AS INTEGER)",
+				"ALTER TABLE recurring_expenses DROP COLUMN amount",
+				"ALTER TABLE recurring_expenses RENAME COLUMN amount_minor TO amount",
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execStatements(tx,
+				"DROP INDEX IF EXISTS idx_expenses_amount",
+				"ALTER TABLE expenses ADD COLUMN amount_real REAL NOT NULL DEFAULT 0",
+				"UPDATE expenses SET amount_real = amount / 100.0",
+				"ALTER TABLE expenses DROP COLUMN amount",
+				"ALTER TABLE expenses RENAME COLUMN amount_real TO amount",
+				"CREATE INDEX IF NOT EXISTS idx_expenses_amount ON expenses (amount)",
+				"ALTER TABLE recurring_expenses ADD COLUMN amount_real REAL NOT NULL DEFAULT 0",
+				"UPDATE recurring_expenses SET amount_real = amount / 100.0",
+				"ALTER TABLE recurring_expenses DROP COLUMN amount",
+				"ALTER TABLE recurring_expenses RENAME COLUMN amount_real TO amount",
+			)
+		},
+	}, {
+		// dated exchange rates, kept as exact decimal text, and an optional
+		// rate locked on each expense
+		Version: 12,
+		Name:    "exchange_rates",
+		Up: func(tx *sql.Tx) error {
+			return execStatements(tx,
+				`CREATE TABLE IF NOT EXISTS exchange_rates (
+					date TIMESTAMP NOT NULL,
+					currency TEXT NOT NULL,
+					quote TEXT NOT NULL,
+					rate TEXT NOT NULL,
+					PRIMARY KEY (currency, quote, date)
+				)`,
+				"ALTER TABLE expenses ADD COLUMN rate TEXT",
+				"ALTER TABLE expenses ADD COLUMN rate_currency TEXT",
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execStatements(tx,
+				"ALTER TABLE expenses DROP COLUMN rate_currency",
+				"ALTER TABLE expenses DROP COLUMN rate",
+				"DROP TABLE IF EXISTS exchange_rates",
+			)
+		},
+	}, {
+		// currencies of the ISO 4217 catalog enabled for expenses and rules,
+		// seeded with the ones supported before the catalog
+		Version: 13,
+		Name:    "enabled_currencies",
+		Up: func(tx *sql.Tx) error {
+			return execStatements(tx,
+				`CREATE TABLE IF NOT EXISTS enabled_currencies (
+					code TEXT PRIMARY KEY,
+					position INTEGER NOT NULL
+				)`,
+				`INSERT INTO enabled_currencies (code, position) VALUES ('ars', 1), ('usd', 2), ('eur', 3)
+					ON CONFLICT (code) DO NOTHING`,
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execStatements(tx, "DROP TABLE IF EXISTS enabled_currencies")
+		},
+	}, {
+		// monthly consumer price indexes for real-terms reports
+		Version: 14,
+		Name:    "cpi_indexes",
+		Up: func(tx *sql.Tx) error {
+			return execStatements(tx,
+				`CREATE TABLE IF NOT EXISTS cpi_indexes (
+					currency TEXT NOT NULL,
+					month TIMESTAMP NOT NULL,
+					value TEXT NOT NULL,
+					PRIMARY KEY (currency, month)
+				)`,
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execStatements(tx, "DROP TABLE IF EXISTS cpi_indexes")
+		},
+	}, {
+		// currency exchanges and the expense legs they own
+		Version: 15,
+		Name:    "currency_exchanges",
+		Up: func(tx *sql.Tx) error {
+			return execStatements(tx,
+				`CREATE TABLE IF NOT EXISTS currency_exchanges (
+					id TEXT PRIMARY KEY,
+					name TEXT NOT NULL,
+					date TIMESTAMP NOT NULL,
+					from_currency TEXT NOT NULL,
+					from_amount INTEGER NOT NULL,
+					to_currency TEXT NOT NULL,
+					to_amount INTEGER NOT NULL,
+					rate TEXT NOT NULL,
+					outgoing_id TEXT NOT NULL,
+					incoming_id TEXT NOT NULL
+				)`,
+				"ALTER TABLE expenses ADD COLUMN exchange_id TEXT",
+				"CREATE INDEX IF NOT EXISTS idx_expenses_exchange_id ON expenses (exchange_id)",
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execStatements(tx,
+				"DELETE FROM expenses WHERE exchange_id IS NOT NULL",
+				"DROP INDEX IF EXISTS idx_expenses_exchange_id",
+				"ALTER TABLE expenses DROP COLUMN exchange_id",
+				"DROP TABLE IF EXISTS currency_exchanges",
+			)
+		},
+	}, {
+		// accounts replace the free-text source and card of expenses
+		Version: 16,
+		Name:    "accounts",
+		Up: func(tx *sql.Tx) error {
+			err := execStatements(tx,
+				`CREATE TABLE IF NOT EXISTS accounts (
+					id TEXT PRIMARY KEY,
+					name TEXT NOT NULL,
+					type TEXT NOT NULL,
+					currency TEXT NOT NULL,
+					opening_balance INTEGER NOT NULL DEFAULT 0,
+					archived BOOLEAN NOT NULL DEFAULT FALSE
+				)`,
+				"ALTER TABLE expenses ADD COLUMN account_id TEXT",
+				"CREATE INDEX IF NOT EXISTS idx_expenses_account_id ON expenses (account_id)",
+			)
+			if err != nil {
+				return err
+			}
+			return mapLegacyAccounts(tx, sqliteDialect)
+		},
+		Down: func(tx *sql.Tx) error {
+			// source and card keep the values derived from the accounts
+			return execStatements(tx,
+				"DROP INDEX IF EXISTS idx_expenses_account_id",
+				"ALTER TABLE expenses DROP COLUMN account_id",
+				"DROP TABLE IF EXISTS accounts",
+			)
+		},
+	}, {
+		// explicit transaction types, with transfers between two accounts
+		Version: 17,
+		Name:    "transaction_types",
+		Up: func(tx *sql.Tx) error {
+			return execStatements(tx,
+				"ALTER TABLE expenses ADD COLUMN type TEXT NOT NULL DEFAULT 'expense'",
+				"ALTER TABLE expenses ADD COLUMN to_account_id TEXT",
+				"UPDATE expenses SET type = 'income' WHERE amount > 0",
+				"UPDATE expenses SET type = 'transfer' WHERE COALESCE(exchange_id, '') <> ''",
+				"CREATE INDEX IF NOT EXISTS idx_expenses_to_account_id ON expenses (to_account_id)",
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			// transfers stay as plain movements out of their source account
+			return execStatements(tx,
+				"DROP INDEX IF EXISTS idx_expenses_to_account_id",
+				"ALTER TABLE expenses DROP COLUMN to_account_id",
+				"ALTER TABLE expenses DROP COLUMN type",
+			)
+		},
+	}, {
+		// statement closing and due days of credit cards
+		Version: 18,
+		Name:    "card_cycles",
+		Up: func(tx *sql.Tx) error {
+			return execStatements(tx,
+				"ALTER TABLE accounts ADD COLUMN closing_day INTEGER NOT NULL DEFAULT 0",
+				"ALTER TABLE accounts ADD COLUMN due_day INTEGER NOT NULL DEFAULT 0",
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execStatements(tx,
+				"ALTER TABLE accounts DROP COLUMN due_day",
+				"ALTER TABLE accounts DROP COLUMN closing_day",
+			)
+		},
+	}, {
+		// installment purchases on credit cards and the expenses they own
+		Version: 19,
+		Name:    "installment_purchases",
+		Up: func(tx *sql.Tx) error {
+			return execStatements(tx,
+				`CREATE TABLE IF NOT EXISTS installment_purchases (
+					id TEXT PRIMARY KEY,
+					name TEXT NOT NULL,
+					category TEXT NOT NULL,
+					account_id TEXT NOT NULL,
+					currency TEXT NOT NULL,
+					total INTEGER NOT NULL,
+					interest INTEGER NOT NULL DEFAULT 0,
+					installments INTEGER NOT NULL,
+					date TIMESTAMP NOT NULL,
+					first_month TIMESTAMP NOT NULL,
+					paid_off_at TIMESTAMP
+				)`,
+				"ALTER TABLE expenses ADD COLUMN installment_id TEXT",
+				"CREATE INDEX IF NOT EXISTS idx_expenses_installment_id ON expenses (installment_id)",
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execStatements(tx,
+				"DELETE FROM expenses WHERE installment_id IS NOT NULL",
+				"DROP INDEX IF EXISTS idx_expenses_installment_id",
+				"ALTER TABLE expenses DROP COLUMN installment_id",
+				"DROP TABLE IF EXISTS installment_purchases",
+			)
+		},
+	}, {
+		// how far ahead the occurrences of each recurring rule are stored; the
+		// rules so far had every occurrence written when added
+		Version: 20,
+		Name:    "recurring_horizon",
+		Up: func(tx *sql.Tx) error {
+			return execStatements(tx,
+				"ALTER TABLE recurring_expenses ADD COLUMN materialized_through TIMESTAMP",
+				`UPDATE recurring_expenses SET materialized_through = COALESCE(
+					(SELECT MAX(date) FROM expenses WHERE expenses.recurring_id = recurring_expenses.id), start_date)`,
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execStatements(tx, "ALTER TABLE recurring_expenses DROP COLUMN materialized_through")
+		},
+	}, {
+		// recurrence rules and business day adjustments of recurring rules,
+		// and the holidays those move occurrences off
+		Version: 21,
+		Name:    "recurrence_rules",
+		Up: func(tx *sql.Tx) error {
+			return execStatements(tx,
+				"ALTER TABLE recurring_expenses ADD COLUMN rrule TEXT NOT NULL DEFAULT ''",
+				"ALTER TABLE recurring_expenses ADD COLUMN business_day TEXT NOT NULL DEFAULT ''",
+				`CREATE TABLE IF NOT EXISTS holidays (
+					date TIMESTAMP PRIMARY KEY,
+					name TEXT NOT NULL DEFAULT ''
+				)`,
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execStatements(tx,
+				"DROP TABLE IF EXISTS holidays",
+				"ALTER TABLE recurring_expenses DROP COLUMN business_day",
+				"ALTER TABLE recurring_expenses DROP COLUMN rrule",
+			)
+		},
+	}, {
+		// per occurrence overrides and amount schedules of recurring rules, and
+		// the scheduled date generated expenses are overridden by
+		Version: 22,
+		Name:    "recurring_overrides",
+		Up: func(tx *sql.Tx) error {
+			return execStatements(tx,
+				"ALTER TABLE recurring_expenses ADD COLUMN amount_changes TEXT NOT NULL DEFAULT '[]'",
+				"ALTER TABLE recurring_expenses ADD COLUMN overrides TEXT NOT NULL DEFAULT '[]'",
+				"ALTER TABLE expenses ADD COLUMN occurrence TIMESTAMP",
+				"UPDATE expenses SET occurrence = date WHERE recurring_id IS NOT NULL AND recurring_id <> ''",
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execStatements(tx,
+				"ALTER TABLE expenses DROP COLUMN occurrence",
+				"ALTER TABLE recurring_expenses DROP COLUMN overrides",
+				"ALTER TABLE recurring_expenses DROP COLUMN amount_changes",
+			)
+		},
+	}, {
+		// the account, source and card recurring rules copy to the expenses
+		// they generate; existing rules keep generating expenses without one
+		Version: 23,
+		Name:    "recurring_accounts",
+		Up: func(tx *sql.Tx) error {
+			return execStatements(tx,
+				"ALTER TABLE recurring_expenses ADD COLUMN source TEXT NOT NULL DEFAULT ''",
+				"ALTER TABLE recurring_expenses ADD COLUMN card TEXT NOT NULL DEFAULT ''",
+				"ALTER TABLE recurring_expenses ADD COLUMN account_id TEXT",
+				"CREATE INDEX IF NOT EXISTS idx_recurring_expenses_account_id ON recurring_expenses (account_id)",
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execStatements(tx,
+				"DROP INDEX IF EXISTS idx_recurring_expenses_account_id",
+				"ALTER TABLE recurring_expenses DROP COLUMN account_id",
+				"ALTER TABLE recurring_expenses DROP COLUMN card",
+				"ALTER TABLE recurring_expenses DROP COLUMN source",
+			)
+		},
+	}, {
+		// the accounts the legs of a currency exchange move; existing
+		// exchanges stay without one
+		Version: 24,
+		Name:    "exchange_accounts",
+		Up: func(tx *sql.Tx) error {
+			return execStatements(tx,
+				"ALTER TABLE currency_exchanges ADD COLUMN from_account_id TEXT NOT NULL DEFAULT ''",
+				"ALTER TABLE currency_exchanges ADD COLUMN to_account_id TEXT NOT NULL DEFAULT ''",
+			)
+		},
+		Down: func(tx *sql.Tx) error {
+			return execStatements(tx,
+				"ALTER TABLE currency_exchanges DROP COLUMN to_account_id",
+				"ALTER TABLE currency_exchanges DROP COLUMN from_account_id",
+			)
+		},
+	}, {
+		// the postgres column gets its time zone; SQLite stores the dates as
+		// text either way, so the version only keeps the two lists paired
+		Version: 25,
+		Name:    "recurring_horizon_timestamptz",
+		Up: func(tx *sql.Tx) error {
+			return nil
+		},
+		Down: func(tx *sql.Tx) error {
+			return nil
+		},
+	},
+}
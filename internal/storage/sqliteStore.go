@@ -0,0 +1,793 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// sqliteStore implements the Storage interface for a single local SQLite file.
+type sqliteStore struct {
+	db *sql.DB
+}
+
+const sqliteFileName = "expenseowl.db"
+
+// SQLite flavour of the databaseStore schema; dates are stored in UTC so that
+// lexical ordering of the stored timestamps matches chronological ordering.
+const (
+	createSQLiteExpensesTableSQL = `
+	CREATE TABLE IF NOT EXISTS expenses (
+		id TEXT PRIMARY KEY,
+		recurring_id TEXT,
+		name TEXT NOT NULL,
+		category TEXT NOT NULL,
+		amount REAL NOT NULL,
+		currency TEXT NOT NULL,
+		date TIMESTAMP NOT NULL,
+		tags TEXT,
+		source TEXT,
+		card TEXT
+	);`
+
+	createSQLiteRecurringExpensesTableSQL = `
+	CREATE TABLE IF NOT EXISTS recurring_expenses (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		amount REAL NOT NULL,
+		currency TEXT NOT NULL,
+		category TEXT NOT NULL,
+		start_date TIMESTAMP NOT NULL,
+		interval TEXT NOT NULL,
+		occurrences INTEGER NOT NULL,
+		tags TEXT
+	);`
+
+	createSQLiteConfigTableSQL = `
+	CREATE TABLE IF NOT EXISTS config (
+		id TEXT PRIMARY KEY DEFAULT 'default',
+		categories TEXT NOT NULL,
+		currency TEXT NOT NULL,
+		start_date INTEGER NOT NULL
+	);`
+
+	createSQLiteCategoriesTableSQL = `
+	CREATE TABLE IF NOT EXISTS categories (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE,
+		position INTEGER NOT NULL,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);`
+)
+
+func InitializeSQLiteStore(baseConfig SystemConfig) (Storage, error) {
+	db, err := openSQLiteDB(baseConfig)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := newMigrator(db, sqliteMigrations, sqlitePlaceholder).Up(); err != nil {
+		return nil, fmt.Errorf("failed to migrate database: %v", err)
+	}
+	return &sqliteStore{db: db}, nil
+}
+
+func openSQLiteDB(baseConfig SystemConfig) (*sql.DB, error) {
+	dbPath := makeSQLitePath(baseConfig)
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %v", err)
+	}
+	db, err := sql.Open("sqlite3", dbPath+"?_foreign_keys=on&_busy_timeout=5000&_journal_mode=WAL")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SQLite database: %v", err)
+	}
+	// a single connection serializes writers and avoids SQLITE_BUSY between them
+	db.SetMaxOpenConns(1)
+	if err := db.Ping(); err != nil {
+		return nil, fmt.Errorf("failed to ping SQLite database: %v", err)
+	}
+	log.Printf("Connected to SQLite database at %s\n", dbPath)
+	return db, nil
+}
+
+// STORAGE_URL is the data directory for sqlite, or a path to a .db file
+func makeSQLitePath(baseConfig SystemConfig) string {
+	if strings.HasSuffix(baseConfig.StorageURL, ".db") {
+		return baseConfig.StorageURL
+	}
+	dir := baseConfig.StorageURL
+	if dir == "" {
+		dir = "data"
+	}
+	return filepath.Join(dir, sqliteFileName)
+}
+
+func (s *sqliteStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *sqliteStore) saveConfig(config *Config) error {
+	query := `
+		INSERT INTO config (id, currency, start_date)
+		VALUES ('default', ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			currency = excluded.currency,
+			start_date = excluded.start_date;
+	`
+	_, err := s.db.Exec(query, config.Currency, config.StartDate)
+	return err
+}
+
+// updateConfig records the change in the audit log; GetConfig seeds the row on first use
+func (s *sqliteStore) updateConfig(updater func(c *configSnapshot)) error {
+	if _, err := s.GetConfig(); err != nil {
+		return err
+	}
+	_, err := sqliteDialect.updateConfig(s.db, updater)
+	return err
+}
+
+func (s *sqliteStore) GetConfig() (*Config, error) {
+	query := `SELECT currency, start_date FROM config WHERE id = 'default'`
+	var currency string
+	var startDate int
+	err := s.db.QueryRow(query).Scan(&currency, &startDate)
+
+	if err == sql.ErrNoRows {
+		base := &Config{}
+		base.SetBaseConfig()
+		if err := s.saveConfig(base); err != nil {
+			return nil, fmt.Errorf("failed to save initial default config: %v", err)
+		}
+		currency, startDate = base.Currency, base.StartDate
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get config from db: %v", err)
+	}
+
+	var config Config
+	config.Currency = currency
+	config.StartDate = startDate
+	categories, err := s.GetCategories()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get categories from db: %v", err)
+	}
+	config.Categories = categories
+	if config.Currencies, err = sqliteDialect.listEnabledCurrencies(s.db); err != nil {
+		return nil, err
+	}
+
+	recurring, err := s.GetRecurringExpenses()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recurring expenses for config: %v", err)
+	}
+	config.RecurringExpenses = recurring
+
+	return &config, nil
+}
+
+func (s *sqliteStore) GetCategories() ([]Category, error) {
+	return sqliteDialect.getCategories(s.db)
+}
+
+func (s *sqliteStore) CategoriesVersion() (int64, error) {
+	return sqliteDialect.readVersion(s.db, categoriesVersion)
+}
+
+func (s *sqliteStore) UpdateCategories(categories []Category, version int64) error {
+	return sqliteDialect.saveCategories(s.db, categories, version)
+}
+
+func (s *sqliteStore) RenameCategory(from, to string, version int64) error {
+	return sqliteDialect.renameCategory(s.db, from, to, version)
+}
+
+func (s *sqliteStore) DeleteCategory(name, reassignTo string, version int64) error {
+	return sqliteDialect.deleteCategory(s.db, name, reassignTo, version)
+}
+
+func (s *sqliteStore) GetCurrency() (string, error) {
+	config, err := s.GetConfig()
+	if err != nil {
+		return "", err
+	}
+	return config.Currency, nil
+}
+
+func (s *sqliteStore) UpdateCurrency(currency string) error {
+	if enabled, err := sqliteDialect.currencyEnabled(s.db, currency); err != nil {
+		return err
+	} else if !enabled {
+		return fmt.Errorf("invalid currency: %s", currency)
+	}
+	return s.updateConfig(func(c *configSnapshot) {
+		c.Currency = currency
+	})
+}
+
+func (s *sqliteStore) GetEnabledCurrencies() ([]string, error) {
+	return sqliteDialect.listEnabledCurrencies(s.db)
+}
+
+// UpdateEnabledCurrencies checks the list against the base currency, so the
+// config row is seeded first
+func (s *sqliteStore) UpdateEnabledCurrencies(codes []string) error {
+	if _, err := s.GetConfig(); err != nil {
+		return err
+	}
+	return sqliteDialect.saveEnabledCurrencies(s.db, codes)
+}
+
+func (s *sqliteStore) GetStartDate() (int, error) {
+	config, err := s.GetConfig()
+	if err != nil {
+		return 0, err
+	}
+	return config.StartDate, nil
+}
+
+func (s *sqliteStore) UpdateStartDate(startDate int) error {
+	if startDate < 1 || startDate > 31 {
+		return fmt.Errorf("invalid start date: %d", startDate)
+	}
+	return s.updateConfig(func(c *configSnapshot) {
+		c.StartDate = startDate
+	})
+}
+
+func (s *sqliteStore) GetTags() ([]Tag, error) {
+	return sqliteDialect.listTags(s.db)
+}
+
+func (s *sqliteStore) AddTag(name string) error {
+	return sqliteDialect.addTag(s.db, name)
+}
+
+func (s *sqliteStore) RenameTag(from, to string) error {
+	return sqliteDialect.renameTag(s.db, from, to)
+}
+
+func (s *sqliteStore) MergeTags(sources []string, target string) error {
+	return sqliteDialect.mergeTags(s.db, sources, target)
+}
+
+func (s *sqliteStore) DeleteTag(name string) error {
+	return sqliteDialect.deleteTag(s.db, name)
+}
+
+func (s *sqliteStore) GetAllExpenses() ([]Expense, error) {
+	return s.QueryExpenses(ExpenseFilter{})
+}
+
+func (s *sqliteStore) QueryExpenses(filter ExpenseFilter) ([]Expense, error) {
+	var expenses []Expense
+	err := s.StreamExpenses(filter, func(e Expense) error {
+		expenses = append(expenses, e)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return expenses, nil
+}
+
+func (s *sqliteStore) QueryExpensesPage(filter ExpenseFilter, after *ExpenseCursor, limit int) (ExpensePage, error) {
+	return sqliteDialect.queryExpensePage(s.db, filter, after, limit)
+}
+
+func (s *sqliteStore) StreamExpenses(filter ExpenseFilter, fn func(Expense) error) error {
+	return sqliteDialect.streamExpenseRows(s.db, filter, nil, 0, fn)
+}
+
+func (s *sqliteStore) SumExpensesByCategory(filter ExpenseFilter) ([]CategorySum, error) {
+	return sqliteDialect.sumExpensesByCategory(s.db, filter)
+}
+
+func (s *sqliteStore) GetExpense(id string) (Expense, error) {
+	query := `SELECT ` + sqliteDialect.expenseColumns() + ` FROM expenses WHERE id = ? AND deleted_at IS NULL`
+	expense, err := scanExpense(s.db.QueryRow(query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Expense{}, fmt.Errorf("expense with ID %s not found", id)
+		}
+		return Expense{}, fmt.Errorf("failed to get expense: %v", err)
+	}
+	return expense, nil
+}
+
+func (s *sqliteStore) AddExpense(expense Expense) error {
+	return withTx(s.db, func(tx *sql.Tx) error {
+		return s.insertExpense(tx, expense, nil)
+	})
+}
+
+func (s *sqliteStore) insertExpense(tx *sql.Tx, expense Expense, cache tagIDs) error {
+	if expense.ID == "" {
+		expense.ID = uuid.New().String()
+	}
+	if err := sqliteDialect.normalizeExpense(tx, &expense); err != nil {
+		return err
+	}
+	if expense.Date.IsZero() {
+		expense.Date = time.Now()
+	}
+	if err := sqliteDialect.requireExpenseCategory(tx, expense); err != nil {
+		return err
+	}
+	if err := sqliteDialect.requireCurrency(tx, expense.Currency); err != nil {
+		return err
+	}
+	if err := sqliteDialect.resolveAccount(tx, &expense, Expense{}); err != nil {
+		return err
+	}
+	query := `
+		INSERT INTO expenses (id, recurring_id, name, category, amount, currency, date, source, card, rate, rate_currency, account_id, type, to_account_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	rate, rateCurrency := lockedRateArgs(expense)
+	if _, err := tx.Exec(query, expense.ID, expense.RecurringID, expense.Name, expense.Category, expense.Amount.Units, expense.Currency, expense.Date.UTC(), expense.Source, expense.Card, rate, rateCurrency, expense.AccountID, expense.Type, expense.ToAccountID); err != nil {
+		return err
+	}
+	if err := sqliteDialect.writeTagLinks(tx, expenseTagLink, expense.ID, expense.Tags, cache); err != nil {
+		return err
+	}
+	expense.Tags = normalizeTags(expense.Tags)
+	expense.Version = 1
+	return sqliteDialect.recordAudit(tx, auditChange{entity: AuditExpense, id: expense.ID, action: AuditCreate, after: expense})
+}
+
+func (s *sqliteStore) UpdateExpense(id string, expense Expense) error {
+	return withTx(s.db, func(tx *sql.Tx) error {
+		if err := sqliteDialect.normalizeExpense(tx, &expense); err != nil {
+			return err
+		}
+		if err := sqliteDialect.requireExpenseCategory(tx, expense); err != nil {
+			return err
+		}
+		if err := sqliteDialect.requireCurrency(tx, expense.Currency); err != nil {
+			return err
+		}
+		before, err := sqliteDialect.loadExpense(tx, id)
+		if err != nil && err != sql.ErrNoRows {
+			return fmt.Errorf("failed to read expense: %v", err)
+		}
+		if err := generatedExpenseError(before); err != nil {
+			return err
+		}
+		if err := sqliteDialect.ruleOccurrence(tx, before); err != nil {
+			return err
+		}
+		if err := sqliteDialect.resolveAccount(tx, &expense, before); err != nil {
+			return err
+		}
+		match, matchArgs := sqliteDialect.versionMatch(expense.Version, 15)
+		query := `
+			UPDATE expenses
+			SET name = ?, category = ?, amount = ?, currency = ?, date = ?, recurring_id = ?, source = ?, card = ?,
+				rate = ?, rate_currency = ?, account_id = ?, type = ?, to_account_id = ?, version = version + 1
+			WHERE id = ? AND deleted_at IS NULL` + match
+		rate, rateCurrency := lockedRateArgs(expense)
+		args := []any{expense.Name, expense.Category, expense.Amount.Units, expense.Currency, expense.Date.UTC(), expense.RecurringID, expense.Source, expense.Card, rate, rateCurrency, expense.AccountID, expense.Type, expense.ToAccountID, id}
+		result, err := tx.Exec(query, append(args, matchArgs...)...)
+		if err != nil {
+			return fmt.Errorf("failed to update expense: %v", err)
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to get rows affected: %v", err)
+		}
+		if rowsAffected == 0 {
+			return sqliteDialect.rowConflict(tx, "expenses", AuditExpense, id, fmt.Errorf("expense with ID %s not found", id))
+		}
+		if err := sqliteDialect.writeTagLinks(tx, expenseTagLink, id, expense.Tags, nil); err != nil {
+			return err
+		}
+		after, err := sqliteDialect.loadExpense(tx, id)
+		if err != nil {
+			return fmt.Errorf("failed to read updated expense: %v", err)
+		}
+		return sqliteDialect.recordAudit(tx, auditChange{entity: AuditExpense, id: id, action: AuditUpdate, before: before, after: after})
+	})
+}
+
+// RemoveExpense moves an expense to the trash
+func (s *sqliteStore) RemoveExpense(id string, version int64) error {
+	moved, err := sqliteDialect.trashExpenses(s.db, []string{id}, version)
+	if err != nil {
+		return err
+	}
+	if moved == 0 {
+		return fmt.Errorf("expense with ID %s not found", id)
+	}
+	return nil
+}
+
+func (s *sqliteStore) AddMultipleExpenses(expenses []Expense) error {
+	if len(expenses) == 0 {
+		return nil
+	}
+	return withTx(s.db, func(tx *sql.Tx) error {
+		cache := tagIDs{}
+		for _, exp := range expenses {
+			if err := s.insertExpense(tx, exp, cache); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *sqliteStore) RemoveMultipleExpenses(ids []string) error {
+	_, err := sqliteDialect.trashExpenses(s.db, ids, 0)
+	return err
+}
+
+func (s *sqliteStore) GetTrash() ([]TrashedExpense, error) {
+	return sqliteDialect.listTrash(s.db)
+}
+
+func (s *sqliteStore) RestoreExpenses(ids []string) error {
+	return sqliteDialect.restoreExpenses(s.db, ids)
+}
+
+func (s *sqliteStore) PurgeExpenses(ids []string) error {
+	return sqliteDialect.purgeExpenses(s.db, ids)
+}
+
+func (s *sqliteStore) PurgeTrash(before time.Time) (int, error) {
+	return sqliteDialect.purgeTrash(s.db, before)
+}
+
+func (s *sqliteStore) GetAuditLog(filter AuditFilter) ([]AuditEntry, error) {
+	return sqliteDialect.queryAudit(s.db, filter)
+}
+
+func (s *sqliteStore) GetExchangeRates() ([]ExchangeRate, error) {
+	return sqliteDialect.listExchangeRates(s.db)
+}
+
+func (s *sqliteStore) SaveExchangeRates(rates []ExchangeRate) error {
+	return sqliteDialect.saveExchangeRates(s.db, rates)
+}
+
+func (s *sqliteStore) DeleteExchangeRate(date time.Time, currency, quote string) error {
+	return sqliteDialect.deleteExchangeRate(s.db, date, currency, quote)
+}
+
+func (s *sqliteStore) GetCPIIndexes() ([]CPIIndex, error) {
+	return sqliteDialect.listCPIIndexes(s.db)
+}
+
+func (s *sqliteStore) SaveCPIIndexes(indexes []CPIIndex) error {
+	return sqliteDialect.saveCPIIndexes(s.db, indexes)
+}
+
+func (s *sqliteStore) DeleteCPIIndex(currency string, month time.Time) error {
+	return sqliteDialect.deleteCPIIndex(s.db, currency, month)
+}
+
+func (s *sqliteStore) GetHolidays() ([]Holiday, error) {
+	return sqliteDialect.listHolidays(s.db)
+}
+
+func (s *sqliteStore) SaveHolidays(holidays []Holiday) error {
+	return sqliteDialect.saveHolidays(s.db, holidays)
+}
+
+func (s *sqliteStore) DeleteHoliday(date time.Time) error {
+	return sqliteDialect.deleteHoliday(s.db, date)
+}
+
+func (s *sqliteStore) GetCurrencyExchanges() ([]CurrencyExchange, error) {
+	return sqliteDialect.listExchanges(s.db)
+}
+
+func (s *sqliteStore) GetCurrencyExchange(id string) (CurrencyExchange, error) {
+	return sqliteDialect.getExchange(s.db, id)
+}
+
+func (s *sqliteStore) AddCurrencyExchange(exchange CurrencyExchange) error {
+	return sqliteDialect.addExchange(s.db, exchange)
+}
+
+func (s *sqliteStore) RemoveCurrencyExchange(id string) error {
+	return sqliteDialect.removeExchange(s.db, id)
+}
+
+func (s *sqliteStore) GetInstallmentPurchases() ([]InstallmentPurchase, error) {
+	return sqliteDialect.listInstallments(s.db)
+}
+
+func (s *sqliteStore) GetInstallmentPurchase(id string) (InstallmentPurchase, error) {
+	return sqliteDialect.getInstallment(s.db, id)
+}
+
+func (s *sqliteStore) AddInstallmentPurchase(purchase InstallmentPurchase) error {
+	return sqliteDialect.addInstallment(s.db, purchase)
+}
+
+func (s *sqliteStore) PayOffInstallmentPurchase(id string, date time.Time) error {
+	return sqliteDialect.payOffInstallment(s.db, id, date)
+}
+
+func (s *sqliteStore) RemoveInstallmentPurchase(id string) error {
+	return sqliteDialect.removeInstallment(s.db, id)
+}
+
+func (s *sqliteStore) GetAccounts() ([]Account, error) {
+	return sqliteDialect.listAccounts(s.db)
+}
+
+func (s *sqliteStore) GetAccount(id string) (Account, error) {
+	return sqliteDialect.getAccount(s.db, id)
+}
+
+func (s *sqliteStore) AddAccount(account Account) error {
+	return sqliteDialect.addAccount(s.db, account)
+}
+
+func (s *sqliteStore) UpdateAccount(id string, account Account) error {
+	return sqliteDialect.updateAccount(s.db, id, account)
+}
+
+func (s *sqliteStore) DeleteAccount(id string) error {
+	return sqliteDialect.deleteAccount(s.db, id)
+}
+
+func (s *sqliteStore) GetAccountBalances() ([]AccountBalance, error) {
+	return sqliteDialect.accountBalances(s.db)
+}
+
+func (s *sqliteStore) GetRecurringExpenses() ([]RecurringExpense, error) {
+	query := `SELECT ` + sqliteDialect.recurringColumns() + ` FROM recurring_expenses`
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query recurring expenses: %v", err)
+	}
+	defer rows.Close()
+	var recurringExpenses []RecurringExpense
+	for rows.Next() {
+		re, err := scanRecurringExpense(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan recurring expense: %v", err)
+		}
+		recurringExpenses = append(recurringExpenses, re)
+	}
+	return recurringExpenses, nil
+}
+
+func (s *sqliteStore) GetRecurringExpense(id string) (RecurringExpense, error) {
+	query := `SELECT ` + sqliteDialect.recurringColumns() + ` FROM recurring_expenses WHERE id = ?`
+	re, err := scanRecurringExpense(s.db.QueryRow(query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return RecurringExpense{}, fmt.Errorf("recurring expense with ID %s not found", id)
+		}
+		return RecurringExpense{}, fmt.Errorf("failed to get recurring expense: %v", err)
+	}
+	return re, nil
+}
+
+// insertSQLiteExpenses is the SQLite stand-in for the postgres COPY IN of generated instances
+func insertSQLiteExpenses(tx *sql.Tx, expenses []Expense) error {
+	if len(expenses) == 0 {
+		return nil
+	}
+	stmt, err := tx.Prepare(`INSERT INTO expenses (id, recurring_id, name, category, amount, currency, date, type, occurrence, source, card, account_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare insert: %v", err)
+	}
+	defer stmt.Close()
+	cache := tagIDs{}
+	for _, exp := range expenses {
+		if _, err := stmt.Exec(exp.ID, exp.RecurringID, exp.Name, exp.Category, exp.Amount.Units, exp.Currency, exp.Date.UTC(), exp.Type, exp.Occurrence.UTC(), exp.Source, exp.Card, exp.AccountID); err != nil {
+			return fmt.Errorf("failed to insert expense instance: %v", err)
+		}
+		if err := sqliteDialect.writeTagLinks(tx, expenseTagLink, exp.ID, exp.Tags, cache); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *sqliteStore) AddRecurringExpense(recurringExpense RecurringExpense) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if recurringExpense.ID == "" {
+		recurringExpense.ID = uuid.New().String()
+	}
+	if recurringExpense.Currency == "" {
+		if recurringExpense.Currency, err = sqliteDialect.baseCurrency(tx); err != nil {
+			return err
+		}
+	}
+	if err := recurringExpense.normalizeAmount(); err != nil {
+		return invalid(err)
+	}
+	if err := sqliteDialect.requireCategory(tx, recurringExpense.Category); err != nil {
+		return err
+	}
+	if err := sqliteDialect.requireCurrency(tx, recurringExpense.Currency); err != nil {
+		return err
+	}
+	err = recurringExpense.resolveAccount(func(e *Expense, current Expense) error {
+		return sqliteDialect.resolveAccount(tx, e, current)
+	}, "")
+	if err != nil {
+		return err
+	}
+	holidays, err := sqliteDialect.loadHolidays(tx)
+	if err != nil {
+		return err
+	}
+	amountChanges, overrides, err := recurringExpense.scheduleJSON()
+	if err != nil {
+		return err
+	}
+	horizon := RecurringHorizon(time.Now())
+	recurringExpense.MaterializedThrough = &horizon
+	ruleQuery := `
+		INSERT INTO recurring_expenses (id, name, amount, currency, category, start_date, interval, occurrences, materialized_through, rrule, business_day, amount_changes, overrides, source, card, account_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	_, err = tx.Exec(ruleQuery, recurringExpense.ID, recurringExpense.Name, recurringExpense.Amount.Units, recurringExpense.Currency, recurringExpense.Category, recurringExpense.StartDate.UTC(), recurringExpense.Interval, recurringExpense.Occurrences, horizon, recurringExpense.RRule, recurringExpense.BusinessDay, amountChanges, overrides, recurringExpense.Source, recurringExpense.Card, recurringExpense.AccountID)
+	if err != nil {
+		return fmt.Errorf("failed to insert recurring expense rule: %v", err)
+	}
+	if err := sqliteDialect.writeTagLinks(tx, recurringTagLink, recurringExpense.ID, recurringExpense.Tags, nil); err != nil {
+		return err
+	}
+	instances := recurringExpense.instances(time.Time{}, horizon, holidays)
+	if err := insertSQLiteExpenses(tx, instances); err != nil {
+		return err
+	}
+	recurringExpense.Tags = normalizeTags(recurringExpense.Tags)
+	recurringExpense.Version = 1
+	err = sqliteDialect.recordAudit(tx, auditChange{entity: AuditRecurring, id: recurringExpense.ID, action: AuditCreate,
+		detail: fmt.Sprintf("%d instances generated", len(instances)), after: recurringExpense})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteStore) UpdateRecurringExpense(id string, recurringExpense RecurringExpense, updateAll bool) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+	recurringExpense.ID = id
+	if recurringExpense.Currency == "" {
+		if recurringExpense.Currency, err = sqliteDialect.baseCurrency(tx); err != nil {
+			return err
+		}
+	}
+	if err := recurringExpense.normalizeAmount(); err != nil {
+		return invalid(err)
+	}
+	if err := sqliteDialect.requireCategory(tx, recurringExpense.Category); err != nil {
+		return err
+	}
+	if err := sqliteDialect.requireCurrency(tx, recurringExpense.Currency); err != nil {
+		return err
+	}
+	before, err := sqliteDialect.loadRecurring(tx, id)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("failed to read recurring expense rule: %v", err)
+	}
+	err = recurringExpense.resolveAccount(func(e *Expense, current Expense) error {
+		return sqliteDialect.resolveAccount(tx, e, current)
+	}, before.AccountID)
+	if err != nil {
+		return err
+	}
+	holidays, err := sqliteDialect.loadHolidays(tx)
+	if err != nil {
+		return err
+	}
+	// overrides only change one occurrence at a time
+	recurringExpense.Overrides = before.Overrides
+	amountChanges, _, err := recurringExpense.scheduleJSON()
+	if err != nil {
+		return err
+	}
+	horizon := RecurringHorizon(time.Now())
+	match, matchArgs := sqliteDialect.versionMatch(recurringExpense.Version, 16)
+	ruleQuery := `
+		UPDATE recurring_expenses
+		SET name = ?, amount = ?, category = ?, start_date = ?, interval = ?, occurrences = ?, currency = ?, materialized_through = ?, rrule = ?, business_day = ?, amount_changes = ?, source = ?, card = ?, account_id = ?, version = version + 1
+		WHERE id = ?` + match
+	args := []any{recurringExpense.Name, recurringExpense.Amount.Units, recurringExpense.Category, recurringExpense.StartDate.UTC(), recurringExpense.Interval, recurringExpense.Occurrences, recurringExpense.Currency, horizon, recurringExpense.RRule, recurringExpense.BusinessDay, amountChanges, recurringExpense.Source, recurringExpense.Card, recurringExpense.AccountID, id}
+	res, err := tx.Exec(ruleQuery, append(args, matchArgs...)...)
+	if err != nil {
+		return fmt.Errorf("failed to update recurring expense rule: %v", err)
+	}
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		return sqliteDialect.rowConflict(tx, "recurring_expenses", AuditRecurring, id, fmt.Errorf("recurring expense with ID %s not found to update", id))
+	}
+	if err := sqliteDialect.writeTagLinks(tx, recurringTagLink, id, recurringExpense.Tags, nil); err != nil {
+		return err
+	}
+
+	var from time.Time
+	if updateAll {
+		res, err = tx.Exec(`DELETE FROM expenses WHERE recurring_id = ?`, id)
+	} else {
+		from = time.Now().UTC()
+		res, err = tx.Exec(`DELETE FROM expenses WHERE recurring_id = ? AND COALESCE(occurrence, date) > ?`, id, from)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete old expense instances for update: %v", err)
+	}
+	removed, _ := res.RowsAffected()
+	instances := recurringExpense.instances(from, horizon, holidays)
+	if err := insertSQLiteExpenses(tx, instances); err != nil {
+		return err
+	}
+	after, err := sqliteDialect.loadRecurring(tx, id)
+	if err != nil {
+		return fmt.Errorf("failed to read updated recurring expense rule: %v", err)
+	}
+	err = sqliteDialect.recordAudit(tx, auditChange{entity: AuditRecurring, id: id, action: AuditUpdate,
+		detail: fmt.Sprintf("%d instances removed, %d generated", removed, len(instances)), before: before, after: after})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteStore) RemoveRecurringExpense(id string, removeAll bool, version int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+	before, err := sqliteDialect.loadRecurring(tx, id)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("failed to read recurring expense rule: %v", err)
+	}
+	match, matchArgs := sqliteDialect.versionMatch(version, 2)
+	res, err := tx.Exec(`DELETE FROM recurring_expenses WHERE id = ?`+match, append([]any{id}, matchArgs...)...)
+	if err != nil {
+		return fmt.Errorf("failed to delete recurring expense rule: %v", err)
+	}
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		return sqliteDialect.rowConflict(tx, "recurring_expenses", AuditRecurring, id, fmt.Errorf("recurring expense with ID %s not found", id))
+	}
+
+	if removeAll {
+		res, err = tx.Exec(`DELETE FROM expenses WHERE recurring_id = ?`, id)
+	} else {
+		res, err = tx.Exec(`DELETE FROM expenses WHERE recurring_id = ? AND COALESCE(occurrence, date) > ?`, id, time.Now().UTC())
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete expense instances: %v", err)
+	}
+	removed, _ := res.RowsAffected()
+	err = sqliteDialect.recordAudit(tx, auditChange{entity: AuditRecurring, id: id, action: AuditDelete,
+		detail: fmt.Sprintf("%d instances removed", removed), before: before})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteStore) OverrideRecurringOccurrence(id string, override RecurringOverride, version int64) error {
+	return sqliteDialect.overrideOccurrence(s.db, id, override, version, insertSQLiteExpenses)
+}
+
+func (s *sqliteStore) MaterializeRecurring(through time.Time) (int, error) {
+	return sqliteDialect.materializeRecurring(s.db, through, insertSQLiteExpenses)
+}
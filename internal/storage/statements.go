@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// CardStatement is one billing cycle of a credit card: what was charged to
+// the card between two closings and what was paid into it afterwards
+type CardStatement struct {
+	Start     time.Time `json:"start"`   // day after the previous closing
+	Closing   time.Time `json:"closing"` // last day of the cycle
+	Due       time.Time `json:"due"`
+	Purchases []Expense `json:"purchases"` // movements out of the card, refunds included, newest first
+	Total     Money     `json:"total"`     // owed for the cycle, positive
+	Paid      Money     `json:"paid"`      // transfers into the card after the closing, up to the next one
+}
+
+// HasCycle reports whether the account is a credit card with closing and due days
+func (a Account) HasCycle() bool {
+	return a.Type == AccountTypeCreditCard && a.ClosingDay > 0 && a.DueDay > 0
+}
+
+// dayIn is the given day of a month, or its last day when the month is shorter
+func dayIn(year int, month time.Month, day int) time.Time {
+	last := time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	return time.Date(year, month, min(day, last), 0, 0, 0, 0, time.UTC)
+}
+
+// StatementDates returns the closing of the statement a movement on date
+// falls in, and the day that statement is due: the first due day after it
+func (a Account) StatementDates(date time.Time) (closing, due time.Time) {
+	date = date.UTC()
+	day := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+	closing = dayIn(day.Year(), day.Month(), a.ClosingDay)
+	if day.After(closing) {
+		closing = dayIn(day.Year(), day.Month()+1, a.ClosingDay)
+	}
+	due = dayIn(closing.Year(), closing.Month(), a.DueDay)
+	if !due.After(closing) {
+		due = dayIn(closing.Year(), closing.Month()+1, a.DueDay)
+	}
+	return closing, due
+}
+
+// previousClosing is the closing of the statement before the one closing on closing
+func (a Account) previousClosing(closing time.Time) time.Time {
+	return dayIn(closing.Year(), closing.Month()-1, a.ClosingDay)
+}
+
+// CardStatements groups the expenses of a credit card into its statements,
+// newest first. Movements out of the card are charged to the statement they
+// fall in; transfers into it pay the last statement closed before them.
+func CardStatements(card Account, expenses []Expense) ([]CardStatement, error) {
+	if !card.HasCycle() {
+		return nil, fmt.Errorf("account %s has no statement cycle", card.Name)
+	}
+	zero := Money{Scale: CurrencyDecimals(card.Currency)}
+	byClosing := map[time.Time]*CardStatement{}
+	statement := func(closing time.Time) *CardStatement {
+		if s, ok := byClosing[closing]; ok {
+			return s
+		}
+		_, due := card.StatementDates(closing)
+		s := &CardStatement{
+			Start:     card.previousClosing(closing).AddDate(0, 0, 1),
+			Closing:   closing,
+			Due:       due,
+			Purchases: []Expense{},
+			Total:     zero,
+			Paid:      zero,
+		}
+		byClosing[closing] = s
+		return s
+	}
+	for _, e := range expenses {
+		switch card.ID {
+		case e.AccountID:
+			closing, _ := card.StatementDates(e.Date)
+			s := statement(closing)
+			s.Purchases = append(s.Purchases, e)
+			s.Total.Units -= e.Amount.Units
+		case e.ToAccountID:
+			closing, _ := card.StatementDates(e.Date)
+			s := statement(card.previousClosing(closing))
+			s.Paid.Units -= e.Amount.Units
+		}
+	}
+	statements := make([]CardStatement, 0, len(byClosing))
+	for _, s := range byClosing {
+		slices.SortStableFunc(s.Purchases, func(a, b Expense) int { return b.Date.Compare(a.Date) })
+		statements = append(statements, *s)
+	}
+	slices.SortFunc(statements, func(a, b CardStatement) int { return b.Closing.Compare(a.Closing) })
+	return statements, nil
+}
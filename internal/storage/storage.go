@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"regexp"
+	"slices"
 	"strings"
 	"time"
 )
@@ -14,40 +15,139 @@ type Storage interface {
 	GetConfig() (*Config, error)
 
 	// Basic Config Updates
-	GetCategories() ([]string, error)
-	UpdateCategories(categories []string) error
-	// GetTags() ([]string, error)
-	// UpdateTags(tags []string) error
+	GetCategories() ([]Category, error)
+	// CategoriesVersion is the version of the whole category list. Writes to
+	// the list take the version they are based on (0 skips the check) and fail
+	// with a *ConflictError when it moved on.
+	CategoriesVersion() (int64, error)
+	UpdateCategories(categories []Category, version int64) error
+	// RenameCategory and DeleteCategory cascade to every expense, recurring
+	// rule and installment purchase; DeleteCategory moves them to reassignTo
+	// and refuses a category in use when reassignTo is empty
+	RenameCategory(from, to string, version int64) error
+	DeleteCategory(name, reassignTo string, version int64) error
 	GetCurrency() (string, error)
 	UpdateCurrency(currency string) error
+	// GetEnabledCurrencies lists the currencies of the catalog that expenses
+	// and recurring rules may use, in display order. UpdateEnabledCurrencies
+	// replaces the list and refuses to drop the base currency or one in use.
+	GetEnabledCurrencies() ([]string, error)
+	UpdateEnabledCurrencies(codes []string) error
 	GetStartDate() (int, error)
 	UpdateStartDate(startDate int) error
 
+	// Tags; changes cascade to every expense and recurring rule carrying the tag
+	GetTags() ([]Tag, error)
+	AddTag(name string) error
+	RenameTag(from, to string) error
+	MergeTags(sources []string, target string) error
+	DeleteTag(name string) error
+
 	// Recurring Expenses
 	GetRecurringExpenses() ([]RecurringExpense, error)
 	GetRecurringExpense(id string) (RecurringExpense, error)
 	AddRecurringExpense(recurringExpense RecurringExpense) error
-	RemoveRecurringExpense(id string, removeAll bool) error
+	RemoveRecurringExpense(id string, removeAll bool, version int64) error
+	// UpdateRecurringExpense and UpdateExpense check the Version of the given
+	// record unless it is 0 and fail with a *ConflictError when it is stale;
+	// RemoveRecurringExpense, OverrideRecurringOccurrence and RemoveExpense
+	// check their version argument the same way
 	UpdateRecurringExpense(id string, recurringExpense RecurringExpense, updateAll bool) error
+	// OverrideRecurringOccurrence edits or skips the occurrence of a rule
+	// scheduled on override.Occurrence and rewrites its expense when stored;
+	// an override changing nothing restores the occurrence. It fails when the
+	// rule schedules nothing on that date.
+	OverrideRecurringOccurrence(id string, override RecurringOverride, version int64) error
+	// Rules keep their occurrences as expenses only up to RecurringHorizon
+	// when added or updated; MaterializeRecurring writes the ones dated up to
+	// through that are missing and returns how many it wrote
+	MaterializeRecurring(through time.Time) (int, error)
 
 	// Expenses
 	GetAllExpenses() ([]Expense, error)
+	QueryExpenses(filter ExpenseFilter) ([]Expense, error)
+	QueryExpensesPage(filter ExpenseFilter, after *ExpenseCursor, limit int) (ExpensePage, error)
+	// StreamExpenses calls fn for each match in listing order without buffering;
+	// fn must not call back into the store
+	StreamExpenses(filter ExpenseFilter, fn func(Expense) error) error
+	SumExpensesByCategory(filter ExpenseFilter) ([]CategorySum, error)
 	GetExpense(id string) (Expense, error)
 	AddExpense(expense Expense) error
-	RemoveExpense(id string) error
+	RemoveExpense(id string, version int64) error
 	AddMultipleExpenses(expenses []Expense) error
 	RemoveMultipleExpenses(ids []string) error
+	// UpdateExpense and the trash refuse the occurrences of an existing rule;
+	// they change through OverrideRecurringOccurrence
 	UpdateExpense(id string, expense Expense) error
 
-	// Potential Future Feature: Multi-currency
-	// GetConversions() (map[string]float64, error)
-	// UpdateConversions(conversions map[string]float64) error
+	// Trash; RemoveExpense and RemoveMultipleExpenses only move expenses here.
+	// RestoreExpenses and PurgeExpenses fail without changes unless every id is trashed.
+	GetTrash() ([]TrashedExpense, error)
+	RestoreExpenses(ids []string) error
+	PurgeExpenses(ids []string) error
+	// PurgeTrash permanently deletes the expenses trashed before the cutoff
+	PurgeTrash(before time.Time) (int, error)
+
+	// Audit log; every change to expenses, recurring rules, categories and the
+	// config is recorded in the same transaction, newest entries first
+	GetAuditLog(filter AuditFilter) ([]AuditEntry, error)
+
+	// Exchange rates, one per currency pair and day; saving a rate for a
+	// pair and day already stored replaces it
+	GetExchangeRates() ([]ExchangeRate, error)
+	SaveExchangeRates(rates []ExchangeRate) error
+	DeleteExchangeRate(date time.Time, currency, quote string) error
+
+	// Consumer price indexes, one per currency and month; saving an index for
+	// a month already stored replaces it
+	GetCPIIndexes() ([]CPIIndex, error)
+	SaveCPIIndexes(indexes []CPIIndex) error
+	DeleteCPIIndex(currency string, month time.Time) error
+
+	// Holidays, one per date; saving one for a date already stored replaces
+	// its name. Recurring rules with a business day adjustment move their
+	// occurrences off them as they are written; those already stored keep
+	// their dates until the rule changes.
+	GetHolidays() ([]Holiday, error)
+	SaveHolidays(holidays []Holiday) error
+	DeleteHoliday(date time.Time) error
+
+	// Currency exchanges, newest first. Adding one stores its two expense
+	// legs and upserts its effective rate; removing one deletes the legs for
+	// good. UpdateExpense and the trash refuse the legs.
+	GetCurrencyExchanges() ([]CurrencyExchange, error)
+	GetCurrencyExchange(id string) (CurrencyExchange, error)
+	AddCurrencyExchange(exchange CurrencyExchange) error
+	RemoveCurrencyExchange(id string) error
+
+	// Installment purchases on credit cards, newest first. Adding one stores
+	// an expense per installment on the card; paying one off replaces the
+	// installments still to come with a single expense, and removing one
+	// deletes its expenses for good. UpdateExpense and the trash refuse them.
+	GetInstallmentPurchases() ([]InstallmentPurchase, error)
+	GetInstallmentPurchase(id string) (InstallmentPurchase, error)
+	AddInstallmentPurchase(purchase InstallmentPurchase) error
+	PayOffInstallmentPurchase(id string, date time.Time) error
+	RemoveInstallmentPurchase(id string) error
+
+	// Accounts, active ones first by name. Expense writes resolve the
+	// account of the expense and derive its Source and Card from it; an
+	// account in use can be archived but not deleted, and keeps its currency.
+	GetAccounts() ([]Account, error)
+	GetAccount(id string) (Account, error)
+	AddAccount(account Account) error
+	UpdateAccount(id string, account Account) error
+	DeleteAccount(id string) error
+	// GetAccountBalances adds the live expenses of each account to its opening
+	// balance; a transfer counts on both of its accounts
+	GetAccountBalances() ([]AccountBalance, error)
 }
 
 // config for expense data
 type Config struct {
-	Categories        []string           `json:"categories"`
+	Categories        []Category         `json:"categories"`
 	Currency          string             `json:"currency"`
+	Currencies        []string           `json:"currencies"`
 	StartDate         int                `json:"startDate"`
 	RecurringExpenses []RecurringExpense `json:"recurringExpenses"`
 	// Tags              []string           `json:"tags"`
@@ -56,13 +156,34 @@ type Config struct {
 type RecurringExpense struct {
 	ID          string    `json:"id"`
 	Name        string    `json:"name"`
-	Amount      float64   `json:"amount"`
+	Amount      Money     `json:"amount"` // exact, in the minor units of Currency once stored
 	Currency    string    `json:"currency"`
 	Tags        []string  `json:"tags"`
 	Category    string    `json:"category"`
 	StartDate   time.Time `json:"startDate"`   // date of the first occurrence
 	Interval    string    `json:"interval"`    // daily, weekly, monthly, yearly
-	Occurrences int       `json:"occurrences"` // 0 for 3000 occurrences (heuristic)
+	Occurrences int       `json:"occurrences"` // 0 recurs indefinitely
+	Version     int64     `json:"version"`     // bumped on every change, starts at 1
+	// RRule is an RFC 5545 recurrence rule such as FREQ=MONTHLY;BYMONTHDAY=-1;
+	// when set, its FREQ and COUNT fill Interval and Occurrences
+	RRule string `json:"rrule,omitempty"`
+	// BusinessDay moves occurrences falling on a weekend or holiday to the
+	// following or preceding business day; empty leaves them be
+	BusinessDay string `json:"businessDay,omitempty"`
+	// AccountID, Source and Card are copied to every generated expense and
+	// resolved the way an expense's are
+	AccountID string `json:"accountId,omitempty"`
+	Source    string `json:"source"`
+	Card      string `json:"card"`
+	// AmountChanges set the amount of the occurrences scheduled from their
+	// date on, oldest first; earlier ones keep Amount
+	AmountChanges []AmountChange `json:"amountChanges"`
+	// Overrides edit or skip single occurrences, oldest first; they are set
+	// through OverrideRecurringOccurrence and kept when the rule is updated
+	Overrides []RecurringOverride `json:"overrides"`
+	// MaterializedThrough is the horizon up to which occurrences are stored
+	// as expenses; set by the store, later ones are only projected
+	MaterializedThrough *time.Time `json:"materializedThrough,omitempty"`
 }
 
 type BackendType string
@@ -71,6 +192,7 @@ const (
 	// BackendTypeJSON is deprecated and no longer supported at runtime.
 	BackendTypeJSON     BackendType = "json"
 	BackendTypePostgres BackendType = "postgres"
+	BackendTypeSQLite   BackendType = "sqlite"
 )
 
 // config for the storage backend
@@ -89,16 +211,42 @@ type Expense struct {
 	Name        string    `json:"name"`
 	Tags        []string  `json:"tags"`
 	Category    string    `json:"category"`
-	Amount      float64   `json:"amount"`
+	Amount      Money     `json:"amount"` // exact, in the minor units of Currency once stored
 	Currency    string    `json:"currency"`
 	Source      string    `json:"source"`
 	Card        string    `json:"card"`
 	Date        time.Time `json:"date"`
+	Version     int64     `json:"version"` // bumped on every change, starts at 1
+	// Rate optionally locks the conversion of the expense: one unit of
+	// Currency is worth Rate units of RateCurrency, the base currency unless set
+	Rate         *Money `json:"rate,omitempty"`
+	RateCurrency string `json:"rateCurrency,omitempty"`
+	// ExchangeID marks one leg of a currency exchange; legs only change
+	// through their exchange
+	ExchangeID string `json:"exchangeId,omitempty"`
+	// AccountID is where the money comes from or goes to. Source and Card
+	// are derived from it for older clients; an expense written without it
+	// picks its account from them.
+	AccountID string `json:"accountId,omitempty"`
+	// Type is expense, income or transfer; a transfer moves the money from
+	// AccountID to ToAccountID and is neither spending nor income
+	Type        string `json:"type"`
+	ToAccountID string `json:"toAccountId,omitempty"`
+	// InstallmentID marks one installment of an installment purchase;
+	// installments only change through their purchase
+	InstallmentID string `json:"installmentId,omitempty"`
+	// Occurrence is the date the rule of a generated expense scheduled it
+	// on, before any override moved it; overrides find the occurrence by it
+	Occurrence *time.Time `json:"occurrence,omitempty"`
+	// Projected marks an occurrence of a recurring rule past its stored
+	// horizon; it has no id and is never stored
+	Projected bool `json:"projected,omitempty"`
 }
 
 func (c *Config) SetBaseConfig() {
 	c.Categories = defaultCategories
 	c.Currency = "usd"
+	c.Currencies = slices.Clone(DefaultCurrencies)
 	c.StartDate = 1
 	// c.Tags = []string{}
 	c.RecurringExpenses = []RecurringExpense{}
@@ -118,6 +266,8 @@ func backendTypeFromEnv(env string) BackendType {
 		return BackendTypeJSON
 	case "postgres":
 		return BackendTypePostgres
+	case "sqlite":
+		return BackendTypeSQLite
 	default:
 		return ""
 	}
@@ -138,24 +288,39 @@ func backendSSLFromEnv(env string) string {
 
 // initializes the storage backend
 func InitializeStorage() (Storage, error) {
+	baseConfig, err := loadSystemConfig()
+	if err != nil {
+		return nil, err
+	}
+	if baseConfig.StorageType == BackendTypeSQLite {
+		return InitializeSQLiteStore(baseConfig)
+	}
+	return InitializePostgresStore(baseConfig)
+}
+
+// reads and validates the storage settings from the environment
+func loadSystemConfig() (SystemConfig, error) {
 	baseConfig := SystemConfig{}
 	baseConfig.SetStorageConfig()
-	if baseConfig.StorageType == "" {
-		return nil, fmt.Errorf("missing STORAGE_TYPE (set STORAGE_TYPE=postgres)")
-	}
-	if baseConfig.StorageType != BackendTypePostgres {
-		return nil, fmt.Errorf("unsupported storage type: %q (json storage deprecated; set STORAGE_TYPE=postgres)", baseConfig.StorageType)
+	switch baseConfig.StorageType {
+	case "":
+		return baseConfig, fmt.Errorf("missing STORAGE_TYPE (set STORAGE_TYPE=postgres or STORAGE_TYPE=sqlite)")
+	case BackendTypeSQLite:
+		return baseConfig, nil
+	case BackendTypePostgres:
+	default:
+		return baseConfig, fmt.Errorf("unsupported storage type: %q (json storage deprecated; set STORAGE_TYPE=postgres or STORAGE_TYPE=sqlite)", baseConfig.StorageType)
 	}
 	if baseConfig.StorageURL == "" {
-		return nil, fmt.Errorf("missing STORAGE_URL for postgres backend")
+		return baseConfig, fmt.Errorf("missing STORAGE_URL for postgres backend")
 	}
 	if baseConfig.StorageUser == "" {
-		return nil, fmt.Errorf("missing STORAGE_USER for postgres backend")
+		return baseConfig, fmt.Errorf("missing STORAGE_USER for postgres backend")
 	}
 	if baseConfig.StoragePass == "" {
-		return nil, fmt.Errorf("missing STORAGE_PASS for postgres backend")
+		return baseConfig, fmt.Errorf("missing STORAGE_PASS for postgres backend")
 	}
-	return InitializePostgresStore(baseConfig)
+	return baseConfig, nil
 }
 
 var REInvalidChars *regexp.Regexp = regexp.MustCompile(`[^\p{L}\p{N}\s.,\-'_!"]`)
@@ -168,6 +333,25 @@ func SanitizeString(s string) string {
 	return strings.TrimSpace(sanitized)
 }
 
+// ValidationError is returned by a write the stored data refuses: an unknown
+// category or account, a currency that is not enabled, an amount finer than
+// its currency allows. The input is at fault, not the store.
+type ValidationError struct {
+	Err error
+}
+
+func (e *ValidationError) Error() string { return e.Err.Error() }
+
+func (e *ValidationError) Unwrap() error { return e.Err }
+
+// invalid marks err as a ValidationError; nil stays nil
+func invalid(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &ValidationError{Err: err}
+}
+
 func ValidateCategory(category string) (string, error) {
 	sanitized := SanitizeString(category)
 	if sanitized == "" {
@@ -181,12 +365,29 @@ func (e *Expense) Validate() error {
 	if e.Name == "" {
 		return fmt.Errorf("expense 'name' cannot be empty")
 	}
-	if e.Category == "" {
-		return fmt.Errorf("expense 'category' cannot be empty")
-	}
-	if e.Amount == 0 {
+	if e.Amount.IsZero() {
 		return fmt.Errorf("expense 'amount' cannot be 0")
 	}
+	if err := e.normalizeType(); err != nil {
+		return err
+	}
+	if e.Currency != "" {
+		if err := e.normalizeAmount(); err != nil {
+			return err
+		}
+	}
+	if e.Rate != nil {
+		if e.Rate.Sign() <= 0 {
+			return fmt.Errorf("expense 'rate' must be positive")
+		}
+		// an empty rate currency is left for the store to default to the base currency
+		e.RateCurrency = strings.ToLower(strings.TrimSpace(e.RateCurrency))
+		if e.RateCurrency != "" {
+			if _, ok := LookupCurrency(e.RateCurrency); !ok {
+				return fmt.Errorf("invalid rate currency: '%s'", e.RateCurrency)
+			}
+		}
+	}
 	e.Source = SanitizeString(e.Source)
 	e.Card = SanitizeString(e.Card)
 	// if e.Currency == "" {
@@ -213,6 +414,8 @@ func (e *RecurringExpense) Validate() error {
 	if e.Name == "" {
 		return fmt.Errorf("recurring expense 'name' cannot be empty")
 	}
+	e.Source = SanitizeString(e.Source)
+	e.Card = SanitizeString(e.Card)
 	if e.Category == "" {
 		return fmt.Errorf("recurring expense 'category' cannot be empty")
 	}
@@ -226,12 +429,50 @@ func (e *RecurringExpense) Validate() error {
 		}
 		e.Tags = cleanedTags
 	}
-	if e.Occurrences < 2 {
-		return fmt.Errorf("at least 2 occurences required to recur")
+	if e.Currency != "" {
+		if err := e.normalizeAmount(); err != nil {
+			return err
+		}
+	}
+	var until time.Time
+	if e.RRule != "" {
+		rule, err := parseRRule(e.RRule)
+		if err != nil {
+			return err
+		}
+		e.RRule = NormalizeRRule(e.RRule)
+		e.Interval = strings.ToLower(rule.freq)
+		e.Occurrences = rule.count
+		until = rule.until
+	}
+	if e.Occurrences < 0 || e.Occurrences == 1 {
+		return fmt.Errorf("at least 2 occurences required to recur, or 0 to recur indefinitely")
 	}
 	if e.StartDate.IsZero() {
 		return fmt.Errorf("start date for recurring expense must be specified")
 	}
+	if !until.IsZero() && until.Before(e.StartDate) {
+		return fmt.Errorf("rrule UNTIL cannot be before the start date")
+	}
+	switch e.BusinessDay {
+	case "", BusinessDayFollowing, BusinessDayPreceding:
+	default:
+		return fmt.Errorf("invalid business day adjustment: '%s'. Must be 'following' or 'preceding'", e.BusinessDay)
+	}
+	slices.SortFunc(e.AmountChanges, func(a, b AmountChange) int { return a.From.Compare(b.From) })
+	for i, change := range e.AmountChanges {
+		if change.From.IsZero() {
+			return fmt.Errorf("amount change 'from' cannot be empty")
+		}
+		if i > 0 && change.From.Equal(e.AmountChanges[i-1].From) {
+			return fmt.Errorf("two amount changes from %s", change.From.Format("2006-01-02"))
+		}
+	}
+	for i := range e.Overrides {
+		if err := e.Overrides[i].Validate(); err != nil {
+			return err
+		}
+	}
 	validIntervals := map[string]bool{
 		"daily":   true,
 		"weekly":  true,
@@ -245,21 +486,15 @@ func (e *RecurringExpense) Validate() error {
 }
 
 // variables
-var defaultCategories = []string{
-	"Food",
-	"Groceries",
-	"Travel",
-	"Rent",
-	"Utilities",
-	"Entertainment",
-	"Healthcare",
-	"Shopping",
-	"Miscellaneous",
-	"Income",
-}
-
-var SupportedCurrencies = []string{
-    "ars", // Argentine Peso
-    "usd", // US Dollar
-    "eur", // Euro
+var defaultCategories = []Category{
+	{Name: "Food", Color: "#ff6b6b", Icon: "utensils", Type: CategoryTypeExpense},
+	{Name: "Groceries", Color: "#4ecdc4", Icon: "basket-shopping", Type: CategoryTypeExpense},
+	{Name: "Travel", Color: "#45b7d1", Icon: "plane", Type: CategoryTypeExpense},
+	{Name: "Rent", Color: "#96ceb4", Icon: "house", Type: CategoryTypeExpense},
+	{Name: "Utilities", Color: "#ffbe0b", Icon: "bolt", Type: CategoryTypeExpense},
+	{Name: "Entertainment", Color: "#ff006e", Icon: "film", Type: CategoryTypeExpense},
+	{Name: "Healthcare", Color: "#8338ec", Icon: "heart-pulse", Type: CategoryTypeExpense},
+	{Name: "Shopping", Color: "#3a86ff", Icon: "bag-shopping", Type: CategoryTypeExpense},
+	{Name: "Miscellaneous", Color: "#fb5607", Icon: "shapes", Type: CategoryTypeExpense},
+	{Name: "Income", Color: "#38b000", Icon: "money-bill-wave", Type: CategoryTypeIncome},
 }
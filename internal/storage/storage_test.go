@@ -1,13 +1,95 @@
 package storage
 
 import (
+	"math"
 	"net/url"
 	"os"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 )
 
-func TestPostgresStoreCRUD(t *testing.T) {
+func TestParseMoney(t *testing.T) {
+	cases := []struct {
+		in, out string
+		units   int64
+		scale   int
+	}{
+		{"-12.50", "-12.50", -1250, 2},
+		{"0.1", "0.1", 1, 1},
+		{"+7", "7", 7, 0},
+		{"-.05", "-0.05", -5, 2},
+		{"999999999999999999", "999999999999999999", 999999999999999999, 0},
+	}
+	for _, c := range cases {
+		m, err := ParseMoney(c.in)
+		if err != nil || m != NewMoney(c.units, c.scale) || m.String() != c.out {
+			t.Fatalf("ParseMoney(%q) = %+v (%v), want %d at scale %d printed %q", c.in, m, err, c.units, c.scale, c.out)
+		}
+	}
+	for _, bad := range []string{"", "-", ".", "1.", "1e3", "1,000.00", "12.3.4", "abc", "1000000000000000000", "-+5", "+-5", "--5"} {
+		if _, err := ParseMoney(bad); err == nil {
+			t.Fatalf("expected ParseMoney(%q) to fail", bad)
+		}
+	}
+	if m, err := MustParseMoney("1.5").In("usd"); err != nil || m != NewMoney(150, 2) {
+		t.Fatalf("expected 1.5 usd as 150 cents, got %+v (%v)", m, err)
+	}
+	if _, err := MustParseMoney("1.505").In("usd"); err == nil {
+		t.Fatalf("expected three decimals to be refused in usd")
+	}
+	if sum, err := MustParseMoney("0.1").Add(MustParseMoney("0.20")); err != nil || sum != NewMoney(30, 2) {
+		t.Fatalf("expected 0.1 + 0.20 = 0.30, got %v (%v)", sum, err)
+	}
+	if sum, err := NewMoney(math.MaxInt64, 0).Add(NewMoney(1, 0)); err == nil {
+		t.Fatalf("expected the overflowing sum refused, got %v", sum)
+	}
+	if sum, err := NewMoney(math.MinInt64+1, 0).Add(NewMoney(-1, 0)); err != nil || sum.Units != math.MinInt64 {
+		t.Fatalf("expected the sum down to the smallest int64, got %v (%v)", sum, err)
+	}
+	if sum, err := NewMoney(math.MaxInt64/2, 0).Add(NewMoney(1, 2)); err == nil {
+		t.Fatalf("expected the amount too large to rescale refused, got %v", sum)
+	}
+}
+
+func TestRateTable(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 5, d, 0, 0, 0, 0, time.UTC) }
+	table := NewRateTable([]ExchangeRate{
+		{Date: day(10), Currency: "usd", Quote: "ars", Rate: MustParseMoney("1000")},
+		{Date: day(1), Currency: "usd", Quote: "ars", Rate: MustParseMoney("900")},
+		{Date: day(20), Currency: "ars", Quote: "usd", Rate: MustParseMoney("0.0008")},
+		{Date: day(1), Currency: "eur", Quote: "usd", Rate: MustParseMoney("1.5")},
+	})
+	cases := []struct {
+		name     string
+		expense  Expense
+		base     string
+		want     string
+		converts bool
+	}{
+		{"same currency", Expense{Amount: MustParseMoney("-3.10"), Currency: "ars", Date: day(1)}, "ars", "-3.10", true},
+		{"before any rate", Expense{Amount: MustParseMoney("-1"), Currency: "usd", Date: day(1).Add(-time.Hour)}, "ars", "", false},
+		{"rate of the first day", Expense{Amount: MustParseMoney("-2"), Currency: "usd", Date: day(1).Add(23 * time.Hour)}, "ars", "-1800.00", true},
+		{"latest rate on or before", Expense{Amount: MustParseMoney("-2"), Currency: "usd", Date: day(15)}, "ars", "-2000.00", true},
+		{"newer inverse rate", Expense{Amount: MustParseMoney("-2"), Currency: "usd", Date: day(25)}, "ars", "-2500.00", true},
+		{"older direct rate inverted", Expense{Amount: MustParseMoney("1500"), Currency: "ars", Date: day(15)}, "usd", "1.50", true},
+		{"halves round away from zero", Expense{Amount: MustParseMoney("-0.05"), Currency: "eur", Date: day(2)}, "usd", "-0.08", true},
+		{"no pair", Expense{Amount: MustParseMoney("5"), Currency: "eur", Date: day(2)}, "ars", "", false},
+		{"locked rate", Expense{Amount: MustParseMoney("5"), Currency: "eur", Date: day(2), Rate: ptr(MustParseMoney("1234.567")), RateCurrency: "ars"}, "ars", "6172.84", true},
+		{"locked rate in another currency", Expense{Amount: MustParseMoney("5"), Currency: "eur", Date: day(2), Rate: ptr(MustParseMoney("2")), RateCurrency: "ars"}, "usd", "7.50", true},
+	}
+	for _, c := range cases {
+		got, ok := table.Convert(c.expense, c.base)
+		if ok != c.converts || ok && got.String() != c.want {
+			t.Fatalf("%s: got %v (%v), want %s (%v)", c.name, got, ok, c.want, c.converts)
+		}
+	}
+}
+
+// postgresTestConfig builds a SystemConfig from TEST_DATABASE_URL or skips the test
+func postgresTestConfig(t *testing.T) SystemConfig {
+	t.Helper()
 	uri := os.Getenv("TEST_DATABASE_URL")
 	if uri == "" {
 		t.Skip("TEST_DATABASE_URL not set; skipping postgres integration test")
@@ -36,13 +118,205 @@ func TestPostgresStoreCRUD(t *testing.T) {
 		sslMode = "disable"
 	}
 
-	baseConfig := SystemConfig{
+	return SystemConfig{
 		StorageURL:  host + "/" + dbName,
 		StorageType: BackendTypePostgres,
 		StorageUser: user,
 		StoragePass: pass,
 		StorageSSL:  sslMode,
 	}
+}
+
+func TestCurrencyCatalog(t *testing.T) {
+	catalog := CurrencyCatalog()
+	for i, currency := range catalog {
+		if len(currency.Code) != 3 || currency.Code != strings.ToLower(currency.Code) || currency.Symbol == "" || currency.Name == "" {
+			t.Fatalf("malformed catalog entry %+v", currency)
+		}
+		if i > 0 && catalog[i-1].Code >= currency.Code {
+			t.Fatalf("catalog not sorted by code at %s", currency.Code)
+		}
+	}
+	for _, code := range DefaultCurrencies {
+		if _, ok := LookupCurrency(code); !ok {
+			t.Fatalf("default currency %s missing from the catalog", code)
+		}
+	}
+	for code, decimals := range map[string]int{"CLP": 0, "jpy": 0, "brl": 2, "uyu": 2, "kwd": 3, "clf": 4, "xyz": 2} {
+		if got := CurrencyDecimals(code); got != decimals {
+			t.Fatalf("%s: expected %d decimals, got %d", code, decimals, got)
+		}
+	}
+	if got, err := NormalizeCurrencyList([]string{" BRL", "usd"}); err != nil || !slices.Equal(got, []string{"brl", "usd"}) {
+		t.Fatalf("unexpected normalized list %v (%v)", got, err)
+	}
+	if _, err := NewMoney(15, 1).In("clp"); err == nil {
+		t.Fatalf("expected 1.5 clp to be refused")
+	}
+}
+
+func TestCPITable(t *testing.T) {
+	month := func(m time.Month) time.Time { return time.Date(2024, m, 1, 0, 0, 0, 0, time.UTC) }
+	table := NewCPITable([]CPIIndex{
+		{Currency: "ars", Month: month(1), Value: MustParseMoney("100")},
+		{Currency: "ars", Month: month(3), Value: MustParseMoney("150")},
+		{Currency: "clp", Month: month(1), Value: MustParseMoney("100")},
+		{Currency: "clp", Month: month(3), Value: MustParseMoney("103")},
+	})
+	cases := []struct {
+		name      string
+		amount    string
+		currency  string
+		spent     time.Time
+		reference time.Month
+		want      string
+		adjusts   bool
+	}{
+		{"in march prices", "-200.00", "ars", month(1).Add(10 * 24 * time.Hour), time.March, "-300.00", true},
+		{"back to january prices", "-200.00", "ars", month(3), time.January, "-133.33", true},
+		{"reference month", "45.50", "ars", month(3), time.March, "45.50", true},
+		{"without decimals", "-999", "clp", month(1), time.March, "-1029", true},
+		{"month without index", "-10.00", "ars", month(2), time.March, "", false},
+		{"reference without index", "-10.00", "ars", month(1), time.February, "", false},
+		{"currency without series", "-10.00", "usd", month(1), time.March, "", false},
+	}
+	for _, c := range cases {
+		got, ok := table.Adjust(MustParseMoney(c.amount), c.currency, c.spent, month(c.reference))
+		if ok != c.adjusts || ok && got.String() != c.want {
+			t.Fatalf("%s: got %s (%v), want %s (%v)", c.name, got, ok, c.want, c.adjusts)
+		}
+	}
+	if latest, ok := table.Latest("ars"); !ok || !latest.Equal(month(3)) {
+		t.Fatalf("expected march as the latest ars index, got %v", latest)
+	}
+	if _, ok := table.Latest("usd"); ok {
+		t.Fatalf("expected no usd series")
+	}
+}
+
+func TestRecurrenceRules(t *testing.T) {
+	date := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 12, 0, 0, 0, time.UTC) }
+	holidays := NewHolidays([]Holiday{
+		{Date: date(2025, time.March, 3), Name: "Carnaval"},
+		{Date: date(2025, time.March, 4), Name: "Carnaval"},
+		{Date: date(2025, time.April, 2), Name: "Malvinas"},
+	})
+	cases := []struct {
+		name        string
+		start       time.Time
+		interval    string
+		occurrences int
+		rrule       string
+		businessDay string
+		want        []string
+	}{
+		{"monthly from the 31st keeps to the end of the month", date(2025, time.January, 31), "monthly", 4, "", "",
+			[]string{"2025-01-31", "2025-02-28", "2025-03-31", "2025-04-30"}},
+		{"yearly from february 29th", date(2024, time.February, 29), "yearly", 2, "", "",
+			[]string{"2024-02-29", "2025-02-28"}},
+		{"rrule skips months without the day", date(2025, time.January, 31), "", 0, "FREQ=MONTHLY;COUNT=3", "",
+			[]string{"2025-01-31", "2025-03-31", "2025-05-31"}},
+		{"every two weeks on tuesday and thursday", date(2025, time.January, 6), "", 0, "RRULE:FREQ=WEEKLY;INTERVAL=2;BYDAY=TU,TH;COUNT=4", "",
+			[]string{"2025-01-07", "2025-01-09", "2025-01-21", "2025-01-23"}},
+		{"last day of the month", date(2025, time.January, 15), "", 0, "FREQ=MONTHLY;BYMONTHDAY=-1;COUNT=3", "",
+			[]string{"2025-01-31", "2025-02-28", "2025-03-31"}},
+		{"last friday until a date", date(2025, time.January, 1), "", 0, "FREQ=MONTHLY;BYDAY=-1FR;UNTIL=20250425", "",
+			[]string{"2025-01-31", "2025-02-28", "2025-03-28", "2025-04-25"}},
+		{"first monday of june", date(2025, time.January, 1), "", 0, "FREQ=YEARLY;BYMONTH=6;BYDAY=1MO;COUNT=2", "",
+			[]string{"2025-06-02", "2026-06-01"}},
+		{"third business day skips holidays", date(2025, time.March, 1), "", 0, "FREQ=MONTHLY;BYDAY=MO,TU,WE,TH,FR;BYSETPOS=3;COUNT=2", BusinessDayFollowing,
+			[]string{"2025-03-07", "2025-04-04"}},
+		{"weekend moves to the following business day", date(2025, time.May, 1), "", 0, "FREQ=MONTHLY;BYMONTHDAY=10;COUNT=3", BusinessDayFollowing,
+			[]string{"2025-05-12", "2025-06-10", "2025-07-10"}},
+		{"weekend moves to the preceding business day", date(2025, time.May, 1), "", 0, "FREQ=MONTHLY;BYMONTHDAY=10;COUNT=3", BusinessDayPreceding,
+			[]string{"2025-05-09", "2025-06-10", "2025-07-10"}},
+		{"holiday moves to the following business day", date(2025, time.March, 3), "daily", 2, "", BusinessDayFollowing,
+			[]string{"2025-03-05"}},
+	}
+	for _, c := range cases {
+		re := RecurringExpense{Name: c.name, Category: "Rent", StartDate: c.start, Interval: c.interval,
+			Occurrences: c.occurrences, RRule: c.rrule, BusinessDay: c.businessDay}
+		if err := re.Validate(); err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		var got []string
+		for _, e := range re.Project(time.Time{}, date(2027, time.January, 1), holidays) {
+			got = append(got, e.Date.Format("2006-01-02"))
+		}
+		if !slices.Equal(got, c.want) {
+			t.Fatalf("%s: got %v, want %v", c.name, got, c.want)
+		}
+	}
+
+	re := RecurringExpense{Name: "Alquiler", Category: "Rent", StartDate: date(2025, time.January, 1), RRule: "freq=weekly;count=5"}
+	if err := re.Validate(); err != nil || re.RRule != "FREQ=WEEKLY;COUNT=5" || re.Interval != "weekly" || re.Occurrences != 5 {
+		t.Fatalf("expected the rrule to fill interval and occurrences, got %+v (%v)", re, err)
+	}
+	for _, rule := range []string{
+		"COUNT=3",
+		"FREQ=HOURLY",
+		"FREQ=MONTHLY;COUNT=3;UNTIL=20250101",
+		"FREQ=MONTHLY;BYHOUR=9",
+		"FREQ=WEEKLY;BYDAY=1MO",
+		"FREQ=YEARLY;BYDAY=MO",
+		"FREQ=MONTHLY;BYMONTHDAY=0",
+		"FREQ=MONTHLY;BYSETPOS=1",
+		"FREQ=MONTHLY;UNTIL=20241231",
+	} {
+		re := RecurringExpense{Name: "Alquiler", Category: "Rent", StartDate: date(2025, time.January, 1), RRule: rule}
+		if err := re.Validate(); err == nil {
+			t.Fatalf("expected rrule %s to be rejected", rule)
+		}
+	}
+	re = RecurringExpense{Name: "Alquiler", Category: "Rent", StartDate: date(2025, time.January, 1), Interval: "monthly", BusinessDay: "nearest"}
+	if err := re.Validate(); err == nil {
+		t.Fatalf("expected an unknown business day adjustment to be rejected")
+	}
+}
+
+func TestRecurringSchedules(t *testing.T) {
+	date := func(m time.Month, d int) time.Time { return time.Date(2025, m, d, 12, 0, 0, 0, time.UTC) }
+	amount := MustParseMoney("-90000")
+	moved := date(time.March, 12)
+	re := RecurringExpense{Name: "Alquiler", Category: "Rent", Amount: MustParseMoney("-80000"), Currency: "ars",
+		StartDate: date(time.January, 10), Interval: "monthly", Occurrences: 5,
+		AmountChanges: []AmountChange{{From: date(time.April, 1), Amount: MustParseMoney("-100000")}, {From: date(time.March, 1), Amount: amount}},
+		Overrides: []RecurringOverride{
+			{Occurrence: date(time.February, 10), Skip: true, Name: "ignored"},
+			{Occurrence: date(time.March, 10), Name: "Alquiler y expensas", Amount: ptr(MustParseMoney("-95000")), Date: &moved},
+		},
+	}
+	if err := re.Validate(); err != nil {
+		t.Fatalf("validate: %v", err)
+	}
+	if !re.AmountChanges[0].From.Equal(date(time.March, 1)) || re.Overrides[0].Name != "" {
+		t.Fatalf("expected sorted amount changes and a skip without edits, got %+v", re)
+	}
+	var got []string
+	for _, e := range re.Project(time.Time{}, date(time.December, 31), nil) {
+		got = append(got, e.Date.Format("01-02")+" "+e.Name+" "+e.Amount.String())
+	}
+	want := []string{
+		"01-10 Alquiler -80000.00",
+		"03-12 Alquiler y expensas -95000.00",
+		"04-10 Alquiler -100000.00",
+		"05-10 Alquiler -100000.00",
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if !re.Schedules(date(time.February, 10), nil) || re.Schedules(date(time.February, 11), nil) || re.Schedules(date(time.June, 10), nil) {
+		t.Fatalf("expected only the dates of the rule scheduled")
+	}
+
+	re.AmountChanges = append(re.AmountChanges, AmountChange{From: date(time.March, 1), Amount: amount})
+	if err := re.Validate(); err == nil {
+		t.Fatalf("expected two amount changes from the same date to be rejected")
+	}
+}
+
+func TestPostgresStoreCRUD(t *testing.T) {
+	baseConfig := postgresTestConfig(t)
 
 	store, err := InitializePostgresStore(baseConfig)
 	if err != nil {
@@ -52,8 +326,8 @@ func TestPostgresStoreCRUD(t *testing.T) {
 
 	expense := Expense{
 		Name:     "PG-Test",
-		Category: "Test",
-		Amount:   -50,
+		Category: "Food",
+		Amount:   money("-50"),
 		Currency: "usd",
 		Date:     time.Now(),
 	}
@@ -70,12 +344,88 @@ func TestPostgresStoreCRUD(t *testing.T) {
 	}
 
 	saved := all[0]
-	saved.Amount = -75
+	saved.Amount = money("-75")
 	if err := store.UpdateExpense(saved.ID, saved); err != nil {
 		t.Fatalf("update expense: %v", err)
 	}
 
-	if err := store.RemoveExpense(saved.ID); err != nil {
+	if err := store.RemoveExpense(saved.ID, 0); err != nil {
 		t.Fatalf("remove expense: %v", err)
 	}
 }
+
+func TestSQLiteStoreCRUD(t *testing.T) {
+	store, err := InitializeSQLiteStore(SystemConfig{
+		StorageURL:  t.TempDir(),
+		StorageType: BackendTypeSQLite,
+	})
+	if err != nil {
+		t.Fatalf("failed to init sqlite store: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	expense := Expense{
+		Name:     "SQLite-Test",
+		Category: "Food",
+		Amount:   money("-50"),
+		Currency: "usd",
+		Date:     time.Now(),
+	}
+	if err := store.AddExpense(expense); err != nil {
+		t.Fatalf("add expense: %v", err)
+	}
+	all, err := store.GetAllExpenses()
+	if err != nil {
+		t.Fatalf("get all: %v", err)
+	}
+	if len(all) != 1 {
+		t.Fatalf("expected 1 expense in sqlite backend, got %d", len(all))
+	}
+
+	saved := all[0]
+	saved.Amount = money("-75")
+	if err := store.UpdateExpense(saved.ID, saved); err != nil {
+		t.Fatalf("update expense: %v", err)
+	}
+	updated, err := store.GetExpense(saved.ID)
+	if err != nil {
+		t.Fatalf("get expense: %v", err)
+	}
+	if !updated.Amount.Equal(money("-75")) {
+		t.Fatalf("expected amount -75, got %v", updated.Amount)
+	}
+
+	recurring := RecurringExpense{
+		Name:        "Rent",
+		Category:    "Rent",
+		Amount:      money("-1000"),
+		Currency:    "usd",
+		StartDate:   time.Now().AddDate(0, -1, 0),
+		Interval:    "monthly",
+		Occurrences: 3,
+	}
+	if err := store.AddRecurringExpense(recurring); err != nil {
+		t.Fatalf("add recurring expense: %v", err)
+	}
+	rules, err := store.GetRecurringExpenses()
+	if err != nil || len(rules) != 1 {
+		t.Fatalf("get recurring expenses: %v (%d rules)", err, len(rules))
+	}
+	if _, err := store.GetRecurringExpense(rules[0].ID); err != nil {
+		t.Fatalf("get recurring expense: %v", err)
+	}
+	if err := store.RemoveRecurringExpense(rules[0].ID, true, 0); err != nil {
+		t.Fatalf("remove recurring expense: %v", err)
+	}
+
+	if err := store.RemoveExpense(saved.ID, 0); err != nil {
+		t.Fatalf("remove expense: %v", err)
+	}
+	all, err = store.GetAllExpenses()
+	if err != nil {
+		t.Fatalf("get all: %v", err)
+	}
+	if len(all) != 0 {
+		t.Fatalf("expected no expenses left, got %d", len(all))
+	}
+}
@@ -0,0 +1,345 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Tag is an entry of the tag catalog with its usage
+type Tag struct {
+	Name           string `json:"name"`
+	Count          int    `json:"count"`          // expenses carrying the tag
+	RecurringCount int    `json:"recurringCount"` // recurring rules carrying the tag
+}
+
+// normalizeTags drops empty and repeated tags, keeping the first occurrence order
+func normalizeTags(tags []string) []string {
+	var normalized []string
+	for _, tag := range tags {
+		if tag = strings.TrimSpace(tag); tag != "" && !slices.Contains(normalized, tag) {
+			normalized = append(normalized, tag)
+		}
+	}
+	return normalized
+}
+
+// tagLink describes a many-to-many table between tags and an owner table
+type tagLink struct {
+	table      string // link table
+	owner      string // column referencing the owner row
+	ownerTable string
+	entity     string // audit entity of the owner
+}
+
+var (
+	expenseTagLink   = tagLink{table: "expense_tags", owner: "expense_id", ownerTable: "expenses", entity: AuditExpense}
+	recurringTagLink = tagLink{table: "recurring_expense_tags", owner: "recurring_id", ownerTable: "recurring_expenses", entity: AuditRecurring}
+)
+
+// tagsMatch is the filter condition "the expense has any of the bound tags"
+func tagsMatch(placeholders []string) string {
+	return fmt.Sprintf(`EXISTS (SELECT 1 FROM expense_tags l JOIN tags t ON t.id = l.tag_id
+		WHERE l.expense_id = expenses.id AND t.name IN (%s))`, strings.Join(placeholders, ", "))
+}
+
+// expenseColumns is the select list read by scanExpense
+func (d sqlDialect) expenseColumns() string {
+	return "id, recurring_id, name, category, amount, currency, date, " + d.tagsJSON(expenseTagLink) + ", source, card, version, rate, rate_currency, exchange_id, account_id, type, to_account_id, installment_id, occurrence"
+}
+
+// recurringColumns is the select list read by scanRecurringExpense
+func (d sqlDialect) recurringColumns() string {
+	return "id, name, amount, currency, category, start_date, interval, occurrences, " + d.tagsJSON(recurringTagLink) + ", version, materialized_through, rrule, business_day, amount_changes, overrides, source, card, account_id"
+}
+
+// tagIDs caches tag ids resolved within one transaction
+type tagIDs map[string]int64
+
+// ensureTag returns the id of a tag, creating it when missing
+func (d sqlDialect) ensureTag(tx *sql.Tx, name string, cache tagIDs) (int64, error) {
+	if id, ok := cache[name]; ok {
+		return id, nil
+	}
+	if _, err := tx.Exec(fmt.Sprintf(`INSERT INTO tags (name) VALUES (%s) ON CONFLICT (name) DO NOTHING`, d.placeholder(1)), name); err != nil {
+		return 0, fmt.Errorf("failed to create tag %s: %v", name, err)
+	}
+	var id int64
+	if err := tx.QueryRow(fmt.Sprintf(`SELECT id FROM tags WHERE name = %s`, d.placeholder(1)), name).Scan(&id); err != nil {
+		return 0, fmt.Errorf("failed to resolve tag %s: %v", name, err)
+	}
+	if cache != nil {
+		cache[name] = id
+	}
+	return id, nil
+}
+
+// writeTagLinks replaces the tags linked to one owner row
+func (d sqlDialect) writeTagLinks(tx *sql.Tx, link tagLink, ownerID string, tags []string, cache tagIDs) error {
+	if _, err := tx.Exec(fmt.Sprintf(`DELETE FROM %s WHERE %s = %s`, link.table, link.owner, d.placeholder(1)), ownerID); err != nil {
+		return fmt.Errorf("failed to clear tags: %v", err)
+	}
+	insert := fmt.Sprintf(`INSERT INTO %s (%s, tag_id, position) VALUES (%s, %s, %s)`,
+		link.table, link.owner, d.placeholder(1), d.placeholder(2), d.placeholder(3))
+	for i, name := range normalizeTags(tags) {
+		id, err := d.ensureTag(tx, name, cache)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(insert, ownerID, id, i+1); err != nil {
+			return fmt.Errorf("failed to link tag %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+func (d sqlDialect) listTags(db *sql.DB) ([]Tag, error) {
+	rows, err := db.Query(`
+		SELECT t.name,
+			(SELECT COUNT(1) FROM expense_tags l JOIN expenses e ON e.id = l.expense_id WHERE l.tag_id = t.id AND e.deleted_at IS NULL),
+			(SELECT COUNT(1) FROM recurring_expense_tags l WHERE l.tag_id = t.id)
+		FROM tags t ORDER BY t.name ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tags: %v", err)
+	}
+	defer rows.Close()
+	var tags []Tag
+	for rows.Next() {
+		var tag Tag
+		if err := rows.Scan(&tag.Name, &tag.Count, &tag.RecurringCount); err != nil {
+			return nil, fmt.Errorf("failed to scan tag: %v", err)
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+func (d sqlDialect) addTag(db *sql.DB, name string) error {
+	return withTx(db, func(tx *sql.Tx) error {
+		_, err := d.ensureTag(tx, name, nil)
+		return err
+	})
+}
+
+// renameTag renames in place; every linked expense and rule follows the tag row
+func (d sqlDialect) renameTag(db *sql.DB, from, to string) error {
+	return withTx(db, func(tx *sql.Tx) error {
+		var exists int
+		err := tx.QueryRow(fmt.Sprintf(`SELECT COUNT(1) FROM tags WHERE name = %s`, d.placeholder(1)), to).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("failed to check tag %s: %v", to, err)
+		}
+		if exists > 0 && from != to {
+			return fmt.Errorf("tag %s already exists", to)
+		}
+		changes, err := d.tagOwnerChanges(tx, []string{from}, fmt.Sprintf("tag %s renamed to %s", from, to))
+		if err != nil {
+			return err
+		}
+		if err := d.bumpTagOwners(tx, from); err != nil {
+			return err
+		}
+		res, err := tx.Exec(fmt.Sprintf(`UPDATE tags SET name = %s WHERE name = %s`, d.placeholder(1), d.placeholder(2)), to, from)
+		if err != nil {
+			return fmt.Errorf("failed to rename tag: %v", err)
+		}
+		if rowsAffected, _ := res.RowsAffected(); rowsAffected == 0 {
+			return fmt.Errorf("tag %s not found", from)
+		}
+		return d.recordOwnerChanges(tx, changes)
+	})
+}
+
+// mergeTags moves every link of the sources onto target (created if needed)
+// and deletes the sources; an owner carrying both keeps a single link
+func (d sqlDialect) mergeTags(db *sql.DB, sources []string, target string) error {
+	return withTx(db, func(tx *sql.Tx) error {
+		targetID, err := d.ensureTag(tx, target, nil)
+		if err != nil {
+			return err
+		}
+		changes, err := d.tagOwnerChanges(tx, sources, mergeDetail(sources, target))
+		if err != nil {
+			return err
+		}
+		for _, source := range sources {
+			if source == target {
+				continue
+			}
+			var sourceID int64
+			err := tx.QueryRow(fmt.Sprintf(`SELECT id FROM tags WHERE name = %s`, d.placeholder(1)), source).Scan(&sourceID)
+			if err == sql.ErrNoRows {
+				return fmt.Errorf("tag %s not found", source)
+			} else if err != nil {
+				return fmt.Errorf("failed to resolve tag %s: %v", source, err)
+			}
+			if err := d.bumpTagOwners(tx, source); err != nil {
+				return err
+			}
+			for _, link := range []tagLink{expenseTagLink, recurringTagLink} {
+				move := fmt.Sprintf(`INSERT INTO %[1]s (%[2]s, tag_id, position)
+					SELECT %[2]s, CAST(%[3]s AS INTEGER), position FROM %[1]s WHERE tag_id = %[4]s
+					ON CONFLICT (%[2]s, tag_id) DO NOTHING`, link.table, link.owner, d.placeholder(1), d.placeholder(2))
+				if _, err := tx.Exec(move, targetID, sourceID); err != nil {
+					return fmt.Errorf("failed to merge tag %s: %v", source, err)
+				}
+			}
+			// links of the source go with it through ON DELETE CASCADE
+			if _, err := tx.Exec(fmt.Sprintf(`DELETE FROM tags WHERE id = %s`, d.placeholder(1)), sourceID); err != nil {
+				return fmt.Errorf("failed to delete merged tag %s: %v", source, err)
+			}
+		}
+		return d.recordOwnerChanges(tx, changes)
+	})
+}
+
+// deleteTag removes a tag from the catalog and from every expense and rule
+func (d sqlDialect) deleteTag(db *sql.DB, name string) error {
+	return withTx(db, func(tx *sql.Tx) error {
+		changes, err := d.tagOwnerChanges(tx, []string{name}, fmt.Sprintf("tag %s deleted", name))
+		if err != nil {
+			return err
+		}
+		if err := d.bumpTagOwners(tx, name); err != nil {
+			return err
+		}
+		res, err := tx.Exec(fmt.Sprintf(`DELETE FROM tags WHERE name = %s`, d.placeholder(1)), name)
+		if err != nil {
+			return fmt.Errorf("failed to delete tag: %v", err)
+		}
+		if rowsAffected, _ := res.RowsAffected(); rowsAffected == 0 {
+			return fmt.Errorf("tag %s not found", name)
+		}
+		return d.recordOwnerChanges(tx, changes)
+	})
+}
+
+// mergeDetail describes a merge of tags for the audit log
+func mergeDetail(sources []string, target string) string {
+	return fmt.Sprintf("tags %s merged into %s", strings.Join(sources, ", "), target)
+}
+
+// tagOwnerChanges starts an update entry for every expense and rule carrying
+// one of tags, read before a change of the tags cascades to them
+func (d sqlDialect) tagOwnerChanges(tx *sql.Tx, tags []string, detail string) ([]auditChange, error) {
+	placeholders := make([]string, len(tags))
+	args := make([]any, len(tags))
+	for i, tag := range tags {
+		placeholders[i] = d.placeholder(i + 1)
+		args[i] = tag
+	}
+	var changes []auditChange
+	for _, link := range []tagLink{expenseTagLink, recurringTagLink} {
+		query := fmt.Sprintf(`SELECT DISTINCT l.%s FROM %s l JOIN tags t ON t.id = l.tag_id WHERE t.name IN (%s) ORDER BY l.%s`,
+			link.owner, link.table, strings.Join(placeholders, ", "), link.owner)
+		rows, err := tx.Query(query, args...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s tagged %s: %v", link.ownerTable, strings.Join(tags, ", "), err)
+		}
+		var ids []string
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			before, err := d.loadOwner(tx, link.entity, id)
+			if err != nil {
+				return nil, err
+			}
+			changes = append(changes, auditChange{entity: link.entity, id: id, action: AuditUpdate, detail: detail, before: before})
+		}
+	}
+	return changes, nil
+}
+
+// withTx runs fn in a transaction that commits only when fn succeeds
+func withTx(db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// moveTagsToLinks fills the link tables from the legacy JSON tags columns
+func moveTagsToLinks(tx *sql.Tx, d sqlDialect) error {
+	cache := tagIDs{}
+	for _, link := range []tagLink{expenseTagLink, recurringTagLink} {
+		rows, err := tx.Query(fmt.Sprintf(`SELECT id, tags FROM %s WHERE tags IS NOT NULL AND tags <> ''`, link.ownerTable))
+		if err != nil {
+			return err
+		}
+		owners := map[string][]string{}
+		for rows.Next() {
+			var id, tagsStr string
+			if err := rows.Scan(&id, &tagsStr); err != nil {
+				rows.Close()
+				return err
+			}
+			var tags []string
+			// rows with unreadable tags simply end up untagged
+			if json.Unmarshal([]byte(tagsStr), &tags) == nil && len(tags) > 0 {
+				owners[id] = tags
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		for id, tags := range owners {
+			if err := d.writeTagLinks(tx, link, id, tags, cache); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// restoreTagColumns writes the link tables back into the legacy JSON columns
+func restoreTagColumns(tx *sql.Tx, d sqlDialect) error {
+	for _, link := range []tagLink{expenseTagLink, recurringTagLink} {
+		rows, err := tx.Query(fmt.Sprintf(`SELECT l.%s, t.name FROM %s l JOIN tags t ON t.id = l.tag_id ORDER BY l.%s, l.position`,
+			link.owner, link.table, link.owner))
+		if err != nil {
+			return err
+		}
+		owners := map[string][]string{}
+		for rows.Next() {
+			var id, name string
+			if err := rows.Scan(&id, &name); err != nil {
+				rows.Close()
+				return err
+			}
+			owners[id] = append(owners[id], name)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		update := fmt.Sprintf(`UPDATE %s SET tags = %s WHERE id = %s`, link.ownerTable, d.placeholder(1), d.placeholder(2))
+		for id, tags := range owners {
+			tagsJSON, err := json.Marshal(tags)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.Exec(update, string(tagsJSON), id); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
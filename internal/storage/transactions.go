@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	TransactionTypeExpense  = "expense"
+	TransactionTypeIncome   = "income"
+	TransactionTypeTransfer = "transfer"
+)
+
+// typeOfAmount is the type of an expense written without one: money going
+// out is an expense, money coming in an income
+func typeOfAmount(amount Money) string {
+	if amount.Sign() > 0 {
+		return TransactionTypeIncome
+	}
+	return TransactionTypeExpense
+}
+
+// normalizeType defaults the type from the sign of the amount and checks the
+// two agree. A transfer has no category and stores the money leaving
+// AccountID, so its amount is always negative whatever sign it came with.
+func (e *Expense) normalizeType() error {
+	e.Type = strings.ToLower(strings.TrimSpace(e.Type))
+	if e.Type == "" {
+		e.Type = typeOfAmount(e.Amount)
+	}
+	switch e.Type {
+	case TransactionTypeExpense:
+		if e.Amount.Sign() > 0 {
+			return fmt.Errorf("expense 'amount' must be negative for an expense")
+		}
+	case TransactionTypeIncome:
+		if e.Amount.Sign() < 0 {
+			return fmt.Errorf("expense 'amount' must be positive for an income")
+		}
+	case TransactionTypeTransfer:
+		if e.AccountID == "" || e.ToAccountID == "" {
+			return fmt.Errorf("a transfer needs both 'accountId' and 'toAccountId'")
+		}
+		if e.AccountID == e.ToAccountID {
+			return fmt.Errorf("a transfer needs two different accounts")
+		}
+		if e.Amount.Sign() > 0 {
+			e.Amount = e.Amount.Neg()
+		}
+		e.Category = ""
+		return nil
+	default:
+		return fmt.Errorf("invalid expense type: '%s'. Must be one of 'expense', 'income' or 'transfer'", e.Type)
+	}
+	e.ToAccountID = ""
+	if e.Category == "" {
+		return fmt.Errorf("expense 'category' cannot be empty")
+	}
+	return nil
+}
+
+// attachDestination checks the destination account of a transfer; current
+// is the destination the transfer had before the change, which may stay even
+// once archived
+func attachDestination(e *Expense, to Account, current string) error {
+	if to.Currency != e.Currency {
+		return invalid(fmt.Errorf("account %s holds %s, not %s; use a currency exchange instead", to.Name, to.Currency, e.Currency))
+	}
+	if to.Archived && to.ID != current {
+		return invalid(fmt.Errorf("account %s is archived", to.Name))
+	}
+	return nil
+}
+
+// AccountAmount is what an expense moves in or out of an account: the amount
+// itself on its account, the opposite on the destination of a transfer
+func (e Expense) AccountAmount(id string) Money {
+	if e.ToAccountID == id {
+		return e.Amount.Neg()
+	}
+	return e.Amount
+}
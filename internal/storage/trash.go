@@ -0,0 +1,170 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TrashedExpense is a soft-deleted expense waiting in the trash
+type TrashedExpense struct {
+	Expense
+	DeletedAt time.Time `json:"deletedAt"`
+}
+
+// trailingScan reads extra columns selected after the ones a scan function knows about
+type trailingScan struct {
+	scanner interface{ Scan(...any) error }
+	extra   []any
+}
+
+func (s trailingScan) Scan(dest ...any) error {
+	return s.scanner.Scan(append(dest, s.extra...)...)
+}
+
+// idList renders "id IN (...)" for the given ids, numbering placeholders after offset
+func (d sqlDialect) idList(ids []string, offset int) (string, []any) {
+	placeholders := make([]string, len(ids))
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		placeholders[i] = d.placeholder(offset + i + 1)
+		args[i] = id
+	}
+	return fmt.Sprintf("id IN (%s)", strings.Join(placeholders, ", ")), args
+}
+
+// trashExpenses soft-deletes the live expenses among ids and returns how many
+// moved; a version other than 0 must match each of them
+func (d sqlDialect) trashExpenses(db *sql.DB, ids []string, version int64) (int, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	moved := 0
+	err := withTx(db, func(tx *sql.Tx) error {
+		expenses, err := d.loadExpenses(tx, ids)
+		if err != nil {
+			return err
+		}
+		for _, expense := range expenses {
+			if err := generatedExpenseError(expense); err != nil {
+				return err
+			}
+			if err := d.ruleOccurrence(tx, expense); err != nil {
+				return err
+			}
+		}
+		now := time.Now().UTC()
+		match, matchArgs := d.versionMatch(version, 3)
+		update := fmt.Sprintf(`UPDATE expenses SET deleted_at = %s WHERE id = %s AND deleted_at IS NULL`, d.placeholder(1), d.placeholder(2)) + match
+		var changes []auditChange
+		for _, expense := range expenses {
+			res, err := tx.Exec(update, append([]any{now, expense.ID}, matchArgs...)...)
+			if err != nil {
+				return fmt.Errorf("failed to move expenses to trash: %v", err)
+			}
+			if rowsAffected, _ := res.RowsAffected(); rowsAffected > 0 {
+				changes = append(changes, auditChange{entity: AuditExpense, id: expense.ID, action: AuditDelete, before: expense})
+			} else if version != 0 {
+				return d.rowConflict(tx, "expenses", AuditExpense, expense.ID, fmt.Errorf("expense with ID %s not found", expense.ID))
+			}
+		}
+		moved = len(changes)
+		return d.recordAudit(tx, changes...)
+	})
+	return moved, err
+}
+
+// listTrash returns the trashed expenses, most recently deleted first
+func (d sqlDialect) listTrash(db *sql.DB) ([]TrashedExpense, error) {
+	rows, err := db.Query(`SELECT ` + d.expenseColumns() + `, deleted_at FROM expenses
+		WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC, id DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query trash: %v", err)
+	}
+	defer rows.Close()
+	var trash []TrashedExpense
+	for rows.Next() {
+		var deletedAt time.Time
+		expense, err := scanExpense(trailingScan{scanner: rows, extra: []any{&deletedAt}})
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan trashed expense: %v", err)
+		}
+		trash = append(trash, TrashedExpense{Expense: expense, DeletedAt: deletedAt})
+	}
+	return trash, rows.Err()
+}
+
+// inTrash applies stmt to the trashed expenses among ids and records action
+// for each, failing without changes unless every id is in the trash
+func (d sqlDialect) inTrash(db *sql.DB, ids []string, stmt, action string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return withTx(db, func(tx *sql.Tx) error {
+		return d.inTrashTx(tx, ids, stmt, action)
+	})
+}
+
+func (d sqlDialect) inTrashTx(tx *sql.Tx, ids []string, stmt, action string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	expenses, err := d.loadExpenses(tx, ids)
+	if err != nil {
+		return err
+	}
+	in, args := d.idList(ids, 0)
+	res, err := tx.Exec(fmt.Sprintf(stmt, in), args...)
+	if err != nil {
+		return fmt.Errorf("failed to %s expenses: %v", action, err)
+	}
+	if rowsAffected, _ := res.RowsAffected(); rowsAffected != int64(len(ids)) {
+		return fmt.Errorf("%d of %d expenses not found in trash", int64(len(ids))-rowsAffected, len(ids))
+	}
+	changes := make([]auditChange, len(expenses))
+	for i, expense := range expenses {
+		// a restore brings the expense back into the listings, a purge removes it for good
+		changes[i] = auditChange{entity: AuditExpense, id: expense.ID, action: action, before: expense}
+		if action == AuditRestore {
+			changes[i].before, changes[i].after = nil, expense
+		}
+	}
+	return d.recordAudit(tx, changes...)
+}
+
+func (d sqlDialect) restoreExpenses(db *sql.DB, ids []string) error {
+	return d.inTrash(db, ids, `UPDATE expenses SET deleted_at = NULL WHERE deleted_at IS NOT NULL AND %s`, AuditRestore)
+}
+
+// purgeExpenses deletes trashed expenses for good; their tag links follow through ON DELETE CASCADE
+func (d sqlDialect) purgeExpenses(db *sql.DB, ids []string) error {
+	return d.inTrash(db, ids, `DELETE FROM expenses WHERE deleted_at IS NOT NULL AND %s`, AuditPurge)
+}
+
+// purgeTrash deletes every expense trashed before the cutoff
+func (d sqlDialect) purgeTrash(db *sql.DB, before time.Time) (int, error) {
+	purged := 0
+	err := withTx(db, func(tx *sql.Tx) error {
+		rows, err := tx.Query(fmt.Sprintf(`SELECT id FROM expenses WHERE deleted_at IS NOT NULL AND deleted_at < %s`, d.placeholder(1)), before.UTC())
+		if err != nil {
+			return fmt.Errorf("failed to query expired trash: %v", err)
+		}
+		var ids []string
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan expired trash: %v", err)
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to read expired trash: %v", err)
+		}
+		purged = len(ids)
+		return d.inTrashTx(tx, ids, `DELETE FROM expenses WHERE deleted_at IS NOT NULL AND %s`, AuditPurge)
+	})
+	return purged, err
+}
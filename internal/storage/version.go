@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// ConflictError is returned by a write based on a version that is no longer
+// the stored one; Current is the version the caller should re-read
+type ConflictError struct {
+	Entity  string // AuditExpense, AuditRecurring or AuditCategory for the whole list
+	ID      string
+	Current int64
+}
+
+func (e *ConflictError) Error() string {
+	if e.ID == "" {
+		return fmt.Sprintf("%s list changed concurrently, now at version %d", e.Entity, e.Current)
+	}
+	return fmt.Sprintf("%s %s changed concurrently, now at version %d", e.Entity, e.ID, e.Current)
+}
+
+// categoriesVersion names the counter of the category list in the versions table
+const categoriesVersion = "categories"
+
+// bumpVersion increments a named counter and fails with a conflict unless it
+// was at expected; 0 skips the check. The upsert locks the counter row, so
+// concurrent writers are serialized on it.
+func (d sqlDialect) bumpVersion(tx *sql.Tx, name string, expected int64) (int64, error) {
+	var next int64
+	err := tx.QueryRow(fmt.Sprintf(`INSERT INTO versions (name, version) VALUES (%s, 2)
+		ON CONFLICT (name) DO UPDATE SET version = versions.version + 1 RETURNING version`, d.placeholder(1)), name).Scan(&next)
+	if err != nil {
+		return 0, fmt.Errorf("failed to bump %s version: %v", name, err)
+	}
+	if expected != 0 && next-1 != expected {
+		return 0, &ConflictError{Entity: AuditCategory, Current: next - 1}
+	}
+	return next, nil
+}
+
+// readVersion returns a named counter; a counter never bumped is at 1
+func (d sqlDialect) readVersion(db *sql.DB, name string) (int64, error) {
+	var version int64
+	err := db.QueryRow(fmt.Sprintf(`SELECT version FROM versions WHERE name = %s`, d.placeholder(1)), name).Scan(&version)
+	if err == sql.ErrNoRows {
+		return 1, nil
+	} else if err != nil {
+		return 0, fmt.Errorf("failed to read %s version: %v", name, err)
+	}
+	return version, nil
+}
+
+// rowConflict explains an update of a versioned row that matched nothing:
+// a conflict when the row exists at another version, not found otherwise
+func (d sqlDialect) rowConflict(tx *sql.Tx, table, entity, id string, notFound error) error {
+	query := fmt.Sprintf(`SELECT version FROM %s WHERE id = %s`, table, d.placeholder(1))
+	if table == "expenses" {
+		query += " AND deleted_at IS NULL"
+	}
+	var current int64
+	err := tx.QueryRow(query, id).Scan(&current)
+	if err == sql.ErrNoRows {
+		return notFound
+	} else if err != nil {
+		return fmt.Errorf("failed to read version of %s %s: %v", entity, id, err)
+	}
+	return &ConflictError{Entity: entity, ID: id, Current: current}
+}
+
+// versionMatch is the update condition for an expected version, empty when unchecked
+func (d sqlDialect) versionMatch(expected int64, n int) (string, []any) {
+	if expected == 0 {
+		return "", nil
+	}
+	return " AND version = " + d.placeholder(n), []any{expected}
+}
+
+// bumpTagOwners moves every expense and rule carrying the tag to a new version
+func (d sqlDialect) bumpTagOwners(tx *sql.Tx, tag string) error {
+	for _, link := range []tagLink{expenseTagLink, recurringTagLink} {
+		bump := fmt.Sprintf(`UPDATE %s SET version = version + 1 WHERE id IN (
+			SELECT l.%s FROM %s l JOIN tags t ON t.id = l.tag_id WHERE t.name = %s)`,
+			link.ownerTable, link.owner, link.table, d.placeholder(1))
+		if _, err := tx.Exec(bump, tag); err != nil {
+			return fmt.Errorf("failed to bump versions of %s tagged %s: %v", link.ownerTable, tag, err)
+		}
+	}
+	return nil
+}
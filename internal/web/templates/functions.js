@@ -9,8 +9,39 @@ const currencyBehaviors = {
     eur: {symbol: "EUR", useComma: true, useDecimals: true, useSpace: false, right: false},
 };
 
+// symbol and minor units of every ISO 4217 currency, filled by loadCurrencies
+let currencyCatalog = {};
+
+// currencyBehavior keeps the formats above and falls back to the catalog for
+// any other enabled currency
+function currencyBehavior(code) {
+    if (currencyBehaviors[code]) return currencyBehaviors[code];
+    const info = currencyCatalog[code];
+    if (!info) return null;
+    return {symbol: info.symbol, useComma: false, useDecimals: info.decimals > 0, decimals: info.decimals, useSpace: true, right: false};
+}
+
+function currencyFractionDigits(behavior) {
+    if (behavior.decimals !== undefined) return behavior.decimals;
+    return behavior.useDecimals ? 2 : 0;
+}
+
+// loadCurrencies fills the catalog and returns the enabled codes in order
+async function loadCurrencies() {
+    const response = await fetch('/currencies');
+    if (!response.ok) throw new Error('No se pudieron obtener las monedas');
+    const data = await response.json();
+    currencyCatalog = Object.fromEntries(data.catalog.map(currency => [currency.code, currency]));
+    return data.enabled;
+}
+
+function currencyLabel(code) {
+    const info = currencyCatalog[code];
+    return info ? `${code.toUpperCase()} (${info.symbol})` : code.toUpperCase();
+}
+
 function formatCurrency(amount) {
-    const behavior = currencyBehaviors[currentCurrency] || {
+    const behavior = currencyBehavior(currentCurrency) || {
         symbol: "$",
         useComma: false,
         useDecimals: true,
@@ -20,8 +51,8 @@ function formatCurrency(amount) {
     const isNegative = amount < 0;
     const absAmount = Math.abs(amount);
     const options = {
-        minimumFractionDigits: behavior.useDecimals ? 2 : 0,
-        maximumFractionDigits: behavior.useDecimals ? 2 : 0,
+        minimumFractionDigits: currencyFractionDigits(behavior),
+        maximumFractionDigits: currencyFractionDigits(behavior),
     };
     let formattedAmount = new Intl.NumberFormat(behavior.useComma ? "de-DE" : "en-US",options).format(absAmount);
     let result = behavior.right
@@ -107,6 +138,87 @@ function getMonthBounds(date) {
     }
 }
 
+// tag suggestions come from the tag catalog rather than the expenses loaded on the page
+async function fetchTagNames() {
+    const response = await fetch('/tags');
+    if (!response.ok) throw new Error('No se pudieron obtener las etiquetas');
+    const tags = await response.json();
+    return (tags || []).map(tag => tag.name);
+}
+
+// lists parents before their subcategories, keeping the stored order among
+// siblings, and tags each entry with its depth
+function categoryTree(categories) {
+    const tree = [];
+    const visit = (parent, depth) => categories
+        .filter(cat => (cat.parent || '') === parent)
+        .forEach(cat => {
+            tree.push({ ...cat, depth });
+            visit(cat.name, depth + 1);
+        });
+    visit('', 0);
+    return tree;
+}
+
+// archived categories stay out of the pickers, except when an expense already uses one
+function categoryOptions(categories, selected) {
+    return categoryTree(categories)
+        .filter(cat => !cat.archived || cat.name === selected)
+        .map(cat => `<option value="${escapeHTML(cat.name)}" ${cat.name === selected ? 'selected' : ''}>${'\u00a0'.repeat(cat.depth * 3)}${escapeHTML(cat.name)}</option>`)
+        .join('');
+}
+
+async function fetchAccounts() {
+    const response = await fetch('/accounts');
+    if (!response.ok) throw new Error('No se pudieron obtener las cuentas');
+    return (await response.json()) || [];
+}
+
+const accountTypeLabels = { bank: 'Cuenta bancaria', cash: 'Efectivo', credit_card: 'Tarjeta de credito' };
+
+// accounts of one currency for an expense form; archived ones only when
+// already selected, and "Sin cuenta" first
+function accountOptions(accounts, currency, selected) {
+    return `<option value="">Sin cuenta</option>` + accounts
+        .filter(acc => acc.currency === currency && (!acc.archived || acc.id === selected))
+        .map(acc => `<option value="${escapeHTML(acc.id)}" ${acc.id === selected ? 'selected' : ''}>${escapeHTML(acc.name)} (${accountTypeLabels[acc.type] || acc.type})</option>`)
+        .join('');
+}
+
+function accountName(accounts, id) {
+    const account = accounts.find(acc => acc.id === id);
+    return account ? account.name : '';
+}
+
+const transactionTypeLabels = { expense: 'Gasto', income: 'Ingreso', transfer: 'Transferencia' };
+
+// transfers, currency exchange legs included, are neither spending nor income
+function isTransfer(exp) {
+    return exp.type === 'transfer' || !!exp.exchangeId;
+}
+
+// shows the fields of a transaction type in an expense form: a transfer
+// picks a destination account instead of a category
+function applyTransactionType(type) {
+    const transfer = type === 'transfer';
+    const category = document.getElementById('category');
+    category.required = !transfer;
+    category.closest('.form-group').style.display = transfer ? 'none' : '';
+    document.getElementById('toAccountSelect').closest('.form-group').style.display = transfer ? '' : 'none';
+}
+
+// the amount as stored: only incomes are positive
+function signedAmount(type, amount) {
+    return type === 'income' ? Math.abs(amount) : -Math.abs(amount);
+}
+
+// asks the server only for the period being displayed instead of the whole history
+function monthExpensesURL(date) {
+    const { start, end } = getMonthBounds(date);
+    const params = new URLSearchParams({ from: start.toISOString(), to: end.toISOString() });
+    return `/expenses?${params}`;
+}
+
 function getMonthExpenses(expenses) {
     const { start, end } = getMonthBounds(currentDate);
     return expenses.filter(exp => {